@@ -0,0 +1,63 @@
+package gnsssync
+
+import (
+	"bufio"
+	"os"
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// ReadArtistsFile reads artist names from a file having one per line. Blank
+// lines and lines starting with "#" are ignored.
+func ReadArtistsFile(filepath string) (artistNames []string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.Open(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	artistNames = make([]string, 0)
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") == true {
+			continue
+		}
+
+		artistNames = append(artistNames, line)
+	}
+
+	err = s.Err()
+	log.PanicIf(err)
+
+	return artistNames, nil
+}
+
+// MergeArtistNames combines the given lists of artist names, lower-casing
+// them and dropping duplicates. The first occurrence of each keeps its place.
+func MergeArtistNames(lists ...[]string) (merged []string) {
+	merged = make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, artistNames := range lists {
+		for _, artistName := range artistNames {
+			artistName = strings.ToLower(artistName)
+
+			if _, found := seen[artistName]; found == true {
+				continue
+			}
+
+			seen[artistName] = true
+			merged = append(merged, artistName)
+		}
+	}
+
+	return merged
+}
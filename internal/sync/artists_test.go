@@ -0,0 +1,47 @@
+package gnsssync
+
+import (
+	"reflect"
+	"testing"
+
+	"io/ioutil"
+	"path"
+)
+
+func TestReadArtistsFile(t *testing.T) {
+	artistsFilepath := path.Join(t.TempDir(), "artists.txt")
+
+	data := "# Favorites\nThe Band\n\n  Other Artist  \n#Not This One\nthe band\n"
+
+	err := ioutil.WriteFile(artistsFilepath, []byte(data), 0644)
+	if err != nil {
+		t.Fatalf("Could not write artists file: %s", err)
+	}
+
+	artistNames, err := ReadArtistsFile(artistsFilepath)
+	if err != nil {
+		t.Fatalf("Could not read artists file: %s", err)
+	}
+
+	expected := []string{"The Band", "Other Artist", "the band"}
+	if reflect.DeepEqual(artistNames, expected) != true {
+		t.Fatalf("Artists not read correctly: %v", artistNames)
+	}
+
+	// The file and the flags combine without duplicates, with the flags
+	// first.
+
+	merged := MergeArtistNames([]string{"Third Artist", "OTHER ARTIST"}, artistNames)
+
+	expected = []string{"third artist", "other artist", "the band"}
+	if reflect.DeepEqual(merged, expected) != true {
+		t.Fatalf("Artists not merged correctly: %v", merged)
+	}
+}
+
+func TestReadArtistsFile_Missing(t *testing.T) {
+	_, err := ReadArtistsFile(path.Join(t.TempDir(), "missing.txt"))
+	if err == nil {
+		t.Fatalf("Expected an error for a missing file.")
+	}
+}
@@ -0,0 +1,118 @@
+package gnsssync
+
+import (
+	"sync"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// Config
+const (
+	// adaptiveConcurrencyDecreaseInterval is the least time between halvings
+	// so that a burst of rate-limited calls from the workers that are already
+	// running only counts once.
+	adaptiveConcurrencyDecreaseInterval = time.Second * 10
+
+	// adaptiveConcurrencyIncreaseInterval is how long it has to be since we
+	// were last rate-limited (and since the last change) before we allow one
+	// more worker.
+	adaptiveConcurrencyIncreaseInterval = time.Second * 30
+)
+
+// Misc
+var (
+	acLog = log.NewLogger("gnss.concurrency")
+)
+
+// adaptiveConcurrency limits how many workers can run at once, halving the
+// limit while Spotify is rate-limiting us and slowly raising it back up to the
+// maximum once it stops.
+type adaptiveConcurrency struct {
+	m    sync.Mutex
+	cond *sync.Cond
+
+	maximum int
+	limit   int
+	active  int
+
+	lastChangeAt      time.Time
+	lastRateLimitedAt time.Time
+
+	now func() time.Time
+}
+
+func newAdaptiveConcurrency(maximum int) *adaptiveConcurrency {
+	if maximum < 1 {
+		maximum = 1
+	}
+
+	ac := &adaptiveConcurrency{
+		maximum: maximum,
+		limit:   maximum,
+		now:     time.Now,
+	}
+
+	ac.cond = sync.NewCond(&ac.m)
+
+	return ac
+}
+
+// acquire blocks until the worker is allowed to run.
+func (ac *adaptiveConcurrency) acquire() {
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	for ac.active >= ac.limit {
+		ac.cond.Wait()
+	}
+
+	ac.active++
+}
+
+// release lets another worker run.
+func (ac *adaptiveConcurrency) release() {
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	ac.active--
+	ac.cond.Broadcast()
+}
+
+// currentLimit returns how many workers are currently allowed to run at once.
+func (ac *adaptiveConcurrency) currentLimit() int {
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	return ac.limit
+}
+
+// observe adjusts the limit given the outcome of one call.
+func (ac *adaptiveConcurrency) observe(rateLimited bool) {
+	ac.m.Lock()
+	defer ac.m.Unlock()
+
+	now := ac.now()
+
+	if rateLimited == true {
+		ac.lastRateLimitedAt = now
+
+		if ac.limit > 1 && now.Sub(ac.lastChangeAt) >= adaptiveConcurrencyDecreaseInterval {
+			ac.limit /= 2
+			ac.lastChangeAt = now
+
+			acLog.Warningf(nil, "Rate-limited. Reducing concurrency to (%d).", ac.limit)
+		}
+
+		return
+	}
+
+	if ac.limit < ac.maximum && now.Sub(ac.lastRateLimitedAt) >= adaptiveConcurrencyIncreaseInterval && now.Sub(ac.lastChangeAt) >= adaptiveConcurrencyIncreaseInterval {
+		ac.limit++
+		ac.lastChangeAt = now
+
+		acLog.Infof(nil, "No longer rate-limited. Raising concurrency to (%d).", ac.limit)
+
+		ac.cond.Broadcast()
+	}
+}
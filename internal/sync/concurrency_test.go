@@ -0,0 +1,106 @@
+package gnsssync
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestAdaptiveConcurrency returns a controller whose clock only moves when
+// the returned function is called.
+func newTestAdaptiveConcurrency(maximum int) (ac *adaptiveConcurrency, advance func(d time.Duration)) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	ac = newAdaptiveConcurrency(maximum)
+	ac.now = func() time.Time {
+		return now
+	}
+
+	advance = func(d time.Duration) {
+		now = now.Add(d)
+	}
+
+	return ac, advance
+}
+
+func TestAdaptiveConcurrency_SustainedRateLimiting(t *testing.T) {
+	ac, advance := newTestAdaptiveConcurrency(8)
+
+	// A burst from the workers that are already running only halves it once.
+
+	for j := 0; j < 5; j++ {
+		ac.observe(true)
+	}
+
+	if limit := ac.currentLimit(); limit != 4 {
+		t.Fatalf("Limit not halved: (%d)", limit)
+	}
+
+	// It keeps halving while the rate-limiting goes on, but never drops below
+	// one.
+
+	expected := []int{2, 1, 1}
+	for _, expectedLimit := range expected {
+		advance(adaptiveConcurrencyDecreaseInterval)
+		ac.observe(true)
+
+		if limit := ac.currentLimit(); limit != expectedLimit {
+			t.Fatalf("Limit not correct under sustained rate-limiting: (%d) != (%d)", limit, expectedLimit)
+		}
+	}
+
+	// It only comes back up, one at a time, once it's been clear for long
+	// enough.
+
+	advance(adaptiveConcurrencyIncreaseInterval - time.Second)
+	ac.observe(false)
+
+	if limit := ac.currentLimit(); limit != 1 {
+		t.Fatalf("Limit raised too soon: (%d)", limit)
+	}
+
+	advance(time.Second)
+	ac.observe(false)
+	ac.observe(false)
+
+	if limit := ac.currentLimit(); limit != 2 {
+		t.Fatalf("Limit not raised by one: (%d)", limit)
+	}
+
+	for j := 0; j < 10; j++ {
+		advance(adaptiveConcurrencyIncreaseInterval)
+		ac.observe(false)
+	}
+
+	if limit := ac.currentLimit(); limit != 8 {
+		t.Fatalf("Limit should stop at the maximum: (%d)", limit)
+	}
+}
+
+func TestAdaptiveConcurrency_Acquire(t *testing.T) {
+	ac, _ := newTestAdaptiveConcurrency(2)
+	ac.observe(true)
+
+	ac.acquire()
+
+	acquired := make(chan bool)
+	go func() {
+		ac.acquire()
+		acquired <- true
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatalf("Second worker should wait while the limit is one.")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	ac.release()
+
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatalf("Second worker should run once the first is done.")
+	}
+
+	ac.release()
+}
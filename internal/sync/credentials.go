@@ -0,0 +1,103 @@
+package gnsssync
+
+import (
+	"fmt"
+
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Config
+const (
+	// napsterCheckUrl is a cheap, unauthenticated Napster endpoint that only
+	// requires a valid API key.
+	napsterCheckUrl = "https://api.napster.com/v2.2/genres"
+)
+
+// Errors
+var (
+	ErrSpotifyCredentialsInvalid = fmt.Errorf("spotify client-ID or secret key is invalid")
+	ErrNapsterApiKeyInvalid      = fmt.Errorf("napster API key is invalid")
+)
+
+// Misc
+var (
+	cLog = log.NewLogger("gnss.credentials")
+)
+
+// CheckSpotifyCredentials verifies the Spotify client-ID and secret key by
+// requesting a client-credentials token. This doesn't require the user to
+// authorize anything, so it can be done before the interactive flow.
+func CheckSpotifyCredentials(ctx context.Context, hc *http.Client, clientId, secretKey string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cc := &clientcredentials.Config{
+		ClientID:     clientId,
+		ClientSecret: secretKey,
+		TokenURL:     spotify.TokenURL,
+	}
+
+	if hc != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, hc)
+	}
+
+	if _, err := cc.Token(ctx); err != nil {
+		if _, ok := err.(*oauth2.RetrieveError); ok == true {
+			cLog.Warningf(ctx, "Spotify rejected the client credentials: %s", err)
+			log.Panic(ErrSpotifyCredentialsInvalid)
+		}
+
+		log.Panic(err)
+	}
+
+	cLog.Debugf(ctx, "Spotify client credentials are valid.")
+
+	return nil
+}
+
+// CheckNapsterApiKey verifies the Napster API key against an endpoint that
+// only requires the key.
+func CheckNapsterApiKey(ctx context.Context, hc *http.Client, apiKey string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if hc == nil {
+		hc = new(http.Client)
+	}
+
+	u, err := url.Parse(napsterCheckUrl)
+	log.PanicIf(err)
+
+	q := u.Query()
+	q.Set("apikey", apiKey)
+	u.RawQuery = q.Encode()
+
+	response, err := hc.Get(u.String())
+	log.PanicIf(err)
+
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden {
+		log.Panic(ErrNapsterApiKeyInvalid)
+	} else if response.StatusCode != http.StatusOK {
+		log.Panic(fmt.Errorf("napster API-key check failed with status (%d)", response.StatusCode))
+	}
+
+	cLog.Debugf(ctx, "Napster API key is valid.")
+
+	return nil
+}
@@ -0,0 +1,112 @@
+package gnsssync
+
+import (
+	"fmt"
+	"testing"
+
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"golang.org/x/net/context"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// redirectTransport sends every request to the test server rather than to
+// wherever it was addressed.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (rt *redirectTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	redirected := r.Clone(r.Context())
+	redirected.URL.Scheme = rt.target.Scheme
+	redirected.URL.Host = rt.target.Host
+
+	return http.DefaultTransport.RoundTrip(redirected)
+}
+
+// newRedirectedClient returns a server using the given handler and a client
+// whose requests all go to it.
+func newRedirectedClient(t *testing.T, handler http.HandlerFunc) (s *httptest.Server, hc *http.Client) {
+	s = httptest.NewServer(handler)
+
+	target, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatalf("Could not parse server URL: %s", err)
+	}
+
+	hc = &http.Client{
+		Transport: &redirectTransport{target: target},
+	}
+
+	return s, hc
+}
+
+func spotifyTokenHandler(w http.ResponseWriter, r *http.Request) {
+	clientId, secretKey, ok := r.BasicAuth()
+	if ok == false {
+		clientId = r.FormValue("client_id")
+		secretKey = r.FormValue("client_secret")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if clientId != "good-id" || secretKey != "good-secret" {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, `{"error":"invalid_client","error_description":"Invalid client"}`)
+
+		return
+	}
+
+	fmt.Fprintf(w, `{"access_token":"token","token_type":"Bearer","expires_in":3600}`)
+}
+
+func TestCheckSpotifyCredentials(t *testing.T) {
+	s, hc := newRedirectedClient(t, spotifyTokenHandler)
+	defer s.Close()
+
+	err := CheckSpotifyCredentials(context.Background(), hc, "good-id", "good-secret")
+	if err != nil {
+		t.Fatalf("Valid credentials rejected: %s", err)
+	}
+
+	err = CheckSpotifyCredentials(context.Background(), hc, "good-id", "bad-secret")
+	if log.Is(err, ErrSpotifyCredentialsInvalid) == false {
+		t.Fatalf("Invalid credentials not reported: %v", err)
+	}
+}
+
+func TestCheckNapsterApiKey(t *testing.T) {
+	s, hc := newRedirectedClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("apikey") {
+		case "good-key":
+			fmt.Fprintf(w, `{"genres":[]}`)
+		case "broken-key":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+
+	defer s.Close()
+
+	err := CheckNapsterApiKey(context.Background(), hc, "good-key")
+	if err != nil {
+		t.Fatalf("Valid key rejected: %s", err)
+	}
+
+	err = CheckNapsterApiKey(context.Background(), hc, "bad-key")
+	if log.Is(err, ErrNapsterApiKeyInvalid) == false {
+		t.Fatalf("Invalid key not reported: %v", err)
+	}
+
+	// Other failures aren't blamed on the key.
+	err = CheckNapsterApiKey(context.Background(), hc, "broken-key")
+	if err == nil {
+		t.Fatalf("Server failure not reported.")
+	} else if log.Is(err, ErrNapsterApiKeyInvalid) == true {
+		t.Fatalf("Server failure reported as an invalid key.")
+	}
+}
@@ -0,0 +1,43 @@
+package gnsssync
+
+import (
+	"encoding/csv"
+	"io"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Misc
+var (
+	trackInfoCsvHeader = []string{"spotify_id", "artist", "album", "title"}
+)
+
+// WriteTrackInfoCSV writes the given tracks as CSV (with a header), ordered by
+// artist, album, and title.
+func WriteTrackInfoCSV(w io.Writer, tracks map[spotify.ID]TrackInfo) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	cw := csv.NewWriter(w)
+
+	err = cw.Write(trackInfoCsvHeader)
+	log.PanicIf(err)
+
+	for _, id := range sortedTrackIds(tracks) {
+		ti := tracks[id]
+
+		err := cw.Write([]string{string(id), ti.ArtistName, ti.AlbumName, ti.TitleName})
+		log.PanicIf(err)
+	}
+
+	cw.Flush()
+
+	err = cw.Error()
+	log.PanicIf(err)
+
+	return nil
+}
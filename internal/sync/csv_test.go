@@ -0,0 +1,67 @@
+package gnsssync
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"encoding/csv"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestWriteTrackInfoCSV(t *testing.T) {
+	tracks := map[spotify.ID]TrackInfo{
+		"album2-1": {ArtistName: "The Band", AlbumName: "Second Album", TitleName: "Deep Cut"},
+		"album1-1": {ArtistName: "The Band", AlbumName: "First Album", TitleName: "Opener, Part 1"},
+		"album3-1": {ArtistName: "Another Band", AlbumName: "Debut", TitleName: "The \"Single\""},
+	}
+
+	b := new(bytes.Buffer)
+
+	err := WriteTrackInfoCSV(b, tracks)
+	if err != nil {
+		t.Fatalf("Could not write CSV: %s", err)
+	}
+
+	expected := `spotify_id,artist,album,title
+album3-1,Another Band,Debut,"The ""Single"""
+album1-1,The Band,First Album,"Opener, Part 1"
+album2-1,The Band,Second Album,Deep Cut
+`
+
+	if b.String() != expected {
+		t.Fatalf("CSV not correct:\n%s", b.String())
+	}
+
+	// It reads back the same.
+
+	records, err := csv.NewReader(b).ReadAll()
+	if err != nil {
+		t.Fatalf("Could not read CSV: %s", err)
+	}
+
+	expectedRecords := [][]string{
+		{"spotify_id", "artist", "album", "title"},
+		{"album3-1", "Another Band", "Debut", "The \"Single\""},
+		{"album1-1", "The Band", "First Album", "Opener, Part 1"},
+		{"album2-1", "The Band", "Second Album", "Deep Cut"},
+	}
+
+	if reflect.DeepEqual(records, expectedRecords) != true {
+		t.Fatalf("Records not correct: %v", records)
+	}
+}
+
+func TestWriteTrackInfoCSV_Empty(t *testing.T) {
+	b := new(bytes.Buffer)
+
+	err := WriteTrackInfoCSV(b, map[spotify.ID]TrackInfo{})
+	if err != nil {
+		t.Fatalf("Could not write CSV: %s", err)
+	}
+
+	if b.String() != "spotify_id,artist,album,title\n" {
+		t.Fatalf("Expected just the header:\n%s", b.String())
+	}
+}
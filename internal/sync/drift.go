@@ -0,0 +1,231 @@
+package gnsssync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Errors
+var (
+	ErrMirrorIncomplete = fmt.Errorf("not every artist was matched so we can't tell which tracks are no longer favorited")
+)
+
+// Misc
+var (
+	dLog = log.NewLogger("gnss.drift")
+)
+
+// DriftTrack is a track that's in only one of the playlist and the favorites.
+type DriftTrack struct {
+	Id         spotify.ID `json:"id"`
+	ArtistName string     `json:"artist_name"`
+	AlbumName  string     `json:"album_name"`
+	TitleName  string     `json:"title_name"`
+}
+
+// DriftReport describes how a playlist differs from the favorites.
+type DriftReport struct {
+	// MissingFromPlaylist are the favorited tracks that were matched in
+	// Spotify but aren't in the playlist.
+	MissingFromPlaylist []*DriftTrack `json:"missing_from_playlist"`
+
+	// NoLongerFavorited are the tracks in the playlist that don't match any
+	// favorite.
+	NoLongerFavorited []*DriftTrack `json:"no_longer_favorited"`
+
+	// UnmatchedCount is how many favorites couldn't be matched in Spotify (and
+	// so can't be compared).
+	UnmatchedCount int `json:"unmatched_count"`
+}
+
+func newDriftTracks(tracks map[spotify.ID]TrackInfo) []*DriftTrack {
+	dts := make([]*DriftTrack, 0, len(tracks))
+	for id, ti := range tracks {
+		dt := &DriftTrack{
+			Id:         id,
+			ArtistName: ti.ArtistName,
+			AlbumName:  ti.AlbumName,
+			TitleName:  ti.TitleName,
+		}
+
+		dts = append(dts, dt)
+	}
+
+	sort.Slice(dts, func(j, k int) bool {
+		if dts[j].ArtistName != dts[k].ArtistName {
+			return dts[j].ArtistName < dts[k].ArtistName
+		} else if dts[j].AlbumName != dts[k].AlbumName {
+			return dts[j].AlbumName < dts[k].AlbumName
+		}
+
+		return dts[j].TitleName < dts[k].TitleName
+	})
+
+	return dts
+}
+
+// IsEmpty returns whether the playlist and the favorites agree.
+func (dr *DriftReport) IsEmpty() bool {
+	return len(dr.MissingFromPlaylist) == 0 && len(dr.NoLongerFavorited) == 0
+}
+
+// Write writes the report in the given format.
+func (dr *DriftReport) Write(w io.Writer, outputFormat string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if outputFormat == OutputFormatJson {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+
+		err := e.Encode(dr)
+		log.PanicIf(err)
+
+		return nil
+	} else if outputFormat != OutputFormatText {
+		log.Panic(ErrInvalidOutputFormat)
+	}
+
+	sections := []struct {
+		prefix string
+		tracks []*DriftTrack
+	}{
+		{"+", dr.MissingFromPlaylist},
+		{"-", dr.NoLongerFavorited},
+	}
+
+	for _, section := range sections {
+		for _, dt := range section.tracks {
+			_, err := fmt.Fprintf(w, "%s [%s] [%s] [%s] [%s]\n", section.prefix, dt.ArtistName, dt.AlbumName, dt.TitleName, dt.Id)
+			log.PanicIf(err)
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "\n(+) MISSING FROM PLAYLIST=(%d) (-) NO LONGER FAVORITED=(%d) UNMATCHED FAVORITES=(%d)\n", len(dr.MissingFromPlaylist), len(dr.NoLongerFavorited), dr.UnmatchedCount)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// Verify compares the playlist against the favorites without making any
+// changes. Only the playlist tracks by the given artists (or, when retrying,
+// the artists in the missing report) are considered.
+func (i *Importer) Verify(spotifyPlaylistName string, onlyArtists []string, spotifyMarketName string) (dr *DriftReport, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	missingFromPlaylist, err := i.GetTracksToAdd(spotifyPlaylistName, onlyArtists, spotifyMarketName)
+	log.PanicIf(err)
+
+	noLongerFavorited := i.noLongerFavorited(onlyArtists)
+
+	dr = &DriftReport{
+		MissingFromPlaylist: newDriftTracks(missingFromPlaylist),
+		NoLongerFavorited:   newDriftTracks(noLongerFavorited),
+		UnmatchedCount:      i.stats.MissingCount,
+	}
+
+	dLog.Infof(i.ctx, "Drift: MISSING-FROM-PLAYLIST=(%d) NO-LONGER-FAVORITED=(%d) UNMATCHED=(%d)", len(dr.MissingFromPlaylist), len(dr.NoLongerFavorited), dr.UnmatchedCount)
+
+	return dr, nil
+}
+
+// GetTracksToRemove returns the tracks in the playlist, by the given artists,
+// that no longer match any favorite. This must be called after
+// GetTracksToAdd. It fails if any artists were skipped since their tracks
+// would otherwise all look like they're no longer favorited.
+func (i *Importer) GetTracksToRemove(onlyArtists []string) (tracks map[spotify.ID]TrackInfo, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	if i.matchReport == nil {
+		log.Panicf("tracks to add have not been found yet")
+	}
+
+	if i.stats.FailedArtistCount > 0 || i.stats.RemainingArtistCount > 0 {
+		dLog.Warningf(i.ctx, "(%d) artists failed and (%d) weren't matched.", i.stats.FailedArtistCount, i.stats.RemainingArtistCount)
+		log.Panic(ErrMirrorIncomplete)
+	}
+
+	tracks = i.noLongerFavorited(onlyArtists)
+
+	dLog.Infof(i.ctx, "(%d) playlist tracks are no longer favorited.", len(tracks))
+
+	return tracks, nil
+}
+
+// noLongerFavorited returns the tracks in the playlist, by the given artists
+// (or, when retrying, the artists in the missing report), that didn't match
+// any favorite in the last call to GetTracksToAdd.
+func (i *Importer) noLongerFavorited(onlyArtists []string) (tracks map[spotify.ID]TrackInfo) {
+	// Collect everything in the playlist that matched a favorite.
+
+	favorited := make(map[spotify.ID]bool)
+	for _, id := range i.relinkedPresentIds {
+		favorited[id] = true
+	}
+
+	for _, ar := range i.matchReport.Artists {
+		for _, alr := range ar.Albums {
+			for _, id := range alr.alreadyPresentIds {
+				favorited[id] = true
+			}
+		}
+	}
+
+	// Only the playlist tracks by the artists that we were looking at are
+	// expected to be favorited.
+
+	artistNames := make(map[string]bool)
+	for _, artistName := range onlyArtists {
+		artistNames[strings.ToLower(artistName)] = true
+	}
+
+	for _, ar := range i.matchReport.Artists {
+		artistNames[strings.ToLower(ar.ArtistName)] = true
+	}
+
+	isConsidered := func(ti TrackInfo) bool {
+		if i.isExcludedArtist(strings.ToLower(ti.ArtistName)) == true {
+			return false
+		} else if i.allArtists == true {
+			return true
+		}
+
+		for artistName, _ := range artistNames {
+			if i.sa.isArtistMatch(ti.ArtistName, artistName) == true {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	tracks = make(map[spotify.ID]TrackInfo)
+	for id, ti := range i.playlistTracks {
+		if _, found := favorited[id]; found == true {
+			continue
+		} else if isConsidered(ti) == false {
+			continue
+		}
+
+		tracks[id] = ti
+	}
+
+	return tracks
+}
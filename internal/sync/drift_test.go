@@ -0,0 +1,63 @@
+package gnsssync
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	fsc := newTestCatalog()
+	fsc.addAlbum("artist1", "album2", "Second Album", "album", "1992-01-01", "Deep Cut")
+	fsc.addPlaylist("target", "Target", fsc.userId, "album1-1", "album2-1")
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Hidden Track"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+
+	dr, err := i.Verify("Target", []string{"the band"}, "")
+	if err != nil {
+		t.Fatalf("Could not verify: %s", err)
+	}
+
+	expected := &DriftReport{
+		MissingFromPlaylist: []*DriftTrack{
+			{Id: "album1-2", ArtistName: "The Band", AlbumName: "First Album", TitleName: "Closer"},
+		},
+		NoLongerFavorited: []*DriftTrack{
+			{Id: "album2-1", ArtistName: "The Band", AlbumName: "Second Album", TitleName: "Deep Cut"},
+		},
+		UnmatchedCount: 1,
+	}
+
+	if reflect.DeepEqual(dr, expected) != true {
+		t.Fatalf("Drift not correct: %v %v (%d)", dr.MissingFromPlaylist, dr.NoLongerFavorited, dr.UnmatchedCount)
+	}
+
+	// Nothing is changed.
+
+	if fsc.callCount("AddTracksToPlaylist") != 0 || fsc.callCount("RemoveTracksFromPlaylist") != 0 {
+		t.Fatalf("Verifying should not change the playlist.")
+	}
+
+	b := new(bytes.Buffer)
+
+	err = dr.Write(b, OutputFormatText)
+	if err != nil {
+		t.Fatalf("Could not write report: %s", err)
+	}
+
+	expectedText := `+ [The Band] [First Album] [Closer] [album1-2]
+- [The Band] [Second Album] [Deep Cut] [album2-1]
+
+(+) MISSING FROM PLAYLIST=(1) (-) NO LONGER FAVORITED=(1) UNMATCHED FAVORITES=(1)
+`
+
+	if b.String() != expectedText {
+		t.Fatalf("Report text not correct:\n%s", b.String())
+	}
+}
@@ -0,0 +1,136 @@
+package gnsssync
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/dsoprea/go-napster"
+)
+
+// fakeNapsterClient is an in-memory NapsterMemberClient and
+// NapsterMetadataClient.
+type fakeNapsterClient struct {
+	m sync.Mutex
+
+	// favoriteIds are the favorites in the order that Napster lists them.
+	favoriteIds []string
+
+	tracks map[string]napster.MetadataTrackDetail
+
+	// onPage, if not nil, is called after each page of favorites is read with
+	// the number of pages read so far. It can change the favorites.
+	onPage func(fnc *fakeNapsterClient, pages int)
+
+	pages int
+
+	// maxLimit, if not zero, is the most favorites or track details that can
+	// be read at once. Bigger requests fail and are flagged as too large on
+	// `nrlt` like the transport does for a real 413.
+	maxLimit int
+	nrlt     *napsterRateLimitTransport
+
+	// limits are the sizes of all of the requests, in order.
+	limits []int
+}
+
+func newFakeNapsterClient() *fakeNapsterClient {
+	return &fakeNapsterClient{
+		favoriteIds: make([]string, 0),
+		tracks:      make(map[string]napster.MetadataTrackDetail),
+	}
+}
+
+// addFavorite adds a favorite to the end of the list and returns its ID.
+func (fnc *fakeNapsterClient) addFavorite(artistName, albumName, trackName string) string {
+	id := fmt.Sprintf("tra.%d", len(fnc.tracks)+1)
+
+	fnc.tracks[id] = napster.MetadataTrackDetail{
+		Id:         id,
+		ArtistName: artistName,
+		AlbumName:  albumName,
+		Name:       trackName,
+	}
+
+	fnc.favoriteIds = append(fnc.favoriteIds, id)
+
+	return id
+}
+
+// prependFavorite adds a favorite to the front of the list (which is where
+// Napster puts new ones) and returns its ID.
+func (fnc *fakeNapsterClient) prependFavorite(artistName, albumName, trackName string) string {
+	id := fnc.addFavorite(artistName, albumName, trackName)
+
+	fnc.favoriteIds = append([]string{id}, fnc.favoriteIds[:len(fnc.favoriteIds)-1]...)
+
+	return id
+}
+
+// checkLimit records the size of a request and fails it if it's too large.
+// The lock must be held.
+func (fnc *fakeNapsterClient) checkLimit(limit int) error {
+	fnc.limits = append(fnc.limits, limit)
+
+	if fnc.maxLimit == 0 || limit <= fnc.maxLimit {
+		return nil
+	}
+
+	fnc.nrlt.m.Lock()
+	fnc.nrlt.tooLarge = true
+	fnc.nrlt.m.Unlock()
+
+	return fmt.Errorf("request too large: (%d)", limit)
+}
+
+func (fnc *fakeNapsterClient) GetFavoriteTracks(offset, limit int) (favorites []napster.FavoriteInfo, err error) {
+	fnc.m.Lock()
+	defer fnc.m.Unlock()
+
+	err = fnc.checkLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := pageBounds(len(fnc.favoriteIds), offset, limit)
+
+	favorites = make([]napster.FavoriteInfo, 0, to-from)
+	for _, id := range fnc.favoriteIds[from:to] {
+		favorites = append(favorites, napster.FavoriteInfo{Id: id})
+	}
+
+	fnc.pages++
+
+	if fnc.onPage != nil {
+		fnc.onPage(fnc, fnc.pages)
+	}
+
+	return favorites, nil
+}
+
+func (fnc *fakeNapsterClient) GetTrackDetail(trackIds ...string) (tracks []napster.MetadataTrackDetail, err error) {
+	fnc.m.Lock()
+	defer fnc.m.Unlock()
+
+	err = fnc.checkLimit(len(trackIds))
+	if err != nil {
+		return nil, err
+	}
+
+	tracks = make([]napster.MetadataTrackDetail, 0, len(trackIds))
+	for _, id := range trackIds {
+		if track, found := fnc.tracks[id]; found == true {
+			tracks = append(tracks, track)
+		}
+	}
+
+	return tracks, nil
+}
+
+// newTestNapsterImporter returns an importer that reads its favorites from the
+// given client.
+func newTestNapsterImporter(client SpotifyClient, fnc *fakeNapsterClient, batchSize int) *Importer {
+	i := newTestImporterWithoutFavorites(client, batchSize, "")
+	i.napsterMetadataClient = fnc
+
+	return i
+}
@@ -0,0 +1,647 @@
+package gnsssync
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/zmb3/spotify"
+)
+
+// Misc
+var (
+	fakeTrackQueryRx = regexp.MustCompile(`track:"([^"]*)"`)
+)
+
+// fakeSpotifyClient is an in-memory SpotifyClient. It only knows about the
+// artists, albums, and playlists that were added to it and does the least
+// that's needed to look like Spotify (e.g. searches are substring matches).
+type fakeSpotifyClient struct {
+	m sync.Mutex
+
+	userId string
+
+	artists []spotify.FullArtist
+
+	// albums are in the order that they're listed under their artists.
+	albums []*spotify.FullAlbum
+
+	// isrcs are the ISRCs of the album tracks that have one.
+	isrcs map[spotify.ID]string
+
+	playlists      []spotify.SimplePlaylist
+	playlistTracks map[spotify.ID][]spotify.PlaylistTrack
+
+	// playlistPageSize, if not zero, is the most playlists that are returned
+	// at once (whatever the limit that was asked for).
+	playlistPageSize int
+
+	// errs are returned, in order and once each, by the next calls to each
+	// method.
+	errs map[string][]error
+
+	// calls are how many times each method was called.
+	calls map[string]int
+
+	// added are the tracks that were added to each playlist (in order).
+	added map[spotify.ID][]spotify.ID
+
+	// badIds are the tracks that have the whole add rejected like Spotify
+	// does for an invalid ID.
+	badIds map[spotify.ID]bool
+
+	// playlistUserIds are the users that the playlist calls were made for (in
+	// order).
+	playlistUserIds []string
+}
+
+func newFakeSpotifyClient() *fakeSpotifyClient {
+	return &fakeSpotifyClient{
+		userId:         "tester",
+		isrcs:          make(map[spotify.ID]string),
+		playlistTracks: make(map[spotify.ID][]spotify.PlaylistTrack),
+		errs:           make(map[string][]error),
+		calls:          make(map[string]int),
+		added:          make(map[spotify.ID][]spotify.ID),
+		badIds:         make(map[spotify.ID]bool),
+	}
+}
+
+// addArtist adds an artist.
+func (fsc *fakeSpotifyClient) addArtist(id spotify.ID, name string) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	fa := spotify.FullArtist{}
+	fa.ID = id
+	fa.Name = name
+
+	fsc.artists = append(fsc.artists, fa)
+}
+
+// addAlbum adds an album (of the given type: "album", "single", or
+// "compilation") under the given artist. Each track's ID is the album's ID
+// followed by its position.
+func (fsc *fakeSpotifyClient) addAlbum(artistId spotify.ID, id spotify.ID, name string, albumType string, releaseDate string, trackNames ...string) *spotify.FullAlbum {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	artist := spotify.SimpleArtist{
+		ID: artistId,
+	}
+
+	for _, fa := range fsc.artists {
+		if fa.ID == artistId {
+			artist.Name = fa.Name
+		}
+	}
+
+	fa := &spotify.FullAlbum{}
+	fa.ID = id
+	fa.Name = name
+	fa.AlbumType = albumType
+	fa.ReleaseDate = releaseDate
+	fa.Artists = []spotify.SimpleArtist{artist}
+
+	for j, trackName := range trackNames {
+		st := spotify.SimpleTrack{
+			Artists:     []spotify.SimpleArtist{artist},
+			ID:          spotify.ID(fmt.Sprintf("%s-%d", id, j+1)),
+			Name:        trackName,
+			TrackNumber: j + 1,
+			Duration:    180000,
+		}
+
+		fa.Tracks.Tracks = append(fa.Tracks.Tracks, st)
+	}
+
+	fsc.albums = append(fsc.albums, fa)
+
+	return fa
+}
+
+// addPlaylist adds a playlist owned by the given user with the given tracks.
+func (fsc *fakeSpotifyClient) addPlaylist(id spotify.ID, name string, ownerId string, trackIds ...spotify.ID) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	p := spotify.SimplePlaylist{
+		ID:   id,
+		Name: name,
+	}
+
+	p.Owner.ID = ownerId
+
+	fsc.playlists = append(fsc.playlists, p)
+
+	pts := make([]spotify.PlaylistTrack, len(trackIds))
+	for j, trackId := range trackIds {
+		pts[j].Track = fsc.fullTrack(trackId)
+	}
+
+	fsc.playlistTracks[id] = pts
+}
+
+// failNext has the next call to the given method fail with the given error.
+func (fsc *fakeSpotifyClient) failNext(method string, err error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	fsc.errs[method] = append(fsc.errs[method], err)
+}
+
+// callCount returns how many times the given method was called.
+func (fsc *fakeSpotifyClient) callCount(method string) int {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	return fsc.calls[method]
+}
+
+// call records a call to the given method and returns the error that it
+// should fail with, if any. The lock must be held.
+func (fsc *fakeSpotifyClient) call(method string) error {
+	fsc.calls[method]++
+
+	errs := fsc.errs[method]
+	if len(errs) == 0 {
+		return nil
+	}
+
+	fsc.errs[method] = errs[1:]
+
+	return errs[0]
+}
+
+// fullTrack returns the album track having the given ID (or a track having
+// nothing but the ID if it's not on any of the albums). The lock must be
+// held.
+func (fsc *fakeSpotifyClient) fullTrack(id spotify.ID) spotify.FullTrack {
+	for _, fa := range fsc.albums {
+		for _, st := range fa.Tracks.Tracks {
+			if st.ID != id {
+				continue
+			}
+
+			ft := spotify.FullTrack{
+				SimpleTrack: st,
+				Album:       fa.SimpleAlbum,
+			}
+
+			if isrc, found := fsc.isrcs[id]; found == true {
+				ft.ExternalIDs = map[string]string{"isrc": isrc}
+			}
+
+			return ft
+		}
+	}
+
+	ft := spotify.FullTrack{}
+	ft.ID = id
+
+	return ft
+}
+
+// isAvailable returns whether something available in the given markets
+// (everywhere, if none) is available in the given market (or any, if none).
+func isAvailable(availableMarkets []string, opt *spotify.Options) bool {
+	if opt == nil || opt.Country == nil || len(availableMarkets) == 0 {
+		return true
+	}
+
+	for _, marketName := range availableMarkets {
+		if marketName == *opt.Country {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pageBounds returns the part of a list of the given length that was asked
+// for.
+func pageBounds(len_ int, offset int, limit int) (from int, to int) {
+	if limit <= 0 {
+		limit = SpotifyReadBatchSize
+	}
+
+	from = offset
+	if from > len_ {
+		from = len_
+	}
+
+	to = from + limit
+	if to > len_ {
+		to = len_
+	}
+
+	return from, to
+}
+
+// optionsBounds is pageBounds for the given options.
+func optionsBounds(len_ int, opt *spotify.Options) (from int, to int) {
+	offset := 0
+	limit := 0
+
+	if opt != nil {
+		if opt.Offset != nil {
+			offset = *opt.Offset
+		}
+
+		if opt.Limit != nil {
+			limit = *opt.Limit
+		}
+	}
+
+	return pageBounds(len_, offset, limit)
+}
+
+func (fsc *fakeSpotifyClient) CurrentUser() (*spotify.PrivateUser, error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("CurrentUser"); err != nil {
+		return nil, err
+	}
+
+	pu := &spotify.PrivateUser{}
+	pu.ID = fsc.userId
+
+	return pu, nil
+}
+
+func (fsc *fakeSpotifyClient) Search(query string, t spotify.SearchType) (*spotify.SearchResult, error) {
+	return fsc.SearchOpt(query, t, nil)
+}
+
+func (fsc *fakeSpotifyClient) SearchOpt(query string, t spotify.SearchType, opt *spotify.Options) (*spotify.SearchResult, error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("Search"); err != nil {
+		return nil, err
+	}
+
+	sr := &spotify.SearchResult{}
+	lowerQuery := strings.ToLower(query)
+
+	if t&spotify.SearchTypeArtist > 0 {
+		sr.Artists = &spotify.FullArtistPage{}
+
+		for _, fa := range fsc.artists {
+			if strings.Contains(strings.ToLower(fa.Name), lowerQuery) == true {
+				sr.Artists.Artists = append(sr.Artists.Artists, fa)
+			}
+		}
+
+		sr.Artists.Total = len(sr.Artists.Artists)
+	}
+
+	if t&spotify.SearchTypeAlbum > 0 {
+		sr.Albums = &spotify.SimpleAlbumPage{}
+
+		for _, fa := range fsc.albums {
+			if strings.Contains(strings.ToLower(fa.Name), lowerQuery) == true && isAvailable(fa.AvailableMarkets, opt) == true {
+				sr.Albums.Albums = append(sr.Albums.Albums, fa.SimpleAlbum)
+			}
+		}
+
+		sr.Albums.Total = len(sr.Albums.Albums)
+	}
+
+	if t&spotify.SearchTypeTrack > 0 {
+		sr.Tracks = &spotify.FullTrackPage{}
+
+		isrc := ""
+		trackName := lowerQuery
+
+		if strings.HasPrefix(lowerQuery, "isrc:") == true {
+			isrc = strings.ToUpper(query[len("isrc:"):])
+		} else if matches := fakeTrackQueryRx.FindStringSubmatch(lowerQuery); matches != nil {
+			trackName = matches[1]
+		}
+
+		for _, fa := range fsc.albums {
+			for _, st := range fa.Tracks.Tracks {
+				if isrc != "" {
+					if fsc.isrcs[st.ID] != isrc {
+						continue
+					}
+				} else if strings.Contains(strings.ToLower(st.Name), trackName) == false {
+					continue
+				}
+
+				if isAvailable(fa.AvailableMarkets, opt) == false || isAvailable(st.AvailableMarkets, opt) == false {
+					continue
+				}
+
+				sr.Tracks.Tracks = append(sr.Tracks.Tracks, fsc.fullTrack(st.ID))
+			}
+		}
+
+		sr.Tracks.Total = len(sr.Tracks.Tracks)
+	}
+
+	return sr, nil
+}
+
+func (fsc *fakeSpotifyClient) NextArtistResults(s *spotify.SearchResult) error {
+	return spotify.ErrNoMorePages
+}
+
+func (fsc *fakeSpotifyClient) GetArtistAlbumsOpt(artistID spotify.ID, options *spotify.Options, t *spotify.AlbumType) (*spotify.SimpleAlbumPage, error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("GetArtistAlbumsOpt"); err != nil {
+		return nil, err
+	}
+
+	albumTypeNames := map[spotify.AlbumType]string{
+		spotify.AlbumTypeAlbum:       "album",
+		spotify.AlbumTypeSingle:      "single",
+		spotify.AlbumTypeCompilation: "compilation",
+	}
+
+	albums := make([]spotify.SimpleAlbum, 0)
+	for _, fa := range fsc.albums {
+		if t != nil && fa.AlbumType != albumTypeNames[*t] {
+			continue
+		} else if isAvailable(fa.AvailableMarkets, options) == false {
+			continue
+		}
+
+		for _, artist := range fa.Artists {
+			if artist.ID == artistID {
+				albums = append(albums, fa.SimpleAlbum)
+				break
+			}
+		}
+	}
+
+	from, to := optionsBounds(len(albums), options)
+
+	sap := &spotify.SimpleAlbumPage{
+		Albums: albums[from:to],
+	}
+
+	sap.Offset = from
+	sap.Total = len(albums)
+
+	return sap, nil
+}
+
+// album returns the album having the given ID. The lock must be held.
+func (fsc *fakeSpotifyClient) album(id spotify.ID) *spotify.FullAlbum {
+	for _, fa := range fsc.albums {
+		if fa.ID == id {
+			return fa
+		}
+	}
+
+	return nil
+}
+
+func (fsc *fakeSpotifyClient) GetAlbum(id spotify.ID) (*spotify.FullAlbum, error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("GetAlbum"); err != nil {
+		return nil, err
+	}
+
+	fa := fsc.album(id)
+	if fa == nil {
+		return nil, spotify.Error{Message: "non existing id", Status: 400}
+	}
+
+	return fa, nil
+}
+
+func (fsc *fakeSpotifyClient) GetAlbums(ids ...spotify.ID) ([]*spotify.FullAlbum, error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("GetAlbums"); err != nil {
+		return nil, err
+	}
+
+	albums := make([]*spotify.FullAlbum, len(ids))
+	for j, id := range ids {
+		albums[j] = fsc.album(id)
+	}
+
+	return albums, nil
+}
+
+func (fsc *fakeSpotifyClient) GetAlbumTracksOpt(id spotify.ID, limit, offset int) (*spotify.SimpleTrackPage, error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("GetAlbumTracksOpt"); err != nil {
+		return nil, err
+	}
+
+	fa := fsc.album(id)
+	if fa == nil {
+		return nil, spotify.Error{Message: "non existing id", Status: 400}
+	}
+
+	from, to := pageBounds(len(fa.Tracks.Tracks), offset, limit)
+
+	stp := &spotify.SimpleTrackPage{
+		Tracks: fa.Tracks.Tracks[from:to],
+	}
+
+	stp.Offset = from
+	stp.Total = len(fa.Tracks.Tracks)
+
+	return stp, nil
+}
+
+func (fsc *fakeSpotifyClient) GetPlaylistsForUser(userID string) (*spotify.SimplePlaylistPage, error) {
+	return fsc.GetPlaylistsForUserOpt(userID, nil)
+}
+
+func (fsc *fakeSpotifyClient) GetPlaylistsForUserOpt(userID string, opt *spotify.Options) (*spotify.SimplePlaylistPage, error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("GetPlaylistsForUserOpt"); err != nil {
+		return nil, err
+	}
+
+	fsc.playlistUserIds = append(fsc.playlistUserIds, userID)
+
+	from, to := optionsBounds(len(fsc.playlists), opt)
+	if fsc.playlistPageSize > 0 && to-from > fsc.playlistPageSize {
+		to = from + fsc.playlistPageSize
+	}
+
+	splp := &spotify.SimplePlaylistPage{
+		Playlists: fsc.playlists[from:to],
+	}
+
+	splp.Offset = from
+	splp.Total = len(fsc.playlists)
+
+	return splp, nil
+}
+
+func (fsc *fakeSpotifyClient) GetPlaylistTracksOpt(userID string, playlistID spotify.ID, opt *spotify.Options, fields string) (*spotify.PlaylistTrackPage, error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("GetPlaylistTracksOpt"); err != nil {
+		return nil, err
+	}
+
+	fsc.playlistUserIds = append(fsc.playlistUserIds, userID)
+
+	pts, found := fsc.playlistTracks[playlistID]
+	if found == false {
+		return nil, spotify.Error{Message: "Not found.", Status: 404}
+	}
+
+	from, to := optionsBounds(len(pts), opt)
+
+	ptp := &spotify.PlaylistTrackPage{
+		Tracks: pts[from:to],
+	}
+
+	ptp.Offset = from
+	ptp.Total = len(pts)
+
+	return ptp, nil
+}
+
+func (fsc *fakeSpotifyClient) CreatePlaylistForUser(userID, playlistName string, public bool) (*spotify.FullPlaylist, error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("CreatePlaylistForUser"); err != nil {
+		return nil, err
+	}
+
+	fsc.playlistUserIds = append(fsc.playlistUserIds, userID)
+
+	fp := &spotify.FullPlaylist{}
+	fp.ID = spotify.ID(fmt.Sprintf("playlist%d", len(fsc.playlists)+1))
+	fp.Name = playlistName
+	fp.Owner.ID = userID
+
+	fsc.playlists = append(fsc.playlists, fp.SimplePlaylist)
+	fsc.playlistTracks[fp.ID] = make([]spotify.PlaylistTrack, 0)
+
+	return fp, nil
+}
+
+func (fsc *fakeSpotifyClient) AddTracksToPlaylist(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) (snapshotID string, err error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("AddTracksToPlaylist"); err != nil {
+		return "", err
+	}
+
+	for _, id := range trackIDs {
+		if fsc.badIds[id] == true {
+			return "", spotify.Error{Message: "Invalid track uri", Status: http.StatusBadRequest}
+		}
+	}
+
+	fsc.playlistUserIds = append(fsc.playlistUserIds, userID)
+
+	for _, id := range trackIDs {
+		pt := spotify.PlaylistTrack{
+			Track: fsc.fullTrack(id),
+		}
+
+		fsc.playlistTracks[playlistID] = append(fsc.playlistTracks[playlistID], pt)
+	}
+
+	fsc.added[playlistID] = append(fsc.added[playlistID], trackIDs...)
+
+	return "snapshot", nil
+}
+
+func (fsc *fakeSpotifyClient) RemoveTracksFromPlaylist(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) (newSnapshotID string, err error) {
+	fsc.m.Lock()
+	defer fsc.m.Unlock()
+
+	if err := fsc.call("RemoveTracksFromPlaylist"); err != nil {
+		return "", err
+	}
+
+	fsc.playlistUserIds = append(fsc.playlistUserIds, userID)
+
+	removed := make(map[spotify.ID]bool)
+	for _, id := range trackIDs {
+		removed[id] = true
+	}
+
+	kept := make([]spotify.PlaylistTrack, 0)
+	for _, pt := range fsc.playlistTracks[playlistID] {
+		if _, found := removed[pt.Track.ID]; found == false {
+			kept = append(kept, pt)
+		}
+	}
+
+	fsc.playlistTracks[playlistID] = kept
+
+	return "snapshot", nil
+}
+
+// newTestSpotifyContext returns a context whose client is the given one
+// rather than one that talks to Spotify.
+func newTestSpotifyContext(client SpotifyClient) *SpotifyContext {
+	sc := &SpotifyContext{}
+
+	sc.instrumentedClientOnce.Do(func() {
+		sc.instrumentedClient = NewInstrumentedSpotifyClient(client)
+	})
+
+	return sc
+}
+
+// newTestSpotifyAdapter returns an adapter that uses the given client.
+func newTestSpotifyAdapter(client SpotifyClient) *SpotifyAdapter {
+	return NewSpotifyAdapter(context.Background(), newTestSpotifyContext(client))
+}
+
+// newTestImporterWithoutFavorites returns an importer that uses the given
+// client.
+func newTestImporterWithoutFavorites(client SpotifyClient, batchSize int, marketName string) *Importer {
+	ctx := context.Background()
+	sc := newTestSpotifyContext(client)
+
+	return NewImporter(ctx, "", "", "", "", sc, NewSpotifyCache(ctx, sc), batchSize, marketName)
+}
+
+// newTestImporter returns an importer that uses the given client and reads
+// the favorites from a snapshot having the given tracks.
+func newTestImporter(t *testing.T, client SpotifyClient, marketName string, favorites ...NormalizedTrack) *Importer {
+	i := newTestImporterWithoutFavorites(client, SpotifyReadBatchSize, marketName)
+
+	normalizedTracks := make([]*NormalizedTrack, len(favorites))
+	for j, _ := range favorites {
+		normalizedTracks[j] = &favorites[j]
+	}
+
+	favoritesFilepath := path.Join(t.TempDir(), "favorites.json")
+
+	err := WriteFavoritesSnapshot(favoritesFilepath, normalizedTracks)
+	if err != nil {
+		t.Fatalf("Could not write favorites: %s", err)
+	}
+
+	i.SetFavoritesInFilepath(favoritesFilepath)
+
+	return i
+}
@@ -0,0 +1,66 @@
+package gnsssync
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// favoritesSnapshot is the on-disk form of the favorite tracks read from
+// Napster. This lets us re-run the matching without having to talk to Napster.
+type favoritesSnapshot struct {
+	Tracks []*NormalizedTrack `json:"tracks"`
+}
+
+// WriteFavoritesSnapshot writes the given favorite tracks to a JSON file.
+func WriteFavoritesSnapshot(filepath string, normalizedTracks []*NormalizedTrack) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.Create(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	fs := favoritesSnapshot{
+		Tracks: normalizedTracks,
+	}
+
+	e := json.NewEncoder(f)
+	e.SetIndent("", "  ")
+
+	err = e.Encode(fs)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// ReadFavoritesSnapshot reads favorite tracks from a JSON file written by
+// WriteFavoritesSnapshot.
+func ReadFavoritesSnapshot(filepath string) (normalizedTracks []*NormalizedTrack, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.Open(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	fs := favoritesSnapshot{}
+
+	err = json.NewDecoder(f).Decode(&fs)
+	log.PanicIf(err)
+
+	if fs.Tracks == nil {
+		fs.Tracks = make([]*NormalizedTrack, 0)
+	}
+
+	return fs.Tracks, nil
+}
@@ -0,0 +1,86 @@
+package gnsssync
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestReadNapsterFavorites_SnapshotMatchesLive(t *testing.T) {
+	fnc := newFakeNapsterClient()
+	fnc.addFavorite("The Band", "First Album", "Opener")
+	fnc.addFavorite("Other Artist", "Their Album", "Their Song")
+	fnc.addFavorite("The Band", "Second Album", "Single")
+	fnc.addFavorite("The Band", "First Album", "Closer")
+
+	onlyArtists := []string{"the band"}
+	snapshotFilepath := path.Join(t.TempDir(), "favorites.json")
+
+	live := newTestNapsterImporter(newFakeSpotifyClient(), fnc, 2)
+	live.SetDumpFavoritesFilepath(snapshotFilepath)
+
+	liveGrouped, liveSkipped, err := live.readNapsterFavorites(fnc, onlyArtists)
+	if err != nil {
+		t.Fatalf("Could not read live favorites: %s", err)
+	}
+
+	expected := map[albumKeyNames][]string{
+		{artistName: "the band", albumName: "first album"}:  {"opener", "closer"},
+		{artistName: "the band", albumName: "second album"}: {"single"},
+	}
+
+	if reflect.DeepEqual(liveGrouped, expected) == false {
+		t.Fatalf("Live grouping not correct: %v", liveGrouped)
+	} else if liveSkipped != 1 {
+		t.Fatalf("Live skipped count not correct: (%d)", liveSkipped)
+	}
+
+	offline := newTestImporterWithoutFavorites(newFakeSpotifyClient(), SpotifyReadBatchSize, "")
+	offline.SetFavoritesInFilepath(snapshotFilepath)
+
+	offlineGrouped, offlineSkipped, err := offline.readNapsterFavorites(nil, onlyArtists)
+	if err != nil {
+		t.Fatalf("Could not read snapshot: %s", err)
+	}
+
+	if reflect.DeepEqual(offlineGrouped, liveGrouped) == false {
+		t.Fatalf("Snapshot grouping differs from live: %v != %v", offlineGrouped, liveGrouped)
+	} else if offlineSkipped != liveSkipped {
+		t.Fatalf("Snapshot skipped count differs from live: (%d) != (%d)", offlineSkipped, liveSkipped)
+	}
+
+	// The original casing should survive the round-trip.
+
+	if name := offline.displayName("first album"); name != "First Album" {
+		t.Fatalf("Display name not kept in snapshot: [%s]", name)
+	}
+}
+
+func TestReadNapsterFavorites_Duplicates(t *testing.T) {
+	fnc := newFakeNapsterClient()
+
+	openerId := fnc.addFavorite("The Band", "First Album", "Opener")
+	fnc.addFavorite("The Band", "First Album", "Closer")
+
+	// The same favorite listed twice, and the same track favorited again
+	// under another ID.
+	fnc.favoriteIds = append(fnc.favoriteIds, openerId)
+	fnc.addFavorite("THE BAND", "First Album", "opener")
+
+	i := newTestNapsterImporter(newFakeSpotifyClient(), fnc, 2)
+
+	grouped, _, err := i.readNapsterFavorites(fnc, []string{"the band"})
+	if err != nil {
+		t.Fatalf("Could not read favorites: %s", err)
+	}
+
+	expected := map[albumKeyNames][]string{
+		{artistName: "the band", albumName: "first album"}: {"opener", "closer"},
+	}
+
+	if reflect.DeepEqual(grouped, expected) == false {
+		t.Fatalf("Duplicates not collapsed: %v", grouped)
+	} else if i.Stats().DuplicateCount != 2 {
+		t.Fatalf("Duplicate count not correct: (%d)", i.Stats().DuplicateCount)
+	}
+}
@@ -0,0 +1,159 @@
+package gnsssync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Resolution is the Spotify track that a favorite was matched to.
+type Resolution struct {
+	NormalizedTrack
+
+	TrackId spotify.ID `json:"track_id"`
+}
+
+func (r Resolution) String() string {
+	return fmt.Sprintf("[%s] [%s] [%s]", r.ArtistName, r.AlbumName, r.TrackName)
+}
+
+type goldenFile struct {
+	Resolutions []*Resolution `json:"resolutions"`
+}
+
+// sortResolutions sorts the resolutions by artist, album, and track.
+func sortResolutions(resolutions []*Resolution) {
+	sort.Slice(resolutions, func(j, k int) bool {
+		a := resolutions[j]
+		b := resolutions[k]
+
+		if a.ArtistName != b.ArtistName {
+			return a.ArtistName < b.ArtistName
+		} else if a.AlbumName != b.AlbumName {
+			return a.AlbumName < b.AlbumName
+		}
+
+		return a.TrackName < b.TrackName
+	})
+}
+
+// Resolutions returns the Spotify tracks that the favorites were matched to by
+// the last call to GetTracksToAdd, including the ones that were already in
+// the playlist or were skipped. These are sorted by artist, album, and track.
+func (i *Importer) Resolutions() []*Resolution {
+	resolutions := make([]*Resolution, 0)
+
+	if i.matchReport == nil {
+		return resolutions
+	}
+
+	for _, ar := range i.matchReport.Artists {
+		for _, alr := range ar.Albums {
+			for trackName, id := range alr.resolutions {
+				r := &Resolution{
+					NormalizedTrack: NormalizedTrack{
+						ArtistName: ar.ArtistName,
+						AlbumName:  alr.AlbumName,
+						TrackName:  trackName,
+					},
+					TrackId: id,
+				}
+
+				resolutions = append(resolutions, r)
+			}
+		}
+	}
+
+	sortResolutions(resolutions)
+
+	return resolutions
+}
+
+// WriteGoldenFile writes the resolutions to a file so that later runs can be
+// compared against it (see CompareGoldenFile).
+func WriteGoldenFile(filepath string, resolutions []*Resolution) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sorted := make([]*Resolution, len(resolutions))
+	copy(sorted, resolutions)
+
+	sortResolutions(sorted)
+
+	gf := goldenFile{
+		Resolutions: sorted,
+	}
+
+	f, err := os.Create(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	e := json.NewEncoder(f)
+	e.SetIndent("", "  ")
+
+	err = e.Encode(gf)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// CompareGoldenFile compares the resolutions against the ones in a file
+// written by WriteGoldenFile and describes each favorite that was matched
+// differently, is no longer matched, or is newly matched. This is for
+// catching unintended changes to how favorites are matched.
+func CompareGoldenFile(filepath string, resolutions []*Resolution) (drift []string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	raw, err := ioutil.ReadFile(filepath)
+	log.PanicIf(err)
+
+	gf := goldenFile{}
+
+	err = json.Unmarshal(raw, &gf)
+	log.PanicIf(err)
+
+	expected := make(map[NormalizedTrack]spotify.ID)
+	for _, r := range gf.Resolutions {
+		expected[r.NormalizedTrack] = r.TrackId
+	}
+
+	sorted := make([]*Resolution, len(resolutions))
+	copy(sorted, resolutions)
+
+	sortResolutions(sorted)
+
+	drift = make([]string, 0)
+
+	for _, r := range sorted {
+		expectedId, found := expected[r.NormalizedTrack]
+		if found == false {
+			drift = append(drift, fmt.Sprintf("NEWLY MATCHED: %s -> [%s]", r, r.TrackId))
+		} else if expectedId != r.TrackId {
+			drift = append(drift, fmt.Sprintf("MATCHED DIFFERENTLY: %s -> [%s] (WAS [%s])", r, r.TrackId, expectedId))
+		}
+
+		delete(expected, r.NormalizedTrack)
+	}
+
+	for _, r := range gf.Resolutions {
+		if _, found := expected[r.NormalizedTrack]; found == true {
+			drift = append(drift, fmt.Sprintf("NO LONGER MATCHED: %s (WAS [%s])", r, r.TrackId))
+		}
+	}
+
+	return drift, nil
+}
@@ -0,0 +1,118 @@
+package gnsssync
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+
+	"path"
+)
+
+var (
+	updateGolden = flag.Bool("update-golden", false, "Rewrite the golden file with how the favorites are matched now")
+)
+
+const (
+	goldenFilepath = "testdata/golden.json"
+)
+
+// newGoldenCatalog returns a catalog that exercises each of the ways that a
+// favorite can be matched.
+func newGoldenCatalog() *fakeSpotifyClient {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+	fsc.addArtist("artist2", "Other Artist")
+	fsc.addPlaylist("target", "Target", fsc.userId)
+
+	fsc.addAlbum("artist1", "album1", "First Album", "album", "1990-01-01", "Opener", "Closer - Remastered 2009")
+	fsc.addAlbum("artist1", "album2", "Second Album (Deluxe Edition)", "album", "1992-01-01", "Deep Cut", "Bonus Track")
+	fsc.addAlbum("artist1", "single1", "Lead Single", "single", "1993-01-01", "Lead Single")
+	fsc.addAlbum("artist2", "album3", "Their Album", "album", "2001-01-01", "Their Song (feat. The Band)")
+
+	return fsc
+}
+
+// goldenFavorites are the favorites that are matched against the golden
+// catalog.
+var goldenFavorites = []NormalizedTrack{
+	{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+	{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+	{ArtistName: "The Band", AlbumName: "Second Album", TrackName: "Deep Cut"},
+	{ArtistName: "The Band", AlbumName: "Third Album", TrackName: "Lead Single"},
+	{ArtistName: "The Band", AlbumName: "", TrackName: "Bonus Track"},
+	{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Hidden Track"},
+	{ArtistName: "Other Artist", AlbumName: "Their Album", TrackName: "Their Song"},
+}
+
+// TestGetTracksToAdd_Golden fails if the favorites aren't matched the way
+// that they were when the golden file was written. Run with -update-golden to
+// accept an intended change.
+func TestGetTracksToAdd_Golden(t *testing.T) {
+	i := newTestImporter(t, newGoldenCatalog(), "", goldenFavorites...)
+
+	_, err := i.GetTracksToAdd("Target", []string{"the band", "other artist"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	resolutions := i.Resolutions()
+
+	if *updateGolden == true {
+		err := WriteGoldenFile(goldenFilepath, resolutions)
+		if err != nil {
+			t.Fatalf("Could not update the golden file: %s", err)
+		}
+	}
+
+	drift, err := CompareGoldenFile(goldenFilepath, resolutions)
+	if err != nil {
+		t.Fatalf("Could not compare against the golden file: %s", err)
+	}
+
+	for _, phrase := range drift {
+		t.Errorf("%s", phrase)
+	}
+}
+
+func TestCompareGoldenFile(t *testing.T) {
+	filepath := path.Join(t.TempDir(), "golden.json")
+
+	recorded := []*Resolution{
+		{NormalizedTrack: NormalizedTrack{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"}, TrackId: "album1-1"},
+		{NormalizedTrack: NormalizedTrack{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"}, TrackId: "album1-2"},
+		{NormalizedTrack: NormalizedTrack{ArtistName: "The Band", AlbumName: "Second Album", TrackName: "Deep Cut"}, TrackId: "album2-1"},
+	}
+
+	err := WriteGoldenFile(filepath, recorded)
+	if err != nil {
+		t.Fatalf("Could not write golden file: %s", err)
+	}
+
+	drift, err := CompareGoldenFile(filepath, recorded)
+	if err != nil {
+		t.Fatalf("Could not compare: %s", err)
+	} else if len(drift) != 0 {
+		t.Fatalf("Expected no drift: %v", drift)
+	}
+
+	current := []*Resolution{
+		{NormalizedTrack: NormalizedTrack{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"}, TrackId: "album1-1"},
+		{NormalizedTrack: NormalizedTrack{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"}, TrackId: "single1-1"},
+		{NormalizedTrack: NormalizedTrack{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Hidden Track"}, TrackId: "album1-3"},
+	}
+
+	drift, err = CompareGoldenFile(filepath, current)
+	if err != nil {
+		t.Fatalf("Could not compare changed resolutions: %s", err)
+	}
+
+	expected := []string{
+		"MATCHED DIFFERENTLY: [The Band] [First Album] [Closer] -> [single1-1] (WAS [album1-2])",
+		"NEWLY MATCHED: [The Band] [First Album] [Hidden Track] -> [album1-3]",
+		"NO LONGER MATCHED: [The Band] [Second Album] [Deep Cut] (WAS [album2-1])",
+	}
+
+	if reflect.DeepEqual(drift, expected) != true {
+		t.Fatalf("Drift not correct: %v", drift)
+	}
+}
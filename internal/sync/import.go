@@ -2,8 +2,11 @@ package gnsssync
 
 import (
 	"fmt"
+	"io"
 	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"net/http"
 
@@ -28,16 +31,34 @@ type TrackInfo struct {
 	ArtistName string
 	AlbumName  string
 	TitleName  string
+
+	// MatchMethod is how the track was found in Spotify (one of the
+	// MatchMethod* constants).
+	MatchMethod string
+
+	// MarketName is the market that the track was matched in. This is only
+	// set when more than one market was tried.
+	MarketName string
 }
 
 func (ti TrackInfo) String() string {
-	return fmt.Sprintf("TRACK<[%s] [%s] [%s]>", ti.ArtistName, ti.AlbumName, ti.TitleName)
+	if ti.MarketName != "" {
+		return fmt.Sprintf("TRACK<[%s] [%s] [%s] MATCH=[%s] MARKET=[%s]>", ti.ArtistName, ti.AlbumName, ti.TitleName, ti.MatchMethod, ti.MarketName)
+	}
+
+	return fmt.Sprintf("TRACK<[%s] [%s] [%s] MATCH=[%s]>", ti.ArtistName, ti.AlbumName, ti.TitleName, ti.MatchMethod)
 }
 
 type Importer struct {
 	ctx context.Context
 	hc  *http.Client
 
+	napsterRateLimit *napsterRateLimitTransport
+
+	// napsterMetadataClient, if not nil, is used rather than a client that
+	// talks to Napster.
+	napsterMetadataClient NapsterMetadataClient
+
 	napsterApiKey    string
 	napsterSecretKey string
 	napsterUsername  string
@@ -49,155 +70,1557 @@ type Importer struct {
 
 	batchSize int
 
-	spotifyIndex  map[spotify.ID]bool
-	artistNotices map[string]bool
+	spotifyIndex  map[spotify.ID]bool
+	artistNotices map[string]bool
+
+	marketName string
+
+	skipIfInAnyPlaylist bool
+
+	favoritesInFilepath   string
+	dumpFavoritesFilepath string
+
+	artistConcurrency   int
+	adaptiveConcurrency bool
+
+	napsterFavoritesLimit            int
+	napsterFavoritesLimitAfterFilter bool
+	napsterRestartOnShift            bool
+
+	fallbackMarketNames []string
+	unionMarkets        bool
+
+	albumCompleteOnly bool
+
+	missingReportFilepath string
+	retryMissingFilepath  string
+
+	matchReport *MatchReport
+
+	// missingTracks are the favorites that the last call to GetTracksToAdd
+	// won't add.
+	missingTracks []*MissingTrack
+
+	skipUnplayable bool
+
+	artistTriage bool
+
+	stats ImportStats
+
+	artistBatchSize int
+	artistBatchCb   ArtistBatchCallback
+
+	annotateNearest bool
+
+	minDuration time.Duration
+	maxDuration time.Duration
+
+	allArtists     bool
+	excludeArtists []string
+
+	noFail bool
+
+	ignorePreloadErrors bool
+
+	dedupeSource bool
+
+	searchCacheFilepath      string
+	searchCacheNegativeTtl   time.Duration
+	searchCacheFlushEvery    int
+	searchCacheFlushInterval time.Duration
+
+	// summaryWriter, if not nil, gets the summary at the end of the matching
+	// rather than the log.
+	summaryWriter io.Writer
+
+	// isrcs are the ISRCs of the favorites that have them, by album and then
+	// by track name.
+	isrcs map[albumKeyNames]map[string]string
+
+	// displayNames are the original (non-lower-cased) artist, album, and
+	// track names, keyed by their normalized forms.
+	displayNames     map[string]string
+	displayNamesLock sync.RWMutex
+
+	// playlistTracks are the tracks in the target playlist as of the last
+	// call to GetTracksToAdd.
+	playlistTracks map[spotify.ID]TrackInfo
+
+	// relinkedPresentIds are the matched tracks that were already in the
+	// playlist under the ID that they were relinked to.
+	relinkedPresentIds []spotify.ID
+}
+
+// ArtistBatchCallback receives the tracks matched for one group of artists.
+type ArtistBatchCallback func(tracks map[spotify.ID]TrackInfo) error
+
+// ImportStats are the counts from the last call to GetTracksToAdd. These
+// explain why there might be nothing to import.
+type ImportStats struct {
+	// FavoritesCount is how many favorites were read.
+	FavoritesCount int
+
+	// FilteredCount is how many favorites were by artists that we weren't
+	// told to import.
+	FilteredCount int
+
+	// AlreadyPresentCount is how many matched tracks were already in the
+	// playlist.
+	AlreadyPresentCount int
+
+	// MissingCount is how many favorites couldn't be matched (or otherwise
+	// won't be added).
+	MissingCount int
+
+	// DuplicateCount is how many favorites were duplicates of others (by ID
+	// or by name) and were collapsed.
+	DuplicateCount int
+
+	// FailedArtistCount is how many artists were skipped because looking them
+	// up failed (only when we were told not to fail).
+	FailedArtistCount int
+
+	// RemainingArtistCount is how many artists weren't matched at all because
+	// the context was done (e.g. the run ran out of time).
+	RemainingArtistCount int
+
+	// SharedTrackCount is how many Spotify tracks were matched by more than
+	// one favorite (only when we were told to look).
+	SharedTrackCount int
+}
+
+// NewImporter creates an Importer instance. `marketName` can be the name of a
+// market to filter albums by or empty.
+func NewImporter(ctx context.Context, napsterApiKey, napsterSecretKey, napsterUsername, napsterPassword string, spotifyAuth *SpotifyContext, spotifyCache *SpotifyCache, batchSize int, marketName string) *Importer {
+	nrlt := newNapsterRateLimitTransport(nil)
+
+	hc := &http.Client{
+		Transport: nrlt,
+	}
+
+	spotifyIndex := make(map[spotify.ID]bool)
+	artistNotices := make(map[string]bool)
+
+	sa := NewSpotifyAdapter(ctx, spotifyAuth)
+
+	return &Importer{
+		ctx: ctx,
+		hc:  hc,
+
+		napsterRateLimit: nrlt,
+
+		napsterApiKey:    napsterApiKey,
+		napsterSecretKey: napsterSecretKey,
+		napsterUsername:  napsterUsername,
+		napsterPassword:  napsterPassword,
+
+		spotifyAuth: spotifyAuth,
+		sc:          spotifyCache,
+		sa:          sa,
+
+		batchSize: batchSize,
+
+		spotifyIndex:  spotifyIndex,
+		displayNames:  make(map[string]string),
+		artistNotices: artistNotices,
+
+		marketName: marketName,
+	}
+}
+
+// SetSkipIfInAnyPlaylist determines whether tracks that are already in *any* of
+// the user's playlists (rather than just the target playlist) will be skipped.
+// This requires reading every playlist.
+func (i *Importer) SetSkipIfInAnyPlaylist(skipIfInAnyPlaylist bool) {
+	i.skipIfInAnyPlaylist = skipIfInAnyPlaylist
+}
+
+// SetFavoritesInFilepath has us read the favorites from a snapshot previously
+// written via SetDumpFavoritesFilepath rather than from Napster.
+func (i *Importer) SetFavoritesInFilepath(favoritesInFilepath string) {
+	i.favoritesInFilepath = favoritesInFilepath
+}
+
+// SetDumpFavoritesFilepath has us write a snapshot of the favorites that we
+// read to the given file.
+func (i *Importer) SetDumpFavoritesFilepath(dumpFavoritesFilepath string) {
+	i.dumpFavoritesFilepath = dumpFavoritesFilepath
+}
+
+// SetArtistConcurrency sets how many artists will be matched against Spotify
+// at the same time. The results are still collected in artist order.
+func (i *Importer) SetArtistConcurrency(artistConcurrency int) {
+	i.artistConcurrency = artistConcurrency
+}
+
+// SetAlbumSearchOnArtistMiss determines whether we'll search for an album
+// directly when its artist can't be found in Spotify.
+func (i *Importer) SetAlbumSearchOnArtistMiss(albumSearchOnArtistMiss bool) {
+	i.sa.SetAlbumSearchOnArtistMiss(albumSearchOnArtistMiss)
+}
+
+// SetTraceHttp determines whether all Napster requests and responses will be
+// logged.
+func (i *Importer) SetTraceHttp(traceHttp bool) {
+	if traceHttp == true {
+		i.napsterRateLimit.base = NewTracingTransport("napster", i.napsterRateLimit.base)
+	}
+}
+
+// SetAdaptiveConcurrency has us run fewer of the artist workers at once while
+// Spotify is rate-limiting us, working back up to the artist concurrency once
+// it stops.
+func (i *Importer) SetAdaptiveConcurrency(adaptiveConcurrency bool) {
+	i.adaptiveConcurrency = adaptiveConcurrency
+}
+
+// SetNoFail has us skip (and report as missing) the artists and albums whose
+// lookups fail rather than failing the whole run.
+func (i *Importer) SetNoFail(noFail bool) {
+	i.noFail = noFail
+}
+
+// SetIgnorePreloadErrors has us carry on with an empty index if the tracks
+// already in the playlist can't be read. Tracks that are already there may then
+// be added again.
+func (i *Importer) SetIgnorePreloadErrors(ignorePreloadErrors bool) {
+	i.ignorePreloadErrors = ignorePreloadErrors
+}
+
+// SetSearchCache has us load the Spotify lookups from the given file before
+// matching and save them back to it afterwards, so that a later run doesn't
+// have to repeat them. The lookups that found nothing are repeated once
+// `negativeTtl` has passed.
+func (i *Importer) SetSearchCache(searchCacheFilepath string, negativeTtl time.Duration) {
+	i.searchCacheFilepath = searchCacheFilepath
+	i.searchCacheNegativeTtl = negativeTtl
+}
+
+// SetSearchCacheFlush has the search cache also written during the matching
+// once `flushEvery` new lookups have been made or `flushInterval` has passed
+// (either can be zero to not consider it), so that a crash doesn't lose
+// everything looked up since the start.
+func (i *Importer) SetSearchCacheFlush(flushEvery int, flushInterval time.Duration) {
+	i.searchCacheFlushEvery = flushEvery
+	i.searchCacheFlushInterval = flushInterval
+}
+
+// SetDedupeSource has us report the favorites that matched the same Spotify
+// track as another favorite. Only one of them can be added either way, but
+// this keeps track of all of them.
+func (i *Importer) SetDedupeSource(dedupeSource bool) {
+	i.dedupeSource = dedupeSource
+}
+
+// SetSummaryWriter has the summary at the end of the matching (the counts and
+// the tracks that weren't found) written to `w` rather than logged. This is
+// for embedding the importer in another program.
+func (i *Importer) SetSummaryWriter(w io.Writer) {
+	i.summaryWriter = w
+}
+
+// summaryInfof writes a line of the summary.
+func (i *Importer) summaryInfof(format string, args ...interface{}) {
+	if i.summaryWriter == nil {
+		iLog.Infof(i.ctx, format, args...)
+		return
+	}
+
+	_, err := fmt.Fprintf(i.summaryWriter, format+"\n", args...)
+	log.PanicIf(err)
+}
+
+// summaryWarningf writes a line of the summary that deserves attention.
+func (i *Importer) summaryWarningf(format string, args ...interface{}) {
+	if i.summaryWriter == nil {
+		iLog.Warningf(i.ctx, format, args...)
+		return
+	}
+
+	_, err := fmt.Fprintf(i.summaryWriter, "WARNING: "+format+"\n", args...)
+	log.PanicIf(err)
+}
+
+// SetNapsterRestartOnShift has us start reading the favorites over (up to
+// NapsterPagingRestarts times) if they change while we're reading them.
+// Otherwise, we just warn that some might have been missed.
+func (i *Importer) SetNapsterRestartOnShift(napsterRestartOnShift bool) {
+	i.napsterRestartOnShift = napsterRestartOnShift
+}
+
+// SetNapsterFavoritesLimit stops reading favorites once `limit` have been read
+// (zero means no limit). If `afterFilter` is true, only favorites that pass
+// the artist filter count toward the limit.
+func (i *Importer) SetNapsterFavoritesLimit(limit int, afterFilter bool) {
+	i.napsterFavoritesLimit = limit
+	i.napsterFavoritesLimitAfterFilter = afterFilter
+}
+
+// SetFallbackMarketNames sets the markets to try, in order, when an album
+// can't be matched in the primary market.
+func (i *Importer) SetFallbackMarketNames(fallbackMarketNames []string) {
+	i.fallbackMarketNames = fallbackMarketNames
+}
+
+// SetUnionMarkets has us match every album in every market (the primary and
+// all fallbacks) and combine the results rather than stopping at the first
+// market that matches. This maximizes coverage at the cost of more requests.
+func (i *Importer) SetUnionMarkets(unionMarkets bool) {
+	i.unionMarkets = unionMarkets
+}
+
+// SetEditionStopwords sets the words that identify a trailing parenthetical
+// as describing an edition (e.g. "remaster") during liberal title matching.
+func (i *Importer) SetEditionStopwords(editionStopwords []string) {
+	i.sa.SetEditionStopwords(editionStopwords)
+}
+
+// SetMatchStrategies sets the order in which the match strategies are tried.
+func (i *Importer) SetMatchStrategies(matchStrategies []string) {
+	i.sa.SetMatchStrategies(matchStrategies)
+}
+
+// SetAlbumTypes sets the kinds of album that an album's name is looked for
+// under, in order of preference.
+func (i *Importer) SetAlbumTypes(albumTypes []spotify.AlbumType) {
+	i.sa.SetAlbumTypes(albumTypes)
+}
+
+// SetAllArtists has us import the favorites by every artist (other than the
+// excluded ones) rather than just the ones that we're given.
+func (i *Importer) SetAllArtists(allArtists bool) {
+	i.allArtists = allArtists
+}
+
+// SetExcludeArtists sets the artists whose favorites will never be imported.
+func (i *Importer) SetExcludeArtists(excludeArtists []string) {
+	normalized := make([]string, len(excludeArtists))
+	for j, artistName := range excludeArtists {
+		normalized[j] = strings.ToLower(artistName)
+	}
+
+	i.excludeArtists = normalized
+}
+
+// SetDurationRange has us skip (and report) the matched tracks that are
+// shorter than `minDuration` or longer than `maxDuration`. Either can be zero
+// to not check that side.
+func (i *Importer) SetDurationRange(minDuration, maxDuration time.Duration) {
+	i.minDuration = minDuration
+	i.maxDuration = maxDuration
+}
+
+// isDurationInRange returns whether a track of the given length is within the
+// configured range (inclusive).
+func (i *Importer) isDurationInRange(duration time.Duration) bool {
+	if i.minDuration > 0 && duration < i.minDuration {
+		return false
+	} else if i.maxDuration > 0 && duration > i.maxDuration {
+		return false
+	}
+
+	return true
+}
+
+// SetAnnotateNearest has us report the closest album or track that we saw for
+// each one that couldn't be found.
+func (i *Importer) SetAnnotateNearest(annotateNearest bool) {
+	i.annotateNearest = annotateNearest
+	i.sa.SetAnnotateNearest(annotateNearest)
+}
+
+// SetFoldVolumes has the liberal album search ignore differences in how
+// volumes are written (e.g. "Vol. 5" versus "Volume 5").
+func (i *Importer) SetFoldVolumes(foldVolumes bool) {
+	i.sa.SetFoldVolumes(foldVolumes)
+}
+
+// SetStripTrackNumbers has us ignore a track-number prefix (e.g. "01 - " or
+// "1. ") on track names when matching them.
+func (i *Importer) SetStripTrackNumbers(stripTrackNumbers bool) {
+	i.sa.SetStripTrackNumbers(stripTrackNumbers)
+}
+
+// SetFoldDiacritics has us ignore accents when comparing artist, album, and
+// track names.
+func (i *Importer) SetFoldDiacritics(foldDiacritics bool) {
+	i.sa.SetFoldDiacritics(foldDiacritics)
+}
+
+// SetTrackMatchDistance has us accept the closest album track whose name is
+// within this many edits of the favorite's when there's no exact match.
+func (i *Importer) SetTrackMatchDistance(trackMatchDistance int) {
+	i.sa.SetTrackMatchDistance(trackMatchDistance)
+}
+
+// SetStrictArtist has us require exact artist-name matches.
+func (i *Importer) SetStrictArtist(strictArtist bool) {
+	i.sa.SetStrictArtist(strictArtist)
+}
+
+// SetAlbumCompleteOnly has us skip an album entirely if any of its favorited
+// tracks can't be found in Spotify, rather than adding the ones that can.
+func (i *Importer) SetAlbumCompleteOnly(albumCompleteOnly bool) {
+	i.albumCompleteOnly = albumCompleteOnly
+}
+
+// SetPreferEarliestAlbum has us choose the earliest-released album when more
+// than one of an artist's albums matches.
+func (i *Importer) SetPreferEarliestAlbum(preferEarliestAlbum bool) {
+	i.sa.SetPreferEarliestAlbum(preferEarliestAlbum)
+}
+
+// SetMissingReportFilepath has us write the favorited tracks that we couldn't
+// add to the given file.
+func (i *Importer) SetMissingReportFilepath(missingReportFilepath string) {
+	i.missingReportFilepath = missingReportFilepath
+}
+
+// SetRetryMissingFilepath has us only try to match the tracks in a report
+// previously written via SetMissingReportFilepath rather than reading the
+// favorites.
+func (i *Importer) SetRetryMissingFilepath(retryMissingFilepath string) {
+	i.retryMissingFilepath = retryMissingFilepath
+}
+
+// SetSkipUnplayable has us skip matched tracks that aren't available in the
+// primary market (and so would be greyed-out in the playlist).
+func (i *Importer) SetSkipUnplayable(skipUnplayable bool) {
+	i.skipUnplayable = skipUnplayable
+}
+
+// SetArtistTriage has us report, for each of the artists that we were told to
+// import, whether they had any favorites in Napster and whether they could be
+// found in Spotify. This explains why an artist didn't contribute anything.
+func (i *Importer) SetArtistTriage(artistTriage bool) {
+	i.artistTriage = artistTriage
+}
+
+// SetArtistBatch has us match the artists in groups of `artistBatchSize`,
+// handing each group's tracks to `cb` (e.g. to add them) before moving on to
+// the next group.
+func (i *Importer) SetArtistBatch(artistBatchSize int, cb ArtistBatchCallback) {
+	i.artistBatchSize = artistBatchSize
+	i.artistBatchCb = cb
+}
+
+// PlaylistTrackCount returns how many tracks were in the target playlist as
+// of the last call to GetTracksToAdd.
+func (i *Importer) PlaylistTrackCount() int {
+	return len(i.playlistTracks)
+}
+
+// Stats returns the counts from the last call to GetTracksToAdd.
+func (i *Importer) Stats() ImportStats {
+	return i.stats
+}
+
+// MatchReport returns how the favorites were matched by the last call to
+// GetTracksToAdd.
+func (i *Importer) MatchReport() *MatchReport {
+	return i.matchReport
+}
+
+type NormalizedTrack struct {
+	ArtistName string `json:"artist_name"`
+	AlbumName  string `json:"album_name"`
+	TrackName  string `json:"track_name"`
+
+	// Isrc identifies the recording, if Napster had it.
+	Isrc string `json:"isrc,omitempty"`
+}
+
+func (nt NormalizedTrack) String() string {
+	return fmt.Sprintf("TRACK<[%s] [%s] [%s]>", nt.ArtistName, nt.AlbumName, nt.TrackName)
+}
+
+// ArtistNames returns all of the artists credited on the track: the artist
+// followed by any featured artists given in the artist name (e.g. "Drake
+// feat. Rihanna") or the track name (e.g. "Song (with Future)"). Napster only
+// gives us the one artist-name, so this is how we know about the others.
+func (nt NormalizedTrack) ArtistNames() (artistNames []string) {
+	artistName, featuredInArtist := splitFeaturedArtists(nt.ArtistName)
+	_, featuredInTrack := splitFeaturedArtists(nt.TrackName)
+
+	artistNames = []string{nt.ArtistName}
+	seen := map[string]bool{nt.ArtistName: true}
+
+	candidates := append([]string{artistName}, featuredInArtist...)
+	candidates = append(candidates, featuredInTrack...)
+
+	for _, candidate := range candidates {
+		if _, found := seen[candidate]; found == true {
+			continue
+		}
+
+		artistNames = append(artistNames, candidate)
+		seen[candidate] = true
+	}
+
+	return artistNames
+}
+
+func (i *Importer) getNapsterNormalizedTrack(track *napster.MetadataTrackDetail) *NormalizedTrack {
+	nt := NormalizedTrack{
+		ArtistName: track.ArtistName,
+		AlbumName:  track.AlbumName,
+		TrackName:  track.Name,
+		Isrc:       track.Isrc,
+	}
+
+	return i.normalizeTrack(nt)
+}
+
+// recordDisplayName returns the normalized (lower-case) form of the given name
+// and remembers the original so that it can be shown to the user.
+func (i *Importer) recordDisplayName(name string) string {
+	normalized := strings.ToLower(name)
+
+	i.displayNamesLock.Lock()
+	defer i.displayNamesLock.Unlock()
+
+	if _, found := i.displayNames[normalized]; found == false {
+		i.displayNames[normalized] = name
+	}
+
+	return normalized
+}
+
+// displayName returns the original form of the given normalized name (or the
+// normalized name if we never saw the original).
+func (i *Importer) displayName(normalized string) string {
+	i.displayNamesLock.RLock()
+	defer i.displayNamesLock.RUnlock()
+
+	if name, found := i.displayNames[normalized]; found == true {
+		return name
+	}
+
+	return normalized
+}
+
+// normalizeTrack returns the normalized form of a track as read from Napster
+// or from one of our files, remembering the original names.
+func (i *Importer) normalizeTrack(nt NormalizedTrack) *NormalizedTrack {
+	return &NormalizedTrack{
+		ArtistName: i.recordDisplayName(nt.ArtistName),
+		AlbumName:  i.recordDisplayName(nt.AlbumName),
+		TrackName:  i.recordDisplayName(nt.TrackName),
+		Isrc:       normalizeIsrc(nt.Isrc),
+	}
+}
+
+// displayTrack returns the given normalized track with its original names.
+func (i *Importer) displayTrack(nt NormalizedTrack) NormalizedTrack {
+	return NormalizedTrack{
+		ArtistName: i.displayName(nt.ArtistName),
+		AlbumName:  i.displayName(nt.AlbumName),
+		TrackName:  i.displayName(nt.TrackName),
+		Isrc:       nt.Isrc,
+	}
+}
+
+// fetchNapsterFavorites reads all of the favorite tracks from Napster.
+func (i *Importer) fetchNapsterFavorites(amc NapsterMemberClient, onlyArtists []string) (normalizedTracks []*NormalizedTrack, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	mc := i.napsterMetadataClient
+	if mc == nil {
+		mc = napster.NewMetadataClient(i.ctx, i.hc, i.napsterApiKey)
+	}
+
+	normalizedTracks = make([]*NormalizedTrack, 0)
+
+	// The pass that each ID was first seen in. We start over if the list
+	// changes while we're paging through it (if we were told to), and the IDs
+	// from an earlier pass aren't duplicates.
+	seenIds := make(map[string]int)
+	pass := 0
+
+	// The last ID of the previous page. Each page after the first overlaps
+	// the previous one by one track so that we can tell if the list shifted
+	// under us (a favorite was added or removed before the offset).
+	lastId := ""
+
+	// This shrinks if Napster can't handle batches this big.
+	napsterBatchSize := i.batchSize
+
+	j := 0
+	counted := 0
+	for {
+		batchSize := napsterBatchSize
+
+		if i.napsterFavoritesLimit > 0 {
+			if counted >= i.napsterFavoritesLimit {
+				iLog.Infof(i.ctx, "Stopping after reading (%d) favorites due to the limit.", j)
+				break
+			}
+
+			// If we're counting everything, don't read more than we need.
+			if i.napsterFavoritesLimitAfterFilter == false && i.napsterFavoritesLimit-counted < batchSize {
+				batchSize = i.napsterFavoritesLimit - counted
+			}
+		}
+
+		var ids []string
+
+		overlap := 0
+		if lastId != "" {
+			overlap = 1
+		}
+
+		err := withNapsterRetry(i.napsterRateLimit, "reading favorite tracks", func() error {
+			favorites, err := amc.GetFavoriteTracks(j-overlap, batchSize+overlap)
+			if err != nil {
+				return err
+			}
+
+			ids = make([]string, len(favorites))
+			for k, info := range favorites {
+				ids[k] = info.Id
+			}
+
+			return nil
+		})
+
+		if err != nil && i.napsterRateLimit.wasTooLarge() == true && napsterBatchSize > NapsterMinBatchSize {
+			napsterBatchSize = shrinkNapsterBatchSize(napsterBatchSize)
+			iLog.Warningf(i.ctx, "Napster couldn't handle reading (%d) favorites at once. Retrying with (%d).", batchSize, napsterBatchSize)
+
+			continue
+		}
+
+		log.PanicIf(err)
+
+		// If the list shifted, the overlap isn't where we expect it. We keep
+		// the whole page in that case (rather than dropping a favorite that we
+		// haven't seen) and don't count the ones that we've already seen as
+		// duplicates.
+		shifted := false
+
+		// The page started `overlap` before the index.
+		pageLen := len(ids)
+
+		if overlap > 0 {
+			if len(ids) == 0 || ids[0] != lastId {
+				if i.napsterRestartOnShift == true && pass < NapsterPagingRestarts {
+					iLog.Warningf(i.ctx, "Napster favorites changed while reading them (at index (%d)). Starting over.", j)
+
+					pass++
+					lastId = ""
+					j = 0
+
+					continue
+				}
+
+				iLog.Warningf(i.ctx, "Napster favorites changed while reading them (at index (%d)). Some favorites may have been missed.", j)
+
+				shifted = true
+			} else {
+				ids = ids[1:]
+			}
+		}
+
+		favoritesLen := len(ids)
+		if favoritesLen == 0 {
+			break
+		}
+
+		lastId = ids[favoritesLen-1]
+
+		iLog.Debugf(i.ctx, "(%d) favorite tracks received starting at index (%d).", favoritesLen, j)
+
+		j += pageLen - overlap
+
+		// Skip tracks that were favorited more than once.
+
+		uniqueIds := make([]string, 0, len(ids))
+		for _, id := range ids {
+			if seenPass, found := seenIds[id]; found == true {
+				if seenPass == pass && shifted == false {
+					i.stats.DuplicateCount++
+				}
+
+				continue
+			}
+
+			uniqueIds = append(uniqueIds, id)
+			seenIds[id] = pass
+		}
+
+		ids = uniqueIds
+
+		if len(ids) == 0 {
+			continue
+		}
+
+		tracks, err := i.readNapsterTrackDetails(mc, ids, &napsterBatchSize)
+		log.PanicIf(err)
+
+		for _, track := range tracks {
+			nt := i.getNapsterNormalizedTrack(&track)
+			normalizedTracks = append(normalizedTracks, nt)
+
+			if i.napsterFavoritesLimitAfterFilter == false || i.isAllowedTrack(nt, onlyArtists) == true {
+				counted++
+			}
+		}
+	}
+
+	return i.limitFavorites(normalizedTracks, onlyArtists), nil
+}
+
+// readNapsterTrackDetails reads the details for the given tracks, at most
+// `batchSize` at a time. If Napster can't handle that many at once, the
+// batch-size is halved (for the caller, too) and the batch is tried again.
+func (i *Importer) readNapsterTrackDetails(mc NapsterMetadataClient, ids []string, batchSize *int) (tracks []napster.MetadataTrackDetail, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	tracks = make([]napster.MetadataTrackDetail, 0, len(ids))
+
+	for k := 0; k < len(ids); {
+		l := k + *batchSize
+		if l > len(ids) {
+			l = len(ids)
+		}
+
+		var batchTracks []napster.MetadataTrackDetail
+
+		err := withNapsterRetry(i.napsterRateLimit, "reading track details", func() (err error) {
+			batchTracks, err = mc.GetTrackDetail(ids[k:l]...)
+			return err
+		})
+
+		if err != nil && i.napsterRateLimit.wasTooLarge() == true && *batchSize > NapsterMinBatchSize {
+			*batchSize = shrinkNapsterBatchSize(*batchSize)
+			iLog.Warningf(i.ctx, "Napster couldn't handle reading the details for (%d) tracks at once. Retrying with (%d).", l-k, *batchSize)
+
+			continue
+		}
+
+		log.PanicIf(err)
+
+		tracks = append(tracks, batchTracks...)
+		k = l
+	}
+
+	return tracks, nil
+}
+
+// dedupeFavorites collapses favorites that have the same (normalized)
+// artist, album, and track names. This happens when the same track was
+// favorited from different releases. The first one's ISRC is kept.
+func (i *Importer) dedupeFavorites(normalizedTracks []*NormalizedTrack) (deduped []*NormalizedTrack, duplicates int) {
+	deduped = make([]*NormalizedTrack, 0, len(normalizedTracks))
+	seen := make(map[NormalizedTrack]bool)
+
+	for _, nt := range normalizedTracks {
+		key := NormalizedTrack{
+			ArtistName: nt.ArtistName,
+			AlbumName:  nt.AlbumName,
+			TrackName:  nt.TrackName,
+		}
+
+		if _, found := seen[key]; found == true {
+			iLog.Debugf(i.ctx, "Skipping duplicate favorite: %s", nt)
+
+			duplicates++
+			continue
+		}
+
+		deduped = append(deduped, nt)
+		seen[key] = true
+	}
+
+	return deduped, duplicates
+}
+
+// limitFavorites truncates the favorites to the configured limit.
+func (i *Importer) limitFavorites(normalizedTracks []*NormalizedTrack, onlyArtists []string) []*NormalizedTrack {
+	if i.napsterFavoritesLimit <= 0 {
+		return normalizedTracks
+	}
+
+	counted := 0
+	for j, nt := range normalizedTracks {
+		if i.napsterFavoritesLimitAfterFilter == false || i.isAllowedTrack(nt, onlyArtists) == true {
+			counted++
+		}
+
+		if counted >= i.napsterFavoritesLimit {
+			return normalizedTracks[:j+1]
+		}
+	}
+
+	return normalizedTracks
+}
+
+// isAllowedTrack returns whether the given track is by one of the artists
+// that we were told to import. Any of the artists credited on the track will
+// do, as long as its (first) artist isn't one that we were told to exclude.
+// The first artist is also checked without any featured artists (e.g. "Drake"
+// for "Drake feat. Rihanna").
+func (i *Importer) isAllowedTrack(nt *NormalizedTrack, onlyArtists []string) bool {
+	if i.isExcludedArtist(nt.ArtistName) == true || i.isExcludedArtist(removeFeaturedArtists(nt.ArtistName)) == true {
+		return false
+	}
+
+	for _, artistName := range nt.ArtistNames() {
+		if i.isAllowedArtist(artistName, onlyArtists) == true {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isAllowedArtist returns whether the given artist is one that we were told
+// to import.
+func (i *Importer) isAllowedArtist(artistName string, onlyArtists []string) bool {
+	if i.isExcludedArtist(artistName) == true {
+		return false
+	} else if i.allArtists == true {
+		return true
+	}
+
+	for _, anAllowed := range onlyArtists {
+		if anAllowed == artistName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isExcludedArtist returns whether the given (lower-case) artist is one that
+// we were told to not import.
+func (i *Importer) isExcludedArtist(artistName string) bool {
+	for _, anExcluded := range i.excludeArtists {
+		if anExcluded == artistName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// groupFavorites filters the favorite tracks down to the artists that we're
+// interested in and groups them by album. Their ISRCs are kept separately.
+func (i *Importer) groupFavorites(normalizedTracks []*NormalizedTrack, onlyArtists []string) (groupedTracks map[albumKeyNames][]string, skipped int) {
+	groupedTracks = make(map[albumKeyNames][]string)
+	i.isrcs = make(map[albumKeyNames]map[string]string)
+
+	for _, nt := range normalizedTracks {
+		// We're going to check a couple of different things and be
+		// discriminating in what we print. This should allow us to
+		// efficiently cherry-pick artists, maybe even one at a time, to add to
+		// the playlist.
+
+		// One of the artists on the track must be in the `onlyArtists` list.
+		// If track is *not* in Spotify and not in the `onlyArtists` list,
+		// skip and print.
+		//
+		// Our complexity is higher because each track is associated with
+		// potentially more than one artist.
+
+		if i.isAllowedTrack(nt, onlyArtists) == false {
+			skipped++
+
+			// When importing every artist, the only ones skipped are the
+			// excluded ones, which we already know about.
+			if i.allArtists == false {
+				i.artistNotices[nt.ArtistName] = true
+			}
+
+			continue
+		}
+
+		// Added.
+
+		akn := albumKeyNames{
+			artistName: nt.ArtistName,
+			albumName:  nt.AlbumName,
+		}
+
+		if groupedTracksList, found := groupedTracks[akn]; found == true {
+			groupedTracks[akn] = append(groupedTracksList, nt.TrackName)
+		} else {
+			groupedTracks[akn] = []string{nt.TrackName}
+		}
+
+		if nt.Isrc != "" {
+			if _, found := i.isrcs[akn]; found == false {
+				i.isrcs[akn] = make(map[string]string)
+			}
+
+			i.isrcs[akn][nt.TrackName] = nt.Isrc
+		}
+	}
+
+	return groupedTracks, skipped
+}
+
+// readNapsterFavorites reads the favorite tracks, either from Napster or from a
+// previously-dumped snapshot, and groups the ones that we're interested in by
+// album.
+func (i *Importer) readNapsterFavorites(amc NapsterMemberClient, onlyArtists []string) (groupedTracks map[albumKeyNames][]string, skipped int, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	var normalizedTracks []*NormalizedTrack
+
+	if i.retryMissingFilepath != "" {
+		iLog.Infof(i.ctx, "Reading missing tracks to retry: [%s]", i.retryMissingFilepath)
+
+		missingTracks, err := ReadMissingReport(i.retryMissingFilepath)
+		log.PanicIf(err)
+
+		normalizedTracks = make([]*NormalizedTrack, len(missingTracks))
+		for j, mt := range missingTracks {
+			normalizedTracks[j] = i.normalizeTrack(mt.NormalizedTrack)
+		}
+
+		// Unless we were told otherwise, retry every artist in the report.
+		if len(onlyArtists) == 0 {
+			seen := make(map[string]bool)
+			for _, nt := range normalizedTracks {
+				if _, found := seen[nt.ArtistName]; found == true {
+					continue
+				}
+
+				onlyArtists = append(onlyArtists, nt.ArtistName)
+				seen[nt.ArtistName] = true
+			}
+		}
+	} else if i.favoritesInFilepath != "" {
+		iLog.Infof(i.ctx, "Reading favorites from snapshot: [%s]", i.favoritesInFilepath)
+
+		snapshotTracks, err := ReadFavoritesSnapshot(i.favoritesInFilepath)
+		log.PanicIf(err)
+
+		normalizedTracks = make([]*NormalizedTrack, len(snapshotTracks))
+		for j, nt := range snapshotTracks {
+			normalizedTracks[j] = i.normalizeTrack(*nt)
+		}
+
+		normalizedTracks = i.limitFavorites(normalizedTracks, onlyArtists)
+	} else {
+		normalizedTracks, err = i.fetchNapsterFavorites(amc, onlyArtists)
+		log.PanicIf(err)
+	}
+
+	if i.dumpFavoritesFilepath != "" {
+		iLog.Infof(i.ctx, "Writing favorites snapshot: [%s]", i.dumpFavoritesFilepath)
+
+		displayTracks := make([]*NormalizedTrack, len(normalizedTracks))
+		for j, nt := range normalizedTracks {
+			dt := i.displayTrack(*nt)
+			displayTracks[j] = &dt
+		}
+
+		err := WriteFavoritesSnapshot(i.dumpFavoritesFilepath, displayTracks)
+		log.PanicIf(err)
+	}
+
+	normalizedTracks, duplicates := i.dedupeFavorites(normalizedTracks)
+	i.stats.DuplicateCount += duplicates
+
+	if i.stats.DuplicateCount > 0 {
+		iLog.Infof(i.ctx, "(%d) duplicate favorites were collapsed.", i.stats.DuplicateCount)
+	}
+
+	groupedTracks, skipped = i.groupFavorites(normalizedTracks, onlyArtists)
+
+	i.stats.FavoritesCount = len(normalizedTracks)
+	i.stats.FilteredCount = skipped
+
+	return groupedTracks, skipped, nil
+}
+
+// collectedTrack is a track that was matched and should be added.
+type collectedTrack struct {
+	id        spotify.ID
+	trackInfo TrackInfo
+}
+
+// artistResult is the outcome of matching all of the albums for one artist.
+type artistResult struct {
+	tracks        []collectedTrack
+	missing       []string
+	missingTracks []*MissingTrack
+	report        *ArtistReport
+	err           error
+
+	// notRun is set if the artist wasn't matched because the context was
+	// done (e.g. we ran out of time).
+	notRun bool
+}
+
+// marketNames returns the primary market followed by the fallback markets.
+func (i *Importer) marketNames() []string {
+	marketNames := []string{i.marketName}
+	seen := map[string]bool{i.marketName: true}
+
+	for _, marketName := range i.fallbackMarketNames {
+		if _, found := seen[marketName]; found == true {
+			continue
+		}
+
+		marketNames = append(marketNames, marketName)
+		seen[marketName] = true
+	}
+
+	return marketNames
+}
+
+// matchAlbum finds the given tracks on the given album in Spotify, trying each
+// of the markets. Unless we were told to combine the markets, we stop at the
+// first market that matches anything. If more than one market is tried,
+// `matchMarkets` has the market that each track was found in (the first, when
+// combining them).
+func (i *Importer) matchAlbum(akn albumKeyNames, tracks []string) (foundTracks map[spotify.ID]string, missingTracks []string, matchMethods map[spotify.ID]string, matchMarkets map[spotify.ID]string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	marketNames := i.marketNames()
+
+	var firstErr error
+	foundTracks = make(map[spotify.ID]string)
+	matchMethods = make(map[spotify.ID]string)
+	matchMarkets = make(map[spotify.ID]string)
+	missingNames := make(map[string]bool)
+	matched := false
+
+	for _, marketName := range marketNames {
+		marketFoundTracks, marketMissingTracks, marketMatchMethods, err := i.matchAlbumInMarket(akn, tracks, marketName)
+		if err != nil {
+			if log.Is(err, ErrSpotifyArtistNotFound) == false && log.Is(err, ErrSpotifyAlbumNotFound) == false {
+				log.Panic(err)
+			}
+
+			if firstErr == nil {
+				firstErr = err
+			}
+
+			continue
+		}
+
+		if len(marketNames) > 1 {
+			iLog.Debugf(i.ctx, "Album [%s] [%s] matched (%d) tracks in market [%s].", akn.artistName, akn.albumName, len(marketFoundTracks), marketName)
+		}
+
+		if i.unionMarkets == false {
+			if len(marketNames) > 1 {
+				for id, _ := range marketFoundTracks {
+					matchMarkets[id] = marketName
+				}
+			}
+
+			return marketFoundTracks, marketMissingTracks, marketMatchMethods, matchMarkets, nil
+		}
+
+		matched = true
+
+		for id, name := range marketFoundTracks {
+			foundTracks[id] = name
+
+			if _, found := matchMethods[id]; found == false {
+				matchMethods[id] = marketMatchMethods[id]
+
+				if len(marketNames) > 1 {
+					matchMarkets[id] = marketName
+				}
+			}
+		}
+
+		for _, name := range marketMissingTracks {
+			missingNames[name] = true
+		}
+	}
+
+	if matched == false {
+		log.Panic(firstErr)
+	}
+
+	// A track is only missing if no market had it.
+
+	for _, name := range foundTracks {
+		delete(missingNames, name)
+	}
+
+	missingTracks = make([]string, 0, len(missingNames))
+	for name, _ := range missingNames {
+		missingTracks = append(missingTracks, name)
+	}
+
+	sort.Strings(missingTracks)
+
+	return foundTracks, missingTracks, matchMethods, matchMarkets, nil
+}
+
+// summarizeMatchMethods returns the distinct match methods, for reporting
+// how an album was matched.
+func summarizeMatchMethods(matchMethods map[spotify.ID]string) string {
+	seen := make(map[string]bool)
+	for _, matchMethod := range matchMethods {
+		seen[matchMethod] = true
+	}
+
+	distinct := make([]string, 0, len(seen))
+	for matchMethod, _ := range seen {
+		distinct = append(distinct, matchMethod)
+	}
+
+	sort.Strings(distinct)
+
+	return strings.Join(distinct, ", ")
+}
+
+// annotateNearestCandidate attaches the closest album or track that we saw to
+// the missing track (if it's missing for one of those reasons).
+func (i *Importer) annotateNearestCandidate(mt *MissingTrack) {
+	var nc NearestCandidate
+	var found bool
+	var err error
+
+	if mt.Reason == MissingReasonAlbumNotFound {
+		nc, found, err = i.sa.NearestAlbum(mt.ArtistName, mt.AlbumName)
+	} else if mt.Reason == MissingReasonTrackNotFound {
+		nc, found, err = i.sa.NearestTrack(mt.ArtistName, mt.AlbumName, mt.TrackName)
+	} else {
+		return
+	}
+
+	if err != nil {
+		iLog.Warningf(i.ctx, "Could not find the closest candidate for [%s] [%s] [%s]: %s", i.displayName(mt.ArtistName), i.displayName(mt.AlbumName), i.displayName(mt.TrackName), err)
+		return
+	} else if found == false {
+		return
+	}
+
+	iLog.Infof(i.ctx, "CLOSEST: [%s] [%s] [%s] (%s) => [%s] SCORE=(%.2f)", i.displayName(mt.ArtistName), i.displayName(mt.AlbumName), i.displayName(mt.TrackName), mt.Reason, nc.Name, nc.Score)
+
+	mt.Nearest = &nc
+}
+
+// importArtist matches all of the favorited albums for one artist. This is the
+// unit of work when artists are processed concurrently, which keeps the
+// searches for a given artist within the same worker.
+func (i *Importer) importArtist(artistName string, albums map[albumKeyNames][]string) (tracks []collectedTrack, missing []string, missingTracks []*MissingTrack, report *ArtistReport, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	tracks = make([]collectedTrack, 0)
+	missing = make([]string, 0)
+	missingTracks = make([]*MissingTrack, 0)
+
+	report = &ArtistReport{
+		ArtistName: i.displayName(artistName),
+		Albums:     make([]*AlbumReport, 0),
+	}
+
+	albumReports := make(map[string]*AlbumReport)
+	getAlbumReport := func(albumName string) *AlbumReport {
+		if alr, found := albumReports[albumName]; found == true {
+			return alr
+		}
+
+		alr := newAlbumReport(i.displayName(albumName))
+
+		albumReports[albumName] = alr
+		report.Albums = append(report.Albums, alr)
+
+		return alr
+	}
+
+	addMissingTracks := func(akn albumKeyNames, trackNames []string, reason string) {
+		alr := getAlbumReport(akn.albumName)
+
+		for _, trackName := range trackNames {
+			if reason == MissingReasonAlbumIncomplete || reason == MissingReasonUnplayable || reason == MissingReasonDuration {
+				alr.Skipped = append(alr.Skipped, i.displayName(trackName))
+			} else {
+				alr.Missing = append(alr.Missing, i.displayName(trackName))
+			}
+
+			mt := &MissingTrack{
+				NormalizedTrack: NormalizedTrack{
+					ArtistName: akn.artistName,
+					AlbumName:  akn.albumName,
+					TrackName:  trackName,
+					Isrc:       i.isrcs[akn][trackName],
+				},
+				Reason: reason,
+			}
+
+			if i.annotateNearest == true {
+				i.annotateNearestCandidate(mt)
+			}
+
+			mt.NormalizedTrack = i.displayTrack(mt.NormalizedTrack)
+
+			missingTracks = append(missingTracks, mt)
+		}
+	}
+
+	// Process the albums in a consistent order so that the output is
+	// deterministic.
+
+	albumNames := make([]string, 0, len(albums))
+	for akn, _ := range albums {
+		albumNames = append(albumNames, akn.albumName)
+	}
+
+	sort.Strings(albumNames)
+
+	artistPhrase := fmt.Sprintf("[%s]", i.displayName(artistName))
+
+	for k, albumName := range albumNames {
+		akn := albumKeyNames{
+			artistName: artistName,
+			albumName:  albumName,
+		}
+
+		albumTracks := albums[akn]
+
+		// If track is not in Spotify and *in* the list, print and add.
+		//
+		// Note that this struct will only have exactly one artist (Napster only returns one).
+
+		albumPhrase := fmt.Sprintf("[%s] [%s]", i.displayName(akn.artistName), i.displayName(akn.albumName))
+
+		// Do the lookup.
+
+		spotifyTrackIds, missingTrackNames, matchMethods, matchMarkets, err := i.matchAlbum(akn, albumTracks)
+		if err == nil || log.Is(err, ErrSpotifyAlbumNotFound) == true {
+			report.FoundInSpotify = true
+		}
+
+		if log.Is(err, ErrSpotifyArtistNotFound) == true {
+			if i.sa.hasMatchStrategy(MatchMethodAlbumSearch) == true {
+				// The artist wasn't found but we still searched for the album
+				// directly, and might have more luck with the next album.
+				missing = append(missing, albumPhrase)
+				addMissingTracks(akn, albumTracks, MissingReasonArtistNotFound)
+				iLog.Warningf(i.ctx, "ARTIST NOT FOUND IN SPOTIFY (AND ALBUM NOT FOUND DIRECTLY): %s", albumPhrase)
+
+				continue
+			}
+
+			missing = append(missing, artistPhrase)
+			iLog.Warningf(i.ctx, "ARTIST NOT FOUND IN SPOTIFY: %s", artistPhrase)
+
+			for _, remainingAlbumName := range albumNames[k:] {
+				remainingAkn := albumKeyNames{
+					artistName: artistName,
+					albumName:  remainingAlbumName,
+				}
+
+				addMissingTracks(remainingAkn, albums[remainingAkn], MissingReasonArtistNotFound)
+			}
+
+			// There's no point in looking at any more of this artist's
+			// albums.
+			break
+		} else if log.Is(err, ErrSpotifyAlbumNotFound) == true {
+			missing = append(missing, albumPhrase)
+			addMissingTracks(akn, albumTracks, MissingReasonAlbumNotFound)
+			iLog.Warningf(i.ctx, "ALBUM NOT FOUND IN SPOTIFY: %s", albumPhrase)
+
+			continue
+		} else if err != nil && i.noFail == true {
+			missing = append(missing, albumPhrase)
+			addMissingTracks(akn, albumTracks, MissingReasonLookupFailed)
+			iLog.Errorf(i.ctx, err, "ALBUM LOOKUP FAILED (SKIPPING): %s", albumPhrase)
+
+			continue
+		} else if err != nil {
+			log.Panic(err)
+		}
+
+		alr := getAlbumReport(akn.albumName)
+		alr.MatchMethod = summarizeMatchMethods(matchMethods)
+
+		for spotifyTrackId, name := range spotifyTrackIds {
+			alr.resolutions[i.displayName(name)] = spotifyTrackId
+		}
+
+		if len(missingTrackNames) > 0 {
+			addMissingTracks(akn, missingTrackNames, MissingReasonTrackNotFound)
+
+			for _, trackName := range missingTrackNames {
+				trackPhrase := fmt.Sprintf("[%s] [%s] [%s]", i.displayName(akn.artistName), i.displayName(akn.albumName), i.displayName(trackName))
+
+				missing = append(missing, trackPhrase)
+				iLog.Warningf(i.ctx, "TRACK NOT FOUND IN SPOTIFY: %s", trackPhrase)
+			}
+		}
+
+		if len(spotifyTrackIds) == 0 {
+			iLog.Warningf(i.ctx, "No favorite tracks from this album were found.")
+			continue
+		}
+
+		if i.albumCompleteOnly == true && len(missingTrackNames) > 0 {
+			incompletePhrase := fmt.Sprintf("%s (INCOMPLETE: %d OF %d TRACKS MISSING)", albumPhrase, len(missingTrackNames), len(albumTracks))
+
+			missing = append(missing, incompletePhrase)
+			iLog.Warningf(i.ctx, "SKIPPING INCOMPLETE ALBUM: %s", incompletePhrase)
+
+			// The tracks that were found weren't added, either.
+
+			foundTrackNames := make([]string, 0, len(spotifyTrackIds))
+			for _, name := range spotifyTrackIds {
+				foundTrackNames = append(foundTrackNames, name)
+			}
+
+			sort.Strings(foundTrackNames)
+
+			addMissingTracks(akn, foundTrackNames, MissingReasonAlbumIncomplete)
+
+			continue
+		}
+
+		if i.skipUnplayable == true && i.marketName != "" {
+			unplayableTrackNames := make([]string, 0)
+
+			for spotifyTrackId, name := range spotifyTrackIds {
+				if playable, known := i.sa.IsTrackPlayable(spotifyTrackId, i.marketName); known == false || playable == true {
+					continue
+				}
+
+				trackPhrase := fmt.Sprintf("[%s] [%s] [%s] (UNPLAYABLE IN %s)", i.displayName(akn.artistName), i.displayName(akn.albumName), i.displayName(name), i.marketName)
+
+				missing = append(missing, trackPhrase)
+				iLog.Warningf(i.ctx, "SKIPPING UNPLAYABLE TRACK: %s", trackPhrase)
+
+				unplayableTrackNames = append(unplayableTrackNames, name)
+				delete(spotifyTrackIds, spotifyTrackId)
+			}
+
+			sort.Strings(unplayableTrackNames)
+			addMissingTracks(akn, unplayableTrackNames, MissingReasonUnplayable)
+		}
+
+		if i.minDuration > 0 || i.maxDuration > 0 {
+			outOfRangeTrackNames := make([]string, 0)
+
+			for spotifyTrackId, name := range spotifyTrackIds {
+				duration, known := i.sa.GetTrackDuration(spotifyTrackId)
+				if known == false || i.isDurationInRange(duration) == true {
+					continue
+				}
+
+				trackPhrase := fmt.Sprintf("[%s] [%s] [%s] (DURATION %s)", i.displayName(akn.artistName), i.displayName(akn.albumName), i.displayName(name), duration)
+
+				missing = append(missing, trackPhrase)
+				iLog.Warningf(i.ctx, "SKIPPING TRACK OUTSIDE OF DURATION RANGE: %s", trackPhrase)
+
+				outOfRangeTrackNames = append(outOfRangeTrackNames, name)
+				delete(spotifyTrackIds, spotifyTrackId)
+			}
+
+			sort.Strings(outOfRangeTrackNames)
+			addMissingTracks(akn, outOfRangeTrackNames, MissingReasonDuration)
+		}
+
+		// If track is already in Spotify, don't do or print anything.
 
-	marketName string
-}
+		for spotifyTrackId, name := range spotifyTrackIds {
+			if _, found := i.spotifyIndex[spotifyTrackId]; found == true {
+				iLog.Infof(nil, "Track already in playlist: [%s]", spotifyTrackId)
+				alr.AlreadyPresent = append(alr.AlreadyPresent, i.displayName(name))
 
-// NewImporter creates an Importer instance. `marketName` can be the name of a
-// market to filter albums by or empty.
-func NewImporter(ctx context.Context, napsterApiKey, napsterSecretKey, napsterUsername, napsterPassword string, spotifyAuth *SpotifyContext, spotifyCache *SpotifyCache, batchSize int, marketName string) *Importer {
-	hc := new(http.Client)
+				if marketName := matchMarkets[spotifyTrackId]; marketName != "" {
+					alr.Markets[i.displayName(name)] = marketName
+				}
 
-	spotifyIndex := make(map[spotify.ID]bool)
-	artistNotices := make(map[string]bool)
+				alr.alreadyPresentIds = append(alr.alreadyPresentIds, spotifyTrackId)
 
-	sa := NewSpotifyAdapter(ctx, spotifyAuth)
+				continue
+			}
 
-	return &Importer{
-		ctx: ctx,
-		hc:  hc,
+			alr.ToAdd = append(alr.ToAdd, i.displayName(name))
 
-		napsterApiKey:    napsterApiKey,
-		napsterSecretKey: napsterSecretKey,
-		napsterUsername:  napsterUsername,
-		napsterPassword:  napsterPassword,
+			matchMethod := matchMethods[spotifyTrackId]
+			marketName := matchMarkets[spotifyTrackId]
 
-		spotifyAuth: spotifyAuth,
-		sc:          spotifyCache,
-		sa:          sa,
+			if marketName != "" {
+				alr.Markets[i.displayName(name)] = marketName
+			}
 
-		batchSize: batchSize,
+			iLog.Infof(i.ctx, "WILL ADD: [%s] [%s] [%s] -> [%s] (%s)", i.displayName(akn.artistName), i.displayName(akn.albumName), i.displayName(name), spotifyTrackId, matchMethod)
+
+			ct := collectedTrack{
+				id: spotifyTrackId,
+				trackInfo: TrackInfo{
+					ArtistName:  i.displayName(akn.artistName),
+					AlbumName:   i.displayName(akn.albumName),
+					TitleName:   i.displayName(name),
+					MatchMethod: matchMethod,
+					MarketName:  marketName,
+				},
+			}
 
-		spotifyIndex:  spotifyIndex,
-		artistNotices: artistNotices,
+			tracks = append(tracks, ct)
+		}
+	}
 
-		marketName: marketName,
+	for _, alr := range report.Albums {
+		sort.Strings(alr.ToAdd)
+		sort.Strings(alr.AlreadyPresent)
 	}
-}
 
-type NormalizedTrack struct {
-	ArtistName string
-	AlbumName  string
-	TrackName  string
+	return tracks, missing, missingTracks, report, nil
 }
 
-func (nt NormalizedTrack) String() string {
-	return fmt.Sprintf("TRACK<[%s] [%s] [%s]>", nt.ArtistName, nt.AlbumName, nt.TrackName)
-}
+// failedArtistResult records all of the favorites for an artist that couldn't
+// be processed as missing so that we can carry on with the others.
+func (i *Importer) failedArtistResult(artistName string, albums map[albumKeyNames][]string, cause error) artistResult {
+	iLog.Errorf(i.ctx, cause, "ARTIST LOOKUP FAILED (SKIPPING): [%s]", i.displayName(artistName))
 
-func (i *Importer) getNapsterNormalizedTrack(track *napster.MetadataTrackDetail) *NormalizedTrack {
-	artistName := strings.ToLower(track.ArtistName)
-	trackName := strings.ToLower(track.Name)
-	albumName := strings.ToLower(track.AlbumName)
+	i.stats.FailedArtistCount++
 
-	return &NormalizedTrack{
-		TrackName:  trackName,
-		AlbumName:  albumName,
-		ArtistName: artistName,
+	ar := artistResult{
+		missing:       make([]string, 0),
+		missingTracks: make([]*MissingTrack, 0),
+		report: &ArtistReport{
+			ArtistName: i.displayName(artistName),
+			Albums:     make([]*AlbumReport, 0),
+		},
 	}
-}
 
-func (i *Importer) readNapsterFavorites(amc *napster.AuthenticatedMemberClient, onlyArtists []string) (groupedTracks map[albumKeyNames][]string, skipped int, err error) {
-	defer func() {
-		if state := recover(); state != nil {
-			err = log.Wrap(state.(error))
-		}
-	}()
+	for akn, trackNames := range albums {
+		ar.missing = append(ar.missing, fmt.Sprintf("[%s] [%s]", i.displayName(akn.artistName), i.displayName(akn.albumName)))
 
-	mc := napster.NewMetadataClient(i.ctx, i.hc, i.napsterApiKey)
+		alr := newAlbumReport(i.displayName(akn.albumName))
+		ar.report.Albums = append(ar.report.Albums, alr)
 
-	groupedTracks = make(map[albumKeyNames][]string)
-	j := 0
-	for {
-		favorites, err := amc.GetFavoriteTracks(j, i.batchSize)
-		log.PanicIf(err)
+		for _, trackName := range trackNames {
+			alr.Missing = append(alr.Missing, i.displayName(trackName))
 
-		favoritesLen := len(favorites)
-		if favoritesLen == 0 {
-			break
+			mt := &MissingTrack{
+				NormalizedTrack: i.displayTrack(NormalizedTrack{
+					ArtistName: akn.artistName,
+					AlbumName:  akn.albumName,
+					TrackName:  trackName,
+				}),
+				Reason: MissingReasonLookupFailed,
+			}
+
+			ar.missingTracks = append(ar.missingTracks, mt)
 		}
+	}
 
-		iLog.Debugf(i.ctx, "(%d) favorite tracks received starting at index (%d).", favoritesLen, j)
+	sort.Strings(ar.missing)
 
-		j += favoritesLen
+	sort.Slice(ar.report.Albums, func(j, k int) bool {
+		return ar.report.Albums[j].AlbumName < ar.report.Albums[k].AlbumName
+	})
 
-		ids := make([]string, favoritesLen)
-		for i, info := range favorites {
-			ids[i] = info.Id
-		}
+	return ar
+}
 
-		tracks, err := mc.GetTrackDetail(ids...)
-		log.PanicIf(err)
+// matchArtists matches the favorited albums for the given artists with a pool
+// of workers. Each result is stored at the same position as its artist so that
+// we can collect them in order.
+func (i *Importer) matchArtists(artistNames []string, byArtist map[string]map[albumKeyNames][]string) (results []artistResult) {
+	concurrency := i.artistConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
 
-		for _, track := range tracks {
-			// We're going to check a couple of different things and be
-			// discriminating in what we print. This should allow us to
-			// efficiently cherry-pick artists, maybe even one at a time, to
-			// add to the playlist.
+	var ac *adaptiveConcurrency
+	if i.adaptiveConcurrency == true && concurrency > 1 {
+		ac = newAdaptiveConcurrency(concurrency)
 
-			nt := i.getNapsterNormalizedTrack(&track)
+		isc := i.spotifyAuth.InstrumentedClient()
+		isc.SetRateLimitObserver(ac.observe)
 
-			// One of the artists on the track must be in the `onlyArtists`
-			// list. If track is *not* in Spotify and not in the `onlyArtists`
-			// list, skip and print.
-			//
-			// Our complexity is higher because each track is associated with
-			// potentially more than one artist.
-
-			found := false
-			for _, anAllowed := range onlyArtists {
-				if anAllowed == nt.ArtistName {
-					found = true
-					break
-				}
-			}
+		defer func() {
+			isc.SetRateLimitObserver(nil)
+			iLog.Debugf(i.ctx, "Concurrency was (%d) of (%d) at the end of the group.", ac.currentLimit(), concurrency)
+		}()
+	}
 
-			if found == false {
-				skipped++
+	results = make([]artistResult, len(artistNames))
+	jobs := make(chan int)
+	wg := new(sync.WaitGroup)
 
-				i.artistNotices[nt.ArtistName] = true
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
 
-				continue
-			}
+		go func() {
+			defer wg.Done()
 
-			// Added.
+			for j := range jobs {
+				artistName := artistNames[j]
 
-			akn := albumKeyNames{
-				artistName: nt.ArtistName,
-				albumName:  nt.AlbumName,
-			}
+				if i.ctx.Err() != nil {
+					results[j] = artistResult{
+						notRun: true,
+					}
 
-			if groupedTracksList, found := groupedTracks[akn]; found == true {
-				groupedTracks[akn] = append(groupedTracksList, nt.TrackName)
-			} else {
-				groupedTracks[akn] = []string{nt.TrackName}
+					continue
+				}
+
+				if ac != nil {
+					ac.acquire()
+				}
+
+				tracks, artistMissing, artistMissingTracks, artistReport, err := i.importArtist(artistName, byArtist[artistName])
+
+				if ac != nil {
+					ac.release()
+				}
+
+				results[j] = artistResult{
+					tracks:        tracks,
+					missing:       artistMissing,
+					missingTracks: artistMissingTracks,
+					report:        artistReport,
+					err:           err,
+				}
 			}
-		}
+		}()
 	}
 
-	return groupedTracks, skipped, nil
+	for j, _ := range artistNames {
+		jobs <- j
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	return results
 }
 
-func (i *Importer) importFavorites(amc *napster.AuthenticatedMemberClient, onlyArtists []string, collector *trackCollector, missing []string) (count int, skipped int, missingUpdated []string, err error) {
+func (i *Importer) importFavorites(amc NapsterMemberClient, onlyArtists []string, collector *trackCollector, missing []string) (count int, skipped int, missingUpdated []string, err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	if len(onlyArtists) == 0 {
+	// When retrying, the artists can come from the report.
+	if len(onlyArtists) == 0 && i.retryMissingFilepath == "" && i.allArtists == false {
 		log.Panic(fmt.Errorf("at least one artist must be given to import"))
 	}
 
@@ -205,87 +1628,120 @@ func (i *Importer) importFavorites(amc *napster.AuthenticatedMemberClient, onlyA
 	log.PanicIf(err)
 
 	if len(groupedTracks) == 0 {
-		return 0, 0, nil, nil
+		return 0, skipped, missing, nil
 	}
 
-	missingArtists := make(map[string]bool)
-	missingAlbums := make(map[albumKeyNames]bool)
+	// Group the albums by artist.
 
-	added := 0
+	byArtist := make(map[string]map[albumKeyNames][]string)
 	for akn, tracks := range groupedTracks {
-		// If track is not in Spotify and *in* the list, print and add.
-		//
-		// Note that this struct will only have exactly one artist (Napster only returns one).
+		if albums, found := byArtist[akn.artistName]; found == true {
+			albums[akn] = tracks
+		} else {
+			byArtist[akn.artistName] = map[albumKeyNames][]string{akn: tracks}
+		}
+	}
+
+	artistNames := make([]string, 0, len(byArtist))
+	for artistName, _ := range byArtist {
+		artistNames = append(artistNames, artistName)
+	}
 
-		artistPhrase := fmt.Sprintf("[%s]", akn.artistName)
-		albumPhrase := fmt.Sprintf("[%s] [%s]", akn.artistName, akn.albumName)
+	sort.Strings(artistNames)
 
-		// Short circuit if we've previously missed on this artist or album.
+	// Process the artists in groups (all of them in one group unless we were
+	// told otherwise). Each group's tracks are handed off before moving on to
+	// the next so that progress is kept.
 
-		if _, found := missingArtists[akn.artistName]; found == true {
-			continue
+	groupSize := len(artistNames)
+	if i.artistBatchSize > 0 {
+		groupSize = i.artistBatchSize
+	}
+
+	added := 0
+	remaining := 0
+	for k := 0; k < len(artistNames); k += groupSize {
+		if i.ctx.Err() != nil {
+			remaining += len(artistNames) - k
+			break
 		}
 
-		if _, found := missingAlbums[akn]; found == true {
-			continue
+		l := k + groupSize
+		if l > len(artistNames) {
+			l = len(artistNames)
 		}
 
-		// Do the lookup.
+		results := i.matchArtists(artistNames[k:l], byArtist)
 
-		spotifyTrackIds, missingTrackNames, err := i.sa.GetSpotifyTrackIdsWithNames(akn.artistName, akn.albumName, tracks, i.marketName)
-		if log.Is(err, ErrSpotifyArtistNotFound) == true {
-			if _, found := missingArtists[akn.artistName]; found == false {
-				missing = append(missing, artistPhrase)
-				missingArtists[akn.artistName] = true
+		groupIds := make(map[spotify.ID]TrackInfo)
+		for j, ar := range results {
+			if ar.notRun == true {
+				iLog.Debugf(i.ctx, "Artist not matched: [%s]", artistNames[k+j])
+				remaining++
 
-				iLog.Warningf(i.ctx, "ARTIST NOT FOUND IN SPOTIFY: %s", artistPhrase)
+				continue
+			} else if ar.err != nil && i.noFail == true {
+				artistName := artistNames[k+j]
+				ar = i.failedArtistResult(artistName, byArtist[artistName], ar.err)
 			}
 
-			continue
-		} else if log.Is(err, ErrSpotifyAlbumNotFound) == true {
-			if _, found := missingAlbums[akn]; found == false {
-				missing = append(missing, albumPhrase)
-				missingAlbums[akn] = true
+			log.PanicIf(ar.err)
 
-				iLog.Warningf(i.ctx, "ALBUM NOT FOUND IN SPOTIFY: %s", albumPhrase)
-			}
+			missing = append(missing, ar.missing...)
+			collector.missing = append(collector.missing, ar.missingTracks...)
+			collector.report.Artists = append(collector.report.Artists, ar.report)
 
-			continue
-		} else if err != nil {
-			log.Panic(err)
-		}
+			for _, ct := range ar.tracks {
+				if i.dedupeSource == true {
+					nt := NormalizedTrack{
+						ArtistName: ct.trackInfo.ArtistName,
+						AlbumName:  ct.trackInfo.AlbumName,
+						TrackName:  ct.trackInfo.TitleName,
+					}
 
-		if len(missingTrackNames) > 0 {
-			for _, trackName := range missingTrackNames {
-				trackPhrase := fmt.Sprintf("[%s] [%s] [%s]", akn.artistName, akn.albumName, trackName)
+					collector.sources[ct.id] = append(collector.sources[ct.id], nt)
+				}
 
-				missing = append(missing, trackPhrase)
-				iLog.Warningf(i.ctx, "TRACK NOT FOUND IN SPOTIFY: %s", trackPhrase)
-			}
-		}
+				if _, found := collector.ids[ct.id]; found == true {
+					continue
+				}
 
-		if len(spotifyTrackIds) == 0 {
-			iLog.Warningf(i.ctx, "No favorite tracks from this album were found.")
-			continue
+				groupIds[ct.id] = ct.trackInfo
+			}
 		}
 
-		// If track is already in Spotify, don't do or print anything.
+		if i.marketName != "" && i.spotifyAuth.HttpClient != nil && len(groupIds) > 0 {
+			relinkedIds, err := i.relinkTracks(groupIds)
+			if err != nil && i.noFail == true {
+				iLog.Errorf(i.ctx, err, "Could not relink tracks. Adding them as they are.")
+			} else {
+				log.PanicIf(err)
 
-		for spotifyTrackId, name := range spotifyTrackIds {
-			if _, found := i.spotifyIndex[spotifyTrackId]; found == true {
-				iLog.Infof(nil, "Track already in playlist: [%s]", spotifyTrackId)
-				continue
+				groupIds = relinkedIds
 			}
+		}
 
-			iLog.Infof(i.ctx, "WILL ADD: [%s] [%s] [%s] -> [%s]", akn.artistName, akn.albumName, name, spotifyTrackId)
-			collector.ids[spotifyTrackId] = TrackInfo{
-				ArtistName: akn.artistName,
-				AlbumName:  akn.albumName,
-				TitleName:  name,
+		for id, ti := range groupIds {
+			if _, found := collector.ids[id]; found == true {
+				delete(groupIds, id)
+				continue
 			}
 
+			collector.ids[id] = ti
 			added++
 		}
+
+		if i.artistBatchCb != nil {
+			iLog.Infof(i.ctx, "Handing off (%d) tracks for artists (%d) through (%d) of (%d).", len(groupIds), k+1, l, len(artistNames))
+
+			err := i.artistBatchCb(groupIds)
+			log.PanicIf(err)
+		}
+	}
+
+	if remaining > 0 {
+		iLog.Warningf(i.ctx, "Stopped early (%s): (%d) of (%d) artists weren't matched.", i.ctx.Err(), remaining, len(artistNames))
+		i.stats.RemainingArtistCount = remaining
 	}
 
 	iLog.Debugf(i.ctx, "STATS: ADDED=(%d) SKIPPED=(%d) MISSING=(%d)", added, skipped, len(missing))
@@ -316,25 +1772,191 @@ func (i *Importer) preloadExisting(spotifyPlaylistName, spotifyMarketName string
 		}
 	}()
 
-	spotifyUserId, err := i.sc.GetSpotifyCurrentUserId()
+	spotifyUserId, err := i.sc.GetSpotifyUserId()
 	log.PanicIf(err)
 
 	spotifyPlaylistId, err := i.sc.GetSpotifyPlaylistId(spotifyUserId, spotifyPlaylistName)
 	log.PanicIf(err)
 
-	spotifyTracks, err := i.sa.ReadSpotifyPlaylist(spotifyPlaylistId, spotifyUserId, spotifyMarketName)
+	playlistTracks, err := i.sa.ReadSpotifyPlaylistInfo(spotifyPlaylistId, spotifyUserId, spotifyMarketName)
 	log.PanicIf(err)
 
+	i.playlistTracks = playlistTracks
+
+	spotifyTracks := make([]spotify.ID, 0, len(playlistTracks))
+	for id, _ := range playlistTracks {
+		spotifyTracks = append(spotifyTracks, id)
+	}
+
 	err = i.buildSpotifyIndex(spotifyTracks)
 	log.PanicIf(err)
 
+	if i.skipIfInAnyPlaylist == true {
+		playlists, err := i.sc.GetSpotifyPlaylists(spotifyUserId)
+		log.PanicIf(err)
+
+		for _, p := range playlists {
+			if p.ID == spotifyPlaylistId {
+				continue
+			}
+
+			iLog.Debugf(i.ctx, "Preloading tracks from other playlist: [%s]", p.Name)
+
+			spotifyTracks, err := i.sa.ReadSpotifyPlaylist(p.ID, p.Owner.ID, spotifyMarketName)
+			log.PanicIf(err)
+
+			err = i.buildSpotifyIndex(spotifyTracks)
+			log.PanicIf(err)
+		}
+	}
+
+	return nil
+}
+
+// relinkTracks returns the given tracks with the IDs that Spotify has
+// relinked them to for the primary market so that the ones that we add are
+// playable there. If more than one track ends up with the same ID, the first
+// (by original ID) is kept.
+func (i *Importer) relinkTracks(tracks map[spotify.ID]TrackInfo) (relinkedTracks map[spotify.ID]TrackInfo, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ids := make([]spotify.ID, 0, len(tracks))
+	for id, _ := range tracks {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(j, k int) bool {
+		return ids[j] < ids[k]
+	})
+
+	relinked, err := i.sa.RelinkTracks(ids, i.marketName)
+	log.PanicIf(err)
+
+	relinkedTracks = make(map[spotify.ID]TrackInfo, len(tracks))
+	for _, id := range ids {
+		ti := tracks[id]
+
+		relinkedId, found := relinked[id]
+		if found == false {
+			relinkedId = id
+		} else if _, found := i.spotifyIndex[relinkedId]; found == true {
+			iLog.Infof(i.ctx, "Relinked track already in playlist: [%s] -> [%s]", id, relinkedId)
+			i.stats.AlreadyPresentCount++
+
+			i.relinkedPresentIds = append(i.relinkedPresentIds, relinkedId)
+
+			continue
+		} else {
+			iLog.Debugf(i.ctx, "Using relinked track for market [%s]: [%s] -> [%s] %s", i.marketName, id, relinkedId, ti)
+		}
+
+		if existing, found := relinkedTracks[relinkedId]; found == true {
+			iLog.Infof(i.ctx, "Relinked track is a duplicate: [%s] -> [%s] %s (keeping %s)", id, relinkedId, ti, existing)
+			i.stats.DuplicateCount++
+
+			continue
+		}
+
+		relinkedTracks[relinkedId] = ti
+	}
+
+	return relinkedTracks, nil
+}
+
+// logArtistTriage reports, for each artist that we were told to import,
+// whether they had favorites in Napster and whether they were found in
+// Spotify (as part of the summary). Artists without favorites weren't
+// searched for, so we search for them now.
+func (i *Importer) logArtistTriage(onlyArtists []string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	artistReports := make(map[string]*ArtistReport)
+	for _, ar := range i.matchReport.Artists {
+		artistReports[strings.ToLower(ar.ArtistName)] = ar
+	}
+
+	yesNo := func(value bool) string {
+		if value == true {
+			return "yes"
+		}
+
+		return "no"
+	}
+
+	for _, artistName := range onlyArtists {
+		hadFavorites := false
+		foundInSpotify := false
+
+		if ar, found := artistReports[artistName]; found == true {
+			hadFavorites = true
+			foundInSpotify = ar.FoundInSpotify
+		} else {
+			_, err := i.sa.searchSpotifyArtists(artistName)
+			if err == nil {
+				foundInSpotify = true
+			} else if log.Is(err, ErrSpotifyArtistNotFound) == false {
+				log.Panic(err)
+			}
+		}
+
+		i.summaryInfof("ARTIST TRIAGE: [%s] NAPSTER-FAVORITES=[%s] FOUND-IN-SPOTIFY=[%s]", artistName, yesNo(hadFavorites), yesNo(foundInSpotify))
+	}
+
 	return nil
 }
 
 // trackCollector Keeps track of the tracks that need to be added. We're going
 // to minimize our requests.
 type trackCollector struct {
-	ids map[spotify.ID]TrackInfo
+	ids     map[spotify.ID]TrackInfo
+	missing []*MissingTrack
+	report  *MatchReport
+
+	// sources are all of the favorites that matched each track (only when
+	// we were told to look for ones that matched the same track).
+	sources map[spotify.ID][]NormalizedTrack
+}
+
+// reportSharedTracks adds the Spotify tracks that more than one favorite
+// matched to the report and logs them.
+func (i *Importer) reportSharedTracks(collector *trackCollector) {
+	ids := make([]string, 0)
+	for id, sources := range collector.sources {
+		if len(sources) > 1 {
+			ids = append(ids, string(id))
+		}
+	}
+
+	sort.Strings(ids)
+
+	for _, idRaw := range ids {
+		id := spotify.ID(idRaw)
+		sources := collector.sources[id]
+
+		st := &SharedTrack{
+			TrackId: id,
+			Sources: sources,
+		}
+
+		collector.report.SharedTracks = append(collector.report.SharedTracks, st)
+
+		phrases := make([]string, len(sources))
+		for j, nt := range sources {
+			phrases[j] = fmt.Sprintf("[%s] [%s] [%s]", nt.ArtistName, nt.AlbumName, nt.TrackName)
+		}
+
+		i.summaryWarningf("SAME SPOTIFY TRACK FOR (%d) FAVORITES: [%s] %s", len(sources), id, strings.Join(phrases, ", "))
+	}
+
+	i.stats.SharedTrackCount = len(ids)
 }
 
 func (i *Importer) GetTracksToAdd(spotifyPlaylistName string, onlyArtists []string, spotifyMarketName string) (tracks map[spotify.ID]TrackInfo, err error) {
@@ -349,25 +1971,70 @@ func (i *Importer) GetTracksToAdd(spotifyPlaylistName string, onlyArtists []stri
 		onlyArtists[i] = strings.ToLower(a)
 	}
 
+	if i.searchCacheFilepath != "" {
+		err := i.sa.LoadSearchCache(i.searchCacheFilepath, i.searchCacheNegativeTtl)
+		log.PanicIf(err)
+
+		i.sa.SetSearchCacheFlush(i.searchCacheFilepath, i.searchCacheFlushEvery, i.searchCacheFlushInterval)
+
+		// Save whatever we looked up even if we fail part-way through.
+		defer func() {
+			if err := i.sa.SaveSearchCache(i.searchCacheFilepath); err != nil {
+				iLog.Errorf(i.ctx, err, "Could not save the search cache.")
+			}
+		}()
+	}
+
 	if err := i.preloadExisting(spotifyPlaylistName, spotifyMarketName); err != nil {
-		log.Panic(err)
+		if i.ignorePreloadErrors == false {
+			log.Panic(err)
+		}
+
+		iLog.Errorf(i.ctx, err, "Could not read the tracks already in the playlist. Continuing without them; tracks that are already there may be added again.")
+
+		// Don't trust whatever was read before the failure. We'll still
+		// avoid adding the same track twice in this run.
+
+		i.spotifyIndex = make(map[spotify.ID]bool)
+		i.playlistTracks = make(map[spotify.ID]TrackInfo)
 	}
 
 	iLog.Infof(i.ctx, "Reading Napster favorites.")
 
-	a := napster.NewAuthenticator(i.ctx, i.hc, i.napsterApiKey, i.napsterSecretKey)
-	a.SetUserCredentials(i.napsterUsername, i.napsterPassword)
-
 	collector := new(trackCollector)
 	collector.ids = make(map[spotify.ID]TrackInfo)
+	collector.missing = make([]*MissingTrack, 0)
+	collector.sources = make(map[spotify.ID][]NormalizedTrack)
+
+	collector.report = &MatchReport{
+		Artists: make([]*ArtistReport, 0),
+	}
 
-	amc := napster.NewAuthenticatedMemberClient(i.ctx, i.hc, a)
+	i.matchReport = collector.report
+
+	var amc NapsterMemberClient
+	if i.favoritesInFilepath == "" && i.retryMissingFilepath == "" {
+		a := napster.NewAuthenticator(i.ctx, i.hc, i.napsterApiKey, i.napsterSecretKey)
+		a.SetUserCredentials(i.napsterUsername, i.napsterPassword)
+
+		amc = napster.NewAuthenticatedMemberClient(i.ctx, i.hc, a)
+	}
 
 	missing := make([]string, 0)
 
+	i.stats = ImportStats{}
+	i.relinkedPresentIds = make([]spotify.ID, 0)
+
 	_, skipped, missing, err := i.importFavorites(amc, onlyArtists, collector, missing)
 	log.PanicIf(err)
 
+	for _, ar := range collector.report.Artists {
+		for _, alr := range ar.Albums {
+			i.stats.AlreadyPresentCount += len(alr.AlreadyPresent)
+			i.stats.MissingCount += len(alr.Missing) + len(alr.Skipped)
+		}
+	}
+
 	if len(i.artistNotices) > 0 {
 		ignoredArtists := make([]string, len(i.artistNotices))
 
@@ -381,17 +2048,70 @@ func (i *Importer) GetTracksToAdd(spotifyPlaylistName string, onlyArtists []stri
 		ans.Sort()
 
 		for _, an := range ans {
-			iLog.Warningf(i.ctx, "IGNORING ARTIST: [%s]", an)
+			i.summaryWarningf("IGNORING ARTIST: [%s]", i.displayName(an))
 		}
 	}
 
 	len_ := len(collector.ids)
 
-	iLog.Infof(i.ctx, "(%d) tracks found to import.", len_)
-	iLog.Infof(i.ctx, "(%d) tracks skipped.", skipped)
+	i.summaryInfof("(%d) tracks found to import.", len_)
+	i.summaryInfof("(%d) tracks skipped.", skipped)
+
+	// Summarize how the tracks were matched so that the less-trustworthy
+	// matches can be reviewed.
+
+	methodCounts := make(map[string]int)
+	for _, ti := range collector.ids {
+		methodCounts[ti.MatchMethod]++
+	}
+
+	methods := make([]string, 0, len(methodCounts))
+	for method, _ := range methodCounts {
+		methods = append(methods, method)
+	}
+
+	sort.Strings(methods)
+
+	for _, method := range methods {
+		i.summaryInfof("(%d) tracks matched via [%s].", methodCounts[method], method)
+	}
+
+	// When more than one market was tried, summarize which of them the
+	// tracks came from.
+
+	marketCounts := collector.report.countMarkets()
+
+	marketNames := make([]string, 0, len(marketCounts))
+	for marketName, _ := range marketCounts {
+		marketNames = append(marketNames, marketName)
+	}
+
+	sort.Strings(marketNames)
+
+	for _, marketName := range marketNames {
+		i.summaryInfof("(%d) tracks matched in market [%s].", marketCounts[marketName], marketName)
+	}
 
 	for j, missingPhrase := range missing {
-		iLog.Infof(i.ctx, "NOT FOUND: (%d) %s", j, missingPhrase)
+		i.summaryInfof("NOT FOUND: (%d) %s", j, missingPhrase)
+	}
+
+	if i.dedupeSource == true {
+		i.reportSharedTracks(collector)
+	}
+
+	if i.artistTriage == true {
+		err := i.logArtistTriage(onlyArtists)
+		log.PanicIf(err)
+	}
+
+	i.missingTracks = collector.missing
+
+	if i.missingReportFilepath != "" {
+		iLog.Infof(i.ctx, "Writing (%d) missing tracks to report: [%s]", len(collector.missing), i.missingReportFilepath)
+
+		err := WriteMissingReport(i.missingReportFilepath, collector.missing)
+		log.PanicIf(err)
 	}
 
 	return collector.ids, nil
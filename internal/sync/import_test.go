@@ -0,0 +1,1277 @@
+package gnsssync
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// newTestCatalog returns a client having one artist with one album and an
+// empty playlist to add to.
+func newTestCatalog() *fakeSpotifyClient {
+	fsc := newFakeSpotifyClient()
+
+	fsc.addArtist("artist1", "The Band")
+	fsc.addAlbum("artist1", "album1", "First Album", "album", "1990-01-01", "Opener", "Closer")
+	fsc.addPlaylist("target", "Target", fsc.userId)
+
+	return fsc
+}
+
+func TestGetTracksToAdd_SkipIfInAnyPlaylist(t *testing.T) {
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+	}
+
+	for _, skipIfInAnyPlaylist := range []bool{false, true} {
+		fsc := newTestCatalog()
+		fsc.addPlaylist("other", "Other", fsc.userId, "album1-1")
+
+		i := newTestImporter(t, fsc, "", favorites...)
+		i.SetSkipIfInAnyPlaylist(skipIfInAnyPlaylist)
+
+		tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+		if err != nil {
+			t.Fatalf("Could not get tracks: %s", err)
+		}
+
+		if _, found := tracks["album1-2"]; found == false {
+			t.Fatalf("Track only in the other playlist should never be skipped (%v).", skipIfInAnyPlaylist)
+		}
+
+		_, found := tracks[spotify.ID("album1-1")]
+		if skipIfInAnyPlaylist == true && found == true {
+			t.Fatalf("Track in the other playlist should have been skipped.")
+		} else if skipIfInAnyPlaylist == false && found == false {
+			t.Fatalf("Track in the other playlist should only be skipped when asked.")
+		}
+	}
+}
+
+func TestGetTracksToAdd_ArtistConcurrencyOrdered(t *testing.T) {
+	artistNames := []string{"Zed", "Alpha", "Mike", "Bravo", "Yankee", "Charlie", "Xray", "Delta"}
+
+	fsc := newFakeSpotifyClient()
+	fsc.addPlaylist("target", "Target", fsc.userId)
+
+	favorites := make([]NormalizedTrack, 0)
+	onlyArtists := make([]string, 0)
+	for j, artistName := range artistNames {
+		artistId := spotify.ID(fmt.Sprintf("artist%d", j))
+		albumId := spotify.ID(fmt.Sprintf("album%d", j))
+
+		fsc.addArtist(artistId, artistName)
+		fsc.addAlbum(artistId, albumId, artistName+" Album", "album", "2000-01-01", "Song A", "Song B")
+
+		favorites = append(favorites,
+			NormalizedTrack{ArtistName: artistName, AlbumName: artistName + " Album", TrackName: "Song A"},
+			NormalizedTrack{ArtistName: artistName, AlbumName: artistName + " Album", TrackName: "Song B"})
+
+		onlyArtists = append(onlyArtists, artistName)
+	}
+
+	run := func(artistConcurrency int) (tracks map[spotify.ID]TrackInfo, reportedArtists []string) {
+		i := newTestImporter(t, fsc, "", favorites...)
+		i.SetArtistConcurrency(artistConcurrency)
+
+		tracks, err := i.GetTracksToAdd("Target", append([]string{}, onlyArtists...), "")
+		if err != nil {
+			t.Fatalf("Could not get tracks (%d): %s", artistConcurrency, err)
+		}
+
+		reportedArtists = make([]string, 0)
+		for _, ar := range i.MatchReport().Artists {
+			reportedArtists = append(reportedArtists, ar.ArtistName)
+		}
+
+		return tracks, reportedArtists
+	}
+
+	sequentialTracks, sequentialArtists := run(1)
+
+	expectedArtists := append([]string{}, artistNames...)
+	sort.Strings(expectedArtists)
+
+	if reflect.DeepEqual(sequentialArtists, expectedArtists) == false {
+		t.Fatalf("Sequential artists not in order: %v", sequentialArtists)
+	} else if len(sequentialTracks) != len(favorites) {
+		t.Fatalf("Not all tracks matched: (%d)", len(sequentialTracks))
+	}
+
+	// Run a few times to give the workers a chance to finish out of order.
+
+	for k := 0; k < 5; k++ {
+		concurrentTracks, concurrentArtists := run(4)
+
+		if reflect.DeepEqual(concurrentArtists, sequentialArtists) == false {
+			t.Fatalf("Concurrent artists not in order: %v", concurrentArtists)
+		} else if reflect.DeepEqual(concurrentTracks, sequentialTracks) == false {
+			t.Fatalf("Concurrent tracks differ from sequential tracks.")
+		}
+	}
+}
+
+func TestGetTracksToAdd_MatchMethods(t *testing.T) {
+	fsc := newTestCatalog()
+	fsc.addAlbum("artist1", "album2", "Second Album", "album", "1992-01-01", "Hit")
+	fsc.addAlbum("artist1", "album3", "Rarities", "album", "1995-01-01", "Deep Cut")
+
+	fsc.isrcs["album2-1"] = "USABC9200001"
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album (Remastered)", TrackName: "Closer"},
+		{ArtistName: "The Band", AlbumName: "Greatest Hits", TrackName: "Hit", Isrc: "US-ABC-92-00001"},
+		{ArtistName: "The Band", AlbumName: "Bootleg", TrackName: "Deep Cut"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+
+	b := new(bytes.Buffer)
+	i.SetSummaryWriter(b)
+
+	tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	expected := map[spotify.ID]string{
+		"album1-1": MatchMethodStrictAlbum,
+		"album1-2": MatchMethodLiberalAlbum,
+		"album2-1": MatchMethodIsrc,
+		"album3-1": MatchMethodTrackSearch,
+	}
+
+	if len(tracks) != len(expected) {
+		t.Fatalf("Not all tracks matched: %v", tracks)
+	}
+
+	for id, matchMethod := range expected {
+		if ti := tracks[id]; ti.MatchMethod != matchMethod {
+			t.Fatalf("[%s] match method not correct: [%s] != [%s]", id, ti.MatchMethod, matchMethod)
+		}
+	}
+
+	// Each method should be counted in the summary.
+
+	for _, matchMethod := range expected {
+		line := fmt.Sprintf("(1) tracks matched via [%s].", matchMethod)
+		if strings.Contains(b.String(), line) == false {
+			t.Fatalf("Summary doesn't count [%s]:\n%s", matchMethod, b.String())
+		}
+	}
+}
+
+func TestFetchNapsterFavorites_Limit(t *testing.T) {
+	fnc := newFakeNapsterClient()
+	for j := 0; j < 10; j++ {
+		fnc.addFavorite("The Band", "First Album", fmt.Sprintf("Song %d", j))
+	}
+
+	i := newTestNapsterImporter(newFakeSpotifyClient(), fnc, 3)
+	i.SetNapsterFavoritesLimit(4, false)
+
+	normalizedTracks, err := i.fetchNapsterFavorites(fnc, []string{"the band"})
+	if err != nil {
+		t.Fatalf("Could not read favorites: %s", err)
+	}
+
+	if len(normalizedTracks) != 4 {
+		t.Fatalf("Limit not applied: (%d)", len(normalizedTracks))
+	} else if normalizedTracks[3].TrackName != "song 3" {
+		t.Fatalf("Wrong favorites read: %v", normalizedTracks)
+	}
+
+	// A full page of three and then only the one more that we needed (plus
+	// the overlap).
+	if fnc.pages != 2 {
+		t.Fatalf("Paging didn't stop at the limit: (%d) pages", fnc.pages)
+	}
+}
+
+func TestFetchNapsterFavorites_LimitAfterFilter(t *testing.T) {
+	fnc := newFakeNapsterClient()
+	for j := 0; j < 10; j++ {
+		fnc.addFavorite("The Band", "First Album", fmt.Sprintf("Song %d", j))
+		fnc.addFavorite("Other Artist", "Their Album", fmt.Sprintf("Their Song %d", j))
+	}
+
+	i := newTestNapsterImporter(newFakeSpotifyClient(), fnc, 3)
+	i.SetNapsterFavoritesLimit(3, true)
+
+	normalizedTracks, err := i.fetchNapsterFavorites(fnc, []string{"the band"})
+	if err != nil {
+		t.Fatalf("Could not read favorites: %s", err)
+	}
+
+	allowed := 0
+	for _, nt := range normalizedTracks {
+		if nt.ArtistName == "the band" {
+			allowed++
+		}
+	}
+
+	if allowed != 3 {
+		t.Fatalf("Limit not applied after filtering: (%d)", allowed)
+	} else if last := normalizedTracks[len(normalizedTracks)-1]; last.TrackName != "song 2" {
+		t.Fatalf("Favorites read past the limit: %v", last)
+	}
+
+	// The third favorite by the artist is on the second page.
+	if fnc.pages != 2 {
+		t.Fatalf("Paging didn't stop at the limit: (%d) pages", fnc.pages)
+	}
+}
+
+func TestGetTracksToAdd_UnionMarkets(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+	fsc.addPlaylist("target", "Target", fsc.userId)
+
+	// Each market has its own edition of the album, and each has a track
+	// that the other doesn't.
+
+	gbAlbum := fsc.addAlbum("artist1", "albumgb", "Live Album", "album", "2005-01-01", "Song A", "Song C")
+	gbAlbum.AvailableMarkets = []string{"GB"}
+
+	usAlbum := fsc.addAlbum("artist1", "albumus", "Live Album", "album", "2005-01-01", "Song B", "Song C")
+	usAlbum.AvailableMarkets = []string{"US"}
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "Live Album", TrackName: "Song A"},
+		{ArtistName: "The Band", AlbumName: "Live Album", TrackName: "Song B"},
+		{ArtistName: "The Band", AlbumName: "Live Album", TrackName: "Song C"},
+	}
+
+	cases := []struct {
+		unionMarkets bool
+		expected     map[spotify.ID]string
+	}{
+		{false, map[spotify.ID]string{"albumgb-1": "GB", "albumgb-2": "GB"}},
+		{true, map[spotify.ID]string{"albumgb-1": "GB", "albumgb-2": "GB", "albumus-1": "US", "albumus-2": "US"}},
+	}
+
+	for _, c := range cases {
+		i := newTestImporter(t, fsc, "GB", favorites...)
+		i.SetFallbackMarketNames([]string{"US"})
+		i.SetUnionMarkets(c.unionMarkets)
+
+		tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "GB")
+		if err != nil {
+			t.Fatalf("Could not get tracks (%v): %s", c.unionMarkets, err)
+		}
+
+		actual := make(map[spotify.ID]string)
+		for id, ti := range tracks {
+			actual[id] = ti.MarketName
+		}
+
+		if reflect.DeepEqual(actual, c.expected) == false {
+			t.Fatalf("Tracks not correct (%v): %v != %v", c.unionMarkets, actual, c.expected)
+		}
+	}
+}
+
+func TestGetTracksToAdd_AlbumCompleteOnly(t *testing.T) {
+	fsc := newTestCatalog()
+	fsc.addAlbum("artist1", "album2", "Second Album", "album", "1992-01-01", "Hit", "Ballad")
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Unreleased"},
+		{ArtistName: "The Band", AlbumName: "Second Album", TrackName: "Hit"},
+		{ArtistName: "The Band", AlbumName: "Second Album", TrackName: "Ballad"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+	i.SetAlbumCompleteOnly(true)
+
+	tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	ids := make([]string, 0, len(tracks))
+	for id, _ := range tracks {
+		ids = append(ids, string(id))
+	}
+
+	sort.Strings(ids)
+
+	expectedIds := []string{"album2-1", "album2-2"}
+	if reflect.DeepEqual(ids, expectedIds) == false {
+		t.Fatalf("Only the complete album should have been added: %v", ids)
+	}
+
+	reasons := make(map[string]string)
+	for _, mt := range i.missingTracks {
+		reasons[mt.TrackName] = mt.Reason
+	}
+
+	expectedReasons := map[string]string{
+		"Opener":     MissingReasonAlbumIncomplete,
+		"Closer":     MissingReasonAlbumIncomplete,
+		"Unreleased": MissingReasonTrackNotFound,
+	}
+
+	if reflect.DeepEqual(reasons, expectedReasons) == false {
+		t.Fatalf("Missing tracks not correct: %v", reasons)
+	}
+}
+
+func TestGetTracksToAdd_UserIdOverride(t *testing.T) {
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+	}
+
+	for _, collaborative := range []bool{true, false} {
+		fsc := newFakeSpotifyClient()
+		fsc.addArtist("artist1", "The Band")
+		fsc.addAlbum("artist1", "album1", "First Album", "album", "1990-01-01", "Opener", "Closer")
+		fsc.addPlaylist("shared", "Shared", "family")
+
+		fsc.playlists[0].Collaborative = collaborative
+
+		i := newTestImporter(t, fsc, "", favorites...)
+		i.sc.SetUserIdOverride("family")
+
+		// Reading the playlist is fine either way. Whether we can change it
+		// is only checked before changing it.
+
+		_, err := i.GetTracksToAdd("Shared", []string{"the band"}, "")
+		if err != nil {
+			t.Fatalf("Could not get tracks (%v): %s", collaborative, err)
+		}
+
+		if len(fsc.playlistUserIds) == 0 {
+			t.Fatalf("No playlist calls were made.")
+		}
+
+		for _, userId := range fsc.playlistUserIds {
+			if userId != "family" {
+				t.Fatalf("Playlist call not made for the override: [%s]", userId)
+			}
+		}
+	}
+}
+
+func TestGetTracksToAdd_SkipUnplayable(t *testing.T) {
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+	}
+
+	for _, skipUnplayable := range []bool{false, true} {
+		fsc := newTestCatalog()
+
+		// The second track was matched but can't be played in our market.
+		fa := fsc.albums[0]
+		fa.AvailableMarkets = []string{"US", "GB"}
+		fa.Tracks.Tracks[0].AvailableMarkets = []string{"US", "GB"}
+		fa.Tracks.Tracks[1].AvailableMarkets = []string{"GB"}
+
+		i := newTestImporter(t, fsc, "US", favorites...)
+		i.SetSkipUnplayable(skipUnplayable)
+
+		tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "US")
+		if err != nil {
+			t.Fatalf("Could not get tracks (%v): %s", skipUnplayable, err)
+		}
+
+		if _, found := tracks["album1-1"]; found == false {
+			t.Fatalf("Playable track should always be added (%v).", skipUnplayable)
+		}
+
+		_, found := tracks["album1-2"]
+		if skipUnplayable == false {
+			if found == false {
+				t.Fatalf("Unplayable track should only be skipped when asked.")
+			}
+
+			continue
+		} else if found == true {
+			t.Fatalf("Unplayable track should have been skipped.")
+		}
+
+		if len(i.missingTracks) != 1 {
+			t.Fatalf("Expected the unplayable track to be reported: %v", i.missingTracks)
+		}
+
+		mt := i.missingTracks[0]
+		if mt.TrackName != "Closer" {
+			t.Fatalf("Wrong track reported: [%s]", mt.TrackName)
+		} else if mt.Reason != MissingReasonUnplayable {
+			t.Fatalf("Reason not correct: [%s] != [%s]", mt.Reason, MissingReasonUnplayable)
+		}
+	}
+}
+
+func TestGetTracksToAdd_ArtistTriage(t *testing.T) {
+	fsc := newTestCatalog()
+	fsc.addArtist("artist2", "Unfavorited")
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "Not On Spotify", AlbumName: "Demos", TrackName: "Demo 1"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+	i.SetArtistTriage(true)
+
+	b := new(bytes.Buffer)
+	i.SetSummaryWriter(b)
+
+	onlyArtists := []string{"The Band", "Not On Spotify", "Unfavorited", "Nobody"}
+
+	_, err := i.GetTracksToAdd("Target", onlyArtists, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	expected := []string{
+		"ARTIST TRIAGE: [the band] NAPSTER-FAVORITES=[yes] FOUND-IN-SPOTIFY=[yes]",
+		"ARTIST TRIAGE: [not on spotify] NAPSTER-FAVORITES=[yes] FOUND-IN-SPOTIFY=[no]",
+		"ARTIST TRIAGE: [unfavorited] NAPSTER-FAVORITES=[no] FOUND-IN-SPOTIFY=[yes]",
+		"ARTIST TRIAGE: [nobody] NAPSTER-FAVORITES=[no] FOUND-IN-SPOTIFY=[no]",
+	}
+
+	for _, line := range expected {
+		if strings.Contains(b.String(), line+"\n") == false {
+			t.Fatalf("Triage line missing: [%s]\n%s", line, b.String())
+		}
+	}
+}
+
+func TestGetTracksToAdd_NothingToImportStats(t *testing.T) {
+	bandFavorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+	}
+
+	cases := []struct {
+		description string
+		favorites   []NormalizedTrack
+		onlyArtists []string
+		inPlaylist  []spotify.ID
+		expected    ImportStats
+	}{
+		{"no favorites", nil, []string{"the band"}, nil, ImportStats{}},
+		{"filtered", bandFavorites, []string{"someone else"}, nil, ImportStats{FavoritesCount: 2, FilteredCount: 2}},
+		{"already present", bandFavorites, []string{"the band"}, []spotify.ID{"album1-1", "album1-2"}, ImportStats{FavoritesCount: 2, AlreadyPresentCount: 2}},
+	}
+
+	for _, c := range cases {
+		fsc := newFakeSpotifyClient()
+		fsc.addArtist("artist1", "The Band")
+		fsc.addAlbum("artist1", "album1", "First Album", "album", "1990-01-01", "Opener", "Closer")
+		fsc.addPlaylist("target", "Target", fsc.userId, c.inPlaylist...)
+
+		i := newTestImporter(t, fsc, "", c.favorites...)
+
+		tracks, err := i.GetTracksToAdd("Target", c.onlyArtists, "")
+		if err != nil {
+			t.Fatalf("Could not get tracks (%s): %s", c.description, err)
+		} else if len(tracks) != 0 {
+			t.Fatalf("Expected nothing to import (%s): %v", c.description, tracks)
+		}
+
+		if stats := i.Stats(); stats != c.expected {
+			t.Fatalf("Stats not correct (%s): %+v != %+v", c.description, stats, c.expected)
+		}
+	}
+}
+
+func TestGetTracksToAdd_ArtistBatch(t *testing.T) {
+	artistNames := []string{"Echo", "Alpha", "Delta", "Bravo", "Charlie"}
+
+	fsc := newFakeSpotifyClient()
+	fsc.addPlaylist("target", "Target", fsc.userId)
+
+	favorites := make([]NormalizedTrack, 0)
+	for j, artistName := range artistNames {
+		artistId := spotify.ID(fmt.Sprintf("artist%d", j))
+		albumId := spotify.ID(fmt.Sprintf("album%d", j))
+
+		fsc.addArtist(artistId, artistName)
+		fsc.addAlbum(artistId, albumId, artistName+" Album", "album", "2000-01-01", "Song")
+
+		favorites = append(favorites, NormalizedTrack{ArtistName: artistName, AlbumName: artistName + " Album", TrackName: "Song"})
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+
+	// The artist of each track that was handed off, by batch.
+	batches := make([][]string, 0)
+
+	i.SetArtistBatch(2, func(tracks map[spotify.ID]TrackInfo) error {
+		batch := make([]string, 0, len(tracks))
+		for _, ti := range tracks {
+			batch = append(batch, ti.ArtistName)
+		}
+
+		sort.Strings(batch)
+		batches = append(batches, batch)
+
+		return nil
+	})
+
+	tracks, err := i.GetTracksToAdd("Target", append([]string{}, artistNames...), "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	// Artists are grouped in order of name.
+	expected := [][]string{
+		{"Alpha", "Bravo"},
+		{"Charlie", "Delta"},
+		{"Echo"},
+	}
+
+	if reflect.DeepEqual(batches, expected) == false {
+		t.Fatalf("Batches not correct: %v", batches)
+	} else if len(tracks) != len(artistNames) {
+		t.Fatalf("All tracks should still be returned: (%d)", len(tracks))
+	}
+
+	// A failure to hand off a batch stops before the next one.
+
+	i = newTestImporter(t, fsc, "", favorites...)
+
+	calls := 0
+	i.SetArtistBatch(2, func(tracks map[spotify.ID]TrackInfo) error {
+		calls++
+		return fmt.Errorf("add failed")
+	})
+
+	_, err = i.GetTracksToAdd("Target", append([]string{}, artistNames...), "")
+	if err == nil {
+		t.Fatalf("Expected the hand-off error to be returned.")
+	} else if calls != 1 {
+		t.Fatalf("Batches after the failure should not be matched: (%d) calls", calls)
+	}
+}
+
+func TestFetchNapsterFavorites_Shifted(t *testing.T) {
+	cases := []struct {
+		description string
+		shift       func(fnc *fakeNapsterClient)
+		restart     bool
+		expected    []string
+	}{
+		{
+			description: "grown",
+			shift: func(fnc *fakeNapsterClient) {
+				fnc.prependFavorite("The Band", "First Album", "New Song")
+			},
+			expected: []string{"song 0", "song 1", "song 2", "song 3", "song 4", "song 5"},
+		},
+		{
+			description: "shrunk",
+			shift: func(fnc *fakeNapsterClient) {
+				fnc.favoriteIds = fnc.favoriteIds[1:]
+			},
+			expected: []string{"song 0", "song 1", "song 2", "song 3", "song 4", "song 5"},
+		},
+		{
+			description: "grown and restarted",
+			shift: func(fnc *fakeNapsterClient) {
+				fnc.prependFavorite("The Band", "First Album", "New Song")
+			},
+			restart:  true,
+			expected: []string{"song 0", "song 1", "new song", "song 2", "song 3", "song 4", "song 5"},
+		},
+	}
+
+	for _, c := range cases {
+		fnc := newFakeNapsterClient()
+		for j := 0; j < 6; j++ {
+			fnc.addFavorite("The Band", "First Album", fmt.Sprintf("Song %d", j))
+		}
+
+		// Change the list once, after the first page.
+		fnc.onPage = func(fnc *fakeNapsterClient, pages int) {
+			if pages == 1 {
+				c.shift(fnc)
+			}
+		}
+
+		i := newTestNapsterImporter(newFakeSpotifyClient(), fnc, 2)
+		i.SetNapsterRestartOnShift(c.restart)
+
+		normalizedTracks, err := i.fetchNapsterFavorites(fnc, []string{"the band"})
+		if err != nil {
+			t.Fatalf("[%s] Could not read favorites: %s", c.description, err)
+		}
+
+		trackNames := make([]string, len(normalizedTracks))
+		for j, nt := range normalizedTracks {
+			trackNames[j] = nt.TrackName
+		}
+
+		if reflect.DeepEqual(trackNames, c.expected) != true {
+			t.Fatalf("[%s] Favorites not correct: %v", c.description, trackNames)
+		} else if i.Stats().DuplicateCount != 0 {
+			t.Fatalf("[%s] Favorites seen again after the shift should not be duplicates: (%d)", c.description, i.Stats().DuplicateCount)
+		}
+	}
+}
+
+func TestGetTracksToAdd_DurationRange(t *testing.T) {
+	fsc := newTestCatalog()
+
+	// Just outside, just inside, and on each threshold.
+	fa := fsc.addAlbum("artist1", "album2", "Second Album", "album", "1992-01-01", "Skit", "Short", "Long", "Mix")
+	fa.Tracks.Tracks[0].Duration = 59999
+	fa.Tracks.Tracks[1].Duration = 60000
+	fa.Tracks.Tracks[2].Duration = 600000
+	fa.Tracks.Tracks[3].Duration = 600001
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "Second Album", TrackName: "Skit"},
+		{ArtistName: "The Band", AlbumName: "Second Album", TrackName: "Short"},
+		{ArtistName: "The Band", AlbumName: "Second Album", TrackName: "Long"},
+		{ArtistName: "The Band", AlbumName: "Second Album", TrackName: "Mix"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+	i.SetDurationRange(time.Minute, time.Minute*10)
+
+	tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	ids := make([]string, 0, len(tracks))
+	for id, _ := range tracks {
+		ids = append(ids, string(id))
+	}
+
+	sort.Strings(ids)
+
+	if reflect.DeepEqual(ids, []string{"album2-2", "album2-3"}) != true {
+		t.Fatalf("Tracks within the range not correct: %v", ids)
+	}
+
+	skipped := make([]string, 0)
+	for _, mt := range i.missingTracks {
+		if mt.Reason != MissingReasonDuration {
+			t.Fatalf("Reason not correct for [%s]: [%s]", mt.TrackName, mt.Reason)
+		}
+
+		skipped = append(skipped, mt.TrackName)
+	}
+
+	sort.Strings(skipped)
+
+	if reflect.DeepEqual(skipped, []string{"Mix", "Skit"}) != true {
+		t.Fatalf("Tracks outside of the range not reported: %v", skipped)
+	}
+}
+
+func TestIsDurationInRange(t *testing.T) {
+	cases := []struct {
+		minDuration time.Duration
+		maxDuration time.Duration
+		duration    time.Duration
+		inRange     bool
+	}{
+		{0, 0, time.Hour, true},
+		{time.Minute, 0, time.Minute - time.Millisecond, false},
+		{time.Minute, 0, time.Minute, true},
+		{0, time.Minute * 10, time.Minute * 10, true},
+		{0, time.Minute * 10, time.Minute*10 + time.Millisecond, false},
+		{time.Minute, time.Minute * 10, time.Minute * 5, true},
+	}
+
+	i := newTestImporterWithoutFavorites(newFakeSpotifyClient(), 50, "")
+
+	for _, c := range cases {
+		i.SetDurationRange(c.minDuration, c.maxDuration)
+
+		inRange := i.isDurationInRange(c.duration)
+		if inRange != c.inRange {
+			t.Fatalf("[%s] in [%s, %s] not correct: (%v)", c.duration, c.minDuration, c.maxDuration, inRange)
+		}
+	}
+}
+
+func TestGetTracksToAdd_NoFail(t *testing.T) {
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "Second Album", TrackName: "Deep Cut"},
+	}
+
+	errUnexpected := fmt.Errorf("unexpected failure")
+
+	for _, noFail := range []bool{false, true} {
+		fsc := newTestCatalog()
+		fsc.addAlbum("artist1", "album2", "Second Album", "album", "1992-01-01", "Deep Cut")
+
+		// The albums are looked up in order, so only the first one's tracks
+		// can't be read.
+		fsc.failNext("GetAlbumTracksOpt", errUnexpected)
+
+		i := newTestImporter(t, fsc, "", favorites...)
+		i.SetNoFail(noFail)
+
+		tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+		if noFail == false {
+			if log.Is(err, errUnexpected) != true {
+				t.Fatalf("Expected the lookup failure to fail the run: [%v]", err)
+			}
+
+			continue
+		} else if err != nil {
+			t.Fatalf("Run should have completed: %s", err)
+		}
+
+		if _, found := tracks["album2-1"]; found == false || len(tracks) != 1 {
+			t.Fatalf("The other album should still have been matched: %v", tracks)
+		}
+
+		if len(i.missingTracks) != 1 {
+			t.Fatalf("Expected the failed album's track to be reported: %v", i.missingTracks)
+		}
+
+		mt := i.missingTracks[0]
+		if mt.TrackName != "Opener" {
+			t.Fatalf("Wrong track reported: [%s]", mt.TrackName)
+		} else if mt.Reason != MissingReasonLookupFailed {
+			t.Fatalf("Reason not correct: [%s] != [%s]", mt.Reason, MissingReasonLookupFailed)
+		}
+	}
+}
+
+func TestGetTracksToAdd_MaxRuntime(t *testing.T) {
+	artistNames := []string{"Echo", "Alpha", "Delta", "Bravo", "Charlie"}
+
+	fsc := newFakeSpotifyClient()
+	fsc.addPlaylist("target", "Target", fsc.userId)
+
+	favorites := make([]NormalizedTrack, 0)
+	for j, artistName := range artistNames {
+		artistId := spotify.ID(fmt.Sprintf("artist%d", j))
+		albumId := spotify.ID(fmt.Sprintf("album%d", j))
+
+		fsc.addArtist(artistId, artistName)
+		fsc.addAlbum(artistId, albumId, artistName+" Album", "album", "2000-01-01", "Song")
+
+		favorites = append(favorites, NormalizedTrack{ArtistName: artistName, AlbumName: artistName + " Album", TrackName: "Song"})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	i := newTestImporter(t, fsc, "", favorites...)
+	i.ctx = ctx
+
+	// The first batch is committed and then takes us past the deadline.
+	committed := make([]string, 0)
+
+	i.SetArtistBatch(2, func(tracks map[spotify.ID]TrackInfo) error {
+		for _, ti := range tracks {
+			committed = append(committed, ti.ArtistName)
+		}
+
+		<-ctx.Done()
+
+		return nil
+	})
+
+	tracks, err := i.GetTracksToAdd("Target", append([]string{}, artistNames...), "")
+	if err != nil {
+		t.Fatalf("Running out of time should not be an error: %s", err)
+	}
+
+	sort.Strings(committed)
+
+	if reflect.DeepEqual(committed, []string{"Alpha", "Bravo"}) != true {
+		t.Fatalf("Only the first batch should have been committed: %v", committed)
+	} else if len(tracks) != 2 {
+		t.Fatalf("Only the matched tracks should be returned: %v", tracks)
+	} else if i.Stats().RemainingArtistCount != 3 {
+		t.Fatalf("Remaining artists not correct: (%d)", i.Stats().RemainingArtistCount)
+	}
+}
+
+func TestGetTracksToAdd_NoAlbumName(t *testing.T) {
+	fsc := newTestCatalog()
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "", TrackName: "Closer"},
+		{ArtistName: "The Band", AlbumName: "", TrackName: "Ghost"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+
+	tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	if len(tracks) != 1 {
+		t.Fatalf("Expected just the one track to be found: %v", tracks)
+	} else if ti, found := tracks["album1-2"]; found == false || ti.MatchMethod != MatchMethodTrackSearch {
+		t.Fatalf("Track not found by searching for it: %v", tracks)
+	}
+
+	// The albums were never looked at.
+
+	if calls := fsc.callCount("GetArtistAlbumsOpt"); calls != 0 {
+		t.Fatalf("Albums should not have been listed: (%d) calls", calls)
+	}
+
+	if len(i.missingTracks) != 1 {
+		t.Fatalf("Expected the other track to be reported: %v", i.missingTracks)
+	}
+
+	mt := i.missingTracks[0]
+	if mt.TrackName != "Ghost" {
+		t.Fatalf("Wrong track reported: [%s]", mt.TrackName)
+	} else if mt.Reason != MissingReasonTrackNotFound {
+		t.Fatalf("Reason not correct: [%s] != [%s]", mt.Reason, MissingReasonTrackNotFound)
+	}
+}
+
+func TestGetTracksToAdd_OriginalCasing(t *testing.T) {
+	fsc := newTestCatalog()
+
+	// Napster's casing differs from Spotify's.
+	favorites := []NormalizedTrack{
+		{ArtistName: "THE Band", AlbumName: "First ALBUM", TrackName: "Opener"},
+		{ArtistName: "THE Band", AlbumName: "First ALBUM", TrackName: "Ghost Track"},
+		{ArtistName: "THE Band", AlbumName: "Lost Album", TrackName: "Lost Song"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+
+	tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	// Matching is done on the lower-cased names, but everything that's
+	// reported uses the names as Napster gave them.
+
+	rr := i.RunReport(tracks)
+
+	expectedAlbums := []*RunReportAlbum{
+		{ArtistName: "THE Band", AlbumName: "Lost Album"},
+	}
+
+	if reflect.DeepEqual(rr.MissingAlbums, expectedAlbums) != true {
+		t.Fatalf("Missing albums not correct: %v", rr.MissingAlbums)
+	}
+
+	expectedTracks := []*RunReportTrack{
+		{ArtistName: "THE Band", AlbumName: "First ALBUM", TitleName: "Ghost Track", Reason: MissingReasonTrackNotFound},
+		{ArtistName: "THE Band", AlbumName: "Lost Album", TitleName: "Lost Song", Reason: MissingReasonAlbumNotFound},
+	}
+
+	if reflect.DeepEqual(rr.MissingTracks, expectedTracks) != true {
+		t.Fatalf("Missing tracks not correct: %v", rr.MissingTracks)
+	}
+
+	expectedTracks = []*RunReportTrack{
+		{ArtistName: "THE Band", AlbumName: "First ALBUM", TitleName: "Opener", Id: "album1-1", MatchMethod: MatchMethodStrictAlbum},
+	}
+
+	if reflect.DeepEqual(rr.TracksToAdd, expectedTracks) != true {
+		t.Fatalf("Tracks to add not correct: %v", rr.TracksToAdd)
+	}
+
+	ar := i.matchReport.Artists[0]
+	if ar.ArtistName != "THE Band" {
+		t.Fatalf("Artist in the match report not correct: [%s]", ar.ArtistName)
+	}
+
+	alr := ar.Albums[0]
+	if alr.AlbumName != "First ALBUM" || reflect.DeepEqual(alr.ToAdd, []string{"Opener"}) != true || reflect.DeepEqual(alr.Missing, []string{"Ghost Track"}) != true {
+		t.Fatalf("Album in the match report not correct: %+v", alr)
+	}
+}
+
+func TestFetchNapsterFavorites_ShrinkBatch(t *testing.T) {
+	fnc := newFakeNapsterClient()
+	for j := 0; j < 50; j++ {
+		fnc.addFavorite("The Band", "First Album", fmt.Sprintf("Song %d", j))
+	}
+
+	i := newTestNapsterImporter(newFakeSpotifyClient(), fnc, 40)
+
+	fnc.maxLimit = 25
+	fnc.nrlt = i.napsterRateLimit
+
+	normalizedTracks, err := i.fetchNapsterFavorites(fnc, []string{"the band"})
+	if err != nil {
+		t.Fatalf("Could not read favorites: %s", err)
+	}
+
+	if len(normalizedTracks) != 50 {
+		t.Fatalf("Not all favorites were read: (%d)", len(normalizedTracks))
+	}
+
+	for j, nt := range normalizedTracks {
+		if nt.TrackName != fmt.Sprintf("song %d", j) {
+			t.Fatalf("Favorite (%d) not correct: [%s]", j, nt.TrackName)
+		}
+	}
+
+	// The first page is too big and is retried at half the size. The details
+	// are then read at the smaller size, too.
+	if fnc.limits[0] != 40 || fnc.limits[1] != 20 {
+		t.Fatalf("Batch not retried smaller: %v", fnc.limits)
+	}
+
+	for _, limit := range fnc.limits[1:] {
+		if limit > fnc.maxLimit {
+			t.Fatalf("Batch-size not kept small: %v", fnc.limits)
+		}
+	}
+}
+
+func TestReadNapsterTrackDetails_ShrinkBatch(t *testing.T) {
+	fnc := newFakeNapsterClient()
+
+	ids := make([]string, 50)
+	for j, _ := range ids {
+		ids[j] = fnc.addFavorite("The Band", "First Album", fmt.Sprintf("Song %d", j))
+	}
+
+	i := newTestNapsterImporter(newFakeSpotifyClient(), fnc, 40)
+
+	fnc.maxLimit = 25
+	fnc.nrlt = i.napsterRateLimit
+
+	batchSize := 40
+
+	tracks, err := i.readNapsterTrackDetails(fnc, ids, &batchSize)
+	if err != nil {
+		t.Fatalf("Could not read track details: %s", err)
+	}
+
+	if len(tracks) != 50 {
+		t.Fatalf("Not all details were read: (%d)", len(tracks))
+	} else if batchSize != 20 {
+		t.Fatalf("Batch-size not shrunk for the caller: (%d)", batchSize)
+	}
+
+	expectedLimits := []int{40, 20, 20, 10}
+	if reflect.DeepEqual(fnc.limits, expectedLimits) != true {
+		t.Fatalf("Batch sizes not correct: %v", fnc.limits)
+	}
+}
+
+func TestGetTracksToAdd_Remastered(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+	fsc.addAlbum("artist1", "album1", "First Album", "album", "2001-01-01", "Opener - Remastered 2009", "Closer")
+	fsc.addPlaylist("target", "Target", fsc.userId)
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+
+	tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	if _, found := tracks["album1-1"]; found == false {
+		t.Fatalf("Remastered track not matched: %v", tracks)
+	} else if _, found := tracks["album1-2"]; found == false {
+		t.Fatalf("Exact track not matched: %v", tracks)
+	} else if len(i.missingTracks) != 0 {
+		t.Fatalf("No tracks should be missing: %v", i.missingTracks)
+	}
+}
+
+func TestGetTracksToAdd_MarketAttribution(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+
+	gbAlbum := fsc.addAlbum("artist1", "albumgb", "Live Album", "album", "2005-01-01", "Song A", "Song C")
+	gbAlbum.AvailableMarkets = []string{"GB"}
+
+	usAlbum := fsc.addAlbum("artist1", "albumus", "Live Album", "album", "2005-01-01", "Song B", "Song D")
+	usAlbum.AvailableMarkets = []string{"US"}
+
+	// One of the tracks is already in the playlist. It's still attributed.
+	fsc.addPlaylist("target", "Target", fsc.userId, "albumus-2")
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "Live Album", TrackName: "Song A"},
+		{ArtistName: "The Band", AlbumName: "Live Album", TrackName: "Song B"},
+		{ArtistName: "The Band", AlbumName: "Live Album", TrackName: "Song C"},
+		{ArtistName: "The Band", AlbumName: "Live Album", TrackName: "Song D"},
+	}
+
+	i := newTestImporter(t, fsc, "GB", favorites...)
+	i.SetFallbackMarketNames([]string{"US"})
+	i.SetUnionMarkets(true)
+
+	_, err := i.GetTracksToAdd("Target", []string{"the band"}, "GB")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	b := new(bytes.Buffer)
+
+	err = i.matchReport.WritePlan(b, OutputFormatText)
+	if err != nil {
+		t.Fatalf("Could not write plan: %s", err)
+	}
+
+	expected := `[The Band]
+  [Live Album] (strict-album)
+    + [Song A] (GB)
+    + [Song B] (US)
+    + [Song C] (GB)
+    = [Song D] (US)
+
+(+) TO ADD=(3) (=) ALREADY PRESENT=(1) (-) MISSING=(0) (~) SKIPPED=(0)
+MARKET [GB]=(2)
+MARKET [US]=(2)
+`
+
+	if b.String() != expected {
+		t.Fatalf("Plan not correct:\n%s\n!=\n%s", b.String(), expected)
+	}
+
+	expectedCounts := map[string]int{"GB": 2, "US": 2}
+	if reflect.DeepEqual(i.matchReport.MarketCounts, expectedCounts) != true {
+		t.Fatalf("Market counts not correct: %v", i.matchReport.MarketCounts)
+	}
+
+	// With only the one market, nothing is attributed.
+
+	i = newTestImporter(t, fsc, "GB", favorites...)
+
+	_, err = i.GetTracksToAdd("Target", []string{"the band"}, "GB")
+	if err != nil {
+		t.Fatalf("Could not get tracks for one market: %s", err)
+	}
+
+	if counts := i.matchReport.countMarkets(); len(counts) != 0 {
+		t.Fatalf("Tracks should not be attributed to a market: %v", counts)
+	}
+}
+
+func TestGetTracksToAdd_IgnorePreloadErrors(t *testing.T) {
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+	}
+
+	errUnexpected := fmt.Errorf("unexpected failure")
+
+	for _, ignorePreloadErrors := range []bool{false, true} {
+		fsc := newTestCatalog()
+		fsc.addPlaylist("target", "Target", fsc.userId, "album1-1")
+
+		fsc.failNext("GetPlaylistTracksOpt", errUnexpected)
+
+		i := newTestImporter(t, fsc, "", favorites...)
+		i.SetIgnorePreloadErrors(ignorePreloadErrors)
+
+		tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+		if ignorePreloadErrors == false {
+			if log.Is(err, errUnexpected) != true {
+				t.Fatalf("Expected the preload failure to fail the run: [%v]", err)
+			}
+
+			continue
+		} else if err != nil {
+			t.Fatalf("Run should have completed: %s", err)
+		}
+
+		// The playlist is treated as empty, so the track that's already in it
+		// is added again.
+
+		if len(tracks) != 2 {
+			t.Fatalf("Both tracks should have been matched: %v", tracks)
+		} else if _, found := tracks["album1-1"]; found == false {
+			t.Fatalf("Track already in the playlist should have been matched: %v", tracks)
+		}
+	}
+}
+
+func TestGetTracksToAdd_SummaryWriter(t *testing.T) {
+	fsc := newTestCatalog()
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Hidden Track"},
+		{ArtistName: "Other Artist", AlbumName: "Their Album", TrackName: "Their Song"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+
+	b := new(bytes.Buffer)
+	i.SetSummaryWriter(b)
+
+	_, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	// The summary only goes to the writer.
+
+	expected := `WARNING: IGNORING ARTIST: [Other Artist]
+(1) tracks found to import.
+(1) tracks skipped.
+(1) tracks matched via [strict-album].
+NOT FOUND: (0) [The Band] [First Album] [Hidden Track]
+`
+
+	if b.String() != expected {
+		t.Fatalf("Summary not correct:\n%s\n!=\n%s", b.String(), expected)
+	}
+}
+
+func TestGetTracksToAdd_DedupeSource(t *testing.T) {
+	fsc := newTestCatalog()
+
+	// The second favorite has no album, so it's found by searching for the
+	// track, which finds the same one as the first.
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+	i.SetDedupeSource(true)
+
+	b := new(bytes.Buffer)
+	i.SetSummaryWriter(b)
+
+	tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	// Only the one copy is added.
+
+	if len(tracks) != 2 {
+		t.Fatalf("Tracks not correct: %v", tracks)
+	}
+
+	// Both of the favorites are kept.
+
+	expected := []*SharedTrack{
+		{
+			TrackId: "album1-1",
+			Sources: []NormalizedTrack{
+				{ArtistName: "The Band", AlbumName: "", TrackName: "Opener"},
+				{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+			},
+		},
+	}
+
+	if reflect.DeepEqual(i.matchReport.SharedTracks, expected) != true {
+		t.Fatalf("Shared tracks not correct: %v", i.matchReport.SharedTracks)
+	} else if i.stats.SharedTrackCount != 1 {
+		t.Fatalf("Shared-track count not correct: (%d)", i.stats.SharedTrackCount)
+	}
+
+	if strings.Contains(b.String(), "WARNING: SAME SPOTIFY TRACK FOR (2) FAVORITES: [album1-1] [The Band] [] [Opener], [The Band] [First Album] [Opener]\n") != true {
+		t.Fatalf("Shared track not in the summary:\n%s", b.String())
+	}
+
+	// They're not reported unless we're told to look.
+
+	i = newTestImporter(t, fsc, "", favorites...)
+
+	_, err = i.GetTracksToAdd("Target", []string{"the band"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks without deduping: %s", err)
+	}
+
+	if len(i.matchReport.SharedTracks) != 0 {
+		t.Fatalf("Shared tracks should not be reported: %v", i.matchReport.SharedTracks)
+	}
+}
+
+func TestGetTracksToAdd_SecondArtistAllowed(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "Drake")
+	fsc.addAlbum("artist1", "album1", "Views", "album", "2016-04-29", "Too Good", "Controlla", "Hotline Bling")
+	fsc.addPlaylist("target", "Target", fsc.userId)
+
+	// Napster credits each of these to Drake. Only the first two feature
+	// Rihanna.
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "Drake", AlbumName: "Views", TrackName: "Too Good (feat. Rihanna)"},
+		{ArtistName: "Drake feat. Rihanna", AlbumName: "Views", TrackName: "Controlla"},
+		{ArtistName: "Drake", AlbumName: "Views", TrackName: "Hotline Bling"},
+	}
+
+	i := newTestImporter(t, fsc, "", favorites...)
+
+	tracks, err := i.GetTracksToAdd("Target", []string{"rihanna"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	actual := make([]string, 0, len(tracks))
+	for id, _ := range tracks {
+		actual = append(actual, string(id))
+	}
+
+	sort.Strings(actual)
+
+	expected := []string{"album1-1", "album1-2"}
+	if reflect.DeepEqual(actual, expected) != true {
+		t.Fatalf("Tracks not correct: %v", actual)
+	} else if i.stats.FilteredCount != 1 {
+		t.Fatalf("Expected the track without the allowed artist to be filtered: (%d)", i.stats.FilteredCount)
+	}
+
+	// The first artist being excluded always wins.
+
+	i = newTestImporter(t, fsc, "", favorites...)
+	i.SetExcludeArtists([]string{"Drake"})
+
+	tracks, err = i.GetTracksToAdd("Target", []string{"rihanna"}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks with the exclusion: %s", err)
+	} else if len(tracks) != 0 {
+		t.Fatalf("Tracks by an excluded artist should not be imported: %v", tracks)
+	}
+}
+
+func TestNormalizedTrack_ArtistNames(t *testing.T) {
+	cases := []struct {
+		nt          NormalizedTrack
+		artistNames []string
+	}{
+		{NormalizedTrack{ArtistName: "drake", TrackName: "song"}, []string{"drake"}},
+		{NormalizedTrack{ArtistName: "drake", TrackName: "song (feat. rihanna)"}, []string{"drake", "rihanna"}},
+		{NormalizedTrack{ArtistName: "drake feat. rihanna", TrackName: "song"}, []string{"drake feat. rihanna", "drake", "rihanna"}},
+		{NormalizedTrack{ArtistName: "drake ft. rihanna", TrackName: "song (with future & rihanna)"}, []string{"drake ft. rihanna", "drake", "rihanna", "future"}},
+	}
+
+	for _, c := range cases {
+		artistNames := c.nt.ArtistNames()
+		if reflect.DeepEqual(artistNames, c.artistNames) != true {
+			t.Fatalf("Artists for %s not correct: %v != %v", c.nt, artistNames, c.artistNames)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package gnsssync
+
+import (
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Config
+const (
+	// isrcLength is how long every ISRC is once any hyphens are removed.
+	isrcLength = 12
+)
+
+// normalizeIsrc returns the ISRC in its canonical form (upper-case and without
+// hyphens or spaces) or an empty string if it doesn't look like one.
+func normalizeIsrc(isrc string) string {
+	isrc = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isrc))
+	if len(isrc) != isrcLength {
+		return ""
+	}
+
+	for _, r := range isrc {
+		if (r < '0' || r > '9') && (r < 'A' || r > 'Z') {
+			return ""
+		}
+	}
+
+	return isrc
+}
+
+// searchSpotifyTrackByIsrc finds the track having the given (normalized)
+// ISRC.
+func (sa *SpotifyAdapter) searchSpotifyTrackByIsrc(isrc, marketName string) (id spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sLog.Debugf(sa.ctx, "Searching for track with ISRC [%s].", isrc)
+
+	o := &spotify.Options{}
+	if marketName != "" {
+		o.Country = &marketName
+	}
+
+	sr, err := withRetryValue(sa.retryPolicy, "searching for ISRC", func() (*spotify.SearchResult, error) {
+		return sa.client.SearchOpt("isrc:"+isrc, spotify.SearchTypeTrack, o)
+	})
+
+	log.PanicIf(err)
+
+	if sr.Tracks == nil {
+		log.Panic(ErrSpotifyTrackNotFound)
+	}
+
+	for _, t := range sr.Tracks.Tracks {
+		if normalizeIsrc(t.ExternalIDs["isrc"]) != isrc {
+			continue
+		}
+
+		// Remember what we now know about the track, as if we'd seen it in
+		// an album listing.
+		cat := cachedAlbumTrack{
+			Name:             t.Name,
+			Id:               t.ID,
+			AvailableMarkets: t.AvailableMarkets,
+			DurationMs:       t.Duration,
+		}
+
+		sa.cache.setTracks([]cachedAlbumTrack{cat})
+
+		sLog.Debugf(sa.ctx, "Found track [%s] on album [%s] by ISRC [%s]: [%s]", t.Name, t.Album.Name, isrc, t.ID)
+		return t.ID, nil
+	}
+
+	log.Panic(ErrSpotifyTrackNotFound)
+	return spotify.ID(""), nil
+}
+
+// GetSpotifyTrackIdsByIsrc finds the Spotify IDs for the given tracks by their
+// ISRCs. `isrcs` has the (normalized) ISRC of each track, keyed by the track
+// name. The tracks that aren't found are just not returned.
+func (sa *SpotifyAdapter) GetSpotifyTrackIdsByIsrc(isrcs map[string]string, marketName string) (foundTracks map[spotify.ID]string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	foundTracks = make(map[spotify.ID]string)
+
+	for trackName, isrc := range isrcs {
+		id, err := sa.searchSpotifyTrackByIsrc(isrc, marketName)
+		if log.Is(err, ErrSpotifyTrackNotFound) == true {
+			continue
+		} else if err != nil {
+			log.Panic(err)
+		}
+
+		foundTracks[id] = trackName
+	}
+
+	return foundTracks, nil
+}
+
+// matchAlbumInMarket finds the given tracks from the given album in Spotify
+// within one market. The tracks that have an ISRC are looked for by it first
+// since it identifies the recording exactly. The rest are looked for by name.
+func (i *Importer) matchAlbumInMarket(akn albumKeyNames, tracks []string, marketName string) (foundTracks map[spotify.ID]string, missingTracks []string, matchMethods map[spotify.ID]string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	trackIsrcs := make(map[string]string)
+	for _, trackName := range tracks {
+		if isrc := i.isrcs[akn][trackName]; isrc != "" {
+			trackIsrcs[trackName] = isrc
+		}
+	}
+
+	if len(trackIsrcs) == 0 {
+		return i.sa.GetSpotifyTrackIdsWithNames(akn.artistName, akn.albumName, tracks, marketName)
+	}
+
+	foundTracks, err = i.sa.GetSpotifyTrackIdsByIsrc(trackIsrcs, marketName)
+	log.PanicIf(err)
+
+	matchMethods = make(map[spotify.ID]string)
+	foundNames := make(map[string]bool)
+
+	for id, name := range foundTracks {
+		matchMethods[id] = MatchMethodIsrc
+		foundNames[name] = true
+	}
+
+	remainingTracks := make([]string, 0, len(tracks))
+	for _, trackName := range tracks {
+		if foundNames[trackName] == false {
+			remainingTracks = append(remainingTracks, trackName)
+		}
+	}
+
+	if len(remainingTracks) == 0 {
+		return foundTracks, remainingTracks, matchMethods, nil
+	}
+
+	nameFoundTracks, missingTracks, nameMatchMethods, err := i.sa.GetSpotifyTrackIdsWithNames(akn.artistName, akn.albumName, remainingTracks, marketName)
+	if err != nil {
+		if len(foundTracks) == 0 || (log.Is(err, ErrSpotifyArtistNotFound) == false && log.Is(err, ErrSpotifyAlbumNotFound) == false) {
+			log.Panic(err)
+		}
+
+		// We still found some of them by their ISRCs.
+		return foundTracks, remainingTracks, matchMethods, nil
+	}
+
+	for id, name := range nameFoundTracks {
+		foundTracks[id] = name
+		matchMethods[id] = nameMatchMethods[id]
+	}
+
+	return foundTracks, missingTracks, matchMethods, nil
+}
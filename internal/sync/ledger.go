@@ -0,0 +1,185 @@
+package gnsssync
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Misc
+var (
+	lLog = log.NewLogger("gnss.ledger")
+)
+
+// LedgerEntry records one track that we added to a playlist.
+type LedgerEntry struct {
+	TrackId   spotify.ID `json:"track_id"`
+	AddedAt   time.Time  `json:"added_at"`
+	RemovedAt *time.Time `json:"removed_at,omitempty"`
+}
+
+// Ledger is an append-only record of the tracks that we've added to each
+// playlist so that they can be distinguished from the tracks that the user
+// added themselves (and removed again, later). Entries are never deleted;
+// removals are recorded on the entry.
+type Ledger struct {
+	filepath string
+
+	Playlists map[spotify.ID][]LedgerEntry `json:"playlists"`
+}
+
+// LoadLedger loads the ledger at the given path. If the file doesn't exist yet,
+// an empty ledger is returned.
+func LoadLedger(ledgerFilepath string) (l *Ledger, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	l = &Ledger{
+		filepath:  ledgerFilepath,
+		Playlists: make(map[spotify.ID][]LedgerEntry),
+	}
+
+	f, err := os.Open(ledgerFilepath)
+	if os.IsNotExist(err) == true {
+		lLog.Debugf(nil, "Ledger does not exist yet: [%s]", ledgerFilepath)
+		return l, nil
+	} else if err != nil {
+		log.Panic(err)
+	}
+
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(l)
+	log.PanicIf(err)
+
+	if l.Playlists == nil {
+		l.Playlists = make(map[spotify.ID][]LedgerEntry)
+	}
+
+	return l, nil
+}
+
+// Append records the given tracks as having been added to the given playlist
+// and writes the ledger.
+func (l *Ledger) Append(playlistId spotify.ID, ids []spotify.ID) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	now := time.Now()
+
+	entries := l.Playlists[playlistId]
+	for _, id := range ids {
+		le := LedgerEntry{
+			TrackId: id,
+			AddedAt: now,
+		}
+
+		entries = append(entries, le)
+	}
+
+	l.Playlists[playlistId] = entries
+
+	err = l.save()
+	log.PanicIf(err)
+
+	return nil
+}
+
+// Active returns the IDs of the tracks that we've added to the given playlist
+// and not yet removed.
+func (l *Ledger) Active(playlistId spotify.ID) (ids []spotify.ID) {
+	ids = make([]spotify.ID, 0)
+	seen := make(map[spotify.ID]bool)
+
+	for _, le := range l.Playlists[playlistId] {
+		if le.RemovedAt != nil {
+			continue
+		} else if _, found := seen[le.TrackId]; found == true {
+			continue
+		}
+
+		ids = append(ids, le.TrackId)
+		seen[le.TrackId] = true
+	}
+
+	return ids
+}
+
+// MarkRemoved records that the given tracks were removed from the given
+// playlist and writes the ledger.
+func (l *Ledger) MarkRemoved(playlistId spotify.ID, ids []spotify.ID) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	removed := make(map[spotify.ID]bool)
+	for _, id := range ids {
+		removed[id] = true
+	}
+
+	now := time.Now()
+
+	entries := l.Playlists[playlistId]
+	for j, le := range entries {
+		if le.RemovedAt != nil {
+			continue
+		} else if _, found := removed[le.TrackId]; found == false {
+			continue
+		}
+
+		entries[j].RemovedAt = &now
+	}
+
+	err = l.save()
+	log.PanicIf(err)
+
+	return nil
+}
+
+// save writes the ledger to a temporary file and then moves it into place so
+// that we never leave a partially-written ledger behind.
+func (l *Ledger) save() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := ioutil.TempFile(filepath.Dir(l.filepath), ".ledger")
+	log.PanicIf(err)
+
+	tempFilepath := f.Name()
+
+	e := json.NewEncoder(f)
+	e.SetIndent("", "  ")
+
+	err = e.Encode(l)
+	if err != nil {
+		f.Close()
+		os.Remove(tempFilepath)
+
+		log.Panic(err)
+	}
+
+	err = f.Close()
+	log.PanicIf(err)
+
+	err = os.Rename(tempFilepath, l.filepath)
+	log.PanicIf(err)
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package gnsssync
+
+import (
+	"path"
+	"reflect"
+	"testing"
+
+	"io/ioutil"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestLedger_RoundTrip(t *testing.T) {
+	tempPath := t.TempDir()
+	ledgerFilepath := path.Join(tempPath, "ledger.json")
+
+	l, err := LoadLedger(ledgerFilepath)
+	if err != nil {
+		t.Fatalf("Could not load missing ledger: %s", err)
+	} else if len(l.Active("playlist1")) != 0 {
+		t.Fatalf("New ledger should be empty.")
+	}
+
+	err = l.Append("playlist1", []spotify.ID{"track1", "track2", "track3"})
+	if err != nil {
+		t.Fatalf("Could not append: %s", err)
+	}
+
+	err = l.Append("playlist2", []spotify.ID{"track1"})
+	if err != nil {
+		t.Fatalf("Could not append to second playlist: %s", err)
+	}
+
+	err = l.MarkRemoved("playlist1", []spotify.ID{"track2"})
+	if err != nil {
+		t.Fatalf("Could not mark removed: %s", err)
+	}
+
+	// Re-adding a removed track makes it active again without losing the
+	// removal.
+
+	err = l.Append("playlist1", []spotify.ID{"track2"})
+	if err != nil {
+		t.Fatalf("Could not re-append: %s", err)
+	}
+
+	// Only the ledger should be left; the temporary files were renamed into
+	// place.
+
+	fis, err := ioutil.ReadDir(tempPath)
+	if err != nil {
+		t.Fatalf("Could not list directory: %s", err)
+	} else if len(fis) != 1 || fis[0].Name() != "ledger.json" {
+		t.Fatalf("Temporary files were left behind: %v", fis)
+	}
+
+	recovered, err := LoadLedger(ledgerFilepath)
+	if err != nil {
+		t.Fatalf("Could not reload ledger: %s", err)
+	}
+
+	expected := []spotify.ID{"track1", "track3", "track2"}
+	if active := recovered.Active("playlist1"); reflect.DeepEqual(active, expected) == false {
+		t.Fatalf("Active tracks not correct: %v != %v", active, expected)
+	}
+
+	expected = []spotify.ID{"track1"}
+	if active := recovered.Active("playlist2"); reflect.DeepEqual(active, expected) == false {
+		t.Fatalf("Active tracks of second playlist not correct: %v != %v", active, expected)
+	}
+
+	entries := recovered.Playlists["playlist1"]
+	if len(entries) != 4 {
+		t.Fatalf("Entries should never be deleted: (%d)", len(entries))
+	} else if entries[1].TrackId != "track2" || entries[1].RemovedAt == nil {
+		t.Fatalf("Removal not recorded: %v", entries[1])
+	} else if entries[3].RemovedAt != nil {
+		t.Fatalf("Re-added entry should not be removed: %v", entries[3])
+	}
+}
@@ -0,0 +1,185 @@
+package gnsssync
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// FileLogAdapter is a logging adapter that writes to a file. If a maximum
+// size is given, the file is rotated (to the same path with a ".1" suffix)
+// once it grows past it.
+type FileLogAdapter struct {
+	filepath string
+	maxSize  int64
+
+	m    sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// NewFileLogAdapter opens (or creates) the given log file for appending. A
+// `maxSize` of zero disables rotation.
+func NewFileLogAdapter(filepath string, maxSize int64) (fla *FileLogAdapter, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	fla = &FileLogAdapter{
+		filepath: filepath,
+		maxSize:  maxSize,
+	}
+
+	err = fla.open()
+	log.PanicIf(err)
+
+	return fla, nil
+}
+
+func (fla *FileLogAdapter) open() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.OpenFile(fla.filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	log.PanicIf(err)
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		log.Panic(err)
+	}
+
+	fla.f = f
+	fla.size = fi.Size()
+
+	return nil
+}
+
+// rotate moves the current file aside and starts a new one.
+func (fla *FileLogAdapter) rotate() (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = fla.f.Close()
+	log.PanicIf(err)
+
+	err = os.Rename(fla.filepath, fla.filepath+".1")
+	log.PanicIf(err)
+
+	err = fla.open()
+	log.PanicIf(err)
+
+	return nil
+}
+
+func (fla *FileLogAdapter) write(lc *log.LogContext, levelName string, message *string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	fla.m.Lock()
+	defer fla.m.Unlock()
+
+	if fla.maxSize > 0 && fla.size >= fla.maxSize {
+		err := fla.rotate()
+		log.PanicIf(err)
+	}
+
+	line := fmt.Sprintf("%s %s: [%s] %s\n", time.Now().Format("2006/01/02 15:04:05"), lc.Logger.Noun(), levelName, *message)
+
+	n, err := fla.f.WriteString(line)
+	fla.size += int64(n)
+
+	log.PanicIf(err)
+
+	return nil
+}
+
+func (fla *FileLogAdapter) Debugf(lc *log.LogContext, message *string) error {
+	return fla.write(lc, "DEBUG", message)
+}
+
+func (fla *FileLogAdapter) Infof(lc *log.LogContext, message *string) error {
+	return fla.write(lc, "INFO", message)
+}
+
+func (fla *FileLogAdapter) Warningf(lc *log.LogContext, message *string) error {
+	return fla.write(lc, "WARNING", message)
+}
+
+func (fla *FileLogAdapter) Errorf(lc *log.LogContext, message *string) error {
+	return fla.write(lc, "ERROR", message)
+}
+
+// Close closes the log file.
+func (fla *FileLogAdapter) Close() error {
+	fla.m.Lock()
+	defer fla.m.Unlock()
+
+	return fla.f.Close()
+}
+
+// MultiLogAdapter is a logging adapter that passes every message to each of
+// several other adapters (e.g. the console and a file).
+type MultiLogAdapter struct {
+	adapters []log.LogAdapter
+}
+
+func NewMultiLogAdapter(adapters ...log.LogAdapter) *MultiLogAdapter {
+	return &MultiLogAdapter{
+		adapters: adapters,
+	}
+}
+
+func (mla *MultiLogAdapter) Debugf(lc *log.LogContext, message *string) (err error) {
+	for _, la := range mla.adapters {
+		if currentErr := la.Debugf(lc, message); currentErr != nil && err == nil {
+			err = currentErr
+		}
+	}
+
+	return err
+}
+
+func (mla *MultiLogAdapter) Infof(lc *log.LogContext, message *string) (err error) {
+	for _, la := range mla.adapters {
+		if currentErr := la.Infof(lc, message); currentErr != nil && err == nil {
+			err = currentErr
+		}
+	}
+
+	return err
+}
+
+func (mla *MultiLogAdapter) Warningf(lc *log.LogContext, message *string) (err error) {
+	for _, la := range mla.adapters {
+		if currentErr := la.Warningf(lc, message); currentErr != nil && err == nil {
+			err = currentErr
+		}
+	}
+
+	return err
+}
+
+func (mla *MultiLogAdapter) Errorf(lc *log.LogContext, message *string) (err error) {
+	for _, la := range mla.adapters {
+		if currentErr := la.Errorf(lc, message); currentErr != nil && err == nil {
+			err = currentErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,144 @@
+package gnsssync
+
+import (
+	"strings"
+	"testing"
+
+	"io/ioutil"
+	"path"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// recordingLogAdapter keeps the messages that it's given.
+type recordingLogAdapter struct {
+	messages []string
+}
+
+func (rla *recordingLogAdapter) record(levelName string, message *string) error {
+	rla.messages = append(rla.messages, levelName+" "+*message)
+	return nil
+}
+
+func (rla *recordingLogAdapter) Debugf(lc *log.LogContext, message *string) error {
+	return rla.record("DEBUG", message)
+}
+
+func (rla *recordingLogAdapter) Infof(lc *log.LogContext, message *string) error {
+	return rla.record("INFO", message)
+}
+
+func (rla *recordingLogAdapter) Warningf(lc *log.LogContext, message *string) error {
+	return rla.record("WARNING", message)
+}
+
+func (rla *recordingLogAdapter) Errorf(lc *log.LogContext, message *string) error {
+	return rla.record("ERROR", message)
+}
+
+// readLogLines returns the lines in the given log file.
+func readLogLines(t *testing.T, filepath string) []string {
+	data, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		t.Fatalf("Could not read log [%s]: %s", filepath, err)
+	}
+
+	return strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+}
+
+func TestFileLogAdapter_Write(t *testing.T) {
+	logFilepath := path.Join(t.TempDir(), "sync.log")
+
+	fla, err := NewFileLogAdapter(logFilepath, 0)
+	if err != nil {
+		t.Fatalf("Could not open log: %s", err)
+	}
+
+	lc := &log.LogContext{
+		Logger: log.NewLogger("gnss.test"),
+	}
+
+	first := "first message"
+	second := "second message"
+
+	fla.Infof(lc, &first)
+	fla.Errorf(lc, &second)
+
+	err = fla.Close()
+	if err != nil {
+		t.Fatalf("Could not close log: %s", err)
+	}
+
+	lines := readLogLines(t, logFilepath)
+	if len(lines) != 2 {
+		t.Fatalf("Expected two lines: %v", lines)
+	} else if strings.HasSuffix(lines[0], " gnss.test: [INFO] first message") == false {
+		t.Fatalf("First line not correct: [%s]", lines[0])
+	} else if strings.HasSuffix(lines[1], " gnss.test: [ERROR] second message") == false {
+		t.Fatalf("Second line not correct: [%s]", lines[1])
+	}
+
+	// Reopening appends rather than truncating.
+
+	fla, err = NewFileLogAdapter(logFilepath, 0)
+	if err != nil {
+		t.Fatalf("Could not reopen log: %s", err)
+	}
+
+	third := "third message"
+	fla.Warningf(lc, &third)
+	fla.Close()
+
+	if lines := readLogLines(t, logFilepath); len(lines) != 3 {
+		t.Fatalf("Log not appended to: %v", lines)
+	}
+}
+
+func TestFileLogAdapter_Rotate(t *testing.T) {
+	logFilepath := path.Join(t.TempDir(), "sync.log")
+
+	// Small enough that every line starts a new file.
+	fla, err := NewFileLogAdapter(logFilepath, 10)
+	if err != nil {
+		t.Fatalf("Could not open log: %s", err)
+	}
+
+	lc := &log.LogContext{
+		Logger: log.NewLogger("gnss.test"),
+	}
+
+	for _, message := range []string{"one", "two", "three"} {
+		fla.Infof(lc, &message)
+	}
+
+	fla.Close()
+
+	if lines := readLogLines(t, logFilepath); len(lines) != 1 || strings.HasSuffix(lines[0], "three") == false {
+		t.Fatalf("Current log not correct: %v", lines)
+	} else if lines := readLogLines(t, logFilepath+".1"); len(lines) != 1 || strings.HasSuffix(lines[0], "two") == false {
+		t.Fatalf("Rotated log not correct: %v", lines)
+	}
+}
+
+func TestMultiLogAdapter(t *testing.T) {
+	first := new(recordingLogAdapter)
+	second := new(recordingLogAdapter)
+
+	mla := NewMultiLogAdapter(first, second)
+
+	lc := &log.LogContext{
+		Logger: log.NewLogger("gnss.test"),
+	}
+
+	message := "hello"
+	mla.Infof(lc, &message)
+	mla.Debugf(lc, &message)
+
+	expected := []string{"INFO hello", "DEBUG hello"}
+
+	for _, rla := range []*recordingLogAdapter{first, second} {
+		if strings.Join(rla.messages, "|") != strings.Join(expected, "|") {
+			t.Fatalf("Messages not passed on: %v", rla.messages)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package gnsssync
+
+import (
+	"testing"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestNormalizeMarketName(t *testing.T) {
+	cases := []struct {
+		raw        string
+		normalized string
+	}{
+		{"US", "US"},
+		{"us", "US"},
+		{" gb ", "GB"},
+		{"De", "DE"},
+	}
+
+	for _, c := range cases {
+		normalized, err := NormalizeMarketName(c.raw)
+		if err != nil {
+			t.Fatalf("[%s] valid market rejected: %s", c.raw, err)
+		} else if normalized != c.normalized {
+			t.Fatalf("[%s] normalized market not correct: [%s] != [%s]", c.raw, normalized, c.normalized)
+		}
+	}
+}
+
+func TestNormalizeMarketName_Invalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"USA",
+		"us-east",
+		"U",
+		"XX",
+		"1A",
+	}
+
+	for _, raw := range invalid {
+		_, err := NormalizeMarketName(raw)
+		if err == nil {
+			t.Fatalf("[%s] invalid market accepted.", raw)
+		} else if log.Is(err, ErrInvalidMarket) == false {
+			t.Fatalf("[%s] wrong error: %s", raw, err)
+		}
+	}
+}
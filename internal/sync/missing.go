@@ -0,0 +1,90 @@
+package gnsssync
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// Reasons that a track is missing.
+const (
+	MissingReasonArtistNotFound  = "artist-not-found"
+	MissingReasonAlbumNotFound   = "album-not-found"
+	MissingReasonTrackNotFound   = "track-not-found"
+	MissingReasonAlbumIncomplete = "album-incomplete"
+	MissingReasonUnplayable      = "unplayable"
+	MissingReasonDuration        = "duration"
+	MissingReasonLookupFailed    = "lookup-failed"
+)
+
+// MissingTrack is a favorited track that we couldn't add.
+type MissingTrack struct {
+	NormalizedTrack
+
+	// Reason is why the track couldn't be added (one of the MissingReason*
+	// constants).
+	Reason string `json:"reason"`
+
+	// Nearest is the closest album (if the album wasn't found) or track (if
+	// the track wasn't found) that we saw, if we were told to look.
+	Nearest *NearestCandidate `json:"nearest,omitempty"`
+}
+
+// missingReport is the on-disk form of the tracks that we couldn't add. It can
+// be fed back in to retry just those tracks.
+type missingReport struct {
+	Tracks []*MissingTrack `json:"tracks"`
+}
+
+// WriteMissingReport writes the given missing tracks to a JSON file.
+func WriteMissingReport(filepath string, missingTracks []*MissingTrack) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.Create(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	mr := missingReport{
+		Tracks: missingTracks,
+	}
+
+	e := json.NewEncoder(f)
+	e.SetIndent("", "  ")
+
+	err = e.Encode(mr)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// ReadMissingReport reads missing tracks from a JSON file written by
+// WriteMissingReport.
+func ReadMissingReport(filepath string) (missingTracks []*MissingTrack, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.Open(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	mr := missingReport{}
+
+	err = json.NewDecoder(f).Decode(&mr)
+	log.PanicIf(err)
+
+	if mr.Tracks == nil {
+		mr.Tracks = make([]*MissingTrack, 0)
+	}
+
+	return mr.Tracks, nil
+}
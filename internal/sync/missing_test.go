@@ -0,0 +1,73 @@
+package gnsssync
+
+import (
+	"path"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestGetTracksToAdd_RetryMissing(t *testing.T) {
+	fsc := newTestCatalog()
+	fsc.addArtist("artist2", "Other Artist")
+	fsc.addAlbum("artist2", "album2", "Their Album", "album", "2000-01-01", "Their Song")
+
+	// Only these are retried, even though the rest of the album (and the
+	// other artist) could be matched, too.
+
+	missingTracks := []*MissingTrack{
+		{
+			NormalizedTrack: NormalizedTrack{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+			Reason:          MissingReasonAlbumNotFound,
+		},
+		{
+			NormalizedTrack: NormalizedTrack{ArtistName: "Nobody", AlbumName: "Nothing", TrackName: "Ghost"},
+			Reason:          MissingReasonArtistNotFound,
+		},
+	}
+
+	reportFilepath := path.Join(t.TempDir(), "missing.json")
+
+	err := WriteMissingReport(reportFilepath, missingTracks)
+	if err != nil {
+		t.Fatalf("Could not write report: %s", err)
+	}
+
+	i := newTestImporterWithoutFavorites(fsc, SpotifyReadBatchSize, "")
+	i.SetRetryMissingFilepath(reportFilepath)
+
+	tracks, err := i.GetTracksToAdd("Target", []string{}, "")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	expected := map[spotify.ID]bool{"album1-2": true}
+
+	actual := make(map[spotify.ID]bool)
+	for id, _ := range tracks {
+		actual[id] = true
+	}
+
+	if reflect.DeepEqual(actual, expected) == false {
+		t.Fatalf("Only the listed misses should have been matched: %v", actual)
+	}
+
+	artistNames := make([]string, 0)
+	for _, ar := range i.MatchReport().Artists {
+		artistNames = append(artistNames, ar.ArtistName)
+	}
+
+	sort.Strings(artistNames)
+
+	if reflect.DeepEqual(artistNames, []string{"Nobody", "The Band"}) == false {
+		t.Fatalf("Only the artists in the report should have been matched: %v", artistNames)
+	}
+
+	if len(i.missingTracks) != 1 || i.missingTracks[0].TrackName != "Ghost" {
+		t.Fatalf("Remaining misses not correct: %v", i.missingTracks)
+	} else if i.Stats().FavoritesCount != 2 {
+		t.Fatalf("Favorites count not correct: (%d)", i.Stats().FavoritesCount)
+	}
+}
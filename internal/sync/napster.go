@@ -0,0 +1,195 @@
+package gnsssync
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"net/http"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/dsoprea/go-napster"
+)
+
+// Config
+const (
+	// NapsterRateLimitRetries is how many times we'll retry a Napster call
+	// that was rate-limited before giving up.
+	NapsterRateLimitRetries = 5
+
+	// NapsterPagingRestarts is how many times we'll start reading the
+	// favorites over if they change while we're reading them.
+	NapsterPagingRestarts = 3
+
+	// NapsterMinBatchSize is the smallest that we'll shrink the batch-size to
+	// when Napster can't handle the requests at the size that we were given.
+	NapsterMinBatchSize = 10
+
+	// napsterRateLimitInitialBackoff is how long we'll wait after the first
+	// rate-limited response if the server didn't tell us how long to wait.
+	// This doubles with each subsequent attempt.
+	napsterRateLimitInitialBackoff = time.Second * 2
+)
+
+// Errors
+var (
+	ErrNapsterRateLimited = fmt.Errorf("napster rate-limit retries exhausted")
+)
+
+// Misc
+var (
+	nLog = log.NewLogger("gnss.napster")
+)
+
+// NapsterMemberClient is the part of the authenticated Napster client that we
+// use.
+type NapsterMemberClient interface {
+	GetFavoriteTracks(offset, limit int) (favorites []napster.FavoriteInfo, err error)
+}
+
+// NapsterMetadataClient is the part of the Napster metadata client that we
+// use.
+type NapsterMetadataClient interface {
+	GetTrackDetail(trackIds ...string) (tracks []napster.MetadataTrackDetail, err error)
+}
+
+// napsterRateLimitTransport is an `http.RoundTripper` that watches Napster
+// responses for rate-limiting so that the calls (which are made by the
+// Napster client and only return opaque errors) can be retried.
+type napsterRateLimitTransport struct {
+	base http.RoundTripper
+
+	m          sync.Mutex
+	limited    bool
+	retryAfter time.Duration
+
+	// tooLarge is set if the last call was rejected for being too big or
+	// timed out (which, for a big page, is usually the same thing).
+	tooLarge bool
+}
+
+func newNapsterRateLimitTransport(base http.RoundTripper) *napsterRateLimitTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &napsterRateLimitTransport{
+		base: base,
+	}
+}
+
+func (nrlt *napsterRateLimitTransport) RoundTrip(r *http.Request) (response *http.Response, err error) {
+	response, err = nrlt.base.RoundTrip(r)
+	if err != nil {
+		if ne, ok := err.(net.Error); ok == true && ne.Timeout() == true {
+			nrlt.m.Lock()
+			nrlt.tooLarge = true
+			nrlt.m.Unlock()
+		}
+
+		return nil, err
+	}
+
+	if response.StatusCode == http.StatusRequestEntityTooLarge || response.StatusCode == http.StatusRequestURITooLong || response.StatusCode == http.StatusGatewayTimeout {
+		nrlt.m.Lock()
+		nrlt.tooLarge = true
+		nrlt.m.Unlock()
+	} else if response.StatusCode == http.StatusTooManyRequests {
+		retryAfter, _ := parseRetryAfter(response.Header.Get("Retry-After"))
+
+		nrlt.m.Lock()
+		nrlt.limited = true
+		nrlt.retryAfter = retryAfter
+		nrlt.m.Unlock()
+	}
+
+	return response, nil
+}
+
+// reset clears the rate-limit state ahead of a new call.
+func (nrlt *napsterRateLimitTransport) reset() {
+	nrlt.m.Lock()
+	defer nrlt.m.Unlock()
+
+	nrlt.limited = false
+	nrlt.retryAfter = 0
+	nrlt.tooLarge = false
+}
+
+// wasTooLarge returns whether the last call was rejected for being too big
+// or timed out.
+func (nrlt *napsterRateLimitTransport) wasTooLarge() bool {
+	nrlt.m.Lock()
+	defer nrlt.m.Unlock()
+
+	return nrlt.tooLarge
+}
+
+// shrinkNapsterBatchSize halves the batch-size, but not below the minimum.
+func shrinkNapsterBatchSize(batchSize int) int {
+	batchSize /= 2
+	if batchSize < NapsterMinBatchSize {
+		batchSize = NapsterMinBatchSize
+	}
+
+	return batchSize
+}
+
+// state returns whether the last call was rate-limited and, if the server
+// told us, how long to wait (otherwise zero).
+func (nrlt *napsterRateLimitTransport) state() (limited bool, retryAfter time.Duration) {
+	nrlt.m.Lock()
+	defer nrlt.m.Unlock()
+
+	return nrlt.limited, nrlt.retryAfter
+}
+
+// parseRetryAfter parses a "Retry-After" header, which may either be a number
+// of seconds or an HTTP date.
+func parseRetryAfter(raw string) (retryAfter time.Duration, found bool) {
+	if raw == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		if seconds < 0 {
+			seconds = 0
+		}
+
+		return time.Second * time.Duration(seconds), true
+	}
+
+	if t, err := http.ParseTime(raw); err == nil {
+		retryAfter = t.Sub(time.Now())
+		if retryAfter < 0 {
+			retryAfter = 0
+		}
+
+		return retryAfter, true
+	}
+
+	return 0, false
+}
+
+// withNapsterRetry runs the given Napster call, retrying it with backoff for
+// as long as it fails due to rate-limiting.
+func withNapsterRetry(nrlt *napsterRateLimitTransport, description string, cb func() error) (err error) {
+	policy := RetryPolicy{
+		MaxRetries:     NapsterRateLimitRetries,
+		InitialBackoff: napsterRateLimitInitialBackoff,
+		Classify: func(err error) (retryable bool, retryAfter time.Duration) {
+			limited, retryAfter := nrlt.state()
+			if limited == true {
+				nLog.Warningf(nil, "Napster rate-limited us: %s", description)
+			}
+
+			return limited, retryAfter
+		},
+		BeforeAttempt: nrlt.reset,
+		ExhaustedErr:  ErrNapsterRateLimited,
+	}
+
+	return withRetry(policy, description, cb)
+}
@@ -0,0 +1,228 @@
+package gnsssync
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	inFuture := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	inPast := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+
+	cases := []struct {
+		raw        string
+		found      bool
+		retryAfter time.Duration
+	}{
+		{"", false, 0},
+		{"0", true, 0},
+		{"5", true, time.Second * 5},
+		{"-3", true, 0},
+		{"soon", false, 0},
+		{inPast, true, 0},
+	}
+
+	for _, c := range cases {
+		retryAfter, found := parseRetryAfter(c.raw)
+		if found != c.found {
+			t.Fatalf("[%s] found mismatch: (%v) != (%v)", c.raw, found, c.found)
+		} else if retryAfter != c.retryAfter {
+			t.Fatalf("[%s] wait mismatch: [%s] != [%s]", c.raw, retryAfter, c.retryAfter)
+		}
+	}
+
+	// An HTTP date is relative to now, so only check that it's close.
+
+	retryAfter, found := parseRetryAfter(inFuture)
+	if found != true {
+		t.Fatalf("HTTP date not parsed.")
+	} else if retryAfter < time.Minute*59 || retryAfter > time.Hour {
+		t.Fatalf("HTTP date wait not correct: [%s]", retryAfter)
+	}
+}
+
+// napsterTestServer returns a server that rate-limits the first `limitedCount`
+// requests and then succeeds. The number of requests is counted in `calls`.
+func napsterTestServer(limitedCount int, retryAfter string, calls *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+
+		if *calls <= limitedCount {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		fmt.Fprintf(w, "{}")
+	}))
+}
+
+// napsterTestGet does a request like the Napster client would: it only
+// returns an opaque error if the status wasn't a success.
+func napsterTestGet(hc *http.Client, url string) (err error) {
+	response, err := hc.Get(url)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	_, err = ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("request failed: (%d)", response.StatusCode)
+	}
+
+	return nil
+}
+
+func TestWithNapsterRetry_RateLimitedThenOk(t *testing.T) {
+	calls := 0
+
+	s := napsterTestServer(1, "1", &calls)
+	defer s.Close()
+
+	nrlt := newNapsterRateLimitTransport(nil)
+	hc := &http.Client{Transport: nrlt}
+
+	startedAt := time.Now()
+
+	err := withNapsterRetry(nrlt, "test call", func() error {
+		return napsterTestGet(hc, s.URL)
+	})
+
+	if err != nil {
+		t.Fatalf("Call should have succeeded after retrying: %s", err)
+	} else if calls != 2 {
+		t.Fatalf("Expected one retry: (%d) calls", calls)
+	} else if time.Since(startedAt) < time.Second {
+		t.Fatalf("Retry-After wasn't respected.")
+	}
+}
+
+func TestWithNapsterRetry_NotRateLimited(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+
+	defer s.Close()
+
+	nrlt := newNapsterRateLimitTransport(nil)
+	hc := &http.Client{Transport: nrlt}
+
+	calls := 0
+	err := withNapsterRetry(nrlt, "test call", func() error {
+		calls++
+		return napsterTestGet(hc, s.URL)
+	})
+
+	if err == nil {
+		t.Fatalf("Expected the error to be returned.")
+	} else if calls != 1 {
+		t.Fatalf("Errors other than rate-limiting shouldn't be retried: (%d) calls", calls)
+	}
+}
+
+func TestNapsterRateLimitTransport_State(t *testing.T) {
+	calls := 0
+
+	s := napsterTestServer(1, "7", &calls)
+	defer s.Close()
+
+	nrlt := newNapsterRateLimitTransport(nil)
+	hc := &http.Client{Transport: nrlt}
+
+	err := napsterTestGet(hc, s.URL)
+	if err == nil {
+		t.Fatalf("Expected the rate-limited call to fail.")
+	}
+
+	limited, retryAfter := nrlt.state()
+	if limited != true {
+		t.Fatalf("Rate-limiting not recorded.")
+	} else if retryAfter != time.Second*7 {
+		t.Fatalf("Retry-After not recorded: [%s]", retryAfter)
+	}
+
+	nrlt.reset()
+
+	err = napsterTestGet(hc, s.URL)
+	if err != nil {
+		t.Fatalf("Second call should have succeeded: %s", err)
+	}
+
+	limited, _ = nrlt.state()
+	if limited != false {
+		t.Fatalf("Rate-limiting should have been cleared.")
+	}
+}
+
+func TestNapsterRateLimitTransport_TooLarge(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("limit") == "200" {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		fmt.Fprintf(w, "{}")
+	}))
+
+	defer s.Close()
+
+	nrlt := newNapsterRateLimitTransport(nil)
+	hc := &http.Client{Transport: nrlt}
+
+	err := napsterTestGet(hc, s.URL+"?limit=200")
+	if err == nil {
+		t.Fatalf("Expected the big request to fail.")
+	} else if nrlt.wasTooLarge() != true {
+		t.Fatalf("Too-large request not recorded.")
+	}
+
+	// Being too large isn't rate-limiting.
+
+	limited, _ := nrlt.state()
+	if limited != false {
+		t.Fatalf("Too-large request shouldn't count as rate-limited.")
+	}
+
+	nrlt.reset()
+
+	err = napsterTestGet(hc, s.URL+"?limit=100")
+	if err != nil {
+		t.Fatalf("Smaller request should have succeeded: %s", err)
+	} else if nrlt.wasTooLarge() != false {
+		t.Fatalf("Too-large flag should have been cleared.")
+	}
+}
+
+func TestShrinkNapsterBatchSize(t *testing.T) {
+	cases := []struct {
+		batchSize int
+		expected  int
+	}{
+		{200, 100},
+		{100, 50},
+		{25, 12},
+		{15, NapsterMinBatchSize},
+		{NapsterMinBatchSize, NapsterMinBatchSize},
+	}
+
+	for _, c := range cases {
+		actual := shrinkNapsterBatchSize(c.batchSize)
+		if actual != c.expected {
+			t.Fatalf("Shrunk batch-size for (%d) not correct: (%d) != (%d)", c.batchSize, actual, c.expected)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package gnsssync
+
+import (
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// NearestCandidate is the Spotify name that came closest to one that we
+// couldn't find.
+type NearestCandidate struct {
+	Name string `json:"name"`
+
+	// Score is the similarity of the names from zero (nothing in common) to
+	// one (equal once normalized).
+	Score float64 `json:"score"`
+}
+
+type nearestAlbumKey struct {
+	artistId  spotify.ID
+	albumName string
+}
+
+type nearestTrackKey struct {
+	albumId   spotify.ID
+	trackName string
+}
+
+// nameSimilarity scores how alike two already-normalized names are, from zero
+// to one, based on their edit-distance.
+func nameSimilarity(a, b string) float64 {
+	maxLen := len([]rune(a))
+	if bLen := len([]rune(b)); bLen > maxLen {
+		maxLen = bLen
+	}
+
+	if maxLen == 0 {
+		return 1.0
+	}
+
+	return 1.0 - float64(levenshteinDistance(a, b))/float64(maxLen)
+}
+
+// findNearest returns the candidate that's most like the given name.
+func (sa *SpotifyAdapter) findNearest(name string, candidateNames []string) (nc NearestCandidate, found bool) {
+	normalized := sa.normalizeTitle(name)
+
+	for _, candidateName := range candidateNames {
+		score := nameSimilarity(normalized, sa.normalizeTitle(candidateName))
+
+		if found == false || score > nc.Score {
+			nc = NearestCandidate{
+				Name:  candidateName,
+				Score: score,
+			}
+
+			found = true
+		}
+	}
+
+	return nc, found
+}
+
+// SetAnnotateNearest has us remember the closest candidates for the albums
+// and tracks that we can't find so that they can be reported.
+func (sa *SpotifyAdapter) SetAnnotateNearest(annotateNearest bool) {
+	sa.annotateNearest = annotateNearest
+}
+
+// recordAlbumCandidates remembers the closest of the albums that we saw under
+// the artist while failing to find the given album.
+func (sa *SpotifyAdapter) recordAlbumCandidates(artistId spotify.ID, albumName string, candidateNames []string) {
+	if sa.annotateNearest == false {
+		return
+	}
+
+	nc, found := sa.findNearest(albumName, candidateNames)
+	if found == false {
+		return
+	}
+
+	nak := nearestAlbumKey{
+		artistId:  artistId,
+		albumName: strings.ToLower(albumName),
+	}
+
+	sa.nearestLock.Lock()
+	defer sa.nearestLock.Unlock()
+
+	if sa.nearestAlbums == nil {
+		sa.nearestAlbums = make(map[nearestAlbumKey]NearestCandidate)
+	}
+
+	if existing, found := sa.nearestAlbums[nak]; found == false || nc.Score > existing.Score {
+		sa.nearestAlbums[nak] = nc
+	}
+}
+
+// recordAlbumFound remembers that the given album was found so that the
+// closest candidates for its missing tracks can be looked up.
+func (sa *SpotifyAdapter) recordAlbumFound(artistId spotify.ID, albumName string, albumId spotify.ID) {
+	if sa.annotateNearest == false {
+		return
+	}
+
+	nak := nearestAlbumKey{
+		artistId:  artistId,
+		albumName: strings.ToLower(albumName),
+	}
+
+	sa.nearestLock.Lock()
+	defer sa.nearestLock.Unlock()
+
+	if sa.foundAlbumIds == nil {
+		sa.foundAlbumIds = make(map[nearestAlbumKey][]spotify.ID)
+	}
+
+	for _, existingId := range sa.foundAlbumIds[nak] {
+		if existingId == albumId {
+			return
+		}
+	}
+
+	sa.foundAlbumIds[nak] = append(sa.foundAlbumIds[nak], albumId)
+}
+
+// recordTrackCandidates remembers the closest of the tracks on the album for
+// the given track that couldn't be found there.
+func (sa *SpotifyAdapter) recordTrackCandidates(albumId spotify.ID, trackName string, tracks map[string]spotify.ID) {
+	if sa.annotateNearest == false {
+		return
+	}
+
+	candidateNames := make([]string, 0, len(tracks))
+	for candidateName, _ := range tracks {
+		candidateNames = append(candidateNames, candidateName)
+	}
+
+	nc, found := sa.findNearest(trackName, candidateNames)
+	if found == false {
+		return
+	}
+
+	ntk := nearestTrackKey{
+		albumId:   albumId,
+		trackName: sa.normalizeTitle(trackName),
+	}
+
+	sa.nearestLock.Lock()
+	defer sa.nearestLock.Unlock()
+
+	if sa.nearestTracks == nil {
+		sa.nearestTracks = make(map[nearestTrackKey]NearestCandidate)
+	}
+
+	sa.nearestTracks[ntk] = nc
+}
+
+// NearestAlbum returns the closest album that we saw under any of the
+// matching artists for an album that couldn't be found.
+func (sa *SpotifyAdapter) NearestAlbum(artistName, albumName string) (nc NearestCandidate, found bool, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	artistIds, err := sa.searchSpotifyArtists(artistName)
+	if log.Is(err, ErrSpotifyArtistNotFound) == true {
+		return NearestCandidate{}, false, nil
+	} else if err != nil {
+		log.Panic(err)
+	}
+
+	sa.nearestLock.Lock()
+	defer sa.nearestLock.Unlock()
+
+	for _, artistId := range artistIds {
+		nak := nearestAlbumKey{
+			artistId:  artistId,
+			albumName: strings.ToLower(albumName),
+		}
+
+		if current, currentFound := sa.nearestAlbums[nak]; currentFound == true && (found == false || current.Score > nc.Score) {
+			nc = current
+			found = true
+		}
+	}
+
+	return nc, found, nil
+}
+
+// NearestTrack returns the closest track that we saw on any of the matching
+// albums for a track that couldn't be found.
+func (sa *SpotifyAdapter) NearestTrack(artistName, albumName, trackName string) (nc NearestCandidate, found bool, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	artistIds, err := sa.searchSpotifyArtists(artistName)
+	if log.Is(err, ErrSpotifyArtistNotFound) == true {
+		return NearestCandidate{}, false, nil
+	} else if err != nil {
+		log.Panic(err)
+	}
+
+	normalizedTrackName := sa.normalizeTitle(trackName)
+
+	sa.nearestLock.Lock()
+	defer sa.nearestLock.Unlock()
+
+	for _, artistId := range artistIds {
+		nak := nearestAlbumKey{
+			artistId:  artistId,
+			albumName: strings.ToLower(albumName),
+		}
+
+		for _, albumId := range sa.foundAlbumIds[nak] {
+			ntk := nearestTrackKey{
+				albumId:   albumId,
+				trackName: normalizedTrackName,
+			}
+
+			if current, currentFound := sa.nearestTracks[ntk]; currentFound == true && (found == false || current.Score > nc.Score) {
+				nc = current
+				found = true
+			}
+		}
+	}
+
+	return nc, found, nil
+}
@@ -0,0 +1,57 @@
+package gnsssync
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetTracksToAdd_AnnotateNearest(t *testing.T) {
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closing"},
+		{ArtistName: "The Band", AlbumName: "Last Album", TrackName: "Finale"},
+	}
+
+	for _, annotateNearest := range []bool{false, true} {
+		fsc := newTestCatalog()
+
+		i := newTestImporter(t, fsc, "", favorites...)
+		i.SetAnnotateNearest(annotateNearest)
+
+		_, err := i.GetTracksToAdd("Target", []string{"the band"}, "")
+		if err != nil {
+			t.Fatalf("Could not get tracks: %s", err)
+		}
+
+		nearest := make(map[string]NearestCandidate)
+		for _, mt := range i.missingTracks {
+			if mt.Nearest != nil {
+				nearest[mt.Reason] = *mt.Nearest
+			}
+		}
+
+		if len(i.missingTracks) != 2 {
+			t.Fatalf("Expected both favorites to be missing: %v", i.missingTracks)
+		}
+
+		if annotateNearest == false {
+			if len(nearest) != 0 {
+				t.Fatalf("Nearest candidates should only be reported when asked for: %v", nearest)
+			}
+
+			continue
+		}
+
+		// "last album" is three edits from "first album" and "closing" is
+		// three edits from "closer".
+
+		expected := map[string]NearestCandidate{
+			MissingReasonAlbumNotFound: {Name: "First Album", Score: 1.0 - 3.0/11.0},
+			MissingReasonTrackNotFound: {Name: "closer", Score: 1.0 - 3.0/7.0},
+		}
+
+		if reflect.DeepEqual(nearest, expected) != true {
+			t.Fatalf("Nearest candidates not correct: %v", nearest)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package gnsssync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Config
+const (
+	// spotifyPlaylistTracksUrl is the endpoint for adding tracks to a
+	// playlist.
+	spotifyPlaylistTracksUrl = "https://api.spotify.com/v1/users/%s/playlists/%s/tracks"
+)
+
+// Add positions
+const (
+	AddPositionStart = "start"
+	AddPositionEnd   = "end"
+)
+
+type positionedAddRequest struct {
+	Uris     []string `json:"uris"`
+	Position int      `json:"position"`
+}
+
+// addTracksToPlaylistAt adds the tracks at the given position. The Spotify
+// client only adds to the end, so we do the request ourselves. Errors are
+// returned unwrapped (like the Spotify client's) so that they can be
+// classified for retrying.
+func (sa *SpotifyAdapter) addTracksToPlaylistAt(userId string, playlistId spotify.ID, ids []spotify.ID, position int) (err error) {
+	par := positionedAddRequest{
+		Uris:     make([]string, len(ids)),
+		Position: position,
+	}
+
+	for j, id := range ids {
+		par.Uris[j] = TrackUri(id)
+	}
+
+	body, err := json.Marshal(par)
+	if err != nil {
+		return err
+	}
+
+	requestUrl := fmt.Sprintf(spotifyPlaylistTracksUrl, url.PathEscape(userId), url.PathEscape(string(playlistId)))
+
+	response, err := sa.spotifyAuth.HttpClient.Post(requestUrl, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(response.Body)
+
+		// Return the same error as the Spotify client would.
+		return spotify.Error{
+			Message: fmt.Sprintf("adding tracks failed: %s", strings.TrimSpace(string(message))),
+			Status:  response.StatusCode,
+		}
+	}
+
+	return nil
+}
+
+// isSpotifyBadIdError returns whether Spotify rejected the whole request,
+// which is what happens when one of the IDs in it is invalid (e.g. a track
+// that has since been delisted).
+func isSpotifyBadIdError(err error) bool {
+	switch e := err.(type) {
+	case spotify.Error:
+		return e.Status == http.StatusBadRequest
+	case *spotify.Error:
+		return e.Status == http.StatusBadRequest
+	}
+
+	return false
+}
+
+// addTracksToPlaylist adds the tracks at the given position or, if it's
+// negative, to the end. Errors are returned unwrapped.
+func (sa *SpotifyAdapter) addTracksToPlaylist(userId string, playlistId spotify.ID, ids []spotify.ID, position int) error {
+	return withRetry(sa.retryPolicy, "adding tracks", func() error {
+		if position >= 0 {
+			return sa.addTracksToPlaylistAt(userId, playlistId, ids, position)
+		}
+
+		_, err := sa.spotifyAuth.InstrumentedClient().AddTracksToPlaylist(userId, playlistId, ids...)
+		return err
+	})
+}
+
+// isolateBadIds adds the tracks, splitting them in half and adding each half
+// separately whenever Spotify rejects them because of a bad ID. Only the IDs
+// that are rejected on their own are dropped.
+func (sa *SpotifyAdapter) isolateBadIds(userId string, playlistId spotify.ID, ids []spotify.ID, position int) (added []spotify.ID, dropped []spotify.ID, err error) {
+	// We return copies. `ids` is a slice of the caller's batch, so appending
+	// to it would overwrite the rest of the batch.
+
+	err = sa.addTracksToPlaylist(userId, playlistId, ids, position)
+	if err == nil {
+		return append([]spotify.ID{}, ids...), nil, nil
+	} else if isSpotifyBadIdError(err) == false {
+		return nil, nil, err
+	}
+
+	if len(ids) == 1 {
+		sLog.Warningf(sa.ctx, "Track [%s] was rejected: %s", ids[0], err)
+		return nil, append([]spotify.ID{}, ids...), nil
+	}
+
+	sLog.Debugf(sa.ctx, "Batch of (%d) tracks was rejected. Splitting it to find the bad ID(s): %s", len(ids), err)
+
+	middle := len(ids) / 2
+
+	added, dropped, err = sa.isolateBadIds(userId, playlistId, ids[:middle], position)
+	if err != nil {
+		return added, dropped, err
+	}
+
+	if position >= 0 {
+		position += len(added)
+	}
+
+	secondAdded, secondDropped, err := sa.isolateBadIds(userId, playlistId, ids[middle:], position)
+
+	added = append(added, secondAdded...)
+	dropped = append(dropped, secondDropped...)
+
+	return added, dropped, err
+}
+
+// AddTracksIsolatingBadIds adds the tracks to the playlist starting at the
+// given position or, if it's negative, to the end. If Spotify rejects them
+// because one of the IDs is bad, the bad ones are found (by repeatedly
+// splitting the batch) and dropped so that the rest are still added. The
+// tracks that were added (in order) and the ones that were dropped are
+// returned. If some other error occurs, the tracks that were added before it
+// are still returned.
+func (sa *SpotifyAdapter) AddTracksIsolatingBadIds(userId string, playlistId spotify.ID, ids []spotify.ID, position int) (added []spotify.ID, dropped []spotify.ID, err error) {
+	sLog.Debugf(sa.ctx, "Adding (%d) tracks to playlist [%s].", len(ids), playlistId)
+
+	added, dropped, err = sa.isolateBadIds(userId, playlistId, ids, position)
+	if err != nil {
+		return added, dropped, log.Wrap(err)
+	}
+
+	return added, dropped, nil
+}
@@ -0,0 +1,166 @@
+package gnsssync
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"encoding/json"
+	"net/http"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// positionedAddHandler inserts the tracks that are added to the "target"
+// playlist at the requested position. Any track in `badIds` has the whole
+// request rejected like Spotify does.
+func positionedAddHandler(t *testing.T, playlist *[]spotify.ID, badIds map[spotify.ID]bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/users/tester/playlists/target/tracks" {
+			http.NotFound(w, r)
+			return
+		}
+
+		par := positionedAddRequest{}
+
+		err := json.NewDecoder(r.Body).Decode(&par)
+		if err != nil {
+			t.Errorf("Could not decode request: %s", err)
+
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		ids := make([]spotify.ID, len(par.Uris))
+		for j, uri := range par.Uris {
+			ids[j] = spotify.ID(strings.TrimPrefix(uri, spotifyTrackUriPrefix))
+
+			if badIds[ids[j]] == true {
+				http.Error(w, "Invalid track uri", http.StatusBadRequest)
+				return
+			}
+		}
+
+		updated := make([]spotify.ID, 0, len(*playlist)+len(ids))
+		updated = append(updated, (*playlist)[:par.Position]...)
+		updated = append(updated, ids...)
+		updated = append(updated, (*playlist)[par.Position:]...)
+
+		*playlist = updated
+
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func TestAddTracksIsolatingBadIds_Start(t *testing.T) {
+	playlist := []spotify.ID{"old-1", "old-2"}
+
+	s, hc := newRedirectedClient(t, positionedAddHandler(t, &playlist, nil))
+	defer s.Close()
+
+	sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+	sa.spotifyAuth.HttpClient = hc
+
+	// Add in two batches like the importer does, with the second one going
+	// after the first.
+
+	position := 0
+	for _, batch := range [][]spotify.ID{{"new-1", "new-2"}, {"new-3"}} {
+		added, dropped, err := sa.AddTracksIsolatingBadIds("tester", "target", batch, position)
+		if err != nil {
+			t.Fatalf("Could not add tracks: %s", err)
+		} else if len(dropped) != 0 {
+			t.Fatalf("No tracks should have been dropped: %v", dropped)
+		}
+
+		position += len(added)
+	}
+
+	expected := []spotify.ID{"new-1", "new-2", "new-3", "old-1", "old-2"}
+	if reflect.DeepEqual(playlist, expected) != true {
+		t.Fatalf("Tracks not added at the front: %v", playlist)
+	}
+}
+
+func TestAddTracksIsolatingBadIds_StartWithBadId(t *testing.T) {
+	playlist := []spotify.ID{"old-1"}
+	badIds := map[spotify.ID]bool{"bad": true}
+
+	s, hc := newRedirectedClient(t, positionedAddHandler(t, &playlist, badIds))
+	defer s.Close()
+
+	sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+	sa.spotifyAuth.HttpClient = hc
+
+	added, dropped, err := sa.AddTracksIsolatingBadIds("tester", "target", []spotify.ID{"new-1", "bad", "new-2", "new-3"}, 0)
+	if err != nil {
+		t.Fatalf("Could not add tracks: %s", err)
+	}
+
+	if reflect.DeepEqual(added, []spotify.ID{"new-1", "new-2", "new-3"}) != true {
+		t.Fatalf("Added tracks not correct: %v", added)
+	} else if reflect.DeepEqual(dropped, []spotify.ID{"bad"}) != true {
+		t.Fatalf("Dropped tracks not correct: %v", dropped)
+	}
+
+	// The halves are still added in order at the front.
+
+	expected := []spotify.ID{"new-1", "new-2", "new-3", "old-1"}
+	if reflect.DeepEqual(playlist, expected) != true {
+		t.Fatalf("Tracks not added at the front in order: %v", playlist)
+	}
+}
+
+func TestAddTracksIsolatingBadIds_End(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addPlaylist("target", "Target", fsc.userId, "old-1")
+
+	fsc.badIds["bad-1"] = true
+	fsc.badIds["bad-2"] = true
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	ids := []spotify.ID{"new-1", "bad-1", "new-2", "new-3", "bad-2", "new-4"}
+
+	added, dropped, err := sa.AddTracksIsolatingBadIds(fsc.userId, "target", ids, -1)
+	if err != nil {
+		t.Fatalf("Could not add tracks: %s", err)
+	}
+
+	if reflect.DeepEqual(added, []spotify.ID{"new-1", "new-2", "new-3", "new-4"}) != true {
+		t.Fatalf("Added tracks not correct: %v", added)
+	} else if reflect.DeepEqual(dropped, []spotify.ID{"bad-1", "bad-2"}) != true {
+		t.Fatalf("Dropped tracks not correct: %v", dropped)
+	}
+
+	// The good tracks were added to the end, in order.
+
+	if reflect.DeepEqual(fsc.added["target"], added) != true {
+		t.Fatalf("Tracks not added to the playlist correctly: %v", fsc.added["target"])
+	}
+}
+
+func TestAddTracksIsolatingBadIds_OtherError(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addPlaylist("target", "Target", fsc.userId)
+
+	errUnexpected := fmt.Errorf("unexpected failure")
+	fsc.failNext("AddTracksToPlaylist", errUnexpected)
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	added, dropped, err := sa.AddTracksIsolatingBadIds(fsc.userId, "target", []spotify.ID{"new-1", "new-2"}, -1)
+	if log.Is(err, errUnexpected) != true {
+		t.Fatalf("Expected the error to be returned: [%v]", err)
+	} else if len(added) != 0 || len(dropped) != 0 {
+		t.Fatalf("Nothing should have been added or dropped: %v %v", added, dropped)
+	}
+
+	// The batch isn't split for anything but a bad ID.
+
+	if calls := fsc.callCount("AddTracksToPlaylist"); calls != 1 {
+		t.Fatalf("Batch should not have been split: (%d) calls", calls)
+	}
+}
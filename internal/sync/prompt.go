@@ -0,0 +1,95 @@
+package gnsssync
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Errors
+var (
+	ErrPromptAborted = fmt.Errorf("prompt aborted")
+)
+
+// SetPlaylistPrompt has us ask the user to pick one of their playlists (or to
+// create the playlist) when the named playlist can't be found rather than
+// failing. The prompt is written to `w` and the answer read from `r`.
+func (sc *SpotifyCache) SetPlaylistPrompt(r io.Reader, w io.Writer) {
+	sc.promptReader = bufio.NewReader(r)
+	sc.promptWriter = w
+}
+
+// promptForPlaylist lists the user's playlists and asks which one to use in
+// place of the one that couldn't be found, or whether to create it.
+func (sc *SpotifyCache) promptForPlaylist(spotifyUserId string, playlistName string) (id spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	playlists, err := sc.GetSpotifyPlaylists(spotifyUserId)
+	log.PanicIf(err)
+
+	w := sc.promptWriter
+
+	fmt.Fprintf(w, "Playlist [%s] was not found. Available playlists:\n\n", playlistName)
+
+	for j, p := range playlists {
+		fmt.Fprintf(w, "  (%d) %s\n", j+1, p.Name)
+	}
+
+	fmt.Fprintf(w, "\n")
+
+	for {
+		fmt.Fprintf(w, "Enter the number of the playlist to use, 'c' to create [%s], or 'q' to quit: ", playlistName)
+
+		line, err := sc.promptReader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			log.Panic(ErrPromptAborted)
+		} else if err != nil && err != io.EOF {
+			log.Panic(err)
+		}
+
+		answer := strings.ToLower(strings.TrimSpace(line))
+
+		if answer == "q" {
+			log.Panic(ErrPromptAborted)
+		} else if answer == "c" {
+			fp, err := withRetryValue(sc.retryPolicy, "creating playlist", func() (*spotify.FullPlaylist, error) {
+				return sc.client.CreatePlaylistForUser(spotifyUserId, playlistName, false)
+			})
+
+			log.PanicIf(err)
+
+			sLog.Infof(sc.ctx, "Created playlist [%s]: [%s]", playlistName, fp.ID)
+
+			return fp.ID, nil
+		}
+
+		n, err := strconv.Atoi(answer)
+		if err != nil || n < 1 || n > len(playlists) {
+			fmt.Fprintf(w, "Please enter a number from 1 to %d, 'c', or 'q'.\n", len(playlists))
+			continue
+		}
+
+		p := playlists[n-1]
+
+		err = sc.checkPlaylistWritable(p)
+		if log.Is(err, ErrSpotifyPlaylistNotWritable) == true {
+			fmt.Fprintf(w, "Playlist [%s] can not be changed. Please choose another.\n", p.Name)
+			continue
+		}
+
+		log.PanicIf(err)
+
+		sLog.Infof(sc.ctx, "Using playlist [%s] in place of [%s]: [%s]", p.Name, playlistName, p.ID)
+
+		return p.ID, nil
+	}
+}
@@ -0,0 +1,93 @@
+package gnsssync
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// newTestPromptCache returns a cache whose user has two playlists and that
+// prompts with the given input.
+func newTestPromptCache(input string) (fsc *fakeSpotifyClient, sc *SpotifyCache, output *bytes.Buffer) {
+	fsc = newFakeSpotifyClient()
+	fsc.addPlaylist("first", "First", fsc.userId)
+	fsc.addPlaylist("second", "Second", fsc.userId)
+
+	sc = NewSpotifyCache(context.Background(), newTestSpotifyContext(fsc))
+
+	output = new(bytes.Buffer)
+	sc.SetPlaylistPrompt(strings.NewReader(input), output)
+
+	return fsc, sc, output
+}
+
+func TestGetSpotifyPlaylistId_PromptSelect(t *testing.T) {
+	// The first answer isn't one of the choices, so we're asked again.
+	_, sc, output := newTestPromptCache("3\n2\n")
+
+	id, err := sc.GetSpotifyPlaylistId("tester", "Secnod")
+	if err != nil {
+		t.Fatalf("Could not pick playlist: %s", err)
+	} else if id != "second" {
+		t.Fatalf("Wrong playlist picked: [%s]", id)
+	}
+
+	if strings.Contains(output.String(), "  (1) First\n  (2) Second\n") == false {
+		t.Fatalf("Playlists not listed:\n%s", output.String())
+	} else if strings.Contains(output.String(), "Please enter a number from 1 to 2") == false {
+		t.Fatalf("Invalid answer not rejected:\n%s", output.String())
+	}
+
+	// The choice is remembered for the name.
+
+	id, err = sc.GetSpotifyPlaylistId("tester", "Secnod")
+	if err != nil {
+		t.Fatalf("Could not get playlist again: %s", err)
+	} else if id != "second" {
+		t.Fatalf("Choice not remembered: [%s]", id)
+	}
+}
+
+func TestGetSpotifyPlaylistId_PromptCreate(t *testing.T) {
+	fsc, sc, _ := newTestPromptCache("c\n")
+
+	id, err := sc.GetSpotifyPlaylistId("tester", "Third")
+	if err != nil {
+		t.Fatalf("Could not create playlist: %s", err)
+	} else if fsc.callCount("CreatePlaylistForUser") != 1 {
+		t.Fatalf("Playlist not created.")
+	}
+
+	if _, found := fsc.playlistTracks[id]; found == false {
+		t.Fatalf("Created playlist not returned: [%s]", id)
+	}
+}
+
+func TestGetSpotifyPlaylistId_PromptAborted(t *testing.T) {
+	for _, input := range []string{"q\n", ""} {
+		fsc, sc, _ := newTestPromptCache(input)
+
+		_, err := sc.GetSpotifyPlaylistId("tester", "Third")
+		if log.Is(err, ErrPromptAborted) == false {
+			t.Fatalf("Expected abort for [%s]: %v", input, err)
+		} else if fsc.callCount("CreatePlaylistForUser") != 0 {
+			t.Fatalf("Nothing should have been created for [%s].", input)
+		}
+	}
+}
+
+func TestGetSpotifyPlaylistId_NoPrompt(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addPlaylist("first", "First", fsc.userId)
+
+	sc := NewSpotifyCache(context.Background(), newTestSpotifyContext(fsc))
+
+	_, err := sc.GetSpotifyPlaylistId("tester", "Third")
+	if log.Is(err, ErrSpotifyPlaylistNotFound) == false {
+		t.Fatalf("Expected not-found without a prompt: %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package gnsssync
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Config
+const (
+	// spotifyTracksUrl is the endpoint for reading several tracks at once.
+	spotifyTracksUrl = "https://api.spotify.com/v1/tracks"
+
+	// spotifyTrackLookupBatchSize is the most tracks that Spotify will return
+	// details for at once.
+	spotifyTrackLookupBatchSize = 50
+)
+
+// relinkedTrack is the part of a track that we need to see how Spotify
+// relinked it.
+type relinkedTrack struct {
+	Id         spotify.ID `json:"id"`
+	LinkedFrom *struct {
+		Id spotify.ID `json:"id"`
+	} `json:"linked_from"`
+}
+
+type relinkedTracks struct {
+	Tracks []*relinkedTrack `json:"tracks"`
+}
+
+// readRelinkedTracks reads the given tracks as they're presented in the given
+// market. The Spotify client doesn't let us pass the market when reading
+// tracks, so we do the request ourselves. Errors are returned unwrapped (like
+// the Spotify client's) so that they can be classified for retrying.
+func (sa *SpotifyAdapter) readRelinkedTracks(ids []spotify.ID, marketName string) (tracks []*relinkedTrack, err error) {
+	idPhrases := make([]string, len(ids))
+	for j, id := range ids {
+		idPhrases[j] = string(id)
+	}
+
+	v := url.Values{}
+	v.Set("ids", strings.Join(idPhrases, ","))
+	v.Set("market", marketName)
+
+	response, err := sa.spotifyAuth.HttpClient.Get(spotifyTracksUrl + "?" + v.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(response.Body)
+
+		// Return the same error as the Spotify client would.
+		return nil, spotify.Error{
+			Message: fmt.Sprintf("reading tracks failed: %s", strings.TrimSpace(string(message))),
+			Status:  response.StatusCode,
+		}
+	}
+
+	rt := relinkedTracks{}
+
+	if err := json.NewDecoder(response.Body).Decode(&rt); err != nil {
+		return nil, err
+	}
+
+	return rt.Tracks, nil
+}
+
+// RelinkTracks returns the IDs that Spotify has relinked the given tracks to
+// for the given market (for when the catalog track isn't playable there but
+// an equivalent one is). Tracks that weren't relinked aren't included.
+func (sa *SpotifyAdapter) RelinkTracks(ids []spotify.ID, marketName string) (relinked map[spotify.ID]spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	relinked = make(map[spotify.ID]spotify.ID)
+
+	for j := 0; j < len(ids); j += spotifyTrackLookupBatchSize {
+		k := j + spotifyTrackLookupBatchSize
+		if k > len(ids) {
+			k = len(ids)
+		}
+
+		batchIds := ids[j:k]
+
+		tracks, err := withRetryValue(sa.retryPolicy, "reading relinked tracks", func() ([]*relinkedTrack, error) {
+			return sa.readRelinkedTracks(batchIds, marketName)
+		})
+
+		log.PanicIf(err)
+
+		for _, rt := range tracks {
+			// Tracks that don't exist come back as nulls.
+			if rt == nil || rt.LinkedFrom == nil || rt.LinkedFrom.Id == rt.Id {
+				continue
+			}
+
+			sLog.Debugf(sa.ctx, "Track [%s] is relinked to [%s] in market [%s].", rt.LinkedFrom.Id, rt.Id, marketName)
+
+			relinked[rt.LinkedFrom.Id] = rt.Id
+		}
+	}
+
+	return relinked, nil
+}
@@ -0,0 +1,138 @@
+package gnsssync
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"net/http"
+
+	"github.com/zmb3/spotify"
+)
+
+// relinkHandler answers track lookups like Spotify does: the tracks in
+// `relinked` are replaced, in the "US" market, by their equivalents.
+func relinkHandler(relinked map[string]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/tracks" {
+			http.NotFound(w, r)
+			return
+		}
+
+		phrases := make([]string, 0)
+		for _, id := range strings.Split(r.FormValue("ids"), ",") {
+			if relinkedId, found := relinked[id]; found == true && r.FormValue("market") == "US" {
+				phrases = append(phrases, fmt.Sprintf(`{"id":"%s","linked_from":{"id":"%s"}}`, relinkedId, id))
+			} else {
+				phrases = append(phrases, fmt.Sprintf(`{"id":"%s"}`, id))
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"tracks":[%s]}`, strings.Join(phrases, ","))
+	}
+}
+
+func TestGetTracksToAdd_Relinked(t *testing.T) {
+	fsc := newTestCatalog()
+
+	// The second track was relinked to one that's already in the playlist.
+	fsc.addPlaylist("other", "Other", fsc.userId, "relinked-2")
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+	}
+
+	relinked := map[string]string{
+		"album1-1": "relinked-1",
+		"album1-2": "relinked-2",
+	}
+
+	s, hc := newRedirectedClient(t, relinkHandler(relinked))
+	defer s.Close()
+
+	i := newTestImporter(t, fsc, "US", favorites...)
+	i.SetSkipIfInAnyPlaylist(true)
+	i.spotifyAuth.HttpClient = hc
+
+	tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "US")
+	if err != nil {
+		t.Fatalf("Could not get tracks: %s", err)
+	}
+
+	ids := make([]spotify.ID, 0)
+	for id, _ := range tracks {
+		ids = append(ids, id)
+	}
+
+	if reflect.DeepEqual(ids, []spotify.ID{"relinked-1"}) == false {
+		t.Fatalf("Relinked tracks not used: %v", ids)
+	} else if tracks["relinked-1"].TitleName != "Opener" {
+		t.Fatalf("Relinked track lost its details: %v", tracks["relinked-1"])
+	} else if i.Stats().AlreadyPresentCount != 1 {
+		t.Fatalf("Relinked track already present not counted: (%d)", i.Stats().AlreadyPresentCount)
+	}
+}
+
+func TestGetTracksToAdd_RelinkedDuplicate(t *testing.T) {
+	fsc := newTestCatalog()
+
+	favorites := []NormalizedTrack{
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Opener"},
+		{ArtistName: "The Band", AlbumName: "First Album", TrackName: "Closer"},
+	}
+
+	// Both tracks were relinked to the same one.
+	relinked := map[string]string{
+		"album1-1": "relinked-1",
+		"album1-2": "relinked-1",
+	}
+
+	s, hc := newRedirectedClient(t, relinkHandler(relinked))
+	defer s.Close()
+
+	// The outcome doesn't depend on the order of the map.
+	for j := 0; j < 10; j++ {
+		i := newTestImporter(t, fsc, "US", favorites...)
+		i.spotifyAuth.HttpClient = hc
+
+		tracks, err := i.GetTracksToAdd("Target", []string{"the band"}, "US")
+		if err != nil {
+			t.Fatalf("Could not get tracks: %s", err)
+		}
+
+		if len(tracks) != 1 {
+			t.Fatalf("Relinked duplicates not collapsed: %v", tracks)
+		} else if tracks["relinked-1"].TitleName != "Opener" {
+			t.Fatalf("First track not kept: %v", tracks["relinked-1"])
+		} else if i.Stats().DuplicateCount != 1 {
+			t.Fatalf("Duplicate not counted: (%d)", i.Stats().DuplicateCount)
+		}
+	}
+}
+
+func TestRelinkTracks_OtherMarket(t *testing.T) {
+	s, hc := newRedirectedClient(t, relinkHandler(map[string]string{"album1-1": "relinked-1"}))
+	defer s.Close()
+
+	sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+	sa.spotifyAuth.HttpClient = hc
+
+	relinked, err := sa.RelinkTracks([]spotify.ID{"album1-1", "album1-2"}, "US")
+	if err != nil {
+		t.Fatalf("Could not relink: %s", err)
+	} else if reflect.DeepEqual(relinked, map[spotify.ID]spotify.ID{"album1-1": "relinked-1"}) == false {
+		t.Fatalf("Relinked tracks not correct: %v", relinked)
+	}
+
+	// Nothing is relinked in the other market.
+
+	relinked, err = sa.RelinkTracks([]spotify.ID{"album1-1", "album1-2"}, "GB")
+	if err != nil {
+		t.Fatalf("Could not relink: %s", err)
+	} else if len(relinked) != 0 {
+		t.Fatalf("Nothing should be relinked in another market: %v", relinked)
+	}
+}
@@ -0,0 +1,220 @@
+package gnsssync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Output formats
+const (
+	OutputFormatText = "text"
+	OutputFormatJson = "json"
+)
+
+// Errors
+var (
+	ErrInvalidOutputFormat = fmt.Errorf("output format not valid")
+)
+
+// AlbumReport describes how the favorited tracks on one album were matched.
+type AlbumReport struct {
+	AlbumName string `json:"album_name"`
+
+	// MatchMethod is how the album was found in Spotify (one of the
+	// MatchMethod* constants) or empty if it wasn't.
+	MatchMethod string `json:"match_method,omitempty"`
+
+	// ToAdd are the tracks that will be added.
+	ToAdd []string `json:"to_add"`
+
+	// AlreadyPresent are the tracks that were found but are already in the
+	// playlist.
+	AlreadyPresent []string `json:"already_present"`
+
+	// Missing are the tracks that couldn't be found.
+	Missing []string `json:"missing"`
+
+	// Skipped are the tracks that were found but won't be added (e.g. because
+	// the rest of the album wasn't found).
+	Skipped []string `json:"skipped"`
+
+	// Markets are the markets that the ToAdd and AlreadyPresent tracks were
+	// matched in, by track name. These are only known when more than one
+	// market was tried.
+	Markets map[string]string `json:"markets,omitempty"`
+
+	// alreadyPresentIds are the IDs of the AlreadyPresent tracks.
+	alreadyPresentIds []spotify.ID
+
+	// resolutions are the tracks that the favorites were matched to (before
+	// any were skipped), by track name.
+	resolutions map[string]spotify.ID
+}
+
+func newAlbumReport(albumName string) *AlbumReport {
+	return &AlbumReport{
+		AlbumName:      albumName,
+		ToAdd:          make([]string, 0),
+		AlreadyPresent: make([]string, 0),
+		Missing:        make([]string, 0),
+		Skipped:        make([]string, 0),
+		Markets:        make(map[string]string),
+		resolutions:    make(map[string]spotify.ID),
+	}
+}
+
+// ArtistReport describes how the favorited albums for one artist were
+// matched.
+type ArtistReport struct {
+	ArtistName string `json:"artist_name"`
+
+	// FoundInSpotify is whether the artist could be found in Spotify.
+	FoundInSpotify bool `json:"found_in_spotify"`
+
+	Albums []*AlbumReport `json:"albums"`
+}
+
+// SharedTrack is a Spotify track that more than one favorite matched. Only
+// one copy is added.
+type SharedTrack struct {
+	TrackId spotify.ID `json:"track_id"`
+
+	// Sources are the favorites that matched the track, in the order that
+	// they were matched.
+	Sources []NormalizedTrack `json:"sources"`
+}
+
+// MatchReport describes how all of the favorited tracks were matched, grouped
+// by artist and then album.
+type MatchReport struct {
+	Artists []*ArtistReport `json:"artists"`
+
+	// MarketCounts is how many of the matched tracks came from each market
+	// (only when more than one market was tried).
+	MarketCounts map[string]int `json:"market_counts,omitempty"`
+
+	// SharedTracks are the tracks that more than one favorite matched (only
+	// when we were told to look for them).
+	SharedTracks []*SharedTrack `json:"shared_tracks,omitempty"`
+}
+
+// countMarkets returns how many of the matched tracks came from each market.
+func (mr *MatchReport) countMarkets() map[string]int {
+	marketCounts := make(map[string]int)
+
+	for _, ar := range mr.Artists {
+		for _, alr := range ar.Albums {
+			for _, marketName := range alr.Markets {
+				marketCounts[marketName]++
+			}
+		}
+	}
+
+	return marketCounts
+}
+
+// WritePlan writes the report as an import plan in the given format.
+func (mr *MatchReport) WritePlan(w io.Writer, outputFormat string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	mr.MarketCounts = mr.countMarkets()
+
+	if outputFormat == OutputFormatJson {
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+
+		err := e.Encode(mr)
+		log.PanicIf(err)
+
+		return nil
+	} else if outputFormat != OutputFormatText {
+		log.Panic(ErrInvalidOutputFormat)
+	}
+
+	toAddCount := 0
+	alreadyPresentCount := 0
+	missingCount := 0
+	skippedCount := 0
+
+	for _, ar := range mr.Artists {
+		_, err := fmt.Fprintf(w, "[%s]\n", ar.ArtistName)
+		log.PanicIf(err)
+
+		for _, alr := range ar.Albums {
+			if alr.MatchMethod != "" {
+				_, err = fmt.Fprintf(w, "  [%s] (%s)\n", alr.AlbumName, alr.MatchMethod)
+			} else {
+				_, err = fmt.Fprintf(w, "  [%s]\n", alr.AlbumName)
+			}
+
+			log.PanicIf(err)
+
+			sections := []struct {
+				prefix string
+				names  []string
+			}{
+				{"+", alr.ToAdd},
+				{"=", alr.AlreadyPresent},
+				{"-", alr.Missing},
+				{"~", alr.Skipped},
+			}
+
+			for _, section := range sections {
+				for _, name := range section.names {
+					var err error
+
+					if marketName, found := alr.Markets[name]; found == true && (section.prefix == "+" || section.prefix == "=") {
+						_, err = fmt.Fprintf(w, "    %s [%s] (%s)\n", section.prefix, name, marketName)
+					} else {
+						_, err = fmt.Fprintf(w, "    %s [%s]\n", section.prefix, name)
+					}
+
+					log.PanicIf(err)
+				}
+			}
+
+			toAddCount += len(alr.ToAdd)
+			alreadyPresentCount += len(alr.AlreadyPresent)
+			missingCount += len(alr.Missing)
+			skippedCount += len(alr.Skipped)
+		}
+	}
+
+	_, err = fmt.Fprintf(w, "\n(+) TO ADD=(%d) (=) ALREADY PRESENT=(%d) (-) MISSING=(%d) (~) SKIPPED=(%d)\n", toAddCount, alreadyPresentCount, missingCount, skippedCount)
+	log.PanicIf(err)
+
+	if len(mr.MarketCounts) > 0 {
+		marketNames := make([]string, 0, len(mr.MarketCounts))
+		for marketName, _ := range mr.MarketCounts {
+			marketNames = append(marketNames, marketName)
+		}
+
+		sort.Strings(marketNames)
+
+		for _, marketName := range marketNames {
+			_, err := fmt.Fprintf(w, "MARKET [%s]=(%d)\n", marketName, mr.MarketCounts[marketName])
+			log.PanicIf(err)
+		}
+	}
+
+	for _, st := range mr.SharedTracks {
+		_, err := fmt.Fprintf(w, "SHARED [%s]\n", st.TrackId)
+		log.PanicIf(err)
+
+		for _, nt := range st.Sources {
+			_, err := fmt.Fprintf(w, "  [%s] [%s] [%s]\n", nt.ArtistName, nt.AlbumName, nt.TrackName)
+			log.PanicIf(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package gnsssync
+
+import (
+	"bytes"
+	"testing"
+
+	"encoding/json"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// newTestMatchReport returns a small report with one album that was found and
+// one that wasn't.
+func newTestMatchReport() *MatchReport {
+	found := newAlbumReport("First Album")
+	found.MatchMethod = MatchMethodStrictAlbum
+	found.ToAdd = []string{"Opener"}
+	found.AlreadyPresent = []string{"Closer"}
+	found.Missing = []string{"Hidden Track"}
+
+	notFound := newAlbumReport("Demos")
+	notFound.Missing = []string{"Demo 1"}
+
+	return &MatchReport{
+		Artists: []*ArtistReport{
+			{
+				ArtistName:     "The Band",
+				FoundInSpotify: true,
+				Albums:         []*AlbumReport{found, notFound},
+			},
+		},
+	}
+}
+
+func TestMatchReport_WritePlan_Text(t *testing.T) {
+	mr := newTestMatchReport()
+
+	b := new(bytes.Buffer)
+
+	err := mr.WritePlan(b, OutputFormatText)
+	if err != nil {
+		t.Fatalf("Could not write plan: %s", err)
+	}
+
+	expected := `[The Band]
+  [First Album] (strict-album)
+    + [Opener]
+    = [Closer]
+    - [Hidden Track]
+  [Demos]
+    - [Demo 1]
+
+(+) TO ADD=(1) (=) ALREADY PRESENT=(1) (-) MISSING=(2) (~) SKIPPED=(0)
+`
+
+	if b.String() != expected {
+		t.Fatalf("Plan not correct:\n%s\n!=\n%s", b.String(), expected)
+	}
+}
+
+func TestMatchReport_WritePlan_Json(t *testing.T) {
+	mr := newTestMatchReport()
+
+	b := new(bytes.Buffer)
+
+	err := mr.WritePlan(b, OutputFormatJson)
+	if err != nil {
+		t.Fatalf("Could not write plan: %s", err)
+	}
+
+	recovered := new(MatchReport)
+
+	err = json.Unmarshal(b.Bytes(), recovered)
+	if err != nil {
+		t.Fatalf("Plan is not valid JSON: %s", err)
+	}
+
+	if len(recovered.Artists) != 1 || len(recovered.Artists[0].Albums) != 2 {
+		t.Fatalf("Plan tree not correct: %s", b.String())
+	}
+
+	alr := recovered.Artists[0].Albums[0]
+	if alr.AlbumName != "First Album" || alr.MatchMethod != MatchMethodStrictAlbum {
+		t.Fatalf("Album not correct: [%s] (%s)", alr.AlbumName, alr.MatchMethod)
+	} else if len(alr.ToAdd) != 1 || alr.ToAdd[0] != "Opener" {
+		t.Fatalf("Tracks to add not correct: %v", alr.ToAdd)
+	} else if len(alr.AlreadyPresent) != 1 || alr.AlreadyPresent[0] != "Closer" {
+		t.Fatalf("Tracks already present not correct: %v", alr.AlreadyPresent)
+	} else if len(alr.Missing) != 1 || alr.Missing[0] != "Hidden Track" {
+		t.Fatalf("Missing tracks not correct: %v", alr.Missing)
+	}
+}
+
+func TestMatchReport_WritePlan_InvalidFormat(t *testing.T) {
+	mr := newTestMatchReport()
+
+	err := mr.WritePlan(new(bytes.Buffer), "xml")
+	if log.Is(err, ErrInvalidOutputFormat) == false {
+		t.Fatalf("Expected invalid-format error: %v", err)
+	}
+}
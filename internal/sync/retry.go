@@ -0,0 +1,147 @@
+package gnsssync
+
+import (
+	"fmt"
+	"time"
+
+	"net/http"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Errors
+var (
+	ErrRetriesExhausted   = fmt.Errorf("retries exhausted")
+	ErrSpotifyRateLimited = fmt.Errorf("spotify rate-limit retries exhausted")
+)
+
+// Misc
+var (
+	rLog = log.NewLogger("gnss.retry")
+
+	// spotifyRetryPolicy retries Spotify calls that failed due to
+	// rate-limiting or a server-side problem.
+	spotifyRetryPolicy = RetryPolicy{
+		MaxRetries:     3,
+		InitialBackoff: time.Second * 1,
+		MaxBackoff:     time.Second * 30,
+		Classify:       classifySpotifyError,
+		ExhaustedErr:   ErrSpotifyRateLimited,
+		ExhaustedIf:    isRateLimitError,
+	}
+)
+
+// RetryPolicy describes how a failing call is retried.
+type RetryPolicy struct {
+	// MaxRetries is how many times the call will be retried before giving up.
+	MaxRetries int
+
+	// InitialBackoff is how long to wait before the first retry if the
+	// failure didn't tell us how long to wait. This doubles with each retry.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the backoff (but not a wait that we were told to do).
+	MaxBackoff time.Duration
+
+	// Classify determines whether the given error can be retried and, if the
+	// server told us, how long to wait first (zero to use the backoff).
+	Classify func(err error) (retryable bool, retryAfter time.Duration)
+
+	// BeforeAttempt, if not nil, is called before each attempt.
+	BeforeAttempt func()
+
+	// ExhaustedErr, if not nil, is returned instead of the last error once
+	// the retries are exhausted.
+	ExhaustedErr error
+
+	// ExhaustedIf, if not nil, limits ExhaustedErr to when it accepts the
+	// last error (e.g. only when we were still being rate-limited rather
+	// than failing with a server error).
+	ExhaustedIf func(err error) bool
+
+	// OnSleep, if not nil, is called with each wait before a retry.
+	OnSleep func(description string, wait time.Duration)
+}
+
+// withRetry runs the given call, retrying it according to the policy for as
+// long as it fails with a retryable error. Non-retryable errors are returned
+// immediately.
+func withRetry(policy RetryPolicy, description string, cb func() error) (err error) {
+	backoff := policy.InitialBackoff
+
+	for attempt := 0; ; attempt++ {
+		if policy.BeforeAttempt != nil {
+			policy.BeforeAttempt()
+		}
+
+		err = cb()
+		if err == nil {
+			return nil
+		}
+
+		retryable, retryAfter := policy.Classify(err)
+		if retryable == false {
+			return err
+		}
+
+		if attempt >= policy.MaxRetries {
+			rLog.Warningf(nil, "Giving up after (%d) retries: %s: %s", attempt, description, err)
+
+			if policy.ExhaustedErr != nil && (policy.ExhaustedIf == nil || policy.ExhaustedIf(err) == true) {
+				return policy.ExhaustedErr
+			}
+
+			return err
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+
+		rLog.Warningf(nil, "Call failed. Waiting (%s) before retrying: %s: %s", wait, description, err)
+
+		if policy.OnSleep != nil {
+			policy.OnSleep(description, wait)
+		}
+
+		time.Sleep(wait)
+
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+// withRetryValue is withRetry for calls that return a value.
+func withRetryValue[T any](policy RetryPolicy, description string, cb func() (T, error)) (value T, err error) {
+	err = withRetry(policy, description, func() (err error) {
+		value, err = cb()
+		return err
+	})
+
+	return value, err
+}
+
+// classifySpotifyError considers Spotify rate-limiting and server errors to be
+// retryable.
+func classifySpotifyError(err error) (retryable bool, retryAfter time.Duration) {
+	status := 0
+
+	switch e := err.(type) {
+	case spotify.Error:
+		status = e.Status
+	case *spotify.Error:
+		status = e.Status
+	default:
+		return false, 0
+	}
+
+	if status == http.StatusTooManyRequests || status >= http.StatusInternalServerError {
+		return true, 0
+	}
+
+	return false, 0
+}
@@ -0,0 +1,193 @@
+package gnsssync
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+var (
+	errTestRetryable = fmt.Errorf("retryable")
+	errTestFatal     = fmt.Errorf("fatal")
+)
+
+// newTestRetryPolicy returns a policy that retries errTestRetryable (after the
+// given wait, if any) without waiting long and records the waits.
+func newTestRetryPolicy(maxRetries int, retryAfter time.Duration, waits *[]time.Duration) RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:     maxRetries,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond * 4,
+		Classify: func(err error) (retryable bool, wait time.Duration) {
+			return err == errTestRetryable, retryAfter
+		},
+		OnSleep: func(description string, wait time.Duration) {
+			*waits = append(*waits, wait)
+		},
+	}
+}
+
+func TestWithRetry_RetriesThenSucceeds(t *testing.T) {
+	waits := make([]time.Duration, 0)
+	policy := newTestRetryPolicy(5, 0, &waits)
+
+	calls := 0
+	err := withRetry(policy, "test call", func() error {
+		calls++
+		if calls < 5 {
+			return errTestRetryable
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Call should have succeeded: %s", err)
+	} else if calls != 5 {
+		t.Fatalf("Call count not correct: (%d)", calls)
+	}
+
+	// The backoff doubles up to the maximum.
+	expected := []time.Duration{time.Millisecond, time.Millisecond * 2, time.Millisecond * 4, time.Millisecond * 4}
+	if fmt.Sprintf("%v", waits) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("Waits not correct: %v != %v", waits, expected)
+	}
+}
+
+func TestWithRetry_RetryAfter(t *testing.T) {
+	waits := make([]time.Duration, 0)
+	policy := newTestRetryPolicy(1, time.Millisecond*3, &waits)
+
+	calls := 0
+	err := withRetry(policy, "test call", func() error {
+		calls++
+		if calls < 2 {
+			return errTestRetryable
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Call should have succeeded: %s", err)
+	} else if len(waits) != 1 || waits[0] != time.Millisecond*3 {
+		t.Fatalf("Retry-After not used: %v", waits)
+	}
+}
+
+func TestWithRetry_GivesUp(t *testing.T) {
+	waits := make([]time.Duration, 0)
+	policy := newTestRetryPolicy(2, 0, &waits)
+
+	calls := 0
+	err := withRetry(policy, "test call", func() error {
+		calls++
+		return errTestRetryable
+	})
+
+	if err != errTestRetryable {
+		t.Fatalf("Last error not returned: %v", err)
+	} else if calls != 3 {
+		t.Fatalf("Call count not correct: (%d)", calls)
+	}
+
+	policy.ExhaustedErr = ErrRetriesExhausted
+
+	err = withRetry(policy, "test call", func() error {
+		return errTestRetryable
+	})
+
+	if err != ErrRetriesExhausted {
+		t.Fatalf("Exhausted error not returned: %v", err)
+	}
+}
+
+func TestWithRetry_SpotifyRateLimited(t *testing.T) {
+	policy := spotifyRetryPolicy
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = time.Millisecond
+
+	rateLimitErr := spotify.Error{Status: 429}
+
+	err := withRetry(policy, "test call", func() error {
+		return rateLimitErr
+	})
+
+	if err != ErrSpotifyRateLimited {
+		t.Fatalf("Rate-limit error not returned: %v", err)
+	}
+
+	// Running out of retries for server errors isn't being rate-limited.
+	serverErr := spotify.Error{Status: 502}
+
+	err = withRetry(policy, "test call", func() error {
+		return serverErr
+	})
+
+	if err != serverErr {
+		t.Fatalf("Last error not returned: %v", err)
+	}
+}
+
+func TestWithRetry_NotRetryable(t *testing.T) {
+	waits := make([]time.Duration, 0)
+	policy := newTestRetryPolicy(5, 0, &waits)
+
+	calls := 0
+	err := withRetry(policy, "test call", func() error {
+		calls++
+		return errTestFatal
+	})
+
+	if err != errTestFatal {
+		t.Fatalf("Error not returned: %v", err)
+	} else if calls != 1 {
+		t.Fatalf("Non-retryable error was retried: (%d) calls", calls)
+	} else if len(waits) != 0 {
+		t.Fatalf("Waited for a non-retryable error: %v", waits)
+	}
+}
+
+func TestWithRetryValue(t *testing.T) {
+	waits := make([]time.Duration, 0)
+	policy := newTestRetryPolicy(1, 0, &waits)
+
+	calls := 0
+	value, err := withRetryValue(policy, "test call", func() (int, error) {
+		calls++
+		if calls < 2 {
+			return 0, errTestRetryable
+		}
+
+		return 42, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Call should have succeeded: %s", err)
+	} else if value != 42 {
+		t.Fatalf("Value not returned: (%d)", value)
+	}
+}
+
+func TestClassifySpotifyError(t *testing.T) {
+	cases := []struct {
+		err       error
+		retryable bool
+	}{
+		{spotify.Error{Status: 429}, true},
+		{&spotify.Error{Status: 503}, true},
+		{spotify.Error{Status: 500}, true},
+		{spotify.Error{Status: 404}, false},
+		{spotify.Error{Status: 401}, false},
+		{errTestRetryable, false},
+	}
+
+	for _, c := range cases {
+		retryable, _ := classifySpotifyError(c.err)
+		if retryable != c.retryable {
+			t.Fatalf("[%v] classification not correct: (%v) != (%v)", c.err, retryable, c.retryable)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package gnsssync
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Config
+const (
+	// RunReportSchemaVersion is the version of the structure written by
+	// WriteRunReport. It only changes if existing fields change meaning or
+	// are removed.
+	RunReportSchemaVersion = 1
+)
+
+// RunReportAlbum is an album in a run report.
+type RunReportAlbum struct {
+	ArtistName string `json:"artist_name"`
+	AlbumName  string `json:"album_name"`
+}
+
+// RunReportTrack is a track in a run report.
+type RunReportTrack struct {
+	ArtistName string `json:"artist_name"`
+	AlbumName  string `json:"album_name"`
+	TitleName  string `json:"title_name"`
+
+	// Id is the Spotify track (only for the tracks to add).
+	Id spotify.ID `json:"id,omitempty"`
+
+	// MatchMethod is how the track was found (only for the tracks to add).
+	MatchMethod string `json:"match_method,omitempty"`
+
+	// Reason is why the track won't be added (one of the MissingReason*
+	// constants; only for the missing tracks).
+	Reason string `json:"reason,omitempty"`
+}
+
+// RunReport is the machine-readable outcome of the last call to
+// GetTracksToAdd. Everything is sorted so that reports from different runs
+// can be diffed.
+type RunReport struct {
+	SchemaVersion int `json:"schema_version"`
+
+	// MissingArtists are the artists that couldn't be found in Spotify.
+	MissingArtists []string `json:"missing_artists"`
+
+	// MissingAlbums are the albums that couldn't be found under their artist.
+	MissingAlbums []*RunReportAlbum `json:"missing_albums"`
+
+	// MissingTracks are all of the favorites that won't be added, including
+	// the ones on the missing artists and albums.
+	MissingTracks []*RunReportTrack `json:"missing_tracks"`
+
+	// TracksToAdd are the tracks that will be added.
+	TracksToAdd []*RunReportTrack `json:"tracks_to_add"`
+}
+
+func sortRunReportTracks(tracks []*RunReportTrack) {
+	sort.Slice(tracks, func(j, k int) bool {
+		a := tracks[j]
+		b := tracks[k]
+
+		if a.ArtistName != b.ArtistName {
+			return a.ArtistName < b.ArtistName
+		} else if a.AlbumName != b.AlbumName {
+			return a.AlbumName < b.AlbumName
+		} else if a.TitleName != b.TitleName {
+			return a.TitleName < b.TitleName
+		}
+
+		return a.Id < b.Id
+	})
+}
+
+// RunReport returns the outcome of the last call to GetTracksToAdd given the
+// tracks that will actually be added (which might have been narrowed down
+// since).
+func (i *Importer) RunReport(tracksToAdd map[spotify.ID]TrackInfo) *RunReport {
+	rr := &RunReport{
+		SchemaVersion:  RunReportSchemaVersion,
+		MissingArtists: make([]string, 0),
+		MissingAlbums:  make([]*RunReportAlbum, 0),
+		MissingTracks:  make([]*RunReportTrack, 0, len(i.missingTracks)),
+		TracksToAdd:    make([]*RunReportTrack, 0, len(tracksToAdd)),
+	}
+
+	seenArtists := make(map[string]bool)
+	seenAlbums := make(map[RunReportAlbum]bool)
+
+	for _, mt := range i.missingTracks {
+		rrt := &RunReportTrack{
+			ArtistName: mt.ArtistName,
+			AlbumName:  mt.AlbumName,
+			TitleName:  mt.TrackName,
+			Reason:     mt.Reason,
+		}
+
+		rr.MissingTracks = append(rr.MissingTracks, rrt)
+
+		if mt.Reason == MissingReasonArtistNotFound {
+			if _, found := seenArtists[mt.ArtistName]; found == false {
+				rr.MissingArtists = append(rr.MissingArtists, mt.ArtistName)
+				seenArtists[mt.ArtistName] = true
+			}
+		} else if mt.Reason == MissingReasonAlbumNotFound {
+			rra := RunReportAlbum{
+				ArtistName: mt.ArtistName,
+				AlbumName:  mt.AlbumName,
+			}
+
+			if _, found := seenAlbums[rra]; found == false {
+				rr.MissingAlbums = append(rr.MissingAlbums, &rra)
+				seenAlbums[rra] = true
+			}
+		}
+	}
+
+	for id, ti := range tracksToAdd {
+		rrt := &RunReportTrack{
+			ArtistName:  ti.ArtistName,
+			AlbumName:   ti.AlbumName,
+			TitleName:   ti.TitleName,
+			Id:          id,
+			MatchMethod: ti.MatchMethod,
+		}
+
+		rr.TracksToAdd = append(rr.TracksToAdd, rrt)
+	}
+
+	sort.Strings(rr.MissingArtists)
+
+	sort.Slice(rr.MissingAlbums, func(j, k int) bool {
+		a := rr.MissingAlbums[j]
+		b := rr.MissingAlbums[k]
+
+		if a.ArtistName != b.ArtistName {
+			return a.ArtistName < b.ArtistName
+		}
+
+		return a.AlbumName < b.AlbumName
+	})
+
+	sortRunReportTracks(rr.MissingTracks)
+	sortRunReportTracks(rr.TracksToAdd)
+
+	return rr
+}
+
+// WriteRunReport writes the report to a JSON file.
+func WriteRunReport(filepath string, rr *RunReport) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.Create(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	e := json.NewEncoder(f)
+	e.SetIndent("", "  ")
+
+	err = e.Encode(rr)
+	log.PanicIf(err)
+
+	return nil
+}
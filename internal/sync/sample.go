@@ -0,0 +1,36 @@
+package gnsssync
+
+import (
+	"sort"
+
+	"math/rand"
+
+	"github.com/zmb3/spotify"
+)
+
+// SampleTracks returns `n` of the given tracks chosen at random. The same seed
+// always chooses the same tracks from the same set.
+func SampleTracks(tracks map[spotify.ID]TrackInfo, n int, seed int64) map[spotify.ID]TrackInfo {
+	if n >= len(tracks) {
+		return tracks
+	}
+
+	// Map iteration is random, so put the IDs in a consistent order first.
+
+	ids := make([]string, 0, len(tracks))
+	for id, _ := range tracks {
+		ids = append(ids, string(id))
+	}
+
+	sort.Strings(ids)
+
+	r := rand.New(rand.NewSource(seed))
+
+	sampled := make(map[spotify.ID]TrackInfo, n)
+	for _, j := range r.Perm(len(ids))[:n] {
+		id := spotify.ID(ids[j])
+		sampled[id] = tracks[id]
+	}
+
+	return sampled
+}
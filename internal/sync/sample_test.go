@@ -0,0 +1,60 @@
+package gnsssync
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/zmb3/spotify"
+)
+
+func newTestSampleTracks(count int) map[spotify.ID]TrackInfo {
+	tracks := make(map[spotify.ID]TrackInfo)
+	for j := 0; j < count; j++ {
+		id := spotify.ID(fmt.Sprintf("track%02d", j))
+		tracks[id] = TrackInfo{TitleName: string(id)}
+	}
+
+	return tracks
+}
+
+func TestSampleTracks(t *testing.T) {
+	tracks := newTestSampleTracks(50)
+
+	first := SampleTracks(tracks, 10, 42)
+	if len(first) != 10 {
+		t.Fatalf("Sample size not correct: (%d)", len(first))
+	}
+
+	for id, ti := range first {
+		if original, found := tracks[id]; found == false || original != ti {
+			t.Fatalf("Sampled track [%s] not one of the tracks.", id)
+		}
+	}
+
+	// The same seed gives the same sample, even from a map that was built in
+	// another order.
+
+	second := SampleTracks(newTestSampleTracks(50), 10, 42)
+	if reflect.DeepEqual(first, second) == false {
+		t.Fatalf("Same seed gave a different sample.")
+	}
+
+	// Another seed (almost certainly) doesn't.
+
+	other := SampleTracks(tracks, 10, 43)
+	if reflect.DeepEqual(first, other) == true {
+		t.Fatalf("Different seed gave the same sample.")
+	}
+}
+
+func TestSampleTracks_NotEnough(t *testing.T) {
+	tracks := newTestSampleTracks(3)
+
+	for _, n := range []int{3, 5} {
+		sampled := SampleTracks(tracks, n, 1)
+		if reflect.DeepEqual(sampled, tracks) == false {
+			t.Fatalf("All tracks should be kept when asking for (%d): %v", n, sampled)
+		}
+	}
+}
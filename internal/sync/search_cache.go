@@ -0,0 +1,635 @@
+package gnsssync
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Config
+const (
+	// SearchCacheSchemaVersion is the version of the search-cache file. A
+	// file with any other version is ignored.
+	SearchCacheSchemaVersion = 2
+
+	// DefaultSearchCacheNegativeTtl is how long we remember that something
+	// couldn't be found before we look for it again.
+	DefaultSearchCacheNegativeTtl = time.Hour * 24
+
+	// DefaultSearchCacheFlushEvery is how many new lookups we collect before
+	// writing the cache out during the run.
+	DefaultSearchCacheFlushEvery = 100
+
+	// DefaultSearchCacheFlushInterval is the longest that we go without
+	// writing new lookups out during the run.
+	DefaultSearchCacheFlushInterval = time.Minute
+)
+
+// Misc
+var (
+	scaLog = log.NewLogger("gnss.search_cache")
+)
+
+// albumKey identifies a cached album. Since availability differs by market,
+// the same album-name may resolve differently in different markets.
+type albumKey struct {
+	artistId   spotify.ID
+	albumName  string
+	marketName string
+	albumType  spotify.AlbumType
+}
+
+// albumTracksKey identifies a cached album track-listing. The listing isn't
+// requested for a market (the availability of each track is recorded with it
+// instead), so it's the same for all markets.
+type albumTracksKey struct {
+	albumId spotify.ID
+}
+
+// cachedArtists are the artists that matched a name. No IDs means that none
+// did.
+type cachedArtists struct {
+	ids      []spotify.ID
+	cachedAt time.Time
+}
+
+// cachedAlbum are the albums that matched a name. No IDs means that none
+// did.
+type cachedAlbum struct {
+	ids      []spotify.ID
+	cachedAt time.Time
+}
+
+// cachedAlbumTrack is one track from an album listing, as Spotify named it
+// (so that it doesn't depend on how we normalize names).
+type cachedAlbumTrack struct {
+	Name             string     `json:"name"`
+	Id               spotify.ID `json:"id"`
+	AvailableMarkets []string   `json:"available_markets"`
+	DurationMs       int        `json:"duration_ms"`
+}
+
+// searchCache has the artists, albums, and tracks that we've already looked
+// up so that we don't look them up again. It's safe to use from more than one
+// goroutine.
+type searchCache struct {
+	m sync.RWMutex
+
+	artists map[string]cachedArtists
+	albums  map[albumKey]cachedAlbum
+	tracks  map[albumTracksKey][]cachedAlbumTrack
+
+	// trackMarkets are the markets that each track that we've seen is
+	// available in.
+	trackMarkets map[spotify.ID][]string
+
+	// trackDurations are the lengths of each track that we've seen.
+	trackDurations map[spotify.ID]time.Duration
+
+	// negativeTtl is how long the things that couldn't be found are
+	// remembered.
+	negativeTtl time.Duration
+
+	// flushFilepath, if not empty, is where we write the cache during the run
+	// once `flushEvery` new entries have been made or `flushInterval` has
+	// passed since we last wrote it (whichever is first). Either can be zero
+	// to not consider it.
+	flushFilepath string
+	flushEvery    int
+	flushInterval time.Duration
+
+	// flushM makes sure that only one flush happens at a time.
+	flushM sync.Mutex
+
+	// unflushed is how many entries have been made since the cache was last
+	// written and flushedAt is when that was.
+	unflushed int
+	flushedAt time.Time
+}
+
+func newSearchCache() *searchCache {
+	c := &searchCache{
+		negativeTtl: DefaultSearchCacheNegativeTtl,
+	}
+
+	c.reset()
+
+	return c
+}
+
+// reset clears everything.
+func (c *searchCache) reset() {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.artists = make(map[string]cachedArtists)
+	c.albums = make(map[albumKey]cachedAlbum)
+	c.tracks = make(map[albumTracksKey][]cachedAlbumTrack)
+	c.trackMarkets = make(map[spotify.ID][]string)
+	c.trackDurations = make(map[spotify.ID]time.Duration)
+	c.unflushed = 0
+}
+
+// isExpired returns whether a negative entry that was cached at the given
+// time should be looked up again.
+func (c *searchCache) isExpired(cachedAt time.Time) bool {
+	return time.Since(cachedAt) > c.negativeTtl
+}
+
+// getArtists returns the artists that matched the given (normalized) name.
+// If `found` is true but there are no IDs, we already know that none do.
+func (c *searchCache) getArtists(name string) (ids []spotify.ID, found bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	ca, found := c.artists[name]
+	if found == false || (len(ca.ids) == 0 && c.isExpired(ca.cachedAt) == true) {
+		return nil, false
+	}
+
+	return ca.ids, true
+}
+
+// setArtists records the artists that matched the given (normalized) name.
+// No IDs records that none did.
+func (c *searchCache) setArtists(name string, ids []spotify.ID) {
+	c.m.Lock()
+
+	c.artists[name] = cachedArtists{
+		ids:      ids,
+		cachedAt: time.Now(),
+	}
+
+	c.unflushed++
+
+	c.m.Unlock()
+
+	c.flushIfDue()
+}
+
+// getAlbums returns the albums that matched. If `found` is true but there
+// are no IDs, we already know that none did.
+func (c *searchCache) getAlbums(cak albumKey) (ids []spotify.ID, found bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	ca, found := c.albums[cak]
+	if found == false || (len(ca.ids) == 0 && c.isExpired(ca.cachedAt) == true) {
+		return nil, false
+	}
+
+	return ca.ids, true
+}
+
+// setAlbums records the albums that matched. No IDs records that none did.
+func (c *searchCache) setAlbums(cak albumKey, ids []spotify.ID) {
+	c.m.Lock()
+
+	c.albums[cak] = cachedAlbum{
+		ids:      ids,
+		cachedAt: time.Now(),
+	}
+
+	c.unflushed++
+
+	c.m.Unlock()
+
+	c.flushIfDue()
+}
+
+// getAlbumTracks returns the album's track listing. This must not be
+// modified.
+func (c *searchCache) getAlbumTracks(catk albumTracksKey) (tracks []cachedAlbumTrack, found bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	tracks, found = c.tracks[catk]
+	return tracks, found
+}
+
+// setAlbumTracks records the album's track listing (and what we now know
+// about each of its tracks).
+func (c *searchCache) setAlbumTracks(catk albumTracksKey, tracks []cachedAlbumTrack) {
+	c.m.Lock()
+
+	c.tracks[catk] = tracks
+	c.setTrackDetails(tracks)
+
+	c.unflushed++
+
+	c.m.Unlock()
+
+	c.flushIfDue()
+}
+
+// setTracks records what we know about the given tracks when we've seen them
+// somewhere other than an album listing.
+func (c *searchCache) setTracks(tracks []cachedAlbumTrack) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.setTrackDetails(tracks)
+}
+
+// setTrackDetails records what we know about the tracks from an album
+// listing. The lock must be held.
+func (c *searchCache) setTrackDetails(tracks []cachedAlbumTrack) {
+	for _, cat := range tracks {
+		c.trackMarkets[cat.Id] = cat.AvailableMarkets
+		c.trackDurations[cat.Id] = time.Duration(cat.DurationMs) * time.Millisecond
+	}
+}
+
+func (c *searchCache) getTrackMarkets(id spotify.ID) (availableMarkets []string, found bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	availableMarkets, found = c.trackMarkets[id]
+	return availableMarkets, found
+}
+
+func (c *searchCache) getTrackDuration(id spotify.ID) (duration time.Duration, found bool) {
+	c.m.RLock()
+	defer c.m.RUnlock()
+
+	duration, found = c.trackDurations[id]
+	return duration, found
+}
+
+type searchCacheArtistsEntry struct {
+	Name     string       `json:"name"`
+	Ids      []spotify.ID `json:"ids"`
+	CachedAt time.Time    `json:"cached_at"`
+}
+
+type searchCacheAlbumEntry struct {
+	ArtistId   spotify.ID   `json:"artist_id"`
+	AlbumName  string       `json:"album_name"`
+	MarketName string       `json:"market_name"`
+	AlbumType  int          `json:"album_type"`
+	Ids        []spotify.ID `json:"ids"`
+	CachedAt   time.Time    `json:"cached_at"`
+}
+
+type searchCacheAlbumTracksEntry struct {
+	AlbumId spotify.ID         `json:"album_id"`
+	Tracks  []cachedAlbumTrack `json:"tracks"`
+}
+
+// searchCacheFile is the on-disk form of the cache.
+type searchCacheFile struct {
+	SchemaVersion int                           `json:"schema_version"`
+	Artists       []searchCacheArtistsEntry     `json:"artists"`
+	Albums        []searchCacheAlbumEntry       `json:"albums"`
+	AlbumTracks   []searchCacheAlbumTracksEntry `json:"album_tracks"`
+}
+
+// load adds the entries from the given file. A file that doesn't exist yet
+// is fine. The negative entries that have expired are dropped.
+func (c *searchCache) load(cacheFilepath string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	raw, err := ioutil.ReadFile(cacheFilepath)
+	if os.IsNotExist(err) == true {
+		scaLog.Debugf(nil, "Search cache does not exist yet: [%s]", cacheFilepath)
+		return nil
+	} else if err != nil {
+		log.Panic(err)
+	}
+
+	scf := searchCacheFile{}
+
+	err = json.Unmarshal(raw, &scf)
+	log.PanicIf(err)
+
+	if scf.SchemaVersion != SearchCacheSchemaVersion {
+		scaLog.Warningf(nil, "Ignoring search cache written by a different version (%d): [%s]", scf.SchemaVersion, cacheFilepath)
+		return nil
+	}
+
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for _, e := range scf.Artists {
+		if len(e.Ids) == 0 && c.isExpired(e.CachedAt) == true {
+			continue
+		}
+
+		c.artists[e.Name] = cachedArtists{
+			ids:      e.Ids,
+			cachedAt: e.CachedAt,
+		}
+	}
+
+	for _, e := range scf.Albums {
+		if len(e.Ids) == 0 && c.isExpired(e.CachedAt) == true {
+			continue
+		}
+
+		cak := albumKey{
+			artistId:   e.ArtistId,
+			albumName:  e.AlbumName,
+			marketName: e.MarketName,
+			albumType:  spotify.AlbumType(e.AlbumType),
+		}
+
+		c.albums[cak] = cachedAlbum{
+			ids:      e.Ids,
+			cachedAt: e.CachedAt,
+		}
+	}
+
+	for _, e := range scf.AlbumTracks {
+		catk := albumTracksKey{
+			albumId: e.AlbumId,
+		}
+
+		c.tracks[catk] = e.Tracks
+		c.setTrackDetails(e.Tracks)
+	}
+
+	scaLog.Infof(nil, "Loaded search cache with (%d) artists, (%d) albums, and (%d) album listings: [%s]", len(scf.Artists), len(scf.Albums), len(scf.AlbumTracks), cacheFilepath)
+
+	return nil
+}
+
+// save writes the cache to the given file, replacing it.
+func (c *searchCache) save(cacheFilepath string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	scf := searchCacheFile{
+		SchemaVersion: SearchCacheSchemaVersion,
+		Artists:       make([]searchCacheArtistsEntry, 0),
+		Albums:        make([]searchCacheAlbumEntry, 0),
+		AlbumTracks:   make([]searchCacheAlbumTracksEntry, 0),
+	}
+
+	c.m.RLock()
+
+	for name, ca := range c.artists {
+		e := searchCacheArtistsEntry{
+			Name:     name,
+			Ids:      ca.ids,
+			CachedAt: ca.cachedAt,
+		}
+
+		scf.Artists = append(scf.Artists, e)
+	}
+
+	for cak, ca := range c.albums {
+		e := searchCacheAlbumEntry{
+			ArtistId:   cak.artistId,
+			AlbumName:  cak.albumName,
+			MarketName: cak.marketName,
+			AlbumType:  int(cak.albumType),
+			Ids:        ca.ids,
+			CachedAt:   ca.cachedAt,
+		}
+
+		scf.Albums = append(scf.Albums, e)
+	}
+
+	for catk, tracks := range c.tracks {
+		e := searchCacheAlbumTracksEntry{
+			AlbumId: catk.albumId,
+			Tracks:  tracks,
+		}
+
+		scf.AlbumTracks = append(scf.AlbumTracks, e)
+	}
+
+	unflushed := c.unflushed
+
+	c.m.RUnlock()
+
+	// Write to a temporary file first so that an interrupted write doesn't
+	// lose the existing cache.
+
+	f, err := ioutil.TempFile(filepath.Dir(cacheFilepath), ".search-cache")
+	log.PanicIf(err)
+
+	tempFilepath := f.Name()
+
+	err = json.NewEncoder(f).Encode(scf)
+	if err != nil {
+		f.Close()
+		os.Remove(tempFilepath)
+
+		log.Panic(err)
+	}
+
+	err = f.Close()
+	log.PanicIf(err)
+
+	err = os.Rename(tempFilepath, cacheFilepath)
+	log.PanicIf(err)
+
+	// Anything added while we were writing is still unflushed.
+
+	c.m.Lock()
+	c.unflushed -= unflushed
+	c.flushedAt = time.Now()
+	c.m.Unlock()
+
+	scaLog.Debugf(nil, "Wrote search cache with (%d) artists, (%d) albums, and (%d) album listings: [%s]", len(scf.Artists), len(scf.Albums), len(scf.AlbumTracks), cacheFilepath)
+
+	return nil
+}
+
+// LoadSearchCache adds the artists, albums, and tracks that were saved by
+// SaveSearchCache (if the file exists) so that they aren't looked up again.
+// Things that couldn't be found are looked up again once `negativeTtl` has
+// passed.
+func (sa *SpotifyAdapter) LoadSearchCache(cacheFilepath string, negativeTtl time.Duration) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sa.cache.m.Lock()
+	sa.cache.negativeTtl = negativeTtl
+	sa.cache.m.Unlock()
+
+	err = sa.cache.load(cacheFilepath)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// setFlush has the cache written to the given file during the run (see
+// searchCache.flushFilepath).
+func (c *searchCache) setFlush(flushFilepath string, flushEvery int, flushInterval time.Duration) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	c.flushFilepath = flushFilepath
+	c.flushEvery = flushEvery
+	c.flushInterval = flushInterval
+	c.flushedAt = time.Now()
+}
+
+// flushIfDue writes the cache if we were asked to write it during the run and
+// enough has changed or enough time has passed. A failure is only logged
+// since the cache is written again at the end.
+func (c *searchCache) flushIfDue() {
+	c.flushM.Lock()
+	defer c.flushM.Unlock()
+
+	c.m.RLock()
+
+	flushFilepath := c.flushFilepath
+	isDue := c.unflushed > 0 &&
+		((c.flushEvery > 0 && c.unflushed >= c.flushEvery) ||
+			(c.flushInterval > 0 && time.Since(c.flushedAt) >= c.flushInterval))
+
+	c.m.RUnlock()
+
+	if flushFilepath == "" || isDue == false {
+		return
+	}
+
+	if err := c.save(flushFilepath); err != nil {
+		scaLog.Errorf(nil, err, "Could not flush the search cache.")
+	}
+}
+
+// SetSearchCacheFlush has the lookups written to the given file during the run
+// (rather than only when SaveSearchCache is called) once `flushEvery` new
+// lookups have been made or `flushInterval` has passed since it was last
+// written. Either can be zero to not consider it. This way, a crash loses at
+// most what was looked up since the last write.
+func (sa *SpotifyAdapter) SetSearchCacheFlush(cacheFilepath string, flushEvery int, flushInterval time.Duration) {
+	sa.cache.setFlush(cacheFilepath, flushEvery, flushInterval)
+}
+
+// SaveSearchCache writes everything that we've looked up to a file so that a
+// later run can load it.
+func (sa *SpotifyAdapter) SaveSearchCache(cacheFilepath string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = sa.cache.save(cacheFilepath)
+	log.PanicIf(err)
+
+	return nil
+}
+
+// albumTypeName returns the name that the given album type is given as on the
+// command-line.
+func albumTypeName(albumType spotify.AlbumType) string {
+	for name, current := range supportedAlbumTypes {
+		if current == albumType {
+			return name
+		}
+	}
+
+	return fmt.Sprintf("%d", albumType)
+}
+
+// formatCachedIds returns the IDs for printing, or a note that there weren't
+// any.
+func formatCachedIds(ids []spotify.ID) string {
+	if len(ids) == 0 {
+		return "(NOT FOUND)"
+	}
+
+	phrases := make([]string, len(ids))
+	for j, id := range ids {
+		phrases[j] = fmt.Sprintf("[%s]", id)
+	}
+
+	return strings.Join(phrases, " ")
+}
+
+// DumpSearchCache prints everything in the given search-cache file: the
+// artists, the albums, and the album track-listings. Nothing is dropped for
+// having expired.
+func DumpSearchCache(w io.Writer, cacheFilepath string) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	f, err := os.Open(cacheFilepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	scf := searchCacheFile{}
+
+	err = json.NewDecoder(f).Decode(&scf)
+	log.PanicIf(err)
+
+	if scf.SchemaVersion != SearchCacheSchemaVersion {
+		_, err := fmt.Fprintf(w, "SCHEMA VERSION (%d) IS NOT (%d); THIS FILE WOULD BE IGNORED\n", scf.SchemaVersion, SearchCacheSchemaVersion)
+		log.PanicIf(err)
+	}
+
+	sort.Slice(scf.Artists, func(j, k int) bool {
+		return scf.Artists[j].Name < scf.Artists[k].Name
+	})
+
+	for _, e := range scf.Artists {
+		_, err := fmt.Fprintf(w, "ARTIST [%s] %s (%s)\n", e.Name, formatCachedIds(e.Ids), e.CachedAt.Format(time.RFC3339))
+		log.PanicIf(err)
+	}
+
+	sort.Slice(scf.Albums, func(j, k int) bool {
+		a, b := scf.Albums[j], scf.Albums[k]
+
+		if a.ArtistId != b.ArtistId {
+			return a.ArtistId < b.ArtistId
+		} else if a.AlbumName != b.AlbumName {
+			return a.AlbumName < b.AlbumName
+		} else if a.MarketName != b.MarketName {
+			return a.MarketName < b.MarketName
+		}
+
+		return a.AlbumType < b.AlbumType
+	})
+
+	for _, e := range scf.Albums {
+		_, err := fmt.Fprintf(w, "ALBUM [%s] [%s] MARKET=[%s] TYPE=[%s] %s (%s)\n", e.ArtistId, e.AlbumName, e.MarketName, albumTypeName(spotify.AlbumType(e.AlbumType)), formatCachedIds(e.Ids), e.CachedAt.Format(time.RFC3339))
+		log.PanicIf(err)
+	}
+
+	sort.Slice(scf.AlbumTracks, func(j, k int) bool {
+		return scf.AlbumTracks[j].AlbumId < scf.AlbumTracks[k].AlbumId
+	})
+
+	for _, e := range scf.AlbumTracks {
+		_, err := fmt.Fprintf(w, "ALBUM TRACKS [%s]\n", e.AlbumId)
+		log.PanicIf(err)
+
+		for _, cat := range e.Tracks {
+			_, err := fmt.Fprintf(w, "  [%s] [%s] (%s) MARKETS=[%s]\n", cat.Id, cat.Name, time.Duration(cat.DurationMs)*time.Millisecond, strings.Join(cat.AvailableMarkets, ","))
+			log.PanicIf(err)
+		}
+	}
+
+	return nil
+}
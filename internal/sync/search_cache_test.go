@@ -0,0 +1,379 @@
+package gnsssync
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"encoding/json"
+	"io/ioutil"
+	"path"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestGetSpotifyAlbumId_CachedPerMarket(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+
+	// The same album was released separately in each market.
+	fa := fsc.addAlbum("artist1", "us-release", "Region", "album", "1990", "Song")
+	fa.AvailableMarkets = []string{"US"}
+
+	fa = fsc.addAlbum("artist1", "gb-release", "Region", "album", "1990", "Song")
+	fa.AvailableMarkets = []string{"GB"}
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	cases := []struct {
+		marketName string
+		expected   spotify.ID
+	}{
+		{"US", "us-release"},
+		{"GB", "gb-release"},
+	}
+
+	for _, c := range cases {
+		id, err := sa.getSpotifyAlbumId("artist1", "region", c.marketName, false, false)
+		if err != nil {
+			t.Fatalf("Album not found in [%s]: %s", c.marketName, err)
+		} else if id != c.expected {
+			t.Fatalf("Album for [%s] not correct: [%s] != [%s]", c.marketName, id, c.expected)
+		}
+	}
+
+	// Looking them up again should come entirely from the cache and still
+	// resolve differently per market.
+
+	calls := fsc.callCount("GetArtistAlbumsOpt")
+
+	for _, c := range cases {
+		id, err := sa.getSpotifyAlbumId("artist1", "region", c.marketName, false, false)
+		if err != nil {
+			t.Fatalf("Album not found in [%s] from the cache: %s", c.marketName, err)
+		} else if id != c.expected {
+			t.Fatalf("Cached album for [%s] not correct: [%s] != [%s]", c.marketName, id, c.expected)
+		}
+	}
+
+	if fsc.callCount("GetArtistAlbumsOpt") != calls {
+		t.Fatalf("Albums should have been cached for each market.")
+	}
+
+	// The markets should still be kept apart once saved and loaded.
+
+	cacheFilepath := path.Join(t.TempDir(), "search-cache.json")
+
+	err := sa.cache.save(cacheFilepath)
+	if err != nil {
+		t.Fatalf("Could not save cache: %s", err)
+	}
+
+	loaded := newSearchCache()
+
+	err = loaded.load(cacheFilepath)
+	if err != nil {
+		t.Fatalf("Could not load cache: %s", err)
+	}
+
+	for _, c := range cases {
+		cak := albumKey{
+			artistId:   "artist1",
+			albumName:  "region",
+			marketName: c.marketName,
+			albumType:  spotify.AlbumTypeAlbum,
+		}
+
+		ids, found := loaded.getAlbums(cak)
+		if found == false {
+			t.Fatalf("Album for [%s] not loaded.", c.marketName)
+		} else if len(ids) != 1 || ids[0] != c.expected {
+			t.Fatalf("Loaded album for [%s] not correct: %v", c.marketName, ids)
+		}
+	}
+}
+
+func TestGetSpotifyAlbumTracks_SharedAcrossMarkets(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+	fsc.addAlbum("artist1", "album1", "First Album", "album", "1990", "Opener", "Closer")
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	for _, marketName := range []string{"US", "GB", ""} {
+		_, err := sa.getSpotifyTrackId("album1", "Opener", marketName, false)
+		if err != nil {
+			t.Fatalf("Track not found in [%s]: %s", marketName, err)
+		}
+	}
+
+	// One page of tracks and then an empty one.
+	if calls := fsc.callCount("GetAlbumTracksOpt"); calls != 2 {
+		t.Fatalf("Listing should have been read only once: (%d) calls", calls)
+	}
+}
+
+func TestSearchCache_FlushSurvivesCrash(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+
+	artistNames := []string{"First Band", "Second Band", "Third Band"}
+	for j, artistName := range artistNames {
+		fsc.addArtist(spotify.ID(fmt.Sprintf("artist%d", j+1)), artistName)
+	}
+
+	cacheFilepath := path.Join(t.TempDir(), "search-cache.json")
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	err := sa.LoadSearchCache(cacheFilepath, DefaultSearchCacheNegativeTtl)
+	if err != nil {
+		t.Fatalf("Could not load empty cache: %s", err)
+	}
+
+	sa.SetSearchCacheFlush(cacheFilepath, 2, 0)
+
+	for _, artistName := range artistNames {
+		_, err := sa.searchSpotifyArtists(artistName)
+		if err != nil {
+			t.Fatalf("Artist [%s] not found: %s", artistName, err)
+		}
+	}
+
+	// Crash before the third lookup is flushed (SaveSearchCache is never
+	// called) and start again from the file.
+
+	fsc = newFakeSpotifyClient()
+	for j, artistName := range artistNames {
+		fsc.addArtist(spotify.ID(fmt.Sprintf("artist%d", j+1)), artistName)
+	}
+
+	sa = newTestSpotifyAdapter(fsc)
+
+	err = sa.LoadSearchCache(cacheFilepath, DefaultSearchCacheNegativeTtl)
+	if err != nil {
+		t.Fatalf("Could not load flushed cache: %s", err)
+	}
+
+	for j, artistName := range artistNames {
+		_, err := sa.searchSpotifyArtists(artistName)
+		if err != nil {
+			t.Fatalf("Artist [%s] not found after crash: %s", artistName, err)
+		}
+
+		// Only the last lookup wasn't flushed.
+		expected := 0
+		if j == 2 {
+			expected = 1
+		}
+
+		if calls := fsc.callCount("Search"); calls != expected {
+			t.Fatalf("Artist [%s] searched (%d) times after crash; expected (%d).", artistName, calls, expected)
+		}
+	}
+
+	// Nothing should be left behind from writing to a temporary file first.
+
+	files, err := ioutil.ReadDir(path.Dir(cacheFilepath))
+	if err != nil {
+		t.Fatalf("Could not list cache directory: %s", err)
+	} else if len(files) != 1 {
+		t.Fatalf("Expected only the cache file: (%d) files", len(files))
+	}
+}
+
+func TestSearchCache_FlushInterval(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+
+	cacheFilepath := path.Join(t.TempDir(), "search-cache.json")
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	// A count that won't be reached, so only time matters.
+	sa.SetSearchCacheFlush(cacheFilepath, 1000, time.Millisecond*10)
+
+	time.Sleep(time.Millisecond * 20)
+
+	_, err := sa.searchSpotifyArtists("The Band")
+	if err != nil {
+		t.Fatalf("Artist not found: %s", err)
+	}
+
+	loaded := newSearchCache()
+
+	err = loaded.load(cacheFilepath)
+	if err != nil {
+		t.Fatalf("Could not load flushed cache: %s", err)
+	}
+
+	if ids, found := loaded.getArtists(sa.artistNameKey("The Band")); found == false || len(ids) != 1 {
+		t.Fatalf("Lookup not flushed once the interval passed: %v", ids)
+	}
+}
+
+func TestDumpSearchCache(t *testing.T) {
+	cachedAt := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	scf := searchCacheFile{
+		SchemaVersion: SearchCacheSchemaVersion,
+		Artists: []searchCacheArtistsEntry{
+			{Name: "the band", Ids: []spotify.ID{"artist1"}, CachedAt: cachedAt},
+			{Name: "nobody", Ids: []spotify.ID{}, CachedAt: cachedAt},
+		},
+		Albums: []searchCacheAlbumEntry{
+			{ArtistId: "artist1", AlbumName: "first album", MarketName: "US", AlbumType: int(spotify.AlbumTypeAlbum), Ids: []spotify.ID{"album1"}, CachedAt: cachedAt},
+		},
+		AlbumTracks: []searchCacheAlbumTracksEntry{
+			{
+				AlbumId: "album1",
+				Tracks: []cachedAlbumTrack{
+					{Name: "Opener", Id: "album1-1", AvailableMarkets: []string{"GB", "US"}, DurationMs: 180000},
+				},
+			},
+		},
+	}
+
+	cacheFilepath := path.Join(t.TempDir(), "search-cache.json")
+
+	f, err := os.Create(cacheFilepath)
+	if err != nil {
+		t.Fatalf("Could not create cache file: %s", err)
+	}
+
+	err = json.NewEncoder(f).Encode(scf)
+	f.Close()
+
+	if err != nil {
+		t.Fatalf("Could not write cache file: %s", err)
+	}
+
+	b := new(bytes.Buffer)
+
+	err = DumpSearchCache(b, cacheFilepath)
+	if err != nil {
+		t.Fatalf("Could not dump cache: %s", err)
+	}
+
+	expected := `ARTIST [nobody] (NOT FOUND) (2020-01-02T03:04:05Z)
+ARTIST [the band] [artist1] (2020-01-02T03:04:05Z)
+ALBUM [artist1] [first album] MARKET=[US] TYPE=[album] [album1] (2020-01-02T03:04:05Z)
+ALBUM TRACKS [album1]
+  [album1-1] [Opener] (3m0s) MARKETS=[GB,US]
+`
+
+	if b.String() != expected {
+		t.Fatalf("Dump not correct:\n%s\n!=\n%s", b.String(), expected)
+	}
+}
+
+func TestSpotifyAdapter_ResetCaches(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+	fsc.addAlbum("artist1", "album1", "First Album", "album", "1990", "Song")
+
+	lookup := func(sa *SpotifyAdapter) {
+		id, err := sa.getSpotifyAlbumId("artist1", "first album", "", false, false)
+		if err != nil {
+			t.Fatalf("Album not found: %s", err)
+		} else if id != "album1" {
+			t.Fatalf("Album not correct: [%s]", id)
+		}
+	}
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	lookup(sa)
+
+	perLookup := fsc.callCount("GetArtistAlbumsOpt")
+
+	lookup(sa)
+
+	if fsc.callCount("GetArtistAlbumsOpt") != perLookup {
+		t.Fatalf("Second lookup should have come from the cache: (%d) calls", fsc.callCount("GetArtistAlbumsOpt"))
+	}
+
+	// Another adapter doesn't see the first one's cache.
+
+	lookup(newTestSpotifyAdapter(fsc))
+
+	if fsc.callCount("GetArtistAlbumsOpt") != perLookup*2 {
+		t.Fatalf("Adapters should not share a cache: (%d) calls", fsc.callCount("GetArtistAlbumsOpt"))
+	}
+
+	// Once reset, the first adapter has to look it up again.
+
+	sa.ResetCaches()
+	lookup(sa)
+
+	if fsc.callCount("GetArtistAlbumsOpt") != perLookup*3 {
+		t.Fatalf("Reset should have cleared the cache: (%d) calls", fsc.callCount("GetArtistAlbumsOpt"))
+	}
+
+	lookup(sa)
+
+	if fsc.callCount("GetArtistAlbumsOpt") != perLookup*3 {
+		t.Fatalf("Lookup after the reset should have been cached again: (%d) calls", fsc.callCount("GetArtistAlbumsOpt"))
+	}
+}
+
+func TestSpotifyAdapter_ConcurrentAdapters(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+
+	artistNames := []string{"First Band", "Second Band", "Third Band"}
+	for j, artistName := range artistNames {
+		artistId := spotify.ID(fmt.Sprintf("artist%d", j+1))
+		fsc.addArtist(artistId, artistName)
+		fsc.addAlbum(artistId, spotify.ID(fmt.Sprintf("album%d", j+1)), "Debut", "album", "1990", "Opener", "Closer")
+	}
+
+	adapters := []*SpotifyAdapter{newTestSpotifyAdapter(fsc), newTestSpotifyAdapter(fsc)}
+
+	// Each adapter looks up all of the same artists from several goroutines
+	// at once. This is for running with -race.
+
+	var wg sync.WaitGroup
+	errC := make(chan error, len(adapters)*len(artistNames)*2)
+
+	for _, sa := range adapters {
+		for k := 0; k < 2; k++ {
+			for _, artistName := range artistNames {
+				wg.Add(1)
+
+				go func(sa *SpotifyAdapter, artistName string) {
+					defer wg.Done()
+
+					foundTracks, missingTracks, _, err := sa.GetSpotifyTrackIdsWithNames(artistName, "Debut", []string{"opener", "closer"}, "")
+					if err != nil {
+						errC <- err
+					} else if len(foundTracks) != 2 || len(missingTracks) != 0 {
+						errC <- fmt.Errorf("tracks for [%s] not correct: %v %v", artistName, foundTracks, missingTracks)
+					}
+				}(sa, artistName)
+			}
+		}
+	}
+
+	wg.Wait()
+	close(errC)
+
+	for err := range errC {
+		t.Fatalf("Lookup failed: %s", err)
+	}
+
+	// Each adapter has everything cached now, on its own.
+
+	for j, sa := range adapters {
+		for _, artistName := range artistNames {
+			if _, found := sa.cache.getArtists(sa.artistNameKey(artistName)); found == false {
+				t.Fatalf("Artist [%s] not cached by adapter (%d).", artistName, j)
+			}
+		}
+	}
+
+	if adapters[0].cache == adapters[1].cache {
+		t.Fatalf("Adapters should not share a cache.")
+	}
+}
@@ -0,0 +1,91 @@
+package gnsssync
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"golang.org/x/net/context"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// Config
+const (
+	// sessionIdSize is how many random bytes go into a session ID.
+	sessionIdSize = 4
+)
+
+type sessionIdKey struct{}
+
+// NewSessionId returns a short random ID that identifies one run.
+func NewSessionId() (sessionId string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	raw := make([]byte, sessionIdSize)
+
+	_, err = rand.Read(raw)
+	log.PanicIf(err)
+
+	return hex.EncodeToString(raw), nil
+}
+
+// WithSessionId returns a context that carries the given session ID.
+func WithSessionId(ctx context.Context, sessionId string) context.Context {
+	return context.WithValue(ctx, sessionIdKey{}, sessionId)
+}
+
+// SessionIdFromContext returns the session ID carried by the context, if any.
+func SessionIdFromContext(ctx context.Context) (sessionId string, found bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	sessionId, found = ctx.Value(sessionIdKey{}).(string)
+	return sessionId, found
+}
+
+// SessionLogAdapter is a logging adapter that prefixes every message with the
+// session ID before passing it to another adapter, so that one run can be
+// picked out of a log that several runs write to. The ID carried by the
+// message's context is used if there is one.
+type SessionLogAdapter struct {
+	sessionId string
+	adapter   log.LogAdapter
+}
+
+func NewSessionLogAdapter(sessionId string, adapter log.LogAdapter) *SessionLogAdapter {
+	return &SessionLogAdapter{
+		sessionId: sessionId,
+		adapter:   adapter,
+	}
+}
+
+func (sla *SessionLogAdapter) prefix(lc *log.LogContext, message *string) *string {
+	sessionId := sla.sessionId
+	if currentSessionId, found := SessionIdFromContext(lc.Ctx); found == true {
+		sessionId = currentSessionId
+	}
+
+	prefixed := "<" + sessionId + "> " + *message
+	return &prefixed
+}
+
+func (sla *SessionLogAdapter) Debugf(lc *log.LogContext, message *string) error {
+	return sla.adapter.Debugf(lc, sla.prefix(lc, message))
+}
+
+func (sla *SessionLogAdapter) Infof(lc *log.LogContext, message *string) error {
+	return sla.adapter.Infof(lc, sla.prefix(lc, message))
+}
+
+func (sla *SessionLogAdapter) Warningf(lc *log.LogContext, message *string) error {
+	return sla.adapter.Warningf(lc, sla.prefix(lc, message))
+}
+
+func (sla *SessionLogAdapter) Errorf(lc *log.LogContext, message *string) error {
+	return sla.adapter.Errorf(lc, sla.prefix(lc, message))
+}
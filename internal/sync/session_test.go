@@ -0,0 +1,80 @@
+package gnsssync
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestNewSessionId(t *testing.T) {
+	first, err := NewSessionId()
+	if err != nil {
+		t.Fatalf("Could not create session ID: %s", err)
+	} else if len(first) != sessionIdSize*2 {
+		t.Fatalf("Session ID not the right size: [%s]", first)
+	}
+
+	second, err := NewSessionId()
+	if err != nil {
+		t.Fatalf("Could not create second session ID: %s", err)
+	} else if second == first {
+		t.Fatalf("Session IDs should differ between runs: [%s]", first)
+	}
+}
+
+func TestSessionLogAdapter(t *testing.T) {
+	rla := new(recordingLogAdapter)
+	sla := NewSessionLogAdapter("abcd1234", rla)
+
+	lc := &log.LogContext{
+		Logger: log.NewLogger("gnss.test"),
+	}
+
+	first := "first message"
+	second := "second message"
+	third := "third message"
+
+	sla.Infof(lc, &first)
+	sla.Warningf(lc, &second)
+
+	// The ID carried by the context wins.
+
+	lc.Ctx = WithSessionId(context.Background(), "ffff0000")
+	sla.Errorf(lc, &third)
+
+	expected := []string{
+		"INFO <abcd1234> first message",
+		"WARNING <abcd1234> second message",
+		"ERROR <ffff0000> third message",
+	}
+
+	if reflect.DeepEqual(rla.messages, expected) != true {
+		t.Fatalf("Messages not tagged correctly: %v", rla.messages)
+	}
+
+	// The original message isn't changed.
+
+	if first != "first message" {
+		t.Fatalf("Message should not have been changed: [%s]", first)
+	}
+}
+
+func TestSessionIdFromContext(t *testing.T) {
+	_, found := SessionIdFromContext(nil)
+	if found != false {
+		t.Fatalf("No session ID expected without a context.")
+	}
+
+	_, found = SessionIdFromContext(context.Background())
+	if found != false {
+		t.Fatalf("No session ID expected in an empty context.")
+	}
+
+	sessionId, found := SessionIdFromContext(WithSessionId(context.Background(), "abcd1234"))
+	if found != true || sessionId != "abcd1234" {
+		t.Fatalf("Session ID not carried by the context: [%s] (%v)", sessionId, found)
+	}
+}
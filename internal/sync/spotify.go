@@ -1,9 +1,15 @@
 package gnsssync
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 
 	"golang.org/x/net/context"
 
@@ -14,53 +20,177 @@ import (
 // Config
 const (
 	SpotifyReadBatchSize = 50
+
+	// spotifyAlbumLookupBatchSize is the most albums that Spotify will return
+	// details for at once.
+	spotifyAlbumLookupBatchSize = 20
+
+	// spotifyPlaylistReadConcurrency is how many pages of a playlist we'll
+	// read at once.
+	spotifyPlaylistReadConcurrency = 4
+)
+
+// Match methods
+const (
+	// MatchMethodStrictAlbum indicates that the album was found under the
+	// artist by its exact (normalized) name.
+	MatchMethodStrictAlbum = "strict-album"
+
+	// MatchMethodLiberalAlbum indicates that the album was found under the
+	// artist after stripping parenthetical expressions from the names.
+	MatchMethodLiberalAlbum = "liberal-album"
+
+	// MatchMethodAlbumSearch indicates that the artist wasn't found and the
+	// album was found by searching for it directly.
+	MatchMethodAlbumSearch = "album-search"
+
+	// MatchMethodSingle indicates that the album wasn't found and the track
+	// was found on a single (under the artist) having the same name as the
+	// track.
+	MatchMethodSingle = "single"
+
+	// MatchMethodTrackSearch indicates that the favorite had no album name
+	// (or that it wasn't found on the album) and the track was found by
+	// searching for it directly.
+	MatchMethodTrackSearch = "track-search"
+
+	// MatchMethodIsrc indicates that the track was found by its ISRC (the
+	// identifier of the recording), which Napster gave us.
+	MatchMethodIsrc = "isrc"
+)
+
+// Misc
+var (
+	// DefaultMatchStrategies is the order in which the match strategies are
+	// tried if not otherwise configured.
+	DefaultMatchStrategies = []string{
+		MatchMethodStrictAlbum,
+		MatchMethodLiberalAlbum,
+		MatchMethodSingle,
+		MatchMethodTrackSearch,
+	}
+
+	// supportedMatchStrategies are the match methods that can be configured
+	// as strategies.
+	supportedMatchStrategies = []string{
+		MatchMethodStrictAlbum,
+		MatchMethodLiberalAlbum,
+		MatchMethodAlbumSearch,
+		MatchMethodSingle,
+		MatchMethodTrackSearch,
+	}
+
+	// supportedAlbumTypes are the kinds of album that we can look for an
+	// album's name under, by the names that they're configured by.
+	supportedAlbumTypes = map[string]spotify.AlbumType{
+		"album":       spotify.AlbumTypeAlbum,
+		"single":      spotify.AlbumTypeSingle,
+		"compilation": spotify.AlbumTypeCompilation,
+	}
 )
 
 // Errors
 var (
+	ErrInvalidMatchStrategy = fmt.Errorf("match strategy not valid")
+	ErrInvalidAlbumType     = fmt.Errorf("album type not valid")
+
 	ErrSpotifyArtistNotFound = fmt.Errorf("artist not found in Spotify")
 	ErrSpotifyAlbumNotFound  = fmt.Errorf("album not found in Spotify")
 	ErrSpotifyTrackNotFound  = fmt.Errorf("track not found in Spotify")
-)
 
-// Cache
-var (
-	cachedArtists = make(map[string][]spotify.ID)
-	cachedAlbums  = make(map[albumKey]spotify.ID)
-	cachedTracks  = make(map[spotify.ID]map[string]spotify.ID)
+	ErrSpotifyPlaylistNotFound    = fmt.Errorf("playlist not found in Spotify")
+	ErrSpotifyPlaylistNotWritable = fmt.Errorf("playlist belongs to another user and is not collaborative")
+	ErrSpotifyPlaylistAmbiguous   = fmt.Errorf("more than one playlist matches")
 )
 
 // Misc
 var (
+	// DefaultEditionStopwords are the words that, when found in a trailing
+	// parenthetical/bracketed clause, indicate that the clause describes an
+	// edition or version rather than being part of the title. These are
+	// matched as whole words (or their inflections in
+	// editionStopwordInflections) so that, for example, "(Liverpool)" isn't
+	// taken for "live".
+	DefaultEditionStopwords = []string{
+		"remaster",
+		"deluxe",
+		"live",
+		"mono",
+		"stereo",
+		"version",
+		"edit",
+		"mix",
+		"remix",
+	}
+
+	// editionStopwordInflections are the other forms of the edition
+	// stopwords that also match (e.g. "Remastered" for "remaster").
+	editionStopwordInflections = map[string][]string{
+		"remaster": {"remastered", "remasters", "remastering"},
+		"version":  {"versions"},
+		"edit":     {"edited", "edits"},
+		"mix":      {"mixed", "mixes"},
+		"remix":    {"remixed", "remixes"},
+	}
+
 	sLog                = log.NewLogger("gnss.spotify")
 	invalidTrackCharsRx *regexp.Regexp
 	spaceCharsRx        *regexp.Regexp
+	trackNumberPrefixRx *regexp.Regexp
+	remasterSuffixRx    *regexp.Regexp
 	allowCache          = true
 )
 
-type albumKey struct {
-	artistId  spotify.ID
-	albumName string
-}
-
 type SpotifyCache struct {
 	ctx         context.Context
 	spotifyAuth *SpotifyContext
+	client      SpotifyClient
+	retryPolicy RetryPolicy
 
 	playlistCache map[string]spotify.ID
 	userId        string
+
+	// playlists are the playlists that we've looked up, so that we can
+	// check whether we can change them without reading them again.
+	playlists map[spotify.ID]spotify.SimplePlaylist
+
+	userIdOverride     string
+	playlistIdOverride spotify.ID
+
+	exactPlaylistName bool
+
+	promptReader *bufio.Reader
+	promptWriter io.Writer
 }
 
 func NewSpotifyCache(ctx context.Context, spotifyAuth *SpotifyContext) *SpotifyCache {
 	playlistCache := make(map[string]spotify.ID)
+	playlists := make(map[spotify.ID]spotify.SimplePlaylist)
+	isc := spotifyAuth.InstrumentedClient()
 
 	return &SpotifyCache{
 		ctx:           ctx,
 		spotifyAuth:   spotifyAuth,
+		client:        isc,
+		retryPolicy:   isc.RetryPolicy(spotifyRetryPolicy),
 		playlistCache: playlistCache,
+		playlists:     playlists,
 	}
 }
 
+// SetUserIdOverride has us operate on the playlists of the given user rather
+// than those of the authenticated user.
+func (sc *SpotifyCache) SetUserIdOverride(userIdOverride string) {
+	sc.userIdOverride = userIdOverride
+}
+
+// SetPlaylistIdOverride has us use the given playlist whatever name we're
+// asked for rather than looking it up by name. This is the only way to tell
+// apart playlists having the same name.
+func (sc *SpotifyCache) SetPlaylistIdOverride(playlistIdOverride spotify.ID) {
+	sc.playlistIdOverride = playlistIdOverride
+}
+
 func (sc *SpotifyCache) GetSpotifyPlaylistId(spotifyUserId string, playlistName string) (id spotify.ID, err error) {
 	defer func() {
 		if state := recover(); state != nil {
@@ -68,265 +198,918 @@ func (sc *SpotifyCache) GetSpotifyPlaylistId(spotifyUserId string, playlistName
 		}
 	}()
 
+	if sc.playlistIdOverride != "" {
+		return sc.playlistIdOverride, nil
+	}
+
+	if sc.exactPlaylistName == false {
+		playlistName = strings.ToLower(playlistName)
+	}
+
 	if id, found := sc.playlistCache[playlistName]; found == true {
 		return id, nil
 	}
 
 	sLog.Debugf(sc.ctx, "Getting playlist ID: [%s]", playlistName)
 
-	splp, err := sc.spotifyAuth.Client.GetPlaylistsForUser(spotifyUserId)
-	log.PanicIf(err)
+	offset := 0
+	limit := SpotifyReadBatchSize
+
+	o := &spotify.Options{
+		Offset: &offset,
+		Limit:  &limit,
+	}
+
+	// Stop at the first page having a match so that we don't read the rest
+	// of the playlists for nothing.
+
+	matches := make([]spotify.SimplePlaylist, 0)
+	for len(matches) == 0 {
+		splp, err := withRetryValue(sc.retryPolicy, "reading playlists", func() (*spotify.SimplePlaylistPage, error) {
+			return sc.client.GetPlaylistsForUserOpt(spotifyUserId, o)
+		})
+
+		log.PanicIf(err)
+
+		if len(splp.Playlists) == 0 {
+			break
+		}
+
+		for _, p := range splp.Playlists {
+			currentPlaylistName := p.Name
+			if sc.exactPlaylistName == false {
+				currentPlaylistName = strings.ToLower(currentPlaylistName)
+			}
 
-	playlistName = strings.ToLower(playlistName)
-	for _, p := range splp.Playlists {
-		currentPlaylistName := strings.ToLower(p.Name)
+			if currentPlaylistName == playlistName {
+				matches = append(matches, p)
+			}
+		}
+
+		offset += len(splp.Playlists)
+	}
 
-		if currentPlaylistName == playlistName {
-			sc.playlistCache[playlistName] = p.ID
+	if len(matches) > 0 {
+		p := matches[0]
 
-			return p.ID, nil
+		if len(matches) > 1 {
+			sLog.Warningf(sc.ctx, "(%d) playlists are named [%s]. Using the first: [%s] ([%s])", len(matches), playlistName, p.Name, p.ID)
 		}
+
+		sc.playlistCache[playlistName] = p.ID
+		sc.playlists[p.ID] = p
+
+		return p.ID, nil
+	}
+
+	if sc.promptReader != nil {
+		id, err := sc.promptForPlaylist(spotifyUserId, playlistName)
+		log.PanicIf(err)
+
+		sc.playlistCache[playlistName] = id
+
+		return id, nil
 	}
 
-	log.Panic(fmt.Errorf("playlist not found: [%s]", playlistName))
+	sLog.Warningf(sc.ctx, "Playlist not found: [%s]", playlistName)
+	log.Panic(ErrSpotifyPlaylistNotFound)
 
 	// Obligatory.
 	return spotify.ID(""), nil
 }
 
-func (sc *SpotifyCache) GetSpotifyCurrentUserId() (id string, err error) {
+// SetExactPlaylistName has us match the playlist name exactly rather than
+// ignoring case.
+func (sc *SpotifyCache) SetExactPlaylistName(exactPlaylistName bool) {
+	sc.exactPlaylistName = exactPlaylistName
+}
+
+// FindSpotifyPlaylistByNameContains returns the one playlist whose name
+// contains the given substring (ignoring case unless we were told to match
+// exactly). It's an error if none or more than one match.
+func (sc *SpotifyCache) FindSpotifyPlaylistByNameContains(spotifyUserId string, substring string) (p spotify.SimplePlaylist, err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	if sc.userId != "" {
-		return sc.userId, nil
+	if sc.exactPlaylistName == false {
+		substring = strings.ToLower(substring)
 	}
 
-	sLog.Debugf(sc.ctx, "Getting current user ID.")
-
-	pu, err := sc.spotifyAuth.Client.CurrentUser()
+	playlists, err := sc.GetSpotifyPlaylists(spotifyUserId)
 	log.PanicIf(err)
 
-	sc.userId = pu.ID
+	matches := make([]spotify.SimplePlaylist, 0)
+	for _, current := range playlists {
+		currentPlaylistName := current.Name
+		if sc.exactPlaylistName == false {
+			currentPlaylistName = strings.ToLower(currentPlaylistName)
+		}
 
-	return pu.ID, nil
-}
+		if strings.Contains(currentPlaylistName, substring) == true {
+			matches = append(matches, current)
+		}
+	}
 
-type SpotifyAdapter struct {
-	ctx         context.Context
-	spotifyAuth *SpotifyContext
-}
+	if len(matches) == 0 {
+		sLog.Warningf(sc.ctx, "No playlist name contains [%s].", substring)
+		log.Panic(ErrSpotifyPlaylistNotFound)
+	} else if len(matches) > 1 {
+		sLog.Warningf(sc.ctx, "(%d) playlist names contain [%s]:", len(matches), substring)
 
-func NewSpotifyAdapter(ctx context.Context, spotifyAuth *SpotifyContext) *SpotifyAdapter {
-	return &SpotifyAdapter{
-		ctx:         ctx,
-		spotifyAuth: spotifyAuth,
+		for _, current := range matches {
+			sLog.Warningf(sc.ctx, "  [%s] ([%s])", current.Name, current.ID)
+		}
+
+		log.Panic(ErrSpotifyPlaylistAmbiguous)
 	}
+
+	return matches[0], nil
 }
 
-func (sa *SpotifyAdapter) searchSpotifyArtists(name string) (ids []spotify.ID, err error) {
+// CheckSpotifyPlaylistWritable verifies that we can change the given playlist
+// before we try to. This is only done before making changes since reading
+// another user's playlist is fine. If the playlist isn't one of the user's, we
+// can't tell and leave it to Spotify to reject the changes.
+func (sc *SpotifyCache) CheckSpotifyPlaylistWritable(spotifyUserId string, playlistId spotify.ID) (err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	if allowCache {
-		if id, found := cachedArtists[name]; found == true {
-			return id, nil
-		}
-	}
+	p, found := sc.playlists[playlistId]
+	if found == false {
+		playlists, err := sc.GetSpotifyPlaylists(spotifyUserId)
+		log.PanicIf(err)
 
-	sLog.Debugf(nil, "Search for artist [%s].", name)
+		for _, current := range playlists {
+			if current.ID == playlistId {
+				p = current
+				found = true
 
-	var sr *spotify.SearchResult
+				break
+			}
+		}
 
-	// Though we support more than one page, we'll limit it to one page for now
-	// under the assumption that we should never need to hit the second.
-	maxPages := 1
+		if found == false {
+			sLog.Warningf(sc.ctx, "Playlist [%s] is not one of the playlists of [%s]. Can not check whether it can be changed.", playlistId, spotifyUserId)
+			return nil
+		}
 
-	matching := make([]spotify.ID, 0)
-	for j := 0; j < maxPages; j++ {
-		if sr == nil {
-			// Extra security due to some concerns that we have.
-			if j > 0 {
-				log.Panicf("for some reason we aren't search against a new artist page on the second iteration")
-			}
+		sc.playlists[playlistId] = p
+	}
 
-			sLog.Debugf(sa.ctx, "Searching for artist: [%s]", name)
+	err = sc.checkPlaylistWritable(p)
+	log.PanicIf(err)
 
-			sr, err = sa.spotifyAuth.Client.Search(name, spotify.SearchTypeArtist)
-			log.PanicIf(err)
-		} else if err := sa.spotifyAuth.Client.NextArtistResults(sr); log.Is(err, spotify.ErrNoMorePages) == true {
-			break
-		} else if err != nil {
-			sLog.Debugf(sa.ctx, "(Retrieving next page of results.)")
-			log.Panic(err)
-		}
+	return nil
+}
 
-		// Safety.
-		if len(sr.Artists.Artists) == 0 {
-			log.Panicf("no artists")
+// checkPlaylistWritable verifies that we can change the given playlist. We can
+// only change another user's playlist if they've made it collaborative. If
+// we were told which user to operate on, we only warn since they might have
+// given us access some other way.
+func (sc *SpotifyCache) checkPlaylistWritable(p spotify.SimplePlaylist) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
 		}
+	}()
 
-		for _, a := range sr.Artists.Artists {
-			an := strings.ToLower(a.Name)
+	currentUserId, err := sc.GetSpotifyCurrentUserId()
+	log.PanicIf(err)
 
-			if an == name {
-				matching = append(matching, a.ID)
-			}
+	if p.Owner.ID != currentUserId && p.Collaborative == false {
+		if sc.userIdOverride != "" {
+			sLog.Warningf(sc.ctx, "Playlist [%s] is owned by [%s] and is not collaborative. Trying to change it anyway.", p.Name, p.Owner.ID)
+			return nil
 		}
+
+		sLog.Warningf(sc.ctx, "Playlist [%s] is owned by [%s] and is not collaborative.", p.Name, p.Owner.ID)
+		log.Panic(ErrSpotifyPlaylistNotWritable)
 	}
 
-	if len(matching) > 0 {
-		if allowCache {
-			cachedArtists[name] = matching
+	return nil
+}
+
+// GetSpotifyPlaylists returns all of the playlists for the given user, reading
+// through all pages.
+func (sc *SpotifyCache) GetSpotifyPlaylists(spotifyUserId string) (playlists []spotify.SimplePlaylist, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
 		}
+	}()
 
-		return matching, nil
-	}
+	sLog.Debugf(sc.ctx, "Reading playlists for user [%s].", spotifyUserId)
 
-	log.Panic(ErrSpotifyArtistNotFound)
-	return []spotify.ID{}, nil
-}
+	offset := 0
+	limit := SpotifyReadBatchSize
 
-// removeSuffixClause removes something like "(xyz)" at the very right side of
-// the given string.
-func (sa *SpotifyAdapter) removeSuffixClause(arg, leftDelimiter, rightDelimiter string) (distilled string) {
-	distilled = strings.TrimSpace(arg)
-	if distilled[len(distilled)-1:] != rightDelimiter {
-		return
+	o := &spotify.Options{
+		Offset: &offset,
+		Limit:  &limit,
 	}
 
-	i := strings.LastIndex(distilled, leftDelimiter)
+	playlists = make([]spotify.SimplePlaylist, 0)
 
-	if i == -1 {
-		return distilled
-	}
+	for {
+		splp, err := withRetryValue(sc.retryPolicy, "reading playlists", func() (*spotify.SimplePlaylistPage, error) {
+			return sc.client.GetPlaylistsForUserOpt(spotifyUserId, o)
+		})
 
-	sLog.Debugf(nil, "Stripping expressions: [%s]", distilled)
+		log.PanicIf(err)
 
-	i--
+		if len(splp.Playlists) == 0 {
+			break
+		}
 
-	for i > 0 && string(distilled[i]) == " " {
-		i--
+		playlists = append(playlists, splp.Playlists...)
+
+		offset += len(splp.Playlists)
 	}
 
-	distilled = strings.TrimRight(distilled[:i+1], " ")
-	return distilled
+	return playlists, nil
 }
 
-func (sa *SpotifyAdapter) normalizeTitle(arg string) (distilled string) {
-	distilled = arg
-
-	// TODO(dustin): Flatten contractions. Yes, we've seen this being different because providers.
+func (sc *SpotifyCache) GetSpotifyCurrentUserId() (id string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
 
-	distilled = invalidTrackCharsRx.ReplaceAllString(distilled, " ")
-	distilled = strings.Trim(spaceCharsRx.ReplaceAllString(distilled, " "), " ")
-	distilled = strings.ToLower(distilled)
+	if sc.userId != "" {
+		return sc.userId, nil
+	}
 
-	return distilled
-}
+	sLog.Debugf(sc.ctx, "Getting current user ID.")
 
-func (sa *SpotifyAdapter) simplifyTitle(arg string) (distilled string) {
-	distilled = arg
+	pu, err := withRetryValue(sc.retryPolicy, "reading current user", func() (*spotify.PrivateUser, error) {
+		return sc.client.CurrentUser()
+	})
 
-	// Repeatedly strip parenthetical/bracketed phrases from the right-side of
-	// the title until they're all gone. We've actually seen some albums be
-	// suffixed with both "(Remastered)" and "(album)".
-	for {
-		distilledThis := sa.removeSuffixClause(distilled, "(", ")")
-		distilledThis = sa.removeSuffixClause(distilledThis, "[", "]")
+	log.PanicIf(err)
 
-		if distilledThis == distilled {
-			return distilled
-		}
+	sc.userId = pu.ID
 
-		distilled = distilledThis
-	}
+	return pu.ID, nil
 }
 
-func (sa *SpotifyAdapter) isEqual(typeName, arg1, arg2 string, doLiberalSearch bool) (isEqual bool, err error) {
+// GetSpotifyUserId returns the ID of the user whose playlists we operate on.
+// This is the authenticated user unless we were given another.
+func (sc *SpotifyCache) GetSpotifyUserId() (id string, err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	// Preprocess the strings.
-
-	arg1 = strings.TrimSpace(arg1)
-	arg1 = strings.ToLower(arg1)
+	if sc.userIdOverride != "" {
+		return sc.userIdOverride, nil
+	}
 
-	arg2 = strings.TrimSpace(arg2)
-	arg2 = strings.ToLower(arg2)
+	id, err = sc.GetSpotifyCurrentUserId()
+	log.PanicIf(err)
 
-	if doLiberalSearch {
-		// Remove subexpressions that may indicate that this album is a
-		// variation or alternate production rather than the original.
+	return id, nil
+}
 
-		distilledArg1 := sa.simplifyTitle(arg1)
-		distilledArg2 := sa.simplifyTitle(arg2)
+type SpotifyAdapter struct {
+	ctx         context.Context
+	spotifyAuth *SpotifyContext
+	client      SpotifyClient
+	retryPolicy RetryPolicy
+
+	albumSearchOnArtistMiss bool
+	editionStopwords        []string
+	preferEarliestAlbum     bool
+	matchStrategies         []string
+	albumTypes              []spotify.AlbumType
+	strictArtist            bool
+	foldVolumes             bool
+	stripTrackNumbers       bool
+	foldDiacritics          bool
+	trackMatchDistance      int
+
+	// The closest candidates for the albums and tracks that we couldn't find
+	// (only kept if annotateNearest is set).
+	annotateNearest bool
+	nearestLock     sync.Mutex
+	nearestAlbums   map[nearestAlbumKey]NearestCandidate
+	foundAlbumIds   map[nearestAlbumKey][]spotify.ID
+	nearestTracks   map[nearestTrackKey]NearestCandidate
+
+	// cache has what we've already looked up.
+	cache *searchCache
+}
 
-		sLog.Infof(nil, "SIMPLIFY [%s]->[%s] ?= [%s]->[%s]", arg1, distilledArg1, arg2, distilledArg2)
+func NewSpotifyAdapter(ctx context.Context, spotifyAuth *SpotifyContext) *SpotifyAdapter {
+	isc := spotifyAuth.InstrumentedClient()
 
-		if distilledArg1 == distilledArg2 {
-			return true, nil
-		}
-	} else {
-		// Do a direct string-comparison.
+	return &SpotifyAdapter{
+		ctx:              ctx,
+		spotifyAuth:      spotifyAuth,
+		client:           isc,
+		retryPolicy:      isc.RetryPolicy(spotifyRetryPolicy),
+		editionStopwords: DefaultEditionStopwords,
+		cache:            newSearchCache(),
+	}
+}
 
-		if arg1 == arg2 {
-			return true, nil
-		}
+// ResetCaches clears the cached artists, albums, and tracks (e.g. before
+// matching against a different account).
+func (sa *SpotifyAdapter) ResetCaches() {
+	sa.cache.reset()
+}
 
-		// Remove symbols and extra spacing (some systems might use parantheses
-		// and others might use square brackets; they will be equal after
-		// this).
+// SetEditionStopwords sets the words that identify a trailing parenthetical
+// as describing an edition (which can be stripped when comparing titles).
+func (sa *SpotifyAdapter) SetEditionStopwords(editionStopwords []string) {
+	normalized := make([]string, len(editionStopwords))
+	for j, stopword := range editionStopwords {
+		normalized[j] = strings.ToLower(strings.TrimSpace(stopword))
+	}
 
-		arg1 = sa.normalizeTitle(arg1)
-		arg2 = sa.normalizeTitle(arg2)
+	sa.editionStopwords = normalized
+}
 
-		if arg1 == arg2 {
-			return true, nil
-		}
-	}
+// SetAlbumSearchOnArtistMiss determines whether we'll search for an album
+// directly (and loosely verify its artist) when the artist can't be found.
+func (sa *SpotifyAdapter) SetAlbumSearchOnArtistMiss(albumSearchOnArtistMiss bool) {
+	sa.albumSearchOnArtistMiss = albumSearchOnArtistMiss
+}
 
-	return false, nil
+// SetPreferEarliestAlbum determines whether, when more than one of an
+// artist's albums match (e.g. an original and its reissues), we'll choose the
+// one that was released first rather than the first one that Spotify returns.
+func (sa *SpotifyAdapter) SetPreferEarliestAlbum(preferEarliestAlbum bool) {
+	sa.preferEarliestAlbum = preferEarliestAlbum
 }
 
-// getSpotifyAlbumId returns a matching Spotify album ID. `doLiberalSearch` can
-// be used to find the first match after modifying the list of fetched albums
-// to exclude paranthetical expressions at the end of the album names (e.g.
-// " (Remastered)") which are sometimes returned instead of the original album
-// name that we'd expect to find. In this case, maybe some newer remastered
-// album has taken place of the original album in Spotify and the origin album
-// in its original quality and with its original name is no longer available.
-func (sa *SpotifyAdapter) getSpotifyAlbumId(artistId spotify.ID, name string, marketName string, doLiberalSearch, doPrintCandidates bool) (id spotify.ID, err error) {
+// ParseMatchStrategies parses a comma-separated list of match strategies
+// (MatchMethod* constants), in the order that they should be tried.
+func ParseMatchStrategies(raw string) (matchStrategies []string, err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	albumAllowCache := allowCache
-	if doLiberalSearch {
-		albumAllowCache = false
-	}
+	matchStrategies = make([]string, 0)
+	seen := make(map[string]bool)
 
-	cak := albumKey{
-		artistId:  artistId,
-		albumName: name,
-	}
+	for _, strategy := range strings.Split(raw, ",") {
+		strategy = strings.ToLower(strings.TrimSpace(strategy))
+		if strategy == "" {
+			continue
+		}
 
-	if albumAllowCache {
-		if id, found := cachedAlbums[cak]; found == true {
-			return id, nil
+		supported := false
+		for _, supportedStrategy := range supportedMatchStrategies {
+			if strategy == supportedStrategy {
+				supported = true
+				break
+			}
 		}
-	}
+
+		if supported == false {
+			sLog.Warningf(nil, "Match strategy [%s] is not one of: %s", strategy, strings.Join(supportedMatchStrategies, ", "))
+			log.Panic(ErrInvalidMatchStrategy)
+		}
+
+		if _, found := seen[strategy]; found == true {
+			continue
+		}
+
+		matchStrategies = append(matchStrategies, strategy)
+		seen[strategy] = true
+	}
+
+	if len(matchStrategies) == 0 {
+		log.Panic(ErrInvalidMatchStrategy)
+	}
+
+	return matchStrategies, nil
+}
+
+// SetMatchStrategies sets the order in which the match strategies are tried.
+func (sa *SpotifyAdapter) SetMatchStrategies(matchStrategies []string) {
+	sa.matchStrategies = matchStrategies
+}
+
+// getMatchStrategies returns the match strategies to try, in order. Unless
+// they were configured, these are the defaults plus searching for the album
+// directly if we were told to do that when the artist isn't found.
+func (sa *SpotifyAdapter) getMatchStrategies() []string {
+	if sa.matchStrategies != nil {
+		return sa.matchStrategies
+	}
+
+	matchStrategies := make([]string, len(DefaultMatchStrategies))
+	copy(matchStrategies, DefaultMatchStrategies)
+
+	if sa.albumSearchOnArtistMiss == true {
+		matchStrategies = append(matchStrategies, MatchMethodAlbumSearch)
+	}
+
+	return matchStrategies
+}
+
+// ParseAlbumTypes parses a comma-separated list of album types (album,
+// single, compilation) in the order that they should be preferred.
+func ParseAlbumTypes(raw string) (albumTypes []spotify.AlbumType, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	albumTypes = make([]spotify.AlbumType, 0)
+	seen := make(map[spotify.AlbumType]bool)
+
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		albumType, found := supportedAlbumTypes[name]
+		if found == false {
+			sLog.Warningf(nil, "Album type [%s] is not one of: album, single, compilation", name)
+			log.Panic(ErrInvalidAlbumType)
+		}
+
+		if _, found := seen[albumType]; found == true {
+			continue
+		}
+
+		albumTypes = append(albumTypes, albumType)
+		seen[albumType] = true
+	}
+
+	if len(albumTypes) == 0 {
+		log.Panic(ErrInvalidAlbumType)
+	}
+
+	return albumTypes, nil
+}
+
+// SetAlbumTypes sets the kinds of album that an album's name is looked for
+// under, in order of preference. If the same name exists as more than one of
+// them (e.g. a self-titled album and single), the earlier type is always the
+// one that's used. Only albums are looked at by default.
+func (sa *SpotifyAdapter) SetAlbumTypes(albumTypes []spotify.AlbumType) {
+	sa.albumTypes = albumTypes
+}
+
+// SetStrictArtist has us require that artist-names match exactly (other than
+// case) rather than loosely. Anything else is reported as not found.
+func (sa *SpotifyAdapter) SetStrictArtist(strictArtist bool) {
+	sa.strictArtist = strictArtist
+}
+
+// SetFoldVolumes has the liberal album search treat the different ways of
+// writing a volume (e.g. "Vol. 5", "Volume V", and "5") as equal.
+func (sa *SpotifyAdapter) SetFoldVolumes(foldVolumes bool) {
+	sa.foldVolumes = foldVolumes
+}
+
+// SetStripTrackNumbers has us ignore a track-number prefix (e.g. "01 - ") on
+// track names.
+func (sa *SpotifyAdapter) SetStripTrackNumbers(stripTrackNumbers bool) {
+	sa.stripTrackNumbers = stripTrackNumbers
+}
+
+// stripTrackNumber removes a leading track-number from the given name. The
+// name is returned as-is if that would leave nothing.
+func stripTrackNumber(arg string) string {
+	stripped := trackNumberPrefixRx.ReplaceAllString(arg, "")
+	if strings.TrimSpace(stripped) == "" {
+		return arg
+	}
+
+	return stripped
+}
+
+// SetFoldDiacritics has us ignore accents when comparing names (e.g.
+// "Motörhead" and "Motorhead").
+func (sa *SpotifyAdapter) SetFoldDiacritics(foldDiacritics bool) {
+	sa.foldDiacritics = foldDiacritics
+}
+
+// SetTrackMatchDistance has us fall back to the album track whose name is
+// closest to the one that we're looking for, as long as it's no more than this
+// many single-character edits away (e.g. a transposed or missing letter). Zero
+// only allows exact matches.
+func (sa *SpotifyAdapter) SetTrackMatchDistance(trackMatchDistance int) {
+	sa.trackMatchDistance = trackMatchDistance
+}
+
+// artistNameKey returns the form of the artist-name that we compare exactly.
+// Any featured artists are ignored.
+func (sa *SpotifyAdapter) artistNameKey(artistName string) string {
+	artistName = removeFeaturedArtists(artistName)
+
+	if sa.foldDiacritics == true {
+		artistName = foldDiacritics(artistName)
+	}
+
+	return strings.ToLower(artistName)
+}
+
+// isArtistMatch returns whether the given Spotify artist-name matches the
+// given (lower-case) artist-name. Unless we're being strict, this is a loose
+// comparison.
+func (sa *SpotifyAdapter) isArtistMatch(spotifyArtistName, artistName string) bool {
+	if sa.artistNameKey(spotifyArtistName) == sa.artistNameKey(artistName) {
+		return true
+	} else if sa.strictArtist == true {
+		return false
+	}
+
+	return isFuzzyNameMatch(sa.normalizeTitle(spotifyArtistName), sa.normalizeTitle(artistName))
+}
+
+// hasMatchStrategy returns whether the given match strategy will be tried.
+func (sa *SpotifyAdapter) hasMatchStrategy(matchStrategy string) bool {
+	for _, current := range sa.getMatchStrategies() {
+		if current == matchStrategy {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (sa *SpotifyAdapter) searchSpotifyArtists(name string) (ids []spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	// The cache is keyed on the name as we compare it so that it's still
+	// valid when loaded by a later run.
+	nameKey := sa.artistNameKey(name)
+
+	if allowCache {
+		if ids, found := sa.cache.getArtists(nameKey); found == true {
+			if len(ids) == 0 {
+				log.Panic(ErrSpotifyArtistNotFound)
+			}
+
+			return ids, nil
+		}
+	}
+
+	sLog.Debugf(nil, "Search for artist [%s].", name)
+
+	var sr *spotify.SearchResult
+
+	// Though we support more than one page, we'll limit it to one page for now
+	// under the assumption that we should never need to hit the second.
+	maxPages := 1
+
+	matching := make([]spotify.ID, 0)
+	for j := 0; j < maxPages; j++ {
+		if sr == nil {
+			// Extra security due to some concerns that we have.
+			if j > 0 {
+				log.Panicf("for some reason we aren't search against a new artist page on the second iteration")
+			}
+
+			sLog.Debugf(sa.ctx, "Searching for artist: [%s]", name)
+
+			sr, err = withRetryValue(sa.retryPolicy, "searching for artist", func() (*spotify.SearchResult, error) {
+				return sa.client.Search(removeFeaturedArtists(name), spotify.SearchTypeArtist)
+			})
+
+			log.PanicIf(err)
+		} else if err := sa.client.NextArtistResults(sr); log.Is(err, spotify.ErrNoMorePages) == true {
+			break
+		} else if err != nil {
+			sLog.Debugf(sa.ctx, "(Retrieving next page of results.)")
+			log.Panic(err)
+		}
+
+		// No results just means that there's no such artist. This is cached
+		// like any other miss.
+		if sr.Artists == nil || len(sr.Artists.Artists) == 0 {
+			break
+		}
+
+		for _, a := range sr.Artists.Artists {
+			if sa.artistNameKey(a.Name) == nameKey {
+				matching = append(matching, a.ID)
+			}
+		}
+	}
+
+	if allowCache {
+		sa.cache.setArtists(nameKey, matching)
+	}
+
+	if len(matching) > 0 {
+		return matching, nil
+	}
+
+	log.Panic(ErrSpotifyArtistNotFound)
+	return []spotify.ID{}, nil
+}
+
+// removeSuffixClause removes something like "(xyz)" at the very right side of
+// the given string. The string is returned as-is (but trimmed) if it's too
+// short to have a clause, if the clause isn't balanced, or if the clause is
+// all that there is.
+func (sa *SpotifyAdapter) removeSuffixClause(arg, leftDelimiter, rightDelimiter string) (distilled string) {
+	distilled = strings.TrimSpace(arg)
+	if len(distilled) < len(leftDelimiter)+len(rightDelimiter) || strings.HasSuffix(distilled, rightDelimiter) == false {
+		return distilled
+	}
+
+	// Find the delimiter that opens the clause, skipping over any nested
+	// clauses (e.g. "Song (Live (Remastered))").
+
+	i := len(distilled) - len(rightDelimiter)
+	depth := 1
+	for depth > 0 {
+		i--
+		if i < 0 {
+			// It's not balanced.
+			return distilled
+		}
+
+		if strings.HasPrefix(distilled[i:], rightDelimiter) == true {
+			depth++
+		} else if strings.HasPrefix(distilled[i:], leftDelimiter) == true {
+			depth--
+		}
+	}
+
+	if i == 0 {
+		return distilled
+	}
+
+	sLog.Debugf(nil, "Stripping expressions: [%s]", distilled)
+
+	i--
+
+	for i > 0 && string(distilled[i]) == " " {
+		i--
+	}
+
+	distilled = strings.TrimRight(distilled[:i+1], " ")
+	return distilled
+}
+
+func (sa *SpotifyAdapter) normalizeTitle(arg string) (distilled string) {
+	distilled = arg
+
+	// TODO(dustin): Flatten contractions. Yes, we've seen this being different because providers.
+
+	if sa.stripTrackNumbers == true {
+		distilled = stripTrackNumber(distilled)
+	}
+
+	// This has to happen before the brackets are removed.
+	distilled = removeFeaturedArtists(distilled)
+
+	if sa.foldDiacritics == true {
+		distilled = foldDiacritics(distilled)
+	}
+
+	distilled = invalidTrackCharsRx.ReplaceAllString(distilled, " ")
+	distilled = strings.Trim(spaceCharsRx.ReplaceAllString(distilled, " "), " ")
+	distilled = strings.ToLower(distilled)
+
+	return distilled
+}
+
+// isEditionClause returns whether the given parenthetical/bracketed clause
+// describes an edition or version (e.g. "(Remastered)") rather than being a
+// meaningful part of the title (e.g. "(Skit)"). A clause qualifies if any of
+// its words is one of the edition stopwords or one of their inflections.
+func (sa *SpotifyAdapter) isEditionClause(clause string) bool {
+	words := strings.FieldsFunc(strings.ToLower(clause), func(r rune) bool {
+		return unicode.IsLetter(r) == false && unicode.IsDigit(r) == false
+	})
+
+	for _, word := range words {
+		for _, stopword := range sa.editionStopwords {
+			if word == stopword {
+				return true
+			}
+
+			for _, inflection := range editionStopwordInflections[stopword] {
+				if word == inflection {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// removeEditionSuffixClause removes a parenthetical/bracketed clause from the
+// right side of the given string but only if it describes an edition.
+func (sa *SpotifyAdapter) removeEditionSuffixClause(arg, leftDelimiter, rightDelimiter string) (distilled string) {
+	trimmed := strings.TrimSpace(arg)
+
+	distilled = sa.removeSuffixClause(trimmed, leftDelimiter, rightDelimiter)
+	if distilled == trimmed {
+		return trimmed
+	}
+
+	clause := trimmed[len(distilled):]
+	if sa.isEditionClause(clause) == false {
+		return trimmed
+	}
+
+	return distilled
+}
+
+func (sa *SpotifyAdapter) simplifyTitle(arg string) (distilled string) {
+	distilled = removeFeaturedArtists(arg)
+
+	// Repeatedly strip parenthetical/bracketed edition phrases from the
+	// right-side of the title until they're all gone. We've actually seen some
+	// albums be suffixed with both "(Remastered)" and "(album)".
+	for {
+		distilledThis := sa.removeEditionSuffixClause(distilled, "(", ")")
+		distilledThis = sa.removeEditionSuffixClause(distilledThis, "[", "]")
+
+		if distilledThis == distilled {
+			return distilled
+		}
+
+		distilled = distilledThis
+	}
+}
+
+func (sa *SpotifyAdapter) isEqual(typeName, arg1, arg2 string, doLiberalSearch bool) (isEqual bool, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	// Preprocess the strings.
+
+	arg1 = strings.TrimSpace(arg1)
+	arg1 = strings.ToLower(arg1)
+
+	arg2 = strings.TrimSpace(arg2)
+	arg2 = strings.ToLower(arg2)
+
+	if doLiberalSearch {
+		// Remove subexpressions that may indicate that this album is a
+		// variation or alternate production rather than the original.
+
+		distilledArg1 := sa.simplifyTitle(arg1)
+		distilledArg2 := sa.simplifyTitle(arg2)
+
+		sLog.Infof(nil, "SIMPLIFY [%s]->[%s] ?= [%s]->[%s]", arg1, distilledArg1, arg2, distilledArg2)
+
+		if distilledArg1 == distilledArg2 {
+			return true, nil
+		}
+
+		if typeName == "album" && sa.foldVolumes == true {
+			foldedArg1 := foldVolumeNumbers(sa.normalizeTitle(distilledArg1))
+			foldedArg2 := foldVolumeNumbers(sa.normalizeTitle(distilledArg2))
+
+			if foldedArg1 == foldedArg2 {
+				sLog.Debugf(nil, "Album names match once the volumes are folded: [%s] [%s] => [%s]", arg1, arg2, foldedArg1)
+				return true, nil
+			}
+		}
+	} else {
+		// Do a direct string-comparison.
+
+		if arg1 == arg2 {
+			return true, nil
+		}
+
+		// Remove symbols and extra spacing (some systems might use parantheses
+		// and others might use square brackets; they will be equal after
+		// this).
+
+		arg1 = sa.normalizeTitle(arg1)
+		arg2 = sa.normalizeTitle(arg2)
+
+		if arg1 == arg2 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// getSpotifyAlbumId returns a matching Spotify album ID. `doLiberalSearch` can
+// be used to find the first match after modifying the list of fetched albums
+// to exclude paranthetical expressions at the end of the album names (e.g.
+// " (Remastered)") which are sometimes returned instead of the original album
+// name that we'd expect to find. In this case, maybe some newer remastered
+// album has taken place of the original album in Spotify and the origin album
+// in its original quality and with its original name is no longer available.
+// If more than one album matches, the first is returned unless we prefer the
+// earliest.
+func (sa *SpotifyAdapter) getSpotifyAlbumId(artistId spotify.ID, name string, marketName string, doLiberalSearch, doPrintCandidates bool) (id spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ids, err := sa.getSpotifyAlbumIds(artistId, name, marketName, doLiberalSearch, doPrintCandidates)
+	log.PanicIf(err)
+
+	if len(ids) == 1 || sa.preferEarliestAlbum == false {
+		return ids[0], nil
+	}
+
+	id, err = sa.getEarliestAlbumId(ids)
+	log.PanicIf(err)
+
+	sLog.Debugf(sa.ctx, "Chose earliest of (%d) matching albums for [%s] under artist-ID [%s]: [%s]", len(ids), name, artistId, id)
+
+	return id, nil
+}
+
+// getSpotifyAlbumIds returns every Spotify album under the artist that
+// matches the name (see getSpotifyAlbumId), in the order that Spotify lists
+// them.
+func (sa *SpotifyAdapter) getSpotifyAlbumIds(artistId spotify.ID, name string, marketName string, doLiberalSearch, doPrintCandidates bool) (ids []spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	albumTypes := sa.albumTypes
+	if albumTypes == nil {
+		albumTypes = []spotify.AlbumType{spotify.AlbumTypeAlbum}
+	}
+
+	// The types are tried in order of preference (rather than all at once) so
+	// that a name that exists as more than one type always resolves the same
+	// way.
+
+	for _, albumType := range albumTypes {
+		ids, err = sa.getSpotifyAlbumIdsOfType(artistId, name, marketName, albumType, doLiberalSearch, doPrintCandidates)
+		if err == nil {
+			return ids, nil
+		} else if log.Is(err, ErrSpotifyAlbumNotFound) == false {
+			log.Panic(err)
+		}
+	}
+
+	log.Panic(ErrSpotifyAlbumNotFound)
+	return nil, nil
+}
+
+// getSpotifyAlbumIdsOfType is getSpotifyAlbumIds for a specific type of album
+// (e.g. singles).
+func (sa *SpotifyAdapter) getSpotifyAlbumIdsOfType(artistId spotify.ID, name string, marketName string, albumType spotify.AlbumType, doLiberalSearch, doPrintCandidates bool) (ids []spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	albumAllowCache := allowCache
+	if doLiberalSearch {
+		albumAllowCache = false
+	}
+
+	cak := albumKey{
+		artistId:   artistId,
+		albumName:  name,
+		marketName: marketName,
+		albumType:  albumType,
+	}
+
+	if albumAllowCache {
+		ids, found := sa.cache.getAlbums(cak)
+		if found == true && len(ids) > 0 {
+			if albumType == spotify.AlbumTypeAlbum {
+				for _, id := range ids {
+					sa.recordAlbumFound(artistId, name, id)
+				}
+			}
+
+			return ids, nil
+		} else if found == true && sa.annotateNearest == false {
+			// We already know that it can't be found (but we'll look again
+			// if we need to know what the closest album was).
+			log.Panic(ErrSpotifyAlbumNotFound)
+		}
+	}
 
 	sLog.Debugf(nil, "Searching for album [%s] under artist with ID [%s].", name, artistId)
 
@@ -345,10 +1128,18 @@ func (sa *SpotifyAdapter) getSpotifyAlbumId(artistId spotify.ID, name string, ma
 	}
 
 	distilledAvailable := make([]string, 0)
+	availableNames := make([]string, 0)
+	candidates := make([]spotify.ID, 0)
+
+	// Read every page so that we see every album that matches (e.g. both the
+	// original and the deluxe edition).
 
 	for {
-		ata := spotify.AlbumTypeAlbum
-		sp, err := sa.spotifyAuth.Client.GetArtistAlbumsOpt(artistId, o, &ata)
+		ata := albumType
+		sp, err := withRetryValue(sa.retryPolicy, "reading artist albums", func() (*spotify.SimpleAlbumPage, error) {
+			return sa.client.GetArtistAlbumsOpt(artistId, o, &ata)
+		})
+
 		log.PanicIf(err)
 
 		len_ := len(sp.Albums)
@@ -361,6 +1152,7 @@ func (sa *SpotifyAdapter) getSpotifyAlbumId(artistId spotify.ID, name string, ma
 
 			albumDescription := fmt.Sprintf("%s (%s)", a.Name, a.AlbumType)
 			distilledAvailable = append(distilledAvailable, albumDescription)
+			availableNames = append(availableNames, a.Name)
 
 			matched, err := sa.isEqual("album", searchableName, name, doLiberalSearch)
 			log.PanicIf(err)
@@ -368,148 +1160,673 @@ func (sa *SpotifyAdapter) getSpotifyAlbumId(artistId spotify.ID, name string, ma
 			if matched == true {
 				sLog.Debugf(sa.ctx, "Found ID for album under artist-ID [%s]: [%s] found as [%s]", artistId, name, searchableName)
 
-				if albumAllowCache {
-					cachedAlbums[cak] = a.ID
-				}
+				candidates = append(candidates, a.ID)
+			}
+		}
+
+		offset += len_
+	}
+
+	if len(candidates) > 0 {
+		if albumAllowCache {
+			sa.cache.setAlbums(cak, candidates)
+		}
+
+		if albumType == spotify.AlbumTypeAlbum {
+			for _, id := range candidates {
+				sa.recordAlbumFound(artistId, name, id)
+			}
+		}
+
+		return candidates, nil
+	}
+
+	if albumType == spotify.AlbumTypeAlbum {
+		sa.recordAlbumCandidates(artistId, name, availableNames)
+	}
+
+	sLog.Debugf(sa.ctx, "Album [%s] under artist-ID [%s] not found (DO-LIBERAL-SEARCH=[%v]).", name, artistId, doLiberalSearch)
+
+	if albumAllowCache {
+		sa.cache.setAlbums(cak, nil)
+	}
+
+	if doPrintCandidates {
+		sLog.Debugf(sa.ctx, "(%d) other albums were found under artist-ID [%s].", len(distilledAvailable), artistId)
+		for i, thisName := range distilledAvailable {
+			sLog.Debugf(sa.ctx, "Available album under artist-ID [%s]: (%d) [%s]", artistId, i, thisName)
+		}
+	}
+
+	log.Panic(ErrSpotifyAlbumNotFound)
+	return nil, nil
+}
+
+// parseReleaseDate parses a Spotify release-date, which may be just a year or
+// a year and month rather than a full date.
+func parseReleaseDate(releaseDate string) (t time.Time, ok bool) {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, releaseDate); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// getEarliestAlbumId returns the ID of the album that was released first.
+// Albums with unknown release dates are only chosen if no dates are known.
+func (sa *SpotifyAdapter) getEarliestAlbumId(albumIds []spotify.ID) (id spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	id = albumIds[0]
+	var earliest time.Time
+
+	// The album lookup only takes so many IDs at a time.
+	for j := 0; j < len(albumIds); j += spotifyAlbumLookupBatchSize {
+		k := j + spotifyAlbumLookupBatchSize
+		if k > len(albumIds) {
+			k = len(albumIds)
+		}
+
+		batchIds := albumIds[j:k]
+
+		albums, err := withRetryValue(sa.retryPolicy, "reading albums", func() ([]*spotify.FullAlbum, error) {
+			return sa.client.GetAlbums(batchIds...)
+		})
+
+		log.PanicIf(err)
+
+		for _, fa := range albums {
+			if fa == nil {
+				continue
+			}
+
+			t, ok := parseReleaseDate(fa.ReleaseDate)
+			if ok == false {
+				sLog.Debugf(sa.ctx, "Could not parse release-date for album [%s]: [%s]", fa.ID, fa.ReleaseDate)
+				continue
+			}
+
+			if earliest.IsZero() == true || t.Before(earliest) == true {
+				earliest = t
+				id = fa.ID
+			}
+		}
+	}
+
+	return id, nil
+}
+
+// getSpotifyAlbumTracks returns the tracks on the given album, keyed by
+// normalized name. All pages are read.
+func (sa *SpotifyAdapter) getSpotifyAlbumTracks(albumId spotify.ID) (tracks map[string]spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	catk := albumTracksKey{
+		albumId: albumId,
+	}
+
+	// The listing is cached as Spotify has it rather than normalized so that
+	// it's still valid when loaded by a run with different options.
+	if allowCache {
+		if listing, found := sa.cache.getAlbumTracks(catk); found == true {
+			return sa.normalizeAlbumTracks(listing), nil
+		}
+	}
+
+	i := 0
+	listing := make([]cachedAlbumTrack, 0)
+	for {
+		stp, err := withRetryValue(sa.retryPolicy, "reading album tracks", func() (*spotify.SimpleTrackPage, error) {
+			return sa.client.GetAlbumTracksOpt(albumId, SpotifyReadBatchSize, i)
+		})
+
+		log.PanicIf(err)
+
+		if len(stp.Tracks) == 0 {
+			break
+		}
+
+		for _, track := range stp.Tracks {
+			i++
+
+			// Don't let a track that isn't available match under an empty
+			// ID.
+			if track.ID == "" {
+				continue
+			}
+
+			cat := cachedAlbumTrack{
+				Name:             track.Name,
+				Id:               track.ID,
+				AvailableMarkets: track.AvailableMarkets,
+				DurationMs:       track.Duration,
+			}
+
+			listing = append(listing, cat)
+		}
+	}
+
+	// This also records the markets and durations of the tracks. Those are
+	// still needed when the listing itself isn't cached.
+	if allowCache {
+		sa.cache.setAlbumTracks(catk, listing)
+	} else {
+		sa.cache.setTracks(listing)
+	}
+
+	tracks = sa.normalizeAlbumTracks(listing)
+
+	return tracks, nil
+}
+
+// normalizeAlbumTracks returns the tracks from the listing keyed by normalized
+// name.
+func (sa *SpotifyAdapter) normalizeAlbumTracks(listing []cachedAlbumTrack) (tracks map[string]spotify.ID) {
+	tracks = make(map[string]spotify.ID, len(listing))
+
+	for _, cat := range listing {
+		spotifyTrackName := sa.normalizeTitle(cat.Name)
+		tracks[spotifyTrackName] = cat.Id
+	}
+
+	return tracks
+}
+
+// IsTrackPlayable returns whether the given track can be played in the given
+// market. `known` is false if we haven't seen the track in an album listing.
+func (sa *SpotifyAdapter) IsTrackPlayable(id spotify.ID, marketName string) (playable bool, known bool) {
+	availableMarkets, found := sa.cache.getTrackMarkets(id)
+	if found == false {
+		return false, false
+	}
+
+	for _, availableMarket := range availableMarkets {
+		if availableMarket == marketName {
+			return true, true
+		}
+	}
+
+	return false, true
+}
+
+// GetTrackDuration returns the length of the given track. `known` is false if
+// we haven't seen the track in an album listing.
+func (sa *SpotifyAdapter) GetTrackDuration(id spotify.ID) (duration time.Duration, known bool) {
+	return sa.cache.getTrackDuration(id)
+}
+
+// removeRemasterSuffix removes a remaster note from the end of an
+// already-normalized title.
+func removeRemasterSuffix(normalized string) string {
+	return remasterSuffixRx.ReplaceAllString(normalized, "")
+}
+
+// findRemasteredTrack finds the track whose (normalized) name is the same as
+// the given one once any remaster note is removed from either. Spotify often
+// only has the remaster of a track (e.g. "Song - Remastered 2009") where we
+// have the original (or the other way around). If more than one matches, the
+// first by name is used so that the choice is consistent.
+func findRemasteredTrack(name string, tracks map[string]spotify.ID) (id spotify.ID, found bool) {
+	target := removeRemasterSuffix(name)
+	if target == "" {
+		return "", false
+	}
+
+	bestName := ""
+	for candidateName, candidateId := range tracks {
+		if removeRemasterSuffix(candidateName) != target {
+			continue
+		}
+
+		if found == false || candidateName < bestName {
+			bestName = candidateName
+			id = candidateId
+			found = true
+		}
+	}
+
+	return id, found
+}
+
+// findClosestTrack finds the track whose (normalized) name is the fewest edits
+// away from the given one, as long as that's no more than `maxDistance`. If
+// more than one is equally close, the first by name is used so that the
+// choice is consistent.
+func findClosestTrack(name string, tracks map[string]spotify.ID, maxDistance int) (id spotify.ID, closestName string, distance int, found bool) {
+	if maxDistance <= 0 {
+		return "", "", 0, false
+	}
+
+	for candidateName, candidateId := range tracks {
+		candidateDistance := levenshteinDistance(name, candidateName)
+		if candidateDistance > maxDistance {
+			continue
+		}
+
+		if found == false || candidateDistance < distance || (candidateDistance == distance && candidateName < closestName) {
+			id = candidateId
+			closestName = candidateName
+			distance = candidateDistance
+			found = true
+		}
+	}
+
+	return id, closestName, distance, found
+}
+
+// getSpotifyTrackIds Find Spotify IDs for the tracks in the given album having
+// the given names (after normalizing the names).
+func (sa *SpotifyAdapter) getSpotifyTrackIds(albumId spotify.ID, names []string, marketName string, doPrintCandidates bool) (ids map[spotify.ID]string, missing []string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	tracks, err := sa.getSpotifyAlbumTracks(albumId)
+	log.PanicIf(err)
+
+	ids = make(map[spotify.ID]string)
+	missing = make([]string, 0)
+
+	// The names are returned as they were given so that the caller can tell
+	// which of theirs were found.
+	for _, originalName := range names {
+		name := sa.normalizeTitle(originalName)
+
+		if id, found := tracks[name]; found == true {
+			ids[id] = originalName
+			sLog.Debugf(sa.ctx, "Found: [%s] [%s] => [%s]", albumId, name, id)
+		} else if id, found := findRemasteredTrack(name, tracks); found == true {
+			ids[id] = originalName
+			sLog.Debugf(sa.ctx, "Found (ignoring the remaster): [%s] [%s] => [%s]", albumId, name, id)
+		} else if id, closestName, distance, found := findClosestTrack(name, tracks, sa.trackMatchDistance); found == true {
+			ids[id] = originalName
+			sLog.Infof(sa.ctx, "FUZZY: [%s] [%s] => [%s] [%s] DISTANCE=(%d)", albumId, name, closestName, id, distance)
+		} else {
+			missing = append(missing, originalName)
+			sLog.Debugf(sa.ctx, "Track [%s] under album-ID [%s] not found.", name, albumId)
+
+			sa.recordTrackCandidates(albumId, name, tracks)
+		}
+	}
+
+	if len(missing) > 0 && doPrintCandidates {
+		sLog.Debugf(sa.ctx, "(%d) tracks are available in album-ID [%s].", len(tracks), albumId)
+
+		i := 0
+		for thisName, _ := range tracks {
+			sLog.Debugf(sa.ctx, "Available track under album-ID [%s]: (%d) [%s]", albumId, i, thisName)
+
+			i++
+		}
+	}
+
+	return ids, missing, nil
+}
+
+// getSpotifyTrackId finds the Spotify ID for the track in the given album
+// having the given name (after normalizing the name).
+func (sa *SpotifyAdapter) getSpotifyTrackId(albumId spotify.ID, name string, marketName string, doPrintCandidates bool) (id spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	name = sa.normalizeTitle(name)
+
+	tracks, err := sa.getSpotifyAlbumTracks(albumId)
+	log.PanicIf(err)
+
+	if id, found := tracks[name]; found == true {
+		return id, nil
+	} else if id, found := findRemasteredTrack(name, tracks); found == true {
+		sLog.Debugf(sa.ctx, "Found (ignoring the remaster): [%s] [%s] => [%s]", albumId, name, id)
+		return id, nil
+	} else if id, closestName, distance, found := findClosestTrack(name, tracks, sa.trackMatchDistance); found == true {
+		sLog.Infof(sa.ctx, "FUZZY: [%s] [%s] => [%s] [%s] DISTANCE=(%d)", albumId, name, closestName, id, distance)
+		return id, nil
+	}
+
+	sLog.Debugf(sa.ctx, "Track [%s] under album-ID [%s] not found.", name, albumId)
+
+	sa.recordTrackCandidates(albumId, name, tracks)
+
+	if doPrintCandidates {
+		sLog.Debugf(sa.ctx, "(%d) tracks are available in album-ID [%s].", len(tracks), albumId)
+
+		i := 0
+		for thisName, _ := range tracks {
+			sLog.Debugf(sa.ctx, "Available track under album-ID [%s]: (%d) [%s]", albumId, i, thisName)
+
+			i++
+		}
+	}
+
+	log.Panic(ErrSpotifyTrackNotFound)
+	return spotify.ID(""), nil
+}
+
+// searchSpotifyAlbumGlobally searches all of Spotify for the album by name
+// (rather than searching under the artist) and returns the first one having
+// an artist that loosely matches the given artist. This is used when we
+// couldn't find the artist, which usually means that it's spelled differently.
+func (sa *SpotifyAdapter) searchSpotifyAlbumGlobally(artistName, albumName, marketName string) (id spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sLog.Debugf(sa.ctx, "Searching for album [%s] globally for artist [%s].", albumName, artistName)
+
+	o := &spotify.Options{}
+	if marketName != "" {
+		o.Country = &marketName
+	}
+
+	sr, err := withRetryValue(sa.retryPolicy, "searching for album", func() (*spotify.SearchResult, error) {
+		return sa.client.SearchOpt(albumName, spotify.SearchTypeAlbum, o)
+	})
+
+	log.PanicIf(err)
+
+	if sr.Albums == nil {
+		log.Panic(ErrSpotifyAlbumNotFound)
+	}
+
+	checked := make(map[spotify.ID]bool)
+
+	// Prefer a strict match on the album name before trying a liberal one.
+	for _, doLiberalSearch := range []bool{false, true} {
+		for _, a := range sr.Albums.Albums {
+			if _, found := checked[a.ID]; found == true {
+				continue
+			}
+
+			matched, err := sa.isEqual("album", a.Name, albumName, doLiberalSearch)
+			log.PanicIf(err)
+
+			if matched == false {
+				continue
+			}
+
+			checked[a.ID] = true
+
+			// The album search results don't tell us the artists, so we need
+			// the full album.
+			fa, err := withRetryValue(sa.retryPolicy, "reading album", func() (*spotify.FullAlbum, error) {
+				return sa.client.GetAlbum(a.ID)
+			})
+
+			log.PanicIf(err)
+
+			for _, artist := range fa.Artists {
+				if sa.isArtistMatch(artist.Name, artistName) == true {
+					sLog.Infof(sa.ctx, "Found album [%s] globally under artist [%s] for artist [%s]: [%s]", a.Name, artist.Name, artistName, a.ID)
+					return a.ID, nil
+				}
+			}
+		}
+	}
+
+	log.Panic(ErrSpotifyAlbumNotFound)
+	return spotify.ID(""), nil
+}
+
+// GetSpotifyTrackIdWithNames finds the Spotify ID for a single track. This is
+// for when tracks can't be grouped by album ahead of time. The album is looked
+// for under each matching artist using the strict and liberal searches (in
+// the order given by the match strategies).
+func (sa *SpotifyAdapter) GetSpotifyTrackIdWithNames(artistName string, albumName string, trackName string, marketName string) (id spotify.ID, matchMethod string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	artistIds, err := sa.searchSpotifyArtists(artistName)
+	log.PanicIf(err)
+
+	albumFound := false
+	for _, matchMethod := range sa.getMatchStrategies() {
+		if matchMethod != MatchMethodStrictAlbum && matchMethod != MatchMethodLiberalAlbum {
+			continue
+		}
+
+		doLiberalSearch := matchMethod == MatchMethodLiberalAlbum
 
-				return a.ID, nil
+		for _, artistId := range artistIds {
+			albumId, err := sa.getSpotifyAlbumId(artistId, albumName, marketName, doLiberalSearch, doLiberalSearch)
+			if log.Is(err, ErrSpotifyAlbumNotFound) == true {
+				continue
+			} else if err != nil {
+				log.Panic(err)
 			}
-		}
 
-		offset := *o.Offset + len_
-		o.Offset = &offset
-	}
+			albumFound = true
 
-	sLog.Debugf(sa.ctx, "Album [%s] under artist-ID [%s] not found (DO-LIBERAL-SEARCH=[%v]).", name, artistId, doLiberalSearch)
+			id, err := sa.getSpotifyTrackId(albumId, trackName, marketName, doLiberalSearch)
+			if log.Is(err, ErrSpotifyTrackNotFound) == true {
+				continue
+			} else if err != nil {
+				log.Panic(err)
+			}
 
-	if doPrintCandidates {
-		sLog.Debugf(sa.ctx, "(%d) other albums were found under artist-ID [%s].", len(distilledAvailable), artistId)
-		for i, thisName := range distilledAvailable {
-			sLog.Debugf(sa.ctx, "Available album under artist-ID [%s]: (%d) [%s]", artistId, i, thisName)
+			return id, matchMethod, nil
 		}
 	}
 
-	log.Panic(ErrSpotifyAlbumNotFound)
-	return spotify.ID(""), nil
+	if albumFound == false {
+		log.Panic(ErrSpotifyAlbumNotFound)
+	}
+
+	log.Panic(ErrSpotifyTrackNotFound)
+	return spotify.ID(""), "", nil
 }
 
-// getSpotifyTrackId Find Spotify IDs for the tracks in the given album having
-// the given names (after normalizing the names).
-func (sa *SpotifyAdapter) getSpotifyTrackIds(albumId spotify.ID, names []string, doPrintCandidates bool) (ids map[spotify.ID]string, missing []string, err error) {
+type albumHits struct {
+	albumId       spotify.ID
+	foundTracks   map[spotify.ID]string
+	missingTracks []string
+}
+
+// matchUnderArtists looks for the given tracks on every matching album under
+// each of the given artists (e.g. both the original and a deluxe edition) and
+// returns the hits for the album that is missing the fewest of them. If more
+// than one is missing the same number, the one that was released first wins.
+func (sa *SpotifyAdapter) matchUnderArtists(artistIds []spotify.ID, artistName string, albumName string, tracks []string, marketName string, doLiberalSearch bool) (ah albumHits, found bool, err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	found := false
-	var tracks map[string]spotify.ID
+	hits := make(map[spotify.ID]albumHits)
+	bestMissingTracks := 0
 
-	if allowCache {
-		tracks, found = cachedTracks[albumId]
-	}
+	for _, artistId := range artistIds {
+		albumIds, err := sa.getSpotifyAlbumIds(artistId, albumName, marketName, doLiberalSearch, doLiberalSearch)
+		if err != nil {
+			if log.Is(err, ErrSpotifyAlbumNotFound) == true {
+				continue
+			} else {
+				log.Panic(err)
+			}
+		}
 
-	if found == false {
-		i := 0
-		tracks = make(map[string]spotify.ID)
-		for {
-			stp, err := sa.spotifyAuth.Client.GetAlbumTracksOpt(albumId, SpotifyReadBatchSize, i)
+		for _, albumId := range albumIds {
+			if _, found := hits[albumId]; found == true {
+				continue
+			}
+
+			foundTracks, missingTracks, err := sa.getSpotifyTrackIds(albumId, tracks, marketName, true)
 			log.PanicIf(err)
 
-			if len(stp.Tracks) == 0 {
-				break
+			if len(foundTracks) == 0 {
+				continue
 			}
 
-			for _, track := range stp.Tracks {
-				spotifyTrackName := sa.normalizeTitle(track.Name)
-				tracks[spotifyTrackName] = track.ID
+			len_ := len(missingTracks)
 
-				i++
+			sLog.Infof(nil, "HITS: [%s] ([%s]) [%s] ([%s]) MISSING=(%d)", artistName, artistId, albumName, albumId, len_)
+
+			if len(hits) == 0 || len_ < bestMissingTracks {
+				bestMissingTracks = len_
 			}
-		}
 
-		if allowCache {
-			cachedTracks[albumId] = tracks
+			hits[albumId] = albumHits{
+				albumId:       albumId,
+				foundTracks:   foundTracks,
+				missingTracks: missingTracks,
+			}
 		}
 	}
 
-	ids = make(map[spotify.ID]string)
-	missing = make([]string, 0)
-
-	for _, name := range names {
-		name = sa.normalizeTitle(name)
+	if len(hits) == 0 {
+		return albumHits{}, false, nil
+	}
 
-		if id, found := tracks[name]; found == true {
-			ids[id] = name
-			sLog.Debugf(sa.ctx, "Found: [%s] [%s] => [%s]", albumId, name, id)
-		} else {
-			missing = append(missing, name)
-			sLog.Debugf(sa.ctx, "Track [%s] under album-ID [%s] not found.", name, albumId)
+	bestAlbumIds := make([]spotify.ID, 0)
+	for albumId, ah := range hits {
+		if len(ah.missingTracks) == bestMissingTracks {
+			bestAlbumIds = append(bestAlbumIds, albumId)
 		}
 	}
 
-	if len(missing) > 0 && doPrintCandidates {
-		sLog.Debugf(sa.ctx, "(%d) tracks are available in album-ID [%s].", len(tracks), albumId)
+	bestAlbumId := bestAlbumIds[0]
 
-		i := 0
-		for thisName, _ := range tracks {
-			sLog.Debugf(sa.ctx, "Available track under album-ID [%s]: (%d) [%s]", albumId, i, thisName)
+	if len(bestAlbumIds) > 1 {
+		// Sort them first so that albums without release-dates resolve the
+		// same way every time.
+		sort.Slice(bestAlbumIds, func(j, k int) bool {
+			return bestAlbumIds[j] < bestAlbumIds[k]
+		})
 
-			i++
-		}
+		bestAlbumId, err = sa.getEarliestAlbumId(bestAlbumIds)
+		log.PanicIf(err)
 	}
 
-	return ids, missing, nil
+	sLog.Infof(nil, "ELECTED ALBUM: [%s] MISSING=(%d) CANDIDATES=(%d)", bestAlbumId, bestMissingTracks, len(hits))
+
+	return hits[bestAlbumId], true, nil
 }
 
-// getSpotifyTrackId Find and add the track to the Spotify playlist.
-func (sa *SpotifyAdapter) getSpotifyTrackId(albumId spotify.ID, name string, doPrintCandidates bool) (id spotify.ID, err error) {
+// matchSingles looks for each of the given tracks on a single, under any of
+// the given artists, that has the same name as the track. Lead singles often
+// exist separately from the album and sometimes instead of it.
+func (sa *SpotifyAdapter) matchSingles(artistIds []spotify.ID, tracks []string, marketName string) (foundTracks map[spotify.ID]string, missingTracks []string, err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	name = sa.normalizeTitle(name)
+	foundTracks = make(map[spotify.ID]string)
+	missingTracks = make([]string, 0)
 
-	found := false
-	var tracks map[string]spotify.ID
+	for _, trackName := range tracks {
+		found := false
 
-	if allowCache {
-		tracks, found = cachedTracks[albumId]
-	}
+		for _, doLiberalSearch := range []bool{false, true} {
+			for _, artistId := range artistIds {
+				singleIds, err := sa.getSpotifyAlbumIdsOfType(artistId, trackName, marketName, spotify.AlbumTypeSingle, doLiberalSearch, false)
+				if log.Is(err, ErrSpotifyAlbumNotFound) == true {
+					continue
+				} else if err != nil {
+					log.Panic(err)
+				}
 
-	if found == false {
-		stp, err := sa.spotifyAuth.Client.GetAlbumTracks(albumId)
-		log.PanicIf(err)
+				for _, singleId := range singleIds {
+					singleFoundTracks, _, err := sa.getSpotifyTrackIds(singleId, []string{trackName}, marketName, false)
+					log.PanicIf(err)
 
-		tracks = make(map[string]spotify.ID)
-		for _, track := range stp.Tracks {
-			spotifyTrackName := sa.normalizeTitle(track.Name)
-			tracks[spotifyTrackName] = track.ID
+					for id, name := range singleFoundTracks {
+						sLog.Debugf(sa.ctx, "Found track [%s] on single [%s] under artist-ID [%s]: [%s]", trackName, singleId, artistId, id)
+
+						foundTracks[id] = name
+						found = true
+					}
+
+					if found == true {
+						break
+					}
+				}
+
+				if found == true {
+					break
+				}
+			}
+
+			if found == true {
+				break
+			}
 		}
 
-		if allowCache {
-			cachedTracks[albumId] = tracks
+		if found == false {
+			missingTracks = append(missingTracks, trackName)
 		}
 	}
 
-	for albumTrackName, id := range tracks {
-		if albumTrackName == name {
-			return id, nil
+	return foundTracks, missingTracks, nil
+}
+
+// searchSpotifyTrack searches for the track by name and returns the first
+// result that's by the given artist. This is for favorites that don't have an
+// album to look under.
+func (sa *SpotifyAdapter) searchSpotifyTrack(artistName, trackName, marketName string) (id spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
 		}
+	}()
+
+	sLog.Debugf(sa.ctx, "Searching for track [%s] for artist [%s].", trackName, artistName)
+
+	o := &spotify.Options{}
+	if marketName != "" {
+		o.Country = &marketName
 	}
 
-	sLog.Debugf(sa.ctx, "Track [%s] under album-ID [%s] not found.", name, albumId)
+	query := fmt.Sprintf("track:\"%s\" artist:\"%s\"", strings.Replace(trackName, "\"", "", -1), strings.Replace(artistName, "\"", "", -1))
 
-	if doPrintCandidates {
-		sLog.Debugf(sa.ctx, "(%d) tracks are available in album-ID [%s].", len(tracks), albumId)
+	sr, err := withRetryValue(sa.retryPolicy, "searching for track", func() (*spotify.SearchResult, error) {
+		return sa.client.SearchOpt(query, spotify.SearchTypeTrack, o)
+	})
 
-		i := 0
-		for thisName, _ := range tracks {
-			sLog.Debugf(sa.ctx, "Available track under album-ID [%s]: (%d) [%s]", albumId, i, thisName)
+	log.PanicIf(err)
 
-			i++
+	if sr.Tracks == nil {
+		log.Panic(ErrSpotifyTrackNotFound)
+	}
+
+	// Prefer a strict match on the track name before trying a liberal one.
+	for _, doLiberalSearch := range []bool{false, true} {
+		for _, t := range sr.Tracks.Tracks {
+			matched, err := sa.isEqual("track", t.Name, trackName, doLiberalSearch)
+			log.PanicIf(err)
+
+			if matched == false {
+				continue
+			}
+
+			for _, artist := range t.Artists {
+				if sa.isArtistMatch(artist.Name, artistName) == true {
+					sLog.Debugf(sa.ctx, "Found track [%s] on album [%s] for artist [%s]: [%s]", t.Name, t.Album.Name, artistName, t.ID)
+					return t.ID, nil
+				}
+			}
 		}
 	}
 
@@ -517,128 +1834,209 @@ func (sa *SpotifyAdapter) getSpotifyTrackId(albumId spotify.ID, name string, doP
 	return spotify.ID(""), nil
 }
 
-type albumHits struct {
-	albumId       spotify.ID
-	foundTracks   map[spotify.ID]string
-	missingTracks []string
-}
-
-func (sa *SpotifyAdapter) GetSpotifyTrackIdsWithNames(artistName string, albumName string, tracks []string, marketName string) (foundTracks map[spotify.ID]string, missingTracks []string, err error) {
+// matchTrackSearch looks for each of the given tracks by searching for it
+// directly.
+func (sa *SpotifyAdapter) matchTrackSearch(artistName string, tracks []string, marketName string) (foundTracks map[spotify.ID]string, missingTracks []string, err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	artistIds, err := sa.searchSpotifyArtists(artistName)
-	log.PanicIf(err)
+	foundTracks = make(map[spotify.ID]string)
+	missingTracks = make([]string, 0)
 
-	hits := make(map[spotify.ID]albumHits)
+	for _, trackName := range tracks {
+		id, err := sa.searchSpotifyTrack(artistName, trackName, marketName)
+		if log.Is(err, ErrSpotifyTrackNotFound) == true {
+			missingTracks = append(missingTracks, trackName)
+			continue
+		} else if err != nil {
+			log.Panic(err)
+		}
 
-	// Search for the albums name using a strict string search. Note that we
-	// search within all matching artistsfor album with an exact name (and then
-	// store any such album that has at least one of the tracks we're looking
-	// for) and then proceed to do a fuzzy search for matching albums. We store
-	// this into the same map. We just assume that one artist will nto have two
-	// albums that basically have the same name and thaat a later album has no
-	// chance to replace an earlier one.
+		foundTracks[id] = trackName
+	}
 
-	for _, artistId := range artistIds {
-		// Do a strict string search to find the album among the candidates.
-		albumId, err := sa.getSpotifyAlbumId(artistId, albumName, marketName, false, false)
-		if err != nil {
-			if log.Is(err, ErrSpotifyAlbumNotFound) == true {
-				continue
-			} else {
-				log.Panic(err)
-			}
+	return foundTracks, missingTracks, nil
+}
+
+// GetSpotifyTrackIdsWithNames finds the Spotify IDs for the given tracks on
+// the given album. The match strategies are tried in order, and each track is
+// only looked for until one of them finds it. `matchMethods` describes how
+// each track was found (one of the MatchMethod* constants), which indicates
+// how much the match can be trusted.
+func (sa *SpotifyAdapter) GetSpotifyTrackIdsWithNames(artistName string, albumName string, tracks []string, marketName string) (foundTracks map[spotify.ID]string, missingTracks []string, matchMethods map[spotify.ID]string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
 		}
+	}()
+
+	artistIds, err := sa.searchSpotifyArtists(artistName)
+	artistFound := true
+	if log.Is(err, ErrSpotifyArtistNotFound) == true {
+		artistFound = false
+	} else if err != nil {
+		log.Panic(err)
+	}
+
+	foundTracks = make(map[spotify.ID]string)
+	matchMethods = make(map[spotify.ID]string)
+	missingTracks = tracks
 
-		foundTracks, missingTracks, err = sa.getSpotifyTrackIds(albumId, tracks, true)
+	// Without an album name there's no album to look under, so the tracks can
+	// only be found by searching for them.
+	if strings.TrimSpace(albumName) == "" {
+		foundTracks, missingTracks, err = sa.matchTrackSearch(artistName, tracks, marketName)
 		log.PanicIf(err)
 
-		if len(foundTracks) == 0 {
-			continue
+		for id, _ := range foundTracks {
+			matchMethods[id] = MatchMethodTrackSearch
 		}
 
-		hits[artistId] = albumHits{
-			albumId:       albumId,
-			foundTracks:   foundTracks,
-			missingTracks: missingTracks,
+		if len(foundTracks) == 0 && artistFound == false {
+			log.Panic(ErrSpotifyArtistNotFound)
 		}
+
+		return foundTracks, missingTracks, matchMethods, nil
 	}
 
-	// We could find either the album or any of our tracks under this artist.
-	// Try with a more fuzzy album search.
+	for _, strategy := range sa.getMatchStrategies() {
+		if len(missingTracks) == 0 {
+			break
+		}
+
+		var ah albumHits
+		found := false
 
-	for _, artistId := range artistIds {
-		// Do a fuzzy string search to find the album among the candidates.
-		albumId, err := sa.getSpotifyAlbumId(artistId, albumName, marketName, true, true)
-		if err != nil {
+		switch strategy {
+		case MatchMethodStrictAlbum, MatchMethodLiberalAlbum:
+			if artistFound == false {
+				continue
+			}
+
+			doLiberalSearch := strategy == MatchMethodLiberalAlbum
+
+			ah, found, err = sa.matchUnderArtists(artistIds, artistName, albumName, missingTracks, marketName, doLiberalSearch)
+			log.PanicIf(err)
+		case MatchMethodSingle:
+			if artistFound == false {
+				continue
+			}
+
+			ah.foundTracks, ah.missingTracks, err = sa.matchSingles(artistIds, missingTracks, marketName)
+			log.PanicIf(err)
+
+			found = len(ah.foundTracks) > 0
+		case MatchMethodTrackSearch:
+			// This finds the tracks that Spotify has on a different album
+			// (e.g. another edition) than the one that we have them on.
+			if artistFound == false {
+				continue
+			}
+
+			ah.foundTracks, ah.missingTracks, err = sa.matchTrackSearch(artistName, missingTracks, marketName)
+			log.PanicIf(err)
+
+			found = len(ah.foundTracks) > 0
+		case MatchMethodAlbumSearch:
+			// We only search for the album directly if we couldn't find the
+			// artist.
+			if artistFound == true {
+				continue
+			}
+
+			albumId, err := sa.searchSpotifyAlbumGlobally(artistName, albumName, marketName)
 			if log.Is(err, ErrSpotifyAlbumNotFound) == true {
 				continue
-			} else {
+			} else if err != nil {
 				log.Panic(err)
 			}
-		}
 
-		foundTracks, missingTracks, err = sa.getSpotifyTrackIds(albumId, tracks, true)
-		log.PanicIf(err)
+			ah.albumId = albumId
+
+			ah.foundTracks, ah.missingTracks, err = sa.getSpotifyTrackIds(albumId, missingTracks, marketName, true)
+			log.PanicIf(err)
+
+			found = true
+		default:
+			log.Panicf("match strategy not handled: [%s]", strategy)
+		}
 
-		if len(foundTracks) == 0 {
+		if found == false {
 			continue
 		}
 
-		hits[artistId] = albumHits{
-			albumId:       albumId,
-			foundTracks:   foundTracks,
-			missingTracks: missingTracks,
+		for id, name := range ah.foundTracks {
+			foundTracks[id] = name
+			matchMethods[id] = strategy
 		}
+
+		missingTracks = ah.missingTracks
 	}
 
-	if len(hits) == 0 {
+	if len(foundTracks) == 0 {
+		if artistFound == false {
+			log.Panic(ErrSpotifyArtistNotFound)
+		}
+
 		// No matching albums were found in any of the matching artists.
 		log.Panic(ErrSpotifyAlbumNotFound)
-		return nil, nil, nil
 	}
 
-	bestArtistId := spotify.ID("")
-	bestMissingTracks := 0
-
-	hitsLen := len(hits)
-	for artistId, ah := range hits {
-		len_ := len(ah.missingTracks)
-
-		if hitsLen > 0 {
-			sLog.Infof(nil, "HITS: [%s] ([%s]) [%s] ([%s]) MISSING=(%d)", artistName, artistId, albumName, ah.albumId, len_)
-		}
+	return foundTracks, missingTracks, matchMethods, nil
+}
 
-		if bestArtistId != spotify.ID("") && len_ >= bestMissingTracks {
-			continue
+func (sa *SpotifyAdapter) ReadSpotifyPlaylist(playlistId spotify.ID, userId string, marketName string) (tracks []spotify.ID, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
 		}
+	}()
 
-		bestArtistId = artistId
-		bestMissingTracks = len_
-	}
+	pts, err := sa.readSpotifyPlaylistTracks(playlistId, userId, marketName)
+	log.PanicIf(err)
 
-	if hitsLen > 0 {
-		sLog.Infof(nil, "ELECTED ARTIST: [%s]", bestArtistId)
+	tracks = make([]spotify.ID, len(pts))
+	for j, pt := range pts {
+		tracks[j] = pt.Track.ID
 	}
 
-	ah := hits[bestArtistId]
-	return ah.foundTracks, ah.missingTracks, nil
+	return tracks, nil
 }
 
-func (sa *SpotifyAdapter) ReadSpotifyPlaylist(playlistId spotify.ID, userId string, marketName string) (tracks []spotify.ID, err error) {
+// ReadSpotifyPlaylistInfo reads the tracks in the given playlist along with
+// their names.
+func (sa *SpotifyAdapter) ReadSpotifyPlaylistInfo(playlistId spotify.ID, userId string, marketName string) (tracks map[spotify.ID]TrackInfo, err error) {
 	defer func() {
 		if state := recover(); state != nil {
 			err = log.Wrap(state.(error))
 		}
 	}()
 
-	sLog.Debugf(sa.ctx, "Reading Spotify playlist.")
+	pts, err := sa.readSpotifyPlaylistTracks(playlistId, userId, marketName)
+	log.PanicIf(err)
 
-	offset := 0
+	tracks = make(map[spotify.ID]TrackInfo, len(pts))
+	for _, pt := range pts {
+		artistName := ""
+		if len(pt.Track.Artists) > 0 {
+			artistName = pt.Track.Artists[0].Name
+		}
+
+		tracks[pt.Track.ID] = TrackInfo{
+			ArtistName: artistName,
+			AlbumName:  pt.Track.Album.Name,
+			TitleName:  pt.Track.Name,
+		}
+	}
+
+	return tracks, nil
+}
+
+// readSpotifyPlaylistPage reads the page of the playlist at the given offset.
+func (sa *SpotifyAdapter) readSpotifyPlaylistPage(playlistId spotify.ID, userId string, marketName string, offset int) (ptp *spotify.PlaylistTrackPage, err error) {
 	limit := SpotifyReadBatchSize
 
 	// Filter by market (otherwise we'll see a lot of duplicates, some of which
@@ -652,27 +2050,128 @@ func (sa *SpotifyAdapter) ReadSpotifyPlaylist(playlistId spotify.ID, userId stri
 		o.Country = &marketName
 	}
 
-	tracks = make([]spotify.ID, 0)
+	return withRetryValue(sa.retryPolicy, "reading playlist tracks", func() (*spotify.PlaylistTrackPage, error) {
+		return sa.client.GetPlaylistTracksOpt(userId, playlistId, o, "")
+	})
+}
+
+// readSpotifyPlaylistTracks reads all of the tracks in the playlist. The first
+// page tells us how many there are, so the rest of the pages are read
+// concurrently.
+func (sa *SpotifyAdapter) readSpotifyPlaylistTracks(playlistId spotify.ID, userId string, marketName string) (tracks []spotify.PlaylistTrack, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	sLog.Debugf(sa.ctx, "Reading Spotify playlist.")
+
+	ptp, err := sa.readSpotifyPlaylistPage(playlistId, userId, marketName, 0)
+	log.PanicIf(err)
+
+	tracks = make([]spotify.PlaylistTrack, 0, ptp.Total)
+	tracks = append(tracks, ptp.Tracks...)
+
+	if len(ptp.Tracks) == 0 {
+		return tracks, nil
+	}
+
+	// Read the rest of the pages concurrently. Each page is stored in its own
+	// slot so that the order is kept.
+
+	offsets := make([]int, 0)
+	for offset := len(ptp.Tracks); offset < ptp.Total; offset += SpotifyReadBatchSize {
+		offsets = append(offsets, offset)
+	}
+
+	pages := make([][]spotify.PlaylistTrack, len(offsets))
 
+	jobs := make(chan int)
+	wg := new(sync.WaitGroup)
+
+	var m sync.Mutex
+	var firstErr error
+
+	for w := 0; w < spotifyPlaylistReadConcurrency; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := range jobs {
+				ptp, err := sa.readSpotifyPlaylistPage(playlistId, userId, marketName, offsets[j])
+				if err != nil {
+					m.Lock()
+
+					if firstErr == nil {
+						firstErr = err
+					}
+
+					m.Unlock()
+
+					continue
+				}
+
+				pages[j] = ptp.Tracks
+			}
+		}()
+	}
+
+	for j, _ := range offsets {
+		jobs <- j
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	log.PanicIf(firstErr)
+
+	for _, page := range pages {
+		tracks = append(tracks, page...)
+	}
+
+	// The playlist might have grown while we were reading it, so keep going
+	// until we run out.
+
+	offset := len(ptp.Tracks) + len(offsets)*SpotifyReadBatchSize
 	for {
-		ptp, err := sa.spotifyAuth.Client.GetPlaylistTracksOpt(userId, playlistId, o, "")
+		ptp, err := sa.readSpotifyPlaylistPage(playlistId, userId, marketName, offset)
 		log.PanicIf(err)
 
 		if len(ptp.Tracks) == 0 {
 			break
 		}
 
-		for _, pt := range ptp.Tracks {
-			tracks = append(tracks, pt.Track.ID)
-		}
+		tracks = append(tracks, ptp.Tracks...)
+		offset += len(ptp.Tracks)
+	}
 
-		offset := *o.Offset + len(ptp.Tracks)
-		o.Offset = &offset
+	tracks, unresolvedCount := withoutUnresolvedTracks(tracks)
+	if unresolvedCount > 0 {
+		sLog.Infof(sa.ctx, "Ignoring (%d) playlist entries that are local files or are no longer available.", unresolvedCount)
 	}
 
 	return tracks, nil
 }
 
+// withoutUnresolvedTracks drops the playlist entries that don't have an ID
+// (local files and tracks that were removed from Spotify) so that they don't
+// end-up in the index as an empty ID.
+func withoutUnresolvedTracks(tracks []spotify.PlaylistTrack) (resolved []spotify.PlaylistTrack, unresolvedCount int) {
+	resolved = make([]spotify.PlaylistTrack, 0, len(tracks))
+	for _, pt := range tracks {
+		if pt.Track.ID == "" {
+			unresolvedCount++
+			continue
+		}
+
+		resolved = append(resolved, pt)
+	}
+
+	return resolved, unresolvedCount
+}
+
 func init() {
 	var err error
 
@@ -682,4 +2181,15 @@ func init() {
 	// TODO(dustin): Just search-for and replace occurrences of two or more, not just one or more.
 	spaceCharsRx, err = regexp.Compile("[ ]+")
 	log.PanicIf(err)
+
+	// A track number (optionally preceded by a disc number) followed by a
+	// separator, e.g. "01 - ", "1. ", or "2-03) ". A number without a
+	// separator is left alone since it's likely part of the title.
+	trackNumberPrefixRx, err = regexp.Compile(`^\s*(?:\d{1,2}[-.])?\d{1,3}\s*[-.):]\s+`)
+	log.PanicIf(err)
+
+	// A remaster note at the end of an already-normalized title, e.g. what's
+	// left of " - Remastered 2009" or " (2011 Digital Remaster)".
+	remasterSuffixRx, err = regexp.Compile(`\s+(?:\d{4}\s+)?(?:digital(?:ly)?\s+)?remaster(?:ed)?(?:\s+version)?(?:\s+\d{4})?$`)
+	log.PanicIf(err)
 }
@@ -1,11 +1,21 @@
 package gnsssync
 
 import (
+    "bufio"
     "fmt"
-
+    "io"
+    "os"
+    "strings"
+    "sync"
+    "time"
+
+    "crypto/rand"
+    "encoding/hex"
     "net/http"
+    "net/url"
 
     "golang.org/x/net/context"
+    "golang.org/x/oauth2"
 
     "github.com/pkg/browser"
     "github.com/zmb3/spotify"
@@ -15,17 +25,49 @@ import (
 
 // Config
 const (
-    staticStateString = "arbitrary-state-data"
+    // stateLength is how many random bytes are in the state that we send
+    // with the authorization request.
+    stateLength = 16
 )
 
 // Errors
 var (
     ErrImportComplete = fmt.Errorf("import complete")
+
+    ErrAuthCodeNotFound = fmt.Errorf("no authorization code")
+    ErrAuthStateMismatch = fmt.Errorf("authorization state does not match")
+    ErrAuthDenied = fmt.Errorf("authorization was denied")
+    ErrAuthFinished = fmt.Errorf("authorization has already finished")
+    ErrAuthTimeout = fmt.Errorf("timed out waiting for authorization")
 )
 
 // Misc
 var (
     saLog = log.NewLogger("gnss.spotify_authorizer")
+
+    // openBrowser opens the authorization URL. This is replaced by the tests.
+    openBrowser = browser.OpenURL
+
+    // exchangeAuthCode gets a token for an authorization code. This is
+    // replaced by the tests.
+    exchangeAuthCode = func(auth spotify.Authenticator, code string) (*oauth2.Token, error) {
+        return auth.Exchange(code)
+    }
+
+    // ReadOnlySpotifyScopes are the scopes needed to read the user's
+    // playlists without changing them.
+    ReadOnlySpotifyScopes = []string {
+        spotify.ScopeUserReadPrivate,
+        spotify.ScopePlaylistReadCollaborative,
+        spotify.ScopePlaylistReadPrivate,
+    }
+
+    // DefaultSpotifyScopes are the scopes that are requested unless others
+    // are given. These include modifying the playlists.
+    DefaultSpotifyScopes = append(append([]string {}, ReadOnlySpotifyScopes...),
+        spotify.ScopePlaylistModifyPrivate,
+        spotify.ScopePlaylistModifyPublic,
+    )
 )
 
 
@@ -39,6 +81,28 @@ type SpotifyAuthorizer struct {
     authC chan<- *SpotifyContext
 
     auth spotify.Authenticator
+
+    httpTransport http.RoundTripper
+
+    noBrowser bool
+
+    // state is sent with the authorization request and has to come back with
+    // the code, so that we only accept the response to our own request.
+    state string
+
+    // server receives the callback. It's shut down once we're authorized
+    // (or have given up). `done` is also set while a code is being exchanged
+    // so that only one code is ever exchanged at a time.
+    serverLock sync.Mutex
+    server *http.Server
+    done bool
+    authorized bool
+    timedOut bool
+    expired bool
+
+    authTimeout time.Duration
+
+    scopes []string
 }
 
 func NewSpotifyAuthorizer(ctx context.Context, apiClientId, apiSecretKey, redirectUrl, localBindUrl string, authC chan<- *SpotifyContext) *SpotifyAuthorizer {
@@ -52,55 +116,358 @@ func NewSpotifyAuthorizer(ctx context.Context, apiClientId, apiSecretKey, redire
     }
 }
 
+// SetHttpTransport sets the transport that the Spotify client will send its
+// requests through (e.g. to trace them). Must be called before authorizing.
+func (sa *SpotifyAuthorizer) SetHttpTransport(httpTransport http.RoundTripper) {
+    sa.httpTransport = httpTransport
+}
+
+// newClient returns a Spotify client for the given token, sending requests
+// through our transport if one was given. The underlying (authenticated) HTTP
+// client is also returned for the calls that the Spotify client doesn't
+// support. The token is refreshed when it expires or is rejected.
+func (sa *SpotifyAuthorizer) newClient(t *oauth2.Token) (spotify.Client, *http.Client, *refreshingTokenSource) {
+    // The authenticator doesn't let us provide the HTTP client or get at the
+    // one that it creates, so construct the same OAuth configuration that it
+    // uses.
+
+    oc := &oauth2.Config{
+        ClientID: sa.apiClientId,
+        ClientSecret: sa.apiSecretKey,
+        RedirectURL: sa.apiRedirectUrl,
+        Endpoint: oauth2.Endpoint{
+            AuthURL: spotify.AuthURL,
+            TokenURL: spotify.TokenURL,
+        },
+    }
+
+    ctx := sa.ctx
+    base := http.DefaultTransport
+
+    if sa.httpTransport != nil {
+        hc := &http.Client{
+            Transport: sa.httpTransport,
+        }
+
+        // The token refreshes also go through our transport.
+        ctx = context.WithValue(ctx, oauth2.HTTPClient, hc)
+        base = sa.httpTransport
+    }
+
+    rts := newRefreshingTokenSource(ctx, oc, t)
+
+    authenticatedHc := &http.Client{
+        Transport: &tokenRefreshTransport{
+            rts: rts,
+            base: base,
+        },
+    }
+
+    return spotify.NewClient(authenticatedHc), authenticatedHc, rts
+}
+
+// SetScopes sets the scopes that we ask the user to authorize. These default
+// to DefaultSpotifyScopes.
+func (sa *SpotifyAuthorizer) SetScopes(scopes []string) {
+    sa.scopes = scopes
+}
+
+// SetAuthTimeout sets how long we'll wait for the user to authorize us before
+// giving up. Zero waits forever.
+func (sa *SpotifyAuthorizer) SetAuthTimeout(authTimeout time.Duration) {
+    sa.authTimeout = authTimeout
+}
+
+// SetNoBrowser determines whether we'll just print the authorization URL for
+// the user to open themselves rather than opening the browser. The user can
+// then paste the URL that they were redirected to (or just the code from it)
+// on stdin, which works even when the browser is on another machine. We still
+// accept the callback, too.
+func (sa *SpotifyAuthorizer) SetNoBrowser(noBrowser bool) {
+    sa.noBrowser = noBrowser
+}
 
 type SpotifyContext struct {
     Sa spotify.Authenticator
     Client spotify.Client
+
+    // HttpClient is the authenticated HTTP client that Client uses.
+    HttpClient *http.Client
+
+    // tokenSource has the current token. It's refreshed as needed by
+    // HttpClient.
+    tokenSource *refreshingTokenSource
+
+    instrumentedClientOnce sync.Once
+    instrumentedClient *InstrumentedSpotifyClient
 }
 
-func (sa *SpotifyAuthorizer) handleResponse(w http.ResponseWriter, r *http.Request) {
-    authCode := r.FormValue("code")
-    if authCode == "" {
-        log.Panic(fmt.Errorf("no auth"))
+// InstrumentedClient returns the wrapper around Client that records the calls
+// made through it. The same one is shared by everything using this context.
+func (sc *SpotifyContext) InstrumentedClient() *InstrumentedSpotifyClient {
+    sc.instrumentedClientOnce.Do(func() {
+        sc.instrumentedClient = NewInstrumentedSpotifyClient(&sc.Client)
+    })
+
+    return sc.instrumentedClient
+}
+
+// Token returns the current token, refreshing it first if it has expired.
+func (sc *SpotifyContext) Token() (t *oauth2.Token, err error) {
+    return sc.tokenSource.Token()
+}
+
+// getAuthCode returns the authorization code from the parameters that Spotify
+// redirected to us with.
+func (sa *SpotifyAuthorizer) getAuthCode(values url.Values) (code string, err error) {
+    if values.Get("error") != "" {
+        return "", fmt.Errorf("%w: %s", ErrAuthDenied, values.Get("error"))
     }
 
-    w.WriteHeader(http.StatusOK)
-    fmt.Fprintf(w, "Success")
+    if sa.state == "" || values.Get("state") != sa.state {
+        return "", ErrAuthStateMismatch
+    }
 
-    t, err := sa.auth.Token(staticStateString, r)
-    log.PanicIf(err)
+    code = values.Get("code")
+    if code == "" {
+        return "", ErrAuthCodeNotFound
+    }
 
-    c := sa.auth.NewClient(t)
+    return code, nil
+}
+
+// exchangeCode gets a token for the authorization code and hands the new
+// context to whoever is waiting for it.
+func (sa *SpotifyAuthorizer) exchangeCode(code string) (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = state.(error)
+        }
+    }()
+
+    // Claim the exchange so that the callback and a pasted code can't both
+    // be exchanged. Nobody is waiting for a second one.
+
+    sa.serverLock.Lock()
+
+    if sa.done == true {
+        sa.serverLock.Unlock()
+        log.Panic(ErrAuthFinished)
+    }
+
+    sa.done = true
+
+    sa.serverLock.Unlock()
+
+    t, err := exchangeAuthCode(sa.auth, code)
+    if err != nil {
+        sa.releaseExchange()
+        log.Panic(err)
+    }
+
+    c, hc, rts := sa.newClient(t)
 
     sc := &SpotifyContext{
         Sa: sa.auth,
         Client: c,
+        HttpClient: hc,
+        tokenSource: rts,
     }
 
     sa.authC <- sc
 
     saLog.Debugf(sa.ctx, "Authorization is complete.")
+
+    sa.stopHttp()
+
+    return nil
 }
 
-func (sa *SpotifyAuthorizer) configureHttp() (err error) {
+func (sa *SpotifyAuthorizer) handleResponse(w http.ResponseWriter, r *http.Request) {
+    authCode, err := sa.getAuthCode(r.URL.Query())
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    err = sa.exchangeCode(authCode)
+    if err != nil {
+        http.Error(w, err.Error(), http.StatusInternalServerError)
+        saLog.Errorf(sa.ctx, err, "Could not authorize using the callback.")
+
+        return
+    }
+
+    w.WriteHeader(http.StatusOK)
+    fmt.Fprintf(w, "Success")
+}
+
+// parsePastedCode returns the authorization code from what the user pasted:
+// either the whole URL that they were redirected to or just the code.
+func (sa *SpotifyAuthorizer) parsePastedCode(pasted string) (code string, err error) {
+    if strings.Contains(pasted, "?") == false {
+        return pasted, nil
+    }
+
+    u, err := url.Parse(pasted)
+    if err != nil {
+        return "", err
+    }
+
+    return sa.getAuthCode(u.Query())
+}
+
+// readPastedCode waits for the user to paste the URL that they were redirected
+// to (or just the code from it) and then finishes authorizing.
+func (sa *SpotifyAuthorizer) readPastedCode(r io.Reader) (err error) {
     defer func() {
         if state := recover(); state != nil {
             err = state.(error)
         }
     }()
 
-    saLog.Debugf(nil, "Starting web-server.")
+    s := bufio.NewScanner(r)
+    for s.Scan() {
+        pasted := strings.TrimSpace(s.Text())
+        if pasted == "" {
+            continue
+        }
+
+        code, err := sa.parsePastedCode(pasted)
+        if err != nil {
+            fmt.Printf("That could not be used (%s). Please try again:\n", err)
+            continue
+        }
+
+        err = sa.exchangeCode(code)
+        if log.Is(err, ErrAuthFinished) == true {
+            // The callback beat us to it.
+            return nil
+        } else if err != nil {
+            fmt.Printf("That could not be used (%s). Please try again:\n", err)
+            continue
+        }
+
+        return nil
+    }
+
+    err = s.Err()
+    log.PanicIf(err)
+
+    // Stdin was closed. We might still get the callback.
+    return nil
+}
+
+func (sa *SpotifyAuthorizer) configureHttp() (err error) {
+    defer func() {
+        if state := recover(); state != nil {
+            err = state.(error)
+        }
+    }()
 
     r := mux.NewRouter()
     r.HandleFunc("/authResponse", sa.handleResponse)
 
-    if err := http.ListenAndServe(sa.localBindUrl, r); err != nil {
+    sa.serverLock.Lock()
+
+    // The code might have already been pasted (or we've given up).
+    if sa.authorized == true || sa.timedOut == true {
+        sa.serverLock.Unlock()
+        return nil
+    }
+
+    server := &http.Server{
+        Addr: sa.localBindUrl,
+        Handler: r,
+    }
+
+    sa.server = server
+
+    sa.serverLock.Unlock()
+
+    saLog.Debugf(nil, "Starting web-server.")
+
+    if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
         log.Panic(err)
     }
 
+    saLog.Debugf(nil, "Web-server stopped.")
+
     return nil
 }
 
+// stopHttp shuts down the web-server (if it was started) now that we're
+// authorized, which frees the port and lets Authorize return.
+func (sa *SpotifyAuthorizer) stopHttp() {
+    sa.serverLock.Lock()
+    defer sa.serverLock.Unlock()
+
+    sa.done = true
+    sa.authorized = true
+    sa.shutdownHttp()
+}
+
+// releaseExchange lets another code be exchanged after the exchange failed.
+// If we ran out of time in the meantime, we give up now.
+func (sa *SpotifyAuthorizer) releaseExchange() {
+    sa.serverLock.Lock()
+    sa.done = false
+    expired := sa.expired
+    sa.serverLock.Unlock()
+
+    if expired == true {
+        sa.expire()
+    }
+}
+
+// expire gives up on being authorized (unless a code is being exchanged, in
+// which case we give up only if that fails).
+func (sa *SpotifyAuthorizer) expire() {
+    sa.serverLock.Lock()
+    defer sa.serverLock.Unlock()
+
+    sa.expired = true
+
+    if sa.done == true {
+        return
+    }
+
+    saLog.Warningf(nil, "Timed out waiting for authorization after (%s).", sa.authTimeout)
+
+    sa.done = true
+    sa.timedOut = true
+    sa.shutdownHttp()
+}
+
+// shutdownHttp shuts down the web-server if it was started. The lock must be
+// held.
+func (sa *SpotifyAuthorizer) shutdownHttp() {
+    if sa.server == nil {
+        return
+    }
+
+    server := sa.server
+
+    // This is usually called from the handler, and shutting down waits for
+    // the handlers to finish.
+    go func() {
+        if err := server.Shutdown(context.Background()); err != nil {
+            saLog.Warningf(nil, "Could not shut down the web-server: %s", err)
+        }
+    }()
+}
+
+// newState returns a new random state for an authorization request.
+func newState() (state string, err error) {
+    raw := make([]byte, stateLength)
+
+    if _, err := rand.Read(raw); err != nil {
+        return "", err
+    }
+
+    return hex.EncodeToString(raw), nil
+}
+
 func (sa *SpotifyAuthorizer) Authorize() (err error) {
     defer func() {
         if state := recover(); state != nil {
@@ -108,14 +475,29 @@ func (sa *SpotifyAuthorizer) Authorize() (err error) {
         }
     }()
 
-    scopes := []string {
-        spotify.ScopeUserReadPrivate,
-        spotify.ScopePlaylistReadCollaborative,
-        spotify.ScopePlaylistReadPrivate,
-        spotify.ScopePlaylistModifyPrivate,
-        spotify.ScopePlaylistModifyPublic,
+    sa.state, err = newState()
+    log.PanicIf(err)
+
+    sa.serverLock.Lock()
+    sa.server = nil
+    sa.done = false
+    sa.authorized = false
+    sa.timedOut = false
+    sa.expired = false
+    sa.serverLock.Unlock()
+
+    if sa.authTimeout > 0 {
+        timer := time.AfterFunc(sa.authTimeout, sa.expire)
+        defer timer.Stop()
+    }
+
+    scopes := sa.scopes
+    if scopes == nil {
+        scopes = DefaultSpotifyScopes
     }
 
+    saLog.Debugf(nil, "Requesting scopes: %v", scopes)
+
     // the redirect URL must be an exact match of a URL you've registered for your application
     // scopes determine which permissions the user is prompted to authorize
     sa.auth = spotify.NewAuthenticator(sa.apiRedirectUrl, scopes...)
@@ -126,20 +508,42 @@ func (sa *SpotifyAuthorizer) Authorize() (err error) {
 
     // get the user to this URL - how you do that is up to you
     // you should specify a unique state string to identify the session
-    url := sa.auth.AuthURL(staticStateString)
-
-    // Open the browser.
-
-    saLog.Debugf(nil, "Opening: [%s]", url)
-
-    if err := browser.OpenURL(url); err != nil {
-        log.Panic(err)
+    url := sa.auth.AuthURL(sa.state)
+
+    if sa.noBrowser == true {
+        // The URL is the whole point, so print it regardless of the logging
+        // configuration.
+        fmt.Printf("Please open the following URL to authorize access to Spotify:\n\n%s\n\n", url)
+        fmt.Printf("Then paste the URL that you're redirected to (or just its \"code\" parameter) here:\n")
+
+        go func() {
+            if err := sa.readPastedCode(os.Stdin); err != nil {
+                saLog.Errorf(sa.ctx, err, "Could not authorize using the pasted code.")
+            }
+        }()
+    } else {
+        // Open the browser.
+
+        saLog.Debugf(nil, "Opening: [%s]", url)
+
+        if err := openBrowser(url); err != nil {
+            log.Panic(err)
+        }
     }
 
-    // Wait for the response.
+    // Wait for the response. This returns once we're authorized (or have
+    // timed out).
     if err := sa.configureHttp(); err != nil {
         log.Panic(err)
     }
 
+    sa.serverLock.Lock()
+    timedOut := sa.timedOut
+    sa.serverLock.Unlock()
+
+    if timedOut == true {
+        log.Panic(ErrAuthTimeout)
+    }
+
     return nil
 }
@@ -0,0 +1,274 @@
+package gnsssync
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"net/http"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// freeLocalAddress returns a local address that nothing is listening on.
+func freeLocalAddress(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Could not find a free port: %s", err)
+	}
+
+	address := l.Addr().String()
+	l.Close()
+
+	return address
+}
+
+// waitForListener waits for something to be listening on the given address.
+func waitForListener(t *testing.T, address string) {
+	for j := 0; j < 100; j++ {
+		c, err := net.Dial("tcp", address)
+		if err == nil {
+			c.Close()
+			return
+		}
+
+		time.Sleep(time.Millisecond * 20)
+	}
+
+	t.Fatalf("Nothing is listening on [%s].", address)
+}
+
+func TestAuthorize_NoBrowser(t *testing.T) {
+	for _, noBrowser := range []bool{false, true} {
+		openedUrls := make([]string, 0)
+
+		originalOpenBrowser := openBrowser
+		openBrowser = func(url string) error {
+			openedUrls = append(openedUrls, url)
+			return nil
+		}
+
+		address := freeLocalAddress(t)
+
+		sa := NewSpotifyAuthorizer(context.Background(), "client-id", "secret-key", "http://"+address+"/authResponse", address, make(chan *SpotifyContext, 1))
+		sa.SetNoBrowser(noBrowser)
+
+		errC := make(chan error, 1)
+		go func() {
+			errC <- sa.Authorize()
+		}()
+
+		// The callback server should be running either way.
+
+		waitForListener(t, address)
+
+		response, err := http.Get("http://" + address + "/authResponse?state=wrong&code=code")
+		if err != nil {
+			t.Fatalf("Callback server not reachable (%v): %s", noBrowser, err)
+		}
+
+		response.Body.Close()
+
+		if response.StatusCode != http.StatusBadRequest {
+			t.Fatalf("Callback with the wrong state not rejected (%v): (%d)", noBrowser, response.StatusCode)
+		}
+
+		sa.expire()
+
+		err = <-errC
+		if log.Is(err, ErrAuthTimeout) == false {
+			t.Fatalf("Authorize didn't return once we gave up (%v): %v", noBrowser, err)
+		}
+
+		openBrowser = originalOpenBrowser
+
+		if noBrowser == true && len(openedUrls) != 0 {
+			t.Fatalf("Browser opened despite no-browser: %v", openedUrls)
+		} else if noBrowser == false && len(openedUrls) != 1 {
+			t.Fatalf("Browser not opened: %v", openedUrls)
+		}
+	}
+}
+
+func TestAuthorize_Twice(t *testing.T) {
+	originalOpenBrowser := openBrowser
+	openBrowser = func(url string) error {
+		return nil
+	}
+
+	defer func() {
+		openBrowser = originalOpenBrowser
+	}()
+
+	address := freeLocalAddress(t)
+
+	sa := NewSpotifyAuthorizer(context.Background(), "client-id", "secret-key", "http://"+address+"/authResponse", address, make(chan *SpotifyContext, 1))
+
+	// The same address is used each time, so the web-server has to be shut
+	// down in between.
+
+	for j := 0; j < 2; j++ {
+		errC := make(chan error, 1)
+		go func() {
+			errC <- sa.Authorize()
+		}()
+
+		waitForListener(t, address)
+
+		sa.expire()
+
+		err := <-errC
+		if log.Is(err, ErrAuthTimeout) == false {
+			t.Fatalf("Authorize (%d) didn't return once we gave up: %v", j, err)
+		}
+
+		// The port is free once Authorize returns.
+
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			t.Fatalf("Port not freed after Authorize (%d): %s", j, err)
+		}
+
+		l.Close()
+	}
+}
+
+// newFakeExchangeAuthCode returns a replacement for the code exchange that
+// records the codes and only accepts "good" ones.
+func newFakeExchangeAuthCode(exchanged *[]string) func(auth spotify.Authenticator, code string) (*oauth2.Token, error) {
+	return func(auth spotify.Authenticator, code string) (*oauth2.Token, error) {
+		*exchanged = append(*exchanged, code)
+
+		if strings.HasPrefix(code, "good") == false {
+			return nil, fmt.Errorf("invalid code")
+		}
+
+		return &oauth2.Token{AccessToken: "token"}, nil
+	}
+}
+
+func TestReadPastedCode_Retry(t *testing.T) {
+	exchanged := make([]string, 0)
+
+	originalExchangeAuthCode := exchangeAuthCode
+	exchangeAuthCode = newFakeExchangeAuthCode(&exchanged)
+
+	defer func() {
+		exchangeAuthCode = originalExchangeAuthCode
+	}()
+
+	authC := make(chan *SpotifyContext, 1)
+	sa := NewSpotifyAuthorizer(context.Background(), "client-id", "secret-key", "http://localhost/authResponse", "localhost:0", authC)
+
+	// A code that can't be exchanged doesn't stop the user from pasting
+	// another.
+
+	err := sa.readPastedCode(strings.NewReader("bad\ngood\ngood-again\n"))
+	if err != nil {
+		t.Fatalf("Could not read pasted code: %s", err)
+	}
+
+	if strings.Join(exchanged, ",") != "bad,good" {
+		t.Fatalf("Codes exchanged not correct: %v", exchanged)
+	}
+
+	select {
+	case <-authC:
+	default:
+		t.Fatalf("Context not handed over.")
+	}
+}
+
+func TestExchangeCode_Once(t *testing.T) {
+	exchanged := make([]string, 0)
+
+	originalExchangeAuthCode := exchangeAuthCode
+	exchangeAuthCode = newFakeExchangeAuthCode(&exchanged)
+
+	defer func() {
+		exchangeAuthCode = originalExchangeAuthCode
+	}()
+
+	authC := make(chan *SpotifyContext, 1)
+	sa := NewSpotifyAuthorizer(context.Background(), "client-id", "secret-key", "http://localhost/authResponse", "localhost:0", authC)
+
+	// Once the exchange fails, another code can be exchanged.
+
+	err := sa.exchangeCode("bad")
+	if err == nil {
+		t.Fatalf("Bad code should not have been exchanged.")
+	}
+
+	err = sa.exchangeCode("good")
+	if err != nil {
+		t.Fatalf("Could not exchange code: %s", err)
+	}
+
+	// Once it succeeds, no others are.
+
+	err = sa.exchangeCode("good-again")
+	if log.Is(err, ErrAuthFinished) == false {
+		t.Fatalf("Second code should not have been exchanged: %v", err)
+	}
+
+	if strings.Join(exchanged, ",") != "bad,good" {
+		t.Fatalf("Codes exchanged not correct: %v", exchanged)
+	}
+}
+
+func TestExchangeCode_Concurrent(t *testing.T) {
+	// The exchange blocks until we've tried to exchange a second code.
+
+	releaseC := make(chan struct{})
+
+	originalExchangeAuthCode := exchangeAuthCode
+	exchangeAuthCode = func(auth spotify.Authenticator, code string) (*oauth2.Token, error) {
+		<-releaseC
+		return &oauth2.Token{AccessToken: "token"}, nil
+	}
+
+	defer func() {
+		exchangeAuthCode = originalExchangeAuthCode
+	}()
+
+	authC := make(chan *SpotifyContext, 2)
+	sa := NewSpotifyAuthorizer(context.Background(), "client-id", "secret-key", "http://localhost/authResponse", "localhost:0", authC)
+
+	errC := make(chan error, 1)
+	go func() {
+		errC <- sa.exchangeCode("callback")
+	}()
+
+	// Wait for the first exchange to claim the flag.
+	for j := 0; j < 100; j++ {
+		sa.serverLock.Lock()
+		done := sa.done
+		sa.serverLock.Unlock()
+
+		if done == true {
+			break
+		}
+
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	err := sa.exchangeCode("pasted")
+	if log.Is(err, ErrAuthFinished) == false {
+		t.Fatalf("Code exchanged while another was being exchanged: %v", err)
+	}
+
+	close(releaseC)
+
+	err = <-errC
+	if err != nil {
+		t.Fatalf("Could not exchange code: %s", err)
+	} else if len(authC) != 1 {
+		t.Fatalf("Context not handed over exactly once: (%d)", len(authC))
+	}
+}
@@ -0,0 +1,299 @@
+package gnsssync
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Misc
+var (
+	scLog = log.NewLogger("gnss.spotify_client")
+)
+
+// SpotifyClient is the part of the Spotify client that we use.
+type SpotifyClient interface {
+	CurrentUser() (*spotify.PrivateUser, error)
+
+	Search(query string, t spotify.SearchType) (*spotify.SearchResult, error)
+	SearchOpt(query string, t spotify.SearchType, opt *spotify.Options) (*spotify.SearchResult, error)
+	NextArtistResults(s *spotify.SearchResult) error
+
+	GetArtistAlbumsOpt(artistID spotify.ID, options *spotify.Options, t *spotify.AlbumType) (*spotify.SimpleAlbumPage, error)
+	GetAlbum(id spotify.ID) (*spotify.FullAlbum, error)
+	GetAlbums(ids ...spotify.ID) ([]*spotify.FullAlbum, error)
+	GetAlbumTracksOpt(id spotify.ID, limit, offset int) (*spotify.SimpleTrackPage, error)
+
+	GetPlaylistsForUser(userID string) (*spotify.SimplePlaylistPage, error)
+	GetPlaylistsForUserOpt(userID string, opt *spotify.Options) (*spotify.SimplePlaylistPage, error)
+	GetPlaylistTracksOpt(userID string, playlistID spotify.ID, opt *spotify.Options, fields string) (*spotify.PlaylistTrackPage, error)
+	CreatePlaylistForUser(userID, playlistName string, public bool) (*spotify.FullPlaylist, error)
+	AddTracksToPlaylist(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) (snapshotID string, err error)
+	RemoveTracksFromPlaylist(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) (newSnapshotID string, err error)
+}
+
+// SpotifyMethodStats are the counts for one Spotify client method.
+type SpotifyMethodStats struct {
+	Calls  int
+	Errors int
+
+	// RateLimited is how many of the calls failed due to rate-limiting.
+	RateLimited int
+
+	// Duration is the total time spent in the calls (including any waiting
+	// that the client did itself).
+	Duration time.Duration
+}
+
+// SpotifySleepStats are the waits that we did before retrying one kind of
+// Spotify call.
+type SpotifySleepStats struct {
+	Count    int
+	Duration time.Duration
+}
+
+// SpotifyClientStats is a snapshot of the counts recorded by
+// InstrumentedSpotifyClient.
+type SpotifyClientStats struct {
+	// Methods are keyed by client method name.
+	Methods map[string]SpotifyMethodStats
+
+	// Sleeps are keyed by the description of the call that was retried.
+	Sleeps map[string]SpotifySleepStats
+}
+
+// InstrumentedSpotifyClient wraps a SpotifyClient and records the calls made
+// through it, how long they took, and how long we waited to retry them.
+type InstrumentedSpotifyClient struct {
+	client SpotifyClient
+
+	m       sync.Mutex
+	methods map[string]SpotifyMethodStats
+	sleeps  map[string]SpotifySleepStats
+
+	// rateLimitObserver, if not nil, is told whether each call was
+	// rate-limited.
+	rateLimitObserver func(rateLimited bool)
+}
+
+func NewInstrumentedSpotifyClient(client SpotifyClient) *InstrumentedSpotifyClient {
+	return &InstrumentedSpotifyClient{
+		client:  client,
+		methods: make(map[string]SpotifyMethodStats),
+		sleeps:  make(map[string]SpotifySleepStats),
+	}
+}
+
+// Snapshot returns a copy of the counts recorded so far.
+func (isc *InstrumentedSpotifyClient) Snapshot() SpotifyClientStats {
+	isc.m.Lock()
+	defer isc.m.Unlock()
+
+	scs := SpotifyClientStats{
+		Methods: make(map[string]SpotifyMethodStats, len(isc.methods)),
+		Sleeps:  make(map[string]SpotifySleepStats, len(isc.sleeps)),
+	}
+
+	for method, sms := range isc.methods {
+		scs.Methods[method] = sms
+	}
+
+	for description, sss := range isc.sleeps {
+		scs.Sleeps[description] = sss
+	}
+
+	return scs
+}
+
+// RetryPolicy returns the given policy with the waits that it does recorded
+// against this client.
+func (isc *InstrumentedSpotifyClient) RetryPolicy(policy RetryPolicy) RetryPolicy {
+	policy.OnSleep = isc.recordSleep
+	return policy
+}
+
+// SetRateLimitObserver has the given callback told whether each call was
+// rate-limited (or stops telling it if nil).
+func (isc *InstrumentedSpotifyClient) SetRateLimitObserver(cb func(rateLimited bool)) {
+	isc.m.Lock()
+	defer isc.m.Unlock()
+
+	isc.rateLimitObserver = cb
+}
+
+func (isc *InstrumentedSpotifyClient) recordSleep(description string, wait time.Duration) {
+	scLog.Debugf(nil, "Sleeping (%s) before retrying: %s", wait, description)
+
+	isc.m.Lock()
+	defer isc.m.Unlock()
+
+	sss := isc.sleeps[description]
+	sss.Count++
+	sss.Duration += wait
+
+	isc.sleeps[description] = sss
+}
+
+func (isc *InstrumentedSpotifyClient) record(method string, startedAt time.Time, err error) {
+	duration := time.Since(startedAt)
+	rateLimited := err != nil && isRateLimitError(err) == true
+
+	isc.m.Lock()
+
+	sms := isc.methods[method]
+	sms.Calls++
+	sms.Duration += duration
+
+	if err != nil {
+		sms.Errors++
+
+		if rateLimited == true {
+			scLog.Debugf(nil, "Spotify rate-limited [%s].", method)
+			sms.RateLimited++
+		}
+	}
+
+	isc.methods[method] = sms
+	observer := isc.rateLimitObserver
+
+	isc.m.Unlock()
+
+	// Called without the lock since the observer might take its own.
+	if observer != nil {
+		observer(rateLimited)
+	}
+}
+
+// isRateLimitError returns whether the given error is Spotify telling us to
+// slow down.
+func isRateLimitError(err error) bool {
+	switch e := err.(type) {
+	case spotify.Error:
+		return e.Status == http.StatusTooManyRequests
+	case *spotify.Error:
+		return e.Status == http.StatusTooManyRequests
+	}
+
+	return false
+}
+
+func (isc *InstrumentedSpotifyClient) CurrentUser() (pu *spotify.PrivateUser, err error) {
+	startedAt := time.Now()
+	pu, err = isc.client.CurrentUser()
+	isc.record("CurrentUser", startedAt, err)
+
+	return pu, err
+}
+
+func (isc *InstrumentedSpotifyClient) Search(query string, t spotify.SearchType) (sr *spotify.SearchResult, err error) {
+	startedAt := time.Now()
+	sr, err = isc.client.Search(query, t)
+	isc.record("Search", startedAt, err)
+
+	return sr, err
+}
+
+func (isc *InstrumentedSpotifyClient) SearchOpt(query string, t spotify.SearchType, opt *spotify.Options) (sr *spotify.SearchResult, err error) {
+	startedAt := time.Now()
+	sr, err = isc.client.SearchOpt(query, t, opt)
+	isc.record("SearchOpt", startedAt, err)
+
+	return sr, err
+}
+
+func (isc *InstrumentedSpotifyClient) NextArtistResults(s *spotify.SearchResult) (err error) {
+	startedAt := time.Now()
+	err = isc.client.NextArtistResults(s)
+
+	// Running out of pages isn't a failure.
+	if err == spotify.ErrNoMorePages {
+		isc.record("NextArtistResults", startedAt, nil)
+	} else {
+		isc.record("NextArtistResults", startedAt, err)
+	}
+
+	return err
+}
+
+func (isc *InstrumentedSpotifyClient) GetArtistAlbumsOpt(artistID spotify.ID, options *spotify.Options, t *spotify.AlbumType) (sap *spotify.SimpleAlbumPage, err error) {
+	startedAt := time.Now()
+	sap, err = isc.client.GetArtistAlbumsOpt(artistID, options, t)
+	isc.record("GetArtistAlbumsOpt", startedAt, err)
+
+	return sap, err
+}
+
+func (isc *InstrumentedSpotifyClient) GetAlbum(id spotify.ID) (fa *spotify.FullAlbum, err error) {
+	startedAt := time.Now()
+	fa, err = isc.client.GetAlbum(id)
+	isc.record("GetAlbum", startedAt, err)
+
+	return fa, err
+}
+
+func (isc *InstrumentedSpotifyClient) GetAlbums(ids ...spotify.ID) (albums []*spotify.FullAlbum, err error) {
+	startedAt := time.Now()
+	albums, err = isc.client.GetAlbums(ids...)
+	isc.record("GetAlbums", startedAt, err)
+
+	return albums, err
+}
+
+func (isc *InstrumentedSpotifyClient) GetAlbumTracksOpt(id spotify.ID, limit, offset int) (stp *spotify.SimpleTrackPage, err error) {
+	startedAt := time.Now()
+	stp, err = isc.client.GetAlbumTracksOpt(id, limit, offset)
+	isc.record("GetAlbumTracksOpt", startedAt, err)
+
+	return stp, err
+}
+
+func (isc *InstrumentedSpotifyClient) GetPlaylistsForUser(userID string) (splp *spotify.SimplePlaylistPage, err error) {
+	startedAt := time.Now()
+	splp, err = isc.client.GetPlaylistsForUser(userID)
+	isc.record("GetPlaylistsForUser", startedAt, err)
+
+	return splp, err
+}
+
+func (isc *InstrumentedSpotifyClient) GetPlaylistsForUserOpt(userID string, opt *spotify.Options) (splp *spotify.SimplePlaylistPage, err error) {
+	startedAt := time.Now()
+	splp, err = isc.client.GetPlaylistsForUserOpt(userID, opt)
+	isc.record("GetPlaylistsForUserOpt", startedAt, err)
+
+	return splp, err
+}
+
+func (isc *InstrumentedSpotifyClient) GetPlaylistTracksOpt(userID string, playlistID spotify.ID, opt *spotify.Options, fields string) (ptp *spotify.PlaylistTrackPage, err error) {
+	startedAt := time.Now()
+	ptp, err = isc.client.GetPlaylistTracksOpt(userID, playlistID, opt, fields)
+	isc.record("GetPlaylistTracksOpt", startedAt, err)
+
+	return ptp, err
+}
+
+func (isc *InstrumentedSpotifyClient) CreatePlaylistForUser(userID, playlistName string, public bool) (fp *spotify.FullPlaylist, err error) {
+	startedAt := time.Now()
+	fp, err = isc.client.CreatePlaylistForUser(userID, playlistName, public)
+	isc.record("CreatePlaylistForUser", startedAt, err)
+
+	return fp, err
+}
+
+func (isc *InstrumentedSpotifyClient) AddTracksToPlaylist(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) (snapshotID string, err error) {
+	startedAt := time.Now()
+	snapshotID, err = isc.client.AddTracksToPlaylist(userID, playlistID, trackIDs...)
+	isc.record("AddTracksToPlaylist", startedAt, err)
+
+	return snapshotID, err
+}
+
+func (isc *InstrumentedSpotifyClient) RemoveTracksFromPlaylist(userID string, playlistID spotify.ID, trackIDs ...spotify.ID) (newSnapshotID string, err error) {
+	startedAt := time.Now()
+	newSnapshotID, err = isc.client.RemoveTracksFromPlaylist(userID, playlistID, trackIDs...)
+	isc.record("RemoveTracksFromPlaylist", startedAt, err)
+
+	return newSnapshotID, err
+}
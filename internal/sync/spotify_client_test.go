@@ -0,0 +1,120 @@
+package gnsssync
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestInstrumentedSpotifyClient_Snapshot(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+	fsc.addAlbum("artist1", "album1", "First Album", "album", "2001-01-01", "Opener")
+
+	isc := NewInstrumentedSpotifyClient(fsc)
+
+	rateLimitedCalls := make([]bool, 0)
+	isc.SetRateLimitObserver(func(rateLimited bool) {
+		rateLimitedCalls = append(rateLimitedCalls, rateLimited)
+	})
+
+	_, err := isc.Search("The Band", spotify.SearchTypeArtist)
+	if err != nil {
+		t.Fatalf("Search failed: %s", err)
+	}
+
+	sr, err := isc.Search("The Band", spotify.SearchTypeArtist)
+	if err != nil {
+		t.Fatalf("Second search failed: %s", err)
+	}
+
+	// Running out of pages isn't counted as an error.
+
+	err = isc.NextArtistResults(sr)
+	if err != spotify.ErrNoMorePages {
+		t.Fatalf("Expected no more pages: [%v]", err)
+	}
+
+	_, err = isc.GetAlbum("album1")
+	if err != nil {
+		t.Fatalf("GetAlbum failed: %s", err)
+	}
+
+	_, err = isc.GetAlbum("missing")
+	if err == nil {
+		t.Fatalf("Expected GetAlbum to fail for an unknown album.")
+	}
+
+	fsc.failNext("GetAlbum", spotify.Error{Message: "slow down", Status: http.StatusTooManyRequests})
+
+	_, err = isc.GetAlbum("album1")
+	if isRateLimitError(err) != true {
+		t.Fatalf("Expected a rate-limit error: [%v]", err)
+	}
+
+	// The waits done by a policy from the client are recorded against it.
+
+	policy := isc.RetryPolicy(RetryPolicy{
+		MaxRetries:     2,
+		InitialBackoff: time.Millisecond,
+		Classify: func(err error) (retryable bool, wait time.Duration) {
+			return err == errTestRetryable, 0
+		},
+	})
+
+	attempts := 0
+	err = withRetry(policy, "test call", func() error {
+		attempts++
+		if attempts < 3 {
+			return errTestRetryable
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Retried call failed: %s", err)
+	}
+
+	scs := isc.Snapshot()
+
+	calls := make(map[string][3]int)
+	for method, sms := range scs.Methods {
+		calls[method] = [3]int{sms.Calls, sms.Errors, sms.RateLimited}
+	}
+
+	expectedCalls := map[string][3]int{
+		"Search":            {2, 0, 0},
+		"NextArtistResults": {1, 0, 0},
+		"GetAlbum":          {3, 2, 1},
+	}
+
+	if reflect.DeepEqual(calls, expectedCalls) != true {
+		t.Fatalf("Call counts not correct: %v", calls)
+	}
+
+	sss, found := scs.Sleeps["test call"]
+	if found != true {
+		t.Fatalf("Sleeps not recorded.")
+	} else if sss.Count != 2 {
+		t.Fatalf("Sleep count not correct: (%d)", sss.Count)
+	} else if sss.Duration != time.Millisecond*3 {
+		t.Fatalf("Sleep duration not correct: [%s]", sss.Duration)
+	}
+
+	expectedRateLimitedCalls := []bool{false, false, false, false, false, true}
+	if reflect.DeepEqual(rateLimitedCalls, expectedRateLimitedCalls) != true {
+		t.Fatalf("Rate-limit observations not correct: %v", rateLimitedCalls)
+	}
+
+	// The snapshot is a copy.
+
+	scs.Methods["Search"] = SpotifyMethodStats{}
+
+	if isc.Snapshot().Methods["Search"].Calls != 2 {
+		t.Fatalf("Snapshot should not share state with the client.")
+	}
+}
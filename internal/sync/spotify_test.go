@@ -0,0 +1,980 @@
+package gnsssync
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+func TestSearchSpotifyArtists_NoResults(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	for j := 0; j < 2; j++ {
+		_, err := sa.searchSpotifyArtists("Nobody")
+		if err == nil {
+			t.Fatalf("Expected the artist to not be found.")
+		} else if log.Is(err, ErrSpotifyArtistNotFound) == false {
+			t.Fatalf("Wrong error for an artist without results: %s", err)
+		}
+	}
+
+	// The miss should have been cached.
+	if calls := fsc.callCount("Search"); calls != 1 {
+		t.Fatalf("Miss wasn't cached: (%d) searches", calls)
+	}
+}
+
+func TestGetSpotifyTrackIdsWithNames_MisspelledArtist(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "Guns N' Roses")
+	fsc.addAlbum("artist1", "album1", "Appetite for Destruction", "album", "1987-07-21", "Welcome to the Jungle", "Paradise City")
+
+	tracks := []string{"paradise city"}
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	_, _, _, err := sa.GetSpotifyTrackIdsWithNames("guns n roses", "appetite for destruction", tracks, "")
+	if log.Is(err, ErrSpotifyArtistNotFound) == false {
+		t.Fatalf("Album should only be searched for globally when asked: %v", err)
+	}
+
+	sa = newTestSpotifyAdapter(fsc)
+	sa.SetAlbumSearchOnArtistMiss(true)
+
+	foundTracks, missingTracks, matchMethods, err := sa.GetSpotifyTrackIdsWithNames("guns n roses", "appetite for destruction", tracks, "")
+	if err != nil {
+		t.Fatalf("Lookup failed: %s", err)
+	} else if len(missingTracks) != 0 {
+		t.Fatalf("Tracks missing: %v", missingTracks)
+	} else if name := foundTracks["album1-2"]; name != "paradise city" {
+		t.Fatalf("Track not found on the album found globally: %v", foundTracks)
+	} else if method := matchMethods["album1-2"]; method != MatchMethodAlbumSearch {
+		t.Fatalf("Match method not correct: [%s]", method)
+	}
+}
+
+func TestGetSpotifyTrackIdsWithNames_StrictArtist(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "Guns N' Roses")
+	fsc.addAlbum("artist1", "album1", "Appetite for Destruction", "album", "1987-07-21", "Welcome to the Jungle", "Paradise City")
+
+	// This would be found loosely (see above) but isn't an exact match.
+
+	sa := newTestSpotifyAdapter(fsc)
+	sa.SetAlbumSearchOnArtistMiss(true)
+	sa.SetStrictArtist(true)
+
+	_, _, _, err := sa.GetSpotifyTrackIdsWithNames("guns n roses", "appetite for destruction", []string{"paradise city"}, "")
+	if log.Is(err, ErrSpotifyArtistNotFound) == false {
+		t.Fatalf("Loosely-matching artist should not be accepted when strict: %v", err)
+	}
+
+	// Case still doesn't matter.
+
+	foundTracks, _, _, err := sa.GetSpotifyTrackIdsWithNames("GUNS N' ROSES", "appetite for destruction", []string{"paradise city"}, "")
+	if err != nil {
+		t.Fatalf("Exact artist not found when strict: %s", err)
+	} else if _, found := foundTracks["album1-2"]; found == false {
+		t.Fatalf("Track not found when strict: %v", foundTracks)
+	}
+}
+
+func TestIsArtistMatch_Strict(t *testing.T) {
+	cases := []struct {
+		spotifyArtistName string
+		artistName        string
+		loose             bool
+		strict            bool
+	}{
+		{"Guns N' Roses", "guns n' roses", true, true},
+		{"Guns N' Roses", "guns n roses", true, false},
+		{"The Beatles", "beatles", true, false},
+		{"Yes", "yesterday's children", false, false},
+	}
+
+	for _, c := range cases {
+		sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+
+		if matched := sa.isArtistMatch(c.spotifyArtistName, c.artistName); matched != c.loose {
+			t.Fatalf("Loose match of [%s] and [%s] not correct: (%v)", c.spotifyArtistName, c.artistName, matched)
+		}
+
+		sa.SetStrictArtist(true)
+
+		if matched := sa.isArtistMatch(c.spotifyArtistName, c.artistName); matched != c.strict {
+			t.Fatalf("Strict match of [%s] and [%s] not correct: (%v)", c.spotifyArtistName, c.artistName, matched)
+		}
+	}
+}
+
+func TestGetSpotifyTrackIdsWithNames_AlbumSearchWrongArtist(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "Yesterday's Children")
+	fsc.addAlbum("artist1", "album1", "Greatest Hits", "album", "1970-01-01", "Roundabout")
+
+	sa := newTestSpotifyAdapter(fsc)
+	sa.SetAlbumSearchOnArtistMiss(true)
+
+	_, _, _, err := sa.GetSpotifyTrackIdsWithNames("yes", "greatest hits", []string{"roundabout"}, "")
+	if log.Is(err, ErrSpotifyArtistNotFound) == false {
+		t.Fatalf("Album by a different artist was accepted: %v", err)
+	}
+}
+
+func TestGetSpotifyTrackIdWithNames_MultiPageAlbum(t *testing.T) {
+	trackNames := make([]string, SpotifyReadBatchSize*2+5)
+	for j, _ := range trackNames {
+		trackNames[j] = fmt.Sprintf("Track %d", j+1)
+	}
+
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+	fsc.addAlbum("artist1", "album1", "Box Set", "album", "2001-01-01", trackNames...)
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	// On the last page.
+	id, matchMethod, err := sa.GetSpotifyTrackIdWithNames("the band", "box set", "track 103", "")
+	if err != nil {
+		t.Fatalf("Track on a later page not found: %s", err)
+	} else if id != "album1-103" {
+		t.Fatalf("Wrong track found: [%s]", id)
+	} else if matchMethod != MatchMethodStrictAlbum {
+		t.Fatalf("Match method not correct: [%s]", matchMethod)
+	}
+
+	if calls := fsc.callCount("GetAlbumTracksOpt"); calls < 3 {
+		t.Fatalf("Not every page of the album was read: (%d) calls", calls)
+	}
+
+	_, _, err = sa.GetSpotifyTrackIdWithNames("the band", "box set", "track 999", "")
+	if log.Is(err, ErrSpotifyTrackNotFound) == false {
+		t.Fatalf("Expected track to not be found: %v", err)
+	}
+}
+
+func TestSimplifyTitle_EditionStopwords(t *testing.T) {
+	cases := []struct {
+		editionStopwords []string
+		title            string
+		simplified       string
+	}{
+		{nil, "Album (Remastered)", "Album"},
+		{nil, "Album (Live at Wembley)", "Album"},
+		{nil, "Song (Skit)", "Song (Skit)"},
+		{nil, "Album (Remastered) [Deluxe Edition]", "Album"},
+		{nil, "Song (Skit) (Remastered)", "Song (Skit)"},
+		{nil, "Song (Radio Edit)", "Song"},
+		{nil, "Song (Extended Mix)", "Song"},
+		{nil, "Song (Remixed)", "Song"},
+
+		// The stopwords have to be whole words.
+		{nil, "Song (Monologue)", "Song (Monologue)"},
+		{nil, "Song (Liverpool)", "Song (Liverpool)"},
+		{nil, "Song (Stereotype)", "Song (Stereotype)"},
+		{nil, "Song (Edith)", "Song (Edith)"},
+		{nil, "Song (Album Version)", "Song"},
+		{nil, "Song (Albumen)", "Song (Albumen)"},
+
+		{[]string{"remaster"}, "Album (Remastered)", "Album"},
+		{[]string{"remaster"}, "Album (Live at Wembley)", "Album (Live at Wembley)"},
+		{[]string{"skit"}, "Song (Skit)", "Song"},
+	}
+
+	for _, c := range cases {
+		sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+
+		if c.editionStopwords != nil {
+			sa.SetEditionStopwords(c.editionStopwords)
+		}
+
+		simplified := sa.simplifyTitle(c.title)
+		if simplified != c.simplified {
+			t.Fatalf("[%s] %v simplified title not correct: [%s] != [%s]", c.title, c.editionStopwords, simplified, c.simplified)
+		}
+	}
+}
+
+func TestParseReleaseDate(t *testing.T) {
+	cases := []struct {
+		releaseDate string
+		ok          bool
+		expected    time.Time
+	}{
+		{"1971-11-08", true, time.Date(1971, 11, 8, 0, 0, 0, 0, time.UTC)},
+		{"1971-11", true, time.Date(1971, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"1971", true, time.Date(1971, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"", false, time.Time{}},
+		{"Nov 1971", false, time.Time{}},
+	}
+
+	for _, c := range cases {
+		parsed, ok := parseReleaseDate(c.releaseDate)
+		if ok != c.ok {
+			t.Fatalf("[%s] parse result not correct: (%v) != (%v)", c.releaseDate, ok, c.ok)
+		} else if parsed.Equal(c.expected) == false {
+			t.Fatalf("[%s] parsed date not correct: [%s] != [%s]", c.releaseDate, parsed, c.expected)
+		}
+	}
+}
+
+func TestGetSpotifyAlbumId_PreferEarliestAlbum(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+
+	// Spotify lists the reissue first.
+	fsc.addAlbum("artist1", "reissue", "Classic", "album", "2011-05-01", "Song")
+	fsc.addAlbum("artist1", "undated", "Classic", "album", "", "Song")
+	fsc.addAlbum("artist1", "original", "Classic", "album", "1971", "Song")
+
+	for _, preferEarliestAlbum := range []bool{false, true} {
+		sa := newTestSpotifyAdapter(fsc)
+		sa.SetPreferEarliestAlbum(preferEarliestAlbum)
+
+		id, err := sa.getSpotifyAlbumId("artist1", "classic", "", false, false)
+		if err != nil {
+			t.Fatalf("Album not found (%v): %s", preferEarliestAlbum, err)
+		}
+
+		expected := spotify.ID("reissue")
+		if preferEarliestAlbum == true {
+			expected = "original"
+		}
+
+		if id != expected {
+			t.Fatalf("Wrong album chosen (%v): [%s] != [%s]", preferEarliestAlbum, id, expected)
+		}
+	}
+}
+
+func TestGetSpotifyTrackIdsWithNames_MatchStrategyOrder(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+
+	// The track is both on an album and on a single of the same name.
+	fsc.addAlbum("artist1", "hit-album", "Hit", "album", "1990", "Hit", "B-Side")
+	fsc.addAlbum("artist1", "hit-single", "Hit", "single", "1990", "Hit")
+
+	cases := []struct {
+		matchStrategies []string
+		expectedId      spotify.ID
+		expectedMethod  string
+	}{
+		{[]string{MatchMethodStrictAlbum, MatchMethodSingle}, "hit-album-1", MatchMethodStrictAlbum},
+		{[]string{MatchMethodSingle, MatchMethodStrictAlbum}, "hit-single-1", MatchMethodSingle},
+	}
+
+	for _, c := range cases {
+		sa := newTestSpotifyAdapter(fsc)
+		sa.SetMatchStrategies(c.matchStrategies)
+
+		foundTracks, missingTracks, matchMethods, err := sa.GetSpotifyTrackIdsWithNames("The Band", "Hit", []string{"hit"}, "")
+		if err != nil {
+			t.Fatalf("Could not match %v: %s", c.matchStrategies, err)
+		} else if len(missingTracks) != 0 {
+			t.Fatalf("Track not matched %v: %v", c.matchStrategies, missingTracks)
+		} else if len(foundTracks) != 1 {
+			t.Fatalf("Expected exactly one match %v: %v", c.matchStrategies, foundTracks)
+		}
+
+		if _, found := foundTracks[c.expectedId]; found == false {
+			t.Fatalf("Wrong track matched %v: %v != [%s]", c.matchStrategies, foundTracks, c.expectedId)
+		} else if matchMethods[c.expectedId] != c.expectedMethod {
+			t.Fatalf("Match method not correct %v: [%s] != [%s]", c.matchStrategies, matchMethods[c.expectedId], c.expectedMethod)
+		}
+	}
+
+	// A track that only one strategy can find is missed without it.
+
+	sa := newTestSpotifyAdapter(fsc)
+	sa.SetMatchStrategies([]string{MatchMethodStrictAlbum})
+
+	_, _, _, err := sa.GetSpotifyTrackIdsWithNames("The Band", "Bootleg", []string{"hit"}, "")
+	if log.Is(err, ErrSpotifyAlbumNotFound) == false {
+		t.Fatalf("Track should not be found by strict-album alone: %v", err)
+	}
+
+	sa = newTestSpotifyAdapter(fsc)
+	sa.SetMatchStrategies([]string{MatchMethodStrictAlbum, MatchMethodSingle})
+
+	foundTracks, _, _, err := sa.GetSpotifyTrackIdsWithNames("The Band", "Bootleg", []string{"hit"}, "")
+	if err != nil {
+		t.Fatalf("Track should be found on the single: %s", err)
+	} else if _, found := foundTracks["hit-single-1"]; found == false {
+		t.Fatalf("Wrong track matched: %v", foundTracks)
+	}
+}
+
+func TestParseMatchStrategies(t *testing.T) {
+	matchStrategies, err := ParseMatchStrategies(" single, strict-album,single ,,TRACK-SEARCH")
+	if err != nil {
+		t.Fatalf("Could not parse strategies: %s", err)
+	}
+
+	expected := []string{MatchMethodSingle, MatchMethodStrictAlbum, MatchMethodTrackSearch}
+	if fmt.Sprintf("%v", matchStrategies) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("Strategies not correct: %v != %v", matchStrategies, expected)
+	}
+
+	for _, raw := range []string{"", ",", "strict-album,bogus"} {
+		_, err := ParseMatchStrategies(raw)
+		if log.Is(err, ErrInvalidMatchStrategy) == false {
+			t.Fatalf("[%s] should not be valid: %v", raw, err)
+		}
+	}
+}
+
+func TestGetSpotifyTrackIdsWithNames_SelfTitledSingle(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+	fsc.addAlbum("artist1", "album1", "First Album", "album", "1990", "Opener")
+
+	// The track is only on Spotify as a single named after it.
+	fsc.addAlbum("artist1", "single1", "Lead Single", "single", "1990", "Lead Single")
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	foundTracks, missingTracks, matchMethods, err := sa.GetSpotifyTrackIdsWithNames("The Band", "Second Album", []string{"lead single"}, "")
+	if err != nil {
+		t.Fatalf("Lookup failed: %s", err)
+	} else if len(missingTracks) != 0 {
+		t.Fatalf("Track missing: %v", missingTracks)
+	} else if _, found := foundTracks["single1-1"]; found == false {
+		t.Fatalf("Track not found on the single: %v", foundTracks)
+	} else if method := matchMethods["single1-1"]; method != MatchMethodSingle {
+		t.Fatalf("Match method not correct: [%s]", method)
+	}
+
+	// A single with some other name doesn't count (searching for the track
+	// would find it on the album, so don't).
+
+	sa.SetMatchStrategies([]string{MatchMethodStrictAlbum, MatchMethodLiberalAlbum, MatchMethodSingle})
+
+	_, _, _, err = sa.GetSpotifyTrackIdsWithNames("The Band", "Second Album", []string{"opener"}, "")
+	if log.Is(err, ErrSpotifyAlbumNotFound) == false {
+		t.Fatalf("Track should not be found on a single with a different name: %v", err)
+	}
+}
+
+func TestIsEqual_FoldVolumes(t *testing.T) {
+	sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+
+	variants := []string{
+		"Now That's What I Call Music, Vol. 5",
+		"Now That's What I Call Music, Volume 5",
+		"Now That's What I Call Music 5",
+		"Now That's What I Call Music! Vol. V",
+	}
+
+	cases := []struct {
+		foldVolumes     bool
+		doLiberalSearch bool
+		isEqual         bool
+	}{
+		{false, true, false},
+		{true, false, false},
+		{true, true, true},
+	}
+
+	for _, c := range cases {
+		sa.SetFoldVolumes(c.foldVolumes)
+
+		for _, a := range variants {
+			for _, b := range variants {
+				if a == b {
+					continue
+				}
+
+				isEqual, err := sa.isEqual("album", a, b, c.doLiberalSearch)
+				if err != nil {
+					t.Fatalf("Could not compare: %s", err)
+				} else if isEqual != c.isEqual {
+					t.Fatalf("[%s] [%s] equality not correct (fold=%v liberal=%v): (%v)", a, b, c.foldVolumes, c.doLiberalSearch, isEqual)
+				}
+			}
+		}
+	}
+
+	// Different volumes never match.
+
+	sa.SetFoldVolumes(true)
+
+	isEqual, err := sa.isEqual("album", "Now That's What I Call Music, Vol. 5", "Now That's What I Call Music, Volume 6", true)
+	if err != nil {
+		t.Fatalf("Could not compare: %s", err)
+	} else if isEqual != false {
+		t.Fatalf("Different volumes should not match.")
+	}
+
+	// Only album names are folded.
+
+	isEqual, err = sa.isEqual("track", "Part Vol. 2", "Part 2", true)
+	if err != nil {
+		t.Fatalf("Could not compare: %s", err)
+	} else if isEqual != false {
+		t.Fatalf("Track names should not have their volumes folded.")
+	}
+}
+
+func TestReadSpotifyPlaylist_ConcurrentPages(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+
+	// Enough for more pages than there are workers, with a partial last page.
+
+	trackIds := make([]spotify.ID, SpotifyReadBatchSize*(spotifyPlaylistReadConcurrency+1)+13)
+	for j, _ := range trackIds {
+		trackIds[j] = spotify.ID(fmt.Sprintf("track-%d", j))
+	}
+
+	fsc.addPlaylist("target", "Target", fsc.userId, trackIds...)
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	// Read it one page at a time.
+
+	sequential := make([]spotify.ID, 0)
+	for offset := 0; ; offset += SpotifyReadBatchSize {
+		ptp, err := sa.readSpotifyPlaylistPage("target", fsc.userId, "", offset)
+		if err != nil {
+			t.Fatalf("Could not read page at (%d): %s", offset, err)
+		} else if len(ptp.Tracks) == 0 {
+			break
+		}
+
+		for _, pt := range ptp.Tracks {
+			sequential = append(sequential, pt.Track.ID)
+		}
+	}
+
+	if reflect.DeepEqual(sequential, trackIds) != true {
+		t.Fatalf("Sequential read not correct: (%d) tracks", len(sequential))
+	}
+
+	calls := fsc.callCount("GetPlaylistTracksOpt")
+
+	concurrent, err := sa.ReadSpotifyPlaylist("target", fsc.userId, "")
+	if err != nil {
+		t.Fatalf("Could not read playlist: %s", err)
+	} else if reflect.DeepEqual(concurrent, sequential) != true {
+		t.Fatalf("Concurrent read does not match the sequential one: (%d) tracks", len(concurrent))
+	}
+
+	// Every page plus the check for more is read exactly once.
+
+	if fsc.callCount("GetPlaylistTracksOpt")-calls != calls {
+		t.Fatalf("Pages not read exactly once: (%d) != (%d)", fsc.callCount("GetPlaylistTracksOpt")-calls, calls)
+	}
+}
+
+func TestGetSpotifyPlaylistId_ExactPlaylistName(t *testing.T) {
+	cases := []struct {
+		exactPlaylistName bool
+		playlistName      string
+		expected          spotify.ID
+	}{
+		// Ignoring case, the first one listed wins.
+		{false, "Workout", "lower"},
+		{false, "WORKOUT", "lower"},
+
+		{true, "Workout", "upper"},
+		{true, "workout", "lower"},
+		{true, "WORKOUT", ""},
+	}
+
+	for _, c := range cases {
+		fsc := newFakeSpotifyClient()
+		fsc.addPlaylist("lower", "workout", fsc.userId)
+		fsc.addPlaylist("upper", "Workout", fsc.userId)
+
+		sc := NewSpotifyCache(context.Background(), newTestSpotifyContext(fsc))
+		sc.SetExactPlaylistName(c.exactPlaylistName)
+
+		id, err := sc.GetSpotifyPlaylistId(fsc.userId, c.playlistName)
+		if c.expected == "" {
+			if log.Is(err, ErrSpotifyPlaylistNotFound) != true {
+				t.Fatalf("Expected [%s] to not be found: [%v]", c.playlistName, err)
+			}
+
+			continue
+		} else if err != nil {
+			t.Fatalf("Could not get playlist [%s]: %s", c.playlistName, err)
+		} else if id != c.expected {
+			t.Fatalf("Playlist for [%s] (exact=%v) not correct: [%s] != [%s]", c.playlistName, c.exactPlaylistName, id, c.expected)
+		}
+	}
+}
+
+func TestStripTrackNumber(t *testing.T) {
+	cases := []struct {
+		name     string
+		stripped string
+	}{
+		{"01 - Intro", "Intro"},
+		{"1. Song", "Song"},
+
+		// Titles that are (or start with) numbers are left alone.
+		{"1979", "1979"},
+		{"99 Luftballons", "99 Luftballons"},
+		{"Intro", "Intro"},
+	}
+
+	for _, c := range cases {
+		stripped := stripTrackNumber(c.name)
+		if stripped != c.stripped {
+			t.Fatalf("[%s] not stripped correctly: [%s] != [%s]", c.name, stripped, c.stripped)
+		}
+	}
+}
+
+func TestNormalizeTitle_StripTrackNumbers(t *testing.T) {
+	sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+
+	cases := []struct {
+		stripTrackNumbers bool
+		name              string
+		normalized        string
+	}{
+		{false, "01 - Intro", "01 intro"},
+		{true, "01 - Intro", "intro"},
+		{false, "1979", "1979"},
+		{true, "1979", "1979"},
+	}
+
+	for _, c := range cases {
+		sa.SetStripTrackNumbers(c.stripTrackNumbers)
+
+		normalized := sa.normalizeTitle(c.name)
+		if normalized != c.normalized {
+			t.Fatalf("[%s] (strip=%v) not normalized correctly: [%s] != [%s]", c.name, c.stripTrackNumbers, normalized, c.normalized)
+		}
+	}
+}
+
+func TestFindSpotifyPlaylistByNameContains(t *testing.T) {
+	cases := []struct {
+		substring         string
+		exactPlaylistName bool
+		expected          spotify.ID
+		expectedErr       error
+	}{
+		{"WORK", false, "workout", nil},
+		{"mix", false, "", ErrSpotifyPlaylistAmbiguous},
+		{"Mix", true, "road-mix", nil},
+		{"jazz", false, "", ErrSpotifyPlaylistNotFound},
+	}
+
+	for _, c := range cases {
+		fsc := newFakeSpotifyClient()
+		fsc.addPlaylist("workout", "Workout Tunes", fsc.userId)
+		fsc.addPlaylist("party-mix", "party mix", fsc.userId)
+		fsc.addPlaylist("road-mix", "Road Trip Mix", fsc.userId)
+
+		// Make sure that every page of playlists is looked at.
+		fsc.playlistPageSize = 1
+
+		sc := NewSpotifyCache(context.Background(), newTestSpotifyContext(fsc))
+		sc.SetExactPlaylistName(c.exactPlaylistName)
+
+		p, err := sc.FindSpotifyPlaylistByNameContains(fsc.userId, c.substring)
+		if c.expectedErr != nil {
+			if log.Is(err, c.expectedErr) != true {
+				t.Fatalf("[%s] Expected error [%s]: [%v]", c.substring, c.expectedErr, err)
+			}
+
+			continue
+		} else if err != nil {
+			t.Fatalf("[%s] Could not find playlist: %s", c.substring, err)
+		} else if p.ID != c.expected {
+			t.Fatalf("[%s] Playlist not correct: [%s] != [%s]", c.substring, p.ID, c.expected)
+		}
+	}
+}
+
+func TestReadSpotifyPlaylist_LocalTrack(t *testing.T) {
+	fsc := newTestCatalog()
+
+	// Local files (and tracks that were removed from Spotify) don't have an
+	// ID.
+	fsc.addPlaylist("mixed", "Mixed", fsc.userId, "album1-1", "", "album1-2")
+
+	pts := fsc.playlistTracks["mixed"]
+	pts[1].Track.Name = "My Home Recording"
+
+	if _, unresolvedCount := withoutUnresolvedTracks(pts); unresolvedCount != 1 {
+		t.Fatalf("Unresolved count not correct: (%d)", unresolvedCount)
+	}
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	ids, err := sa.ReadSpotifyPlaylist("mixed", fsc.userId, "")
+	if err != nil {
+		t.Fatalf("Could not read playlist: %s", err)
+	} else if reflect.DeepEqual(ids, []spotify.ID{"album1-1", "album1-2"}) != true {
+		t.Fatalf("Local track should have been skipped: %v", ids)
+	}
+
+	tracks, err := sa.ReadSpotifyPlaylistInfo("mixed", fsc.userId, "")
+	if err != nil {
+		t.Fatalf("Could not read playlist info: %s", err)
+	} else if _, found := tracks[""]; found == true || len(tracks) != 2 {
+		t.Fatalf("Local track should not be indexed: %v", tracks)
+	}
+}
+
+func TestIsArtistMatch_FoldDiacritics(t *testing.T) {
+	sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+
+	// Strict so that the loose comparison doesn't hide the difference.
+	sa.SetStrictArtist(true)
+
+	pairs := [][2]string{
+		{"Motörhead", "motorhead"},
+		{"Beyoncé", "beyonce"},
+		{"Sigur Rós", "sigur ros"},
+		{"Mötley Crüe", "motley crue"},
+	}
+
+	for _, foldDiacritics := range []bool{false, true} {
+		sa.SetFoldDiacritics(foldDiacritics)
+
+		for _, pair := range pairs {
+			if sa.isArtistMatch(pair[0], pair[1]) != foldDiacritics {
+				t.Fatalf("[%s] [%s] match not correct (fold=%v).", pair[0], pair[1], foldDiacritics)
+			}
+
+			// The same accents always match.
+			if sa.isArtistMatch(pair[0], strings.ToLower(pair[0])) != true {
+				t.Fatalf("[%s] should always match itself (fold=%v).", pair[0], foldDiacritics)
+			}
+		}
+	}
+}
+
+func TestRemoveRemasterSuffix(t *testing.T) {
+	sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+
+	cases := []struct {
+		title    string
+		expected string
+	}{
+		{"Song - Remastered 2009", "song"},
+		{"Song (2011 Remaster)", "song"},
+		{"Song (2011 Digital Remaster)", "song"},
+		{"Song - Digitally Remastered", "song"},
+		{"Song - Remastered Version", "song"},
+		{"Song", "song"},
+		{"Remaster", "remaster"},
+		{"The Remaster Song", "the remaster song"},
+	}
+
+	for _, c := range cases {
+		actual := removeRemasterSuffix(sa.normalizeTitle(c.title))
+		if actual != c.expected {
+			t.Fatalf("Remaster suffix for [%s] not removed correctly: [%s] != [%s]", c.title, actual, c.expected)
+		}
+	}
+}
+
+func TestFindRemasteredTrack(t *testing.T) {
+	tracks := map[string]spotify.ID{
+		"opener remastered 2009": "remaster-1",
+		"opener 2011 remaster":   "remaster-2",
+		"closer":                 "closer",
+	}
+
+	cases := []struct {
+		name     string
+		expected spotify.ID
+		found    bool
+	}{
+		// The first by name is used if more than one matches.
+		{"opener", "remaster-2", true},
+
+		// The favorite can be the remaster, too.
+		{"closer remastered", "closer", true},
+
+		{"missing", "", false},
+	}
+
+	for _, c := range cases {
+		id, found := findRemasteredTrack(c.name, tracks)
+		if found != c.found || id != c.expected {
+			t.Fatalf("Remastered track for [%s] not correct: [%s] (%v)", c.name, id, found)
+		}
+	}
+}
+
+func TestParseAlbumTypes(t *testing.T) {
+	albumTypes, err := ParseAlbumTypes(" single, ALBUM,single ,,compilation")
+	if err != nil {
+		t.Fatalf("Could not parse album types: %s", err)
+	}
+
+	expected := []spotify.AlbumType{spotify.AlbumTypeSingle, spotify.AlbumTypeAlbum, spotify.AlbumTypeCompilation}
+	if reflect.DeepEqual(albumTypes, expected) != true {
+		t.Fatalf("Album types not correct: %v != %v", albumTypes, expected)
+	}
+
+	for _, raw := range []string{"", ",", "album,bogus"} {
+		_, err := ParseAlbumTypes(raw)
+		if log.Is(err, ErrInvalidAlbumType) == false {
+			t.Fatalf("[%s] should not be valid: %v", raw, err)
+		}
+	}
+}
+
+func TestGetSpotifyAlbumId_AlbumTypes(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+
+	// The single is listed first and has the same name as the album.
+	fsc.addAlbum("artist1", "single1", "The Band", "single", "1990", "Song")
+	fsc.addAlbum("artist1", "album1", "The Band", "album", "1990", "Song", "Other Song")
+	fsc.addAlbum("artist1", "single2", "B-Side", "single", "1991", "B-Side")
+
+	cases := []struct {
+		albumTypes []spotify.AlbumType
+		name       string
+		expected   spotify.ID
+	}{
+		// Only albums are looked at by default.
+		{nil, "the band", "album1"},
+		{nil, "b-side", ""},
+
+		{[]spotify.AlbumType{spotify.AlbumTypeAlbum, spotify.AlbumTypeSingle}, "the band", "album1"},
+		{[]spotify.AlbumType{spotify.AlbumTypeSingle, spotify.AlbumTypeAlbum}, "the band", "single1"},
+		{[]spotify.AlbumType{spotify.AlbumTypeAlbum, spotify.AlbumTypeSingle}, "b-side", "single2"},
+	}
+
+	for _, c := range cases {
+		sa := newTestSpotifyAdapter(fsc)
+		sa.SetAlbumTypes(c.albumTypes)
+
+		id, err := sa.getSpotifyAlbumId("artist1", c.name, "", false, false)
+		if c.expected == "" {
+			if log.Is(err, ErrSpotifyAlbumNotFound) != true {
+				t.Fatalf("Expected [%s] to not be found %v: [%s] [%v]", c.name, c.albumTypes, id, err)
+			}
+
+			continue
+		} else if err != nil {
+			t.Fatalf("Album [%s] not found %v: %s", c.name, c.albumTypes, err)
+		}
+
+		if id != c.expected {
+			t.Fatalf("Wrong album chosen for [%s] %v: [%s] != [%s]", c.name, c.albumTypes, id, c.expected)
+		}
+	}
+}
+
+func TestIsEqual_FeaturedArtists(t *testing.T) {
+	sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+
+	cases := []struct {
+		arg1    string
+		arg2    string
+		isEqual bool
+	}{
+		{"Song (feat. Drake)", "Song", true},
+		{"Song ft. Drake", "Song (with Drake)", true},
+		{"Song [Featuring Drake]", "song", true},
+		{"Song (feat. Drake)", "Other Song", false},
+	}
+
+	for _, c := range cases {
+		for _, doLiberalSearch := range []bool{false, true} {
+			isEqual, err := sa.isEqual("track", c.arg1, c.arg2, doLiberalSearch)
+			if err != nil {
+				t.Fatalf("Could not compare [%s] and [%s]: %s", c.arg1, c.arg2, err)
+			} else if isEqual != c.isEqual {
+				t.Fatalf("Comparison of [%s] and [%s] (%v) not correct: (%v)", c.arg1, c.arg2, doLiberalSearch, isEqual)
+			}
+		}
+	}
+
+	if sa.artistNameKey("Drake ft. Rihanna") != sa.artistNameKey("Drake") {
+		t.Fatalf("Featured artists should be ignored in artist names.")
+	}
+}
+
+func TestGetSpotifyTrackIdsWithNames_FeaturedArtists(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addArtist("artist1", "The Band")
+	fsc.addAlbum("artist1", "album1", "First Album", "album", "1990", "Opener (feat. Drake)", "Closer")
+
+	sa := newTestSpotifyAdapter(fsc)
+
+	foundTracks, missingTracks, _, err := sa.GetSpotifyTrackIdsWithNames("The Band feat. Drake", "First Album", []string{"opener", "closer ft. rihanna"}, "")
+	if err != nil {
+		t.Fatalf("Lookup failed: %s", err)
+	} else if len(missingTracks) != 0 {
+		t.Fatalf("Tracks missing: %v", missingTracks)
+	} else if len(foundTracks) != 2 {
+		t.Fatalf("Tracks not found: %v", foundTracks)
+	}
+}
+
+func TestRemoveSuffixClause(t *testing.T) {
+	sa := newTestSpotifyAdapter(newFakeSpotifyClient())
+
+	cases := []struct {
+		arg       string
+		distilled string
+	}{
+		{"", ""},
+		{")", ")"},
+		{"()", "()"},
+		{"(Remastered)", "(Remastered)"},
+		{"Song", "Song"},
+		{"Song (Live)", "Song"},
+		{"Song(Live)", "Song"},
+		{"  Song (Live)   ", "Song"},
+		{"Song (Live) (Remastered)", "Song (Live)"},
+		{"Song (Live (Remastered))", "Song"},
+		{"Song Live)", "Song Live)"},
+		{"Song (Live))", "Song (Live))"},
+		{"Song [Live]", "Song [Live]"},
+	}
+
+	for _, c := range cases {
+		distilled := sa.removeSuffixClause(c.arg, "(", ")")
+		if distilled != c.distilled {
+			t.Fatalf("Clause not removed from [%s] correctly: [%s] != [%s]", c.arg, distilled, c.distilled)
+		}
+	}
+}
+
+func TestGetSpotifyPlaylistId_Pages(t *testing.T) {
+	cases := []struct {
+		playlistName string
+		expected     spotify.ID
+		calls        int
+	}{
+		// The pages stop being read once there's a match.
+		{"playlist 1", "playlist1", 1},
+		{"playlist 4", "playlist4", 2},
+
+		// Every page is read (until an empty one) to find one on the last.
+		{"playlist 6", "playlist6", 3},
+		{"missing", "", 4},
+	}
+
+	for _, c := range cases {
+		fsc := newFakeSpotifyClient()
+		fsc.playlistPageSize = 2
+
+		for j := 1; j <= 6; j++ {
+			fsc.addPlaylist(spotify.ID(fmt.Sprintf("playlist%d", j)), fmt.Sprintf("Playlist %d", j), fsc.userId)
+		}
+
+		sc := NewSpotifyCache(context.Background(), newTestSpotifyContext(fsc))
+
+		id, err := sc.GetSpotifyPlaylistId(fsc.userId, c.playlistName)
+		if c.expected == "" {
+			if log.Is(err, ErrSpotifyPlaylistNotFound) != true {
+				t.Fatalf("Expected [%s] to not be found: [%v]", c.playlistName, err)
+			}
+		} else if err != nil {
+			t.Fatalf("Could not get playlist [%s]: %s", c.playlistName, err)
+		} else if id != c.expected {
+			t.Fatalf("Playlist for [%s] not correct: [%s] != [%s]", c.playlistName, id, c.expected)
+		}
+
+		if calls := fsc.callCount("GetPlaylistsForUserOpt"); calls != c.calls {
+			t.Fatalf("Pages read for [%s] not correct: (%d) != (%d)", c.playlistName, calls, c.calls)
+		}
+	}
+}
+
+func TestCheckSpotifyPlaylistWritable(t *testing.T) {
+	cases := []struct {
+		playlistId     spotify.ID
+		userIdOverride string
+		writable       bool
+	}{
+		{"mine", "", true},
+		{"shared", "", true},
+		{"followed", "", false},
+
+		// We only warn if we were told which user to operate on.
+		{"followed", "family", true},
+
+		// We can't tell for a playlist that isn't listed.
+		{"unlisted", "", true},
+	}
+
+	for _, c := range cases {
+		fsc := newFakeSpotifyClient()
+		fsc.addPlaylist("mine", "Mine", fsc.userId)
+		fsc.addPlaylist("shared", "Shared", "family")
+		fsc.addPlaylist("followed", "Followed", "family")
+
+		fsc.playlists[1].Collaborative = true
+
+		sc := NewSpotifyCache(context.Background(), newTestSpotifyContext(fsc))
+		sc.SetUserIdOverride(c.userIdOverride)
+
+		err := sc.CheckSpotifyPlaylistWritable(fsc.userId, c.playlistId)
+		if c.writable == true && err != nil {
+			t.Fatalf("Playlist [%s] should be writable (%s): %s", c.playlistId, c.userIdOverride, err)
+		} else if c.writable == false && log.Is(err, ErrSpotifyPlaylistNotWritable) == false {
+			t.Fatalf("Playlist [%s] should not be writable (%s): %v", c.playlistId, c.userIdOverride, err)
+		}
+	}
+}
+
+func TestCheckSpotifyPlaylistWritable_Found(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addPlaylist("followed", "Followed", "family")
+
+	sc := NewSpotifyCache(context.Background(), newTestSpotifyContext(fsc))
+
+	// Finding a playlist that we can't change isn't an error since we might
+	// only be reading it.
+
+	id, err := sc.GetSpotifyPlaylistId(fsc.userId, "Followed")
+	if err != nil {
+		t.Fatalf("Could not get playlist: %s", err)
+	}
+
+	calls := fsc.callCount("GetPlaylistsForUserOpt")
+
+	err = sc.CheckSpotifyPlaylistWritable(fsc.userId, id)
+	if log.Is(err, ErrSpotifyPlaylistNotWritable) == false {
+		t.Fatalf("Playlist should not be writable: %v", err)
+	}
+
+	// The playlist we found isn't read again.
+	if fsc.callCount("GetPlaylistsForUserOpt") != calls {
+		t.Fatalf("Playlists read again.")
+	}
+}
+
+func TestCheckSpotifyPlaylistWritable_PlaylistIdOverride(t *testing.T) {
+	fsc := newFakeSpotifyClient()
+	fsc.addPlaylist("followed", "Followed", "family")
+
+	sc := NewSpotifyCache(context.Background(), newTestSpotifyContext(fsc))
+	sc.SetPlaylistIdOverride("followed")
+
+	id, err := sc.GetSpotifyPlaylistId(fsc.userId, "followed")
+	if err != nil {
+		t.Fatalf("Could not get playlist: %s", err)
+	}
+
+	// The playlist given by ID is checked the same way as one found by name.
+	err = sc.CheckSpotifyPlaylistWritable(fsc.userId, id)
+	if log.Is(err, ErrSpotifyPlaylistNotWritable) == false {
+		t.Fatalf("Playlist given by ID should not be writable: %v", err)
+	}
+}
@@ -0,0 +1,176 @@
+package gnsssync
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"net/http"
+
+	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// Config
+const (
+	// tokenRefreshMinInterval is the least time between refreshes that we do
+	// because Spotify rejected the token. If a call is still rejected right
+	// after a refresh then the token was probably revoked and refreshing again
+	// won't help.
+	tokenRefreshMinInterval = time.Minute
+)
+
+// Errors
+var (
+	ErrSpotifyTokenNotRefreshable = fmt.Errorf("spotify token has no refresh token")
+)
+
+// Misc
+var (
+	tkLog = log.NewLogger("gnss.spotify_token")
+)
+
+// refreshingTokenSource provides the current token, refreshing it when it
+// expires or when Spotify no longer accepts it.
+type refreshingTokenSource struct {
+	ctx context.Context
+	oc  *oauth2.Config
+
+	m               sync.Mutex
+	t               *oauth2.Token
+	lastRejectionAt time.Time
+}
+
+func newRefreshingTokenSource(ctx context.Context, oc *oauth2.Config, t *oauth2.Token) *refreshingTokenSource {
+	return &refreshingTokenSource{
+		ctx: ctx,
+		oc:  oc,
+		t:   t,
+	}
+}
+
+// Token returns the current token, refreshing it first if it has expired.
+func (rts *refreshingTokenSource) Token() (t *oauth2.Token, err error) {
+	rts.m.Lock()
+	defer rts.m.Unlock()
+
+	if rts.t.Valid() == true {
+		return rts.t, nil
+	}
+
+	return rts.refresh()
+}
+
+// refresh gets a new token using the refresh token. The lock must be held.
+func (rts *refreshingTokenSource) refresh() (t *oauth2.Token, err error) {
+	if rts.t.RefreshToken == "" {
+		return nil, ErrSpotifyTokenNotRefreshable
+	}
+
+	tkLog.Debugf(rts.ctx, "Refreshing Spotify token.")
+
+	// Leaving out the access token forces the refresh.
+	expired := &oauth2.Token{
+		RefreshToken: rts.t.RefreshToken,
+	}
+
+	t, err = rts.oc.TokenSource(rts.ctx, expired).Token()
+	if err != nil {
+		return nil, err
+	}
+
+	// Spotify doesn't always send a new refresh token.
+	if t.RefreshToken == "" {
+		t.RefreshToken = rts.t.RefreshToken
+	}
+
+	rts.t = t
+
+	return t, nil
+}
+
+// refreshRejected refreshes the token because Spotify rejected it (even
+// though it hadn't expired yet). This returns false if the token can't or
+// shouldn't be refreshed again.
+func (rts *refreshingTokenSource) refreshRejected(rejected *oauth2.Token) (refreshed bool, err error) {
+	rts.m.Lock()
+	defer rts.m.Unlock()
+
+	// Another call might have already refreshed it.
+	if rts.t.AccessToken != rejected.AccessToken {
+		return true, nil
+	}
+
+	if time.Since(rts.lastRejectionAt) < tokenRefreshMinInterval {
+		return false, nil
+	}
+
+	rts.lastRejectionAt = time.Now()
+
+	if _, err := rts.refresh(); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// tokenRefreshTransport authorizes the requests with the current token. If
+// Spotify rejects the token, it's refreshed and the request is sent one more
+// time.
+type tokenRefreshTransport struct {
+	rts  *refreshingTokenSource
+	base http.RoundTripper
+}
+
+func (trt *tokenRefreshTransport) send(r *http.Request, t *oauth2.Token, isRetry bool) (response *http.Response, err error) {
+	authorized := r.Clone(r.Context())
+
+	if isRetry == true && r.GetBody != nil {
+		authorized.Body, err = r.GetBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	t.SetAuthHeader(authorized)
+
+	return trt.base.RoundTrip(authorized)
+}
+
+func (trt *tokenRefreshTransport) RoundTrip(r *http.Request) (response *http.Response, err error) {
+	t, err := trt.rts.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	response, err = trt.send(r, t, false)
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err
+	}
+
+	// We can only send it again if we can get another copy of the body.
+	if r.Body != nil && r.Body != http.NoBody && r.GetBody == nil {
+		return response, nil
+	}
+
+	refreshed, err := trt.rts.refreshRejected(t)
+	if err != nil {
+		tkLog.Warningf(nil, "Spotify rejected the token and it could not be refreshed: %s", err)
+		return response, nil
+	} else if refreshed == false {
+		return response, nil
+	}
+
+	t, err = trt.rts.Token()
+	if err != nil {
+		return response, nil
+	}
+
+	tkLog.Infof(nil, "Spotify rejected the token. Retrying with a refreshed one: [%s] [%s]", r.Method, r.URL.Path)
+
+	response.Body.Close()
+
+	return trt.send(r, t, true)
+}
@@ -0,0 +1,111 @@
+package gnsssync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// Config
+const (
+	// StateSchemaVersion is the version of the state-directory layout. This
+	// is incremented whenever a file in it changes incompatibly.
+	StateSchemaVersion = 1
+
+	stateFilename            = "state.json"
+	stateLedgerFilename      = "ledger.json"
+	stateMissingFilename     = "missing.json"
+	stateSearchCacheFilename = "search-cache.json"
+)
+
+// Errors
+var (
+	ErrStateSchemaUnsupported = fmt.Errorf("state directory was written by a newer version")
+)
+
+// Misc
+var (
+	stLog = log.NewLogger("gnss.state")
+)
+
+// stateInfo is the on-disk description of the state directory.
+type stateInfo struct {
+	SchemaVersion int `json:"schema_version"`
+}
+
+// StateDir is a directory that houses all of the files that we persist
+// between runs (the ledger, the missing report, and the search cache) in a
+// consistent layout.
+type StateDir struct {
+	path string
+}
+
+// OpenStateDir opens the state directory at the given path, creating it if it
+// doesn't exist yet.
+func OpenStateDir(stateDirPath string) (sd *StateDir, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	err = os.MkdirAll(stateDirPath, 0755)
+	log.PanicIf(err)
+
+	sd = &StateDir{
+		path: stateDirPath,
+	}
+
+	stateFilepath := path.Join(stateDirPath, stateFilename)
+
+	f, err := os.Open(stateFilepath)
+	if os.IsNotExist(err) == true {
+		f, err := os.Create(stateFilepath)
+		log.PanicIf(err)
+
+		defer f.Close()
+
+		si := stateInfo{
+			SchemaVersion: StateSchemaVersion,
+		}
+
+		err = json.NewEncoder(f).Encode(si)
+		log.PanicIf(err)
+
+		return sd, nil
+	} else if err != nil {
+		log.Panic(err)
+	}
+
+	defer f.Close()
+
+	si := stateInfo{}
+
+	err = json.NewDecoder(f).Decode(&si)
+	log.PanicIf(err)
+
+	if si.SchemaVersion > StateSchemaVersion {
+		stLog.Warningf(nil, "State directory [%s] has schema version (%d) but we only support (%d).", stateDirPath, si.SchemaVersion, StateSchemaVersion)
+		log.Panic(ErrStateSchemaUnsupported)
+	}
+
+	return sd, nil
+}
+
+// LedgerFilepath returns the path of the ledger.
+func (sd *StateDir) LedgerFilepath() string {
+	return path.Join(sd.path, stateLedgerFilename)
+}
+
+// MissingReportFilepath returns the path of the missing report.
+func (sd *StateDir) MissingReportFilepath() string {
+	return path.Join(sd.path, stateMissingFilename)
+}
+
+// SearchCacheFilepath returns the path of the search cache.
+func (sd *StateDir) SearchCacheFilepath() string {
+	return path.Join(sd.path, stateSearchCacheFilename)
+}
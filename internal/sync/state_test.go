@@ -0,0 +1,124 @@
+package gnsssync
+
+import (
+	"reflect"
+	"testing"
+
+	"io/ioutil"
+	"path"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+func TestStateDir_RoundTrip(t *testing.T) {
+	stateDirPath := path.Join(t.TempDir(), "state")
+
+	sd, err := OpenStateDir(stateDirPath)
+	if err != nil {
+		t.Fatalf("Could not create state directory: %s", err)
+	}
+
+	l, err := LoadLedger(sd.LedgerFilepath())
+	if err != nil {
+		t.Fatalf("Could not load ledger: %s", err)
+	}
+
+	err = l.Append("playlist1", []spotify.ID{"track1", "track2"})
+	if err != nil {
+		t.Fatalf("Could not append to ledger: %s", err)
+	}
+
+	missingTracks := []*MissingTrack{
+		{
+			NormalizedTrack: NormalizedTrack{ArtistName: "The Band", AlbumName: "Demos", TrackName: "Demo 1"},
+			Reason:          MissingReasonAlbumNotFound,
+		},
+	}
+
+	err = WriteMissingReport(sd.MissingReportFilepath(), missingTracks)
+	if err != nil {
+		t.Fatalf("Could not write missing report: %s", err)
+	}
+
+	c := newSearchCache()
+	c.setArtists("the band", []spotify.ID{"artist1"})
+
+	err = c.save(sd.SearchCacheFilepath())
+	if err != nil {
+		t.Fatalf("Could not save search cache: %s", err)
+	}
+
+	// Everything should be in the one directory.
+
+	fis, err := ioutil.ReadDir(stateDirPath)
+	if err != nil {
+		t.Fatalf("Could not list state directory: %s", err)
+	}
+
+	names := make([]string, len(fis))
+	for j, fi := range fis {
+		names[j] = fi.Name()
+	}
+
+	expectedNames := []string{"ledger.json", "missing.json", "search-cache.json", "state.json"}
+	if reflect.DeepEqual(names, expectedNames) == false {
+		t.Fatalf("State directory not laid out correctly: %v", names)
+	}
+
+	// Reopen it and read everything back.
+
+	sd, err = OpenStateDir(stateDirPath)
+	if err != nil {
+		t.Fatalf("Could not reopen state directory: %s", err)
+	}
+
+	recoveredLedger, err := LoadLedger(sd.LedgerFilepath())
+	if err != nil {
+		t.Fatalf("Could not reload ledger: %s", err)
+	} else if active := recoveredLedger.Active("playlist1"); reflect.DeepEqual(active, []spotify.ID{"track1", "track2"}) == false {
+		t.Fatalf("Ledger not recovered: %v", active)
+	}
+
+	recoveredMissing, err := ReadMissingReport(sd.MissingReportFilepath())
+	if err != nil {
+		t.Fatalf("Could not read missing report: %s", err)
+	} else if len(recoveredMissing) != 1 || recoveredMissing[0].TrackName != "Demo 1" || recoveredMissing[0].Reason != MissingReasonAlbumNotFound {
+		t.Fatalf("Missing report not recovered: %v", recoveredMissing)
+	}
+
+	recoveredCache := newSearchCache()
+
+	err = recoveredCache.load(sd.SearchCacheFilepath())
+	if err != nil {
+		t.Fatalf("Could not load search cache: %s", err)
+	} else if ids, found := recoveredCache.getArtists("the band"); found == false || reflect.DeepEqual(ids, []spotify.ID{"artist1"}) == false {
+		t.Fatalf("Search cache not recovered: %v", ids)
+	}
+}
+
+func TestOpenStateDir_NewerSchema(t *testing.T) {
+	stateDirPath := t.TempDir()
+
+	err := ioutil.WriteFile(path.Join(stateDirPath, "state.json"), []byte(`{"schema_version":99}`), 0644)
+	if err != nil {
+		t.Fatalf("Could not write state file: %s", err)
+	}
+
+	_, err = OpenStateDir(stateDirPath)
+	if log.Is(err, ErrStateSchemaUnsupported) == false {
+		t.Fatalf("Newer schema should not be accepted: %v", err)
+	}
+
+	// An older (or the same) schema is fine.
+
+	err = ioutil.WriteFile(path.Join(stateDirPath, "state.json"), []byte(`{"schema_version":1}`), 0644)
+	if err != nil {
+		t.Fatalf("Could not rewrite state file: %s", err)
+	}
+
+	_, err = OpenStateDir(stateDirPath)
+	if err != nil {
+		t.Fatalf("Current schema not accepted: %s", err)
+	}
+}
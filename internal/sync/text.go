@@ -0,0 +1,360 @@
+package gnsssync
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Config
+const (
+	// fuzzyNameMinContainedLength is the shortest that a name can be (ignoring
+	// spacing) and still loosely match a longer name that contains it.
+	fuzzyNameMinContainedLength = 4
+)
+
+// levenshteinDistance returns the number of single-character edits required
+// to turn one string into the other.
+func levenshteinDistance(a, b string) int {
+	ar := []rune(a)
+	br := []rune(b)
+
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(minInt(current[j-1]+1, previous[j]+1), previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(br)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+// isContainedName returns whether the words of the shorter name appear, in
+// order and next to each other, in the longer name (e.g. "beatles" in "the
+// beatles" but not "yes" in "yesterday's children"). Names that are too short
+// (e.g. "the") aren't considered to be contained in anything.
+func isContainedName(shorter, longer string) bool {
+	shorterWords := strings.Fields(shorter)
+	longerWords := strings.Fields(longer)
+
+	if len(shorterWords) == 0 || len(shorterWords) >= len(longerWords) {
+		return false
+	} else if len([]rune(strings.Join(shorterWords, ""))) < fuzzyNameMinContainedLength {
+		return false
+	}
+
+	for j := 0; j+len(shorterWords) <= len(longerWords); j++ {
+		matched := true
+		for k, word := range shorterWords {
+			if longerWords[j+k] != word {
+				matched = false
+				break
+			}
+		}
+
+		if matched == true {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isFuzzyNameMatch loosely compares two already-normalized names. They match
+// if they're equal once spacing is ignored, if the words of one appear in the
+// other, or if they're within a small edit-distance of each other relative to
+// their length.
+func isFuzzyNameMatch(a, b string) bool {
+	if isContainedName(a, b) == true || isContainedName(b, a) == true {
+		return true
+	}
+
+	a = strings.Replace(a, " ", "", -1)
+	b = strings.Replace(b, " ", "", -1)
+
+	if a == "" || b == "" {
+		return false
+	} else if a == b {
+		return true
+	}
+
+	maxDistance := len([]rune(a)) / 5
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	return levenshteinDistance(a, b) <= maxDistance
+}
+
+// volumeMarkers are the words that introduce a volume number in an album name.
+var volumeMarkers = map[string]bool{
+	"vol":    true,
+	"volume": true,
+	"v":      true,
+}
+
+var romanNumeralValues = map[rune]int{
+	'i': 1,
+	'v': 5,
+	'x': 10,
+	'l': 50,
+	'c': 100,
+}
+
+// parseVolumeNumber returns the value of the given (lower-case) arabic or
+// roman numeral.
+func parseVolumeNumber(word string) (value int, found bool) {
+	if word == "" {
+		return 0, false
+	}
+
+	if strings.Trim(word, "0123456789") == "" {
+		for _, r := range word {
+			value = value*10 + int(r-'0')
+		}
+
+		return value, true
+	}
+
+	previous := 0
+	for j := len(word) - 1; j >= 0; j-- {
+		current, found := romanNumeralValues[rune(word[j])]
+		if found == false {
+			return 0, false
+		}
+
+		if current < previous {
+			value -= current
+		} else {
+			value += current
+			previous = current
+		}
+	}
+
+	return value, true
+}
+
+// foldVolumeNumbers canonicalizes the volume notation in an already-normalized
+// album name so that "vol 5", "volume v", and a bare trailing "5" all become
+// "5". A bare roman numeral is only folded if it's the last word and longer
+// than one letter (so that "i" isn't mistaken for one).
+func foldVolumeNumbers(normalized string) string {
+	words := strings.Fields(normalized)
+	folded := make([]string, 0, len(words))
+
+	for j := 0; j < len(words); j++ {
+		word := words[j]
+
+		if volumeMarkers[word] == true && j+1 < len(words) {
+			if value, found := parseVolumeNumber(words[j+1]); found == true {
+				folded = append(folded, strconv.Itoa(value))
+				j++
+
+				continue
+			}
+		}
+
+		if strings.Trim(word, "0123456789") == "" || (j == len(words)-1 && len(word) > 1) {
+			if value, found := parseVolumeNumber(word); found == true {
+				folded = append(folded, strconv.Itoa(value))
+				continue
+			}
+		}
+
+		folded = append(folded, word)
+	}
+
+	return strings.Join(folded, " ")
+}
+
+// diacriticFolds are the plain letters for the accented Latin letters that
+// we're likely to see in names.
+var diacriticFolds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Ā': "A", 'Ă': "A", 'Ą': "A",
+	'æ': "ae", 'Æ': "AE",
+	'ç': "c", 'ć': "c", 'č': "c", 'Ç': "C", 'Ć': "C", 'Č': "C",
+	'ď': "d", 'đ': "d", 'ð': "d", 'Ď': "D", 'Đ': "D", 'Ð': "D",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ē': "E", 'Ė': "E", 'Ę': "E", 'Ě': "E",
+	'ğ': "g", 'Ğ': "G",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'ı': "i",
+	'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I", 'Ī': "I", 'İ': "I",
+	'ł': "l", 'Ł': "L",
+	'ñ': "n", 'ń': "n", 'ň': "n", 'Ñ': "N", 'Ń': "N", 'Ň': "N",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O", 'Ō': "O", 'Ő': "O",
+	'œ': "oe", 'Œ': "OE",
+	'ř': "r", 'Ř': "R",
+	'ś': "s", 'š': "s", 'ş': "s", 'Ś': "S", 'Š': "S", 'Ş': "S",
+	'ß': "ss",
+	'ť': "t", 'ţ': "t", 'Ť': "T", 'Ţ': "T",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ū': "U", 'Ů': "U", 'Ű': "U",
+	'ý': "y", 'ÿ': "y", 'Ý': "Y", 'Ÿ': "Y",
+	'ź': "z", 'ż': "z", 'ž': "z", 'Ź': "Z", 'Ż': "Z", 'Ž': "Z",
+}
+
+// foldDiacritics replaces the accented letters in the given string with their
+// plain counterparts (e.g. "Motörhead" becomes "Motorhead").
+func foldDiacritics(arg string) string {
+	var b strings.Builder
+
+	for _, r := range arg {
+		if replacement, found := diacriticFolds[r]; found == true {
+			b.WriteString(replacement)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// FeaturedArtistMarkers are the words that introduce featured artists in a
+// track title or artist name (e.g. "Song feat. Drake"). Each may be followed
+// by a period.
+var FeaturedArtistMarkers = []string{
+	"feat",
+	"ft",
+	"featuring",
+}
+
+// FeaturedArtistClauseMarkers also introduce featured artists but only when
+// they start a parenthetical/bracketed clause (e.g. "Song (with Drake)"). On
+// their own, they're too often just part of the title.
+var FeaturedArtistClauseMarkers = []string{
+	"with",
+}
+
+// markerPrefixLength returns the length of the marker (and any period after
+// it) that the given string starts with as a whole word, or zero if it
+// doesn't start with one of them.
+func markerPrefixLength(s string, markers []string) int {
+	for _, marker := range markers {
+		if len(s) < len(marker) || strings.EqualFold(s[:len(marker)], marker) == false {
+			continue
+		}
+
+		length := len(marker)
+		if strings.HasPrefix(s[length:], ".") == true {
+			length++
+		}
+
+		if length == len(s) || s[length] == ' ' {
+			return length
+		}
+	}
+
+	return 0
+}
+
+// splitArtistNames splits the names in a list of featured artists (e.g.
+// "drake, rihanna & future").
+func splitArtistNames(list string) (artistNames []string) {
+	artistNames = make([]string, 0)
+
+	list = strings.NewReplacer("&", ",", " and ", ",").Replace(list)
+	for _, artistName := range strings.Split(list, ",") {
+		artistName = strings.TrimSpace(artistName)
+		if artistName != "" {
+			artistNames = append(artistNames, artistName)
+		}
+	}
+
+	return artistNames
+}
+
+// splitFeaturedArtists removes the featured artists from the given track
+// title or artist name, whether they're in a clause (e.g. "Song (feat.
+// Drake)" or "Song [with Drake]") or just follow it (e.g. "Song ft. Drake"),
+// and returns them separately.
+func splitFeaturedArtists(arg string) (distilled string, featuredArtistNames []string) {
+	distilled = strings.TrimSpace(arg)
+	featuredArtistNames = make([]string, 0)
+
+	clauseMarkers := make([]string, 0, len(FeaturedArtistMarkers)+len(FeaturedArtistClauseMarkers))
+	clauseMarkers = append(clauseMarkers, FeaturedArtistMarkers...)
+	clauseMarkers = append(clauseMarkers, FeaturedArtistClauseMarkers...)
+
+	for i := 0; i < len(distilled); i++ {
+		var rightDelimiter string
+		switch distilled[i] {
+		case '(':
+			rightDelimiter = ")"
+		case '[':
+			rightDelimiter = "]"
+		default:
+			continue
+		}
+
+		j := strings.Index(distilled[i+1:], rightDelimiter)
+		if j == -1 {
+			continue
+		}
+
+		j += i + 1
+
+		clause := strings.TrimSpace(distilled[i+1 : j])
+
+		length := markerPrefixLength(clause, clauseMarkers)
+		if length == 0 {
+			continue
+		}
+
+		featuredArtistNames = append(featuredArtistNames, splitArtistNames(clause[length:])...)
+
+		distilled = strings.TrimSpace(strings.TrimSpace(distilled[:i]) + " " + strings.TrimSpace(distilled[j+1:]))
+		i = -1
+	}
+
+	// Never remove the first word so that we're always left with something.
+
+	for i := 1; i < len(distilled); i++ {
+		if distilled[i] != ' ' {
+			continue
+		}
+
+		rest := strings.TrimLeft(distilled[i:], " ")
+
+		length := markerPrefixLength(rest, FeaturedArtistMarkers)
+		if length == 0 {
+			continue
+		}
+
+		featuredArtistNames = append(featuredArtistNames, splitArtistNames(rest[length:])...)
+
+		return strings.TrimSpace(distilled[:i]), featuredArtistNames
+	}
+
+	return distilled, featuredArtistNames
+}
+
+// removeFeaturedArtists removes the featured artists from the given track
+// title or artist name (see splitFeaturedArtists).
+func removeFeaturedArtists(arg string) (distilled string) {
+	distilled, _ = splitFeaturedArtists(arg)
+	return distilled
+}
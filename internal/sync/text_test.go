@@ -0,0 +1,115 @@
+package gnsssync
+
+import (
+	"testing"
+)
+
+func TestIsFuzzyNameMatch(t *testing.T) {
+	cases := []struct {
+		a       string
+		b       string
+		isMatch bool
+	}{
+		{"the beatles", "the beatles", true},
+		{"thebeatles", "the beatles", true},
+		{"beatles", "the beatles", true},
+		{"the beatles", "beatles", true},
+		{"guns n roses", "guns n' roses", true},
+		{"jimi hendrix", "the jimi hendrix experience", true},
+
+		// Containment only counts for whole words and for names that aren't
+		// too short.
+		{"yes", "yesterday's children", false},
+		{"the", "the beatles", false},
+		{"abba", "abbalicious", false},
+		{"", "the beatles", false},
+		{"the beatles", "the rolling stones", false},
+	}
+
+	for _, c := range cases {
+		isMatch := isFuzzyNameMatch(c.a, c.b)
+		if isMatch != c.isMatch {
+			t.Fatalf("[%s] [%s] match not correct: (%v) != (%v)", c.a, c.b, isMatch, c.isMatch)
+		}
+	}
+}
+
+func TestFoldVolumeNumbers(t *testing.T) {
+	cases := []struct {
+		normalized string
+		folded     string
+	}{
+		{"now thats what i call music vol 5", "now thats what i call music 5"},
+		{"now thats what i call music volume 5", "now thats what i call music 5"},
+		{"now thats what i call music 5", "now thats what i call music 5"},
+		{"now thats what i call music vol v", "now thats what i call music 5"},
+		{"now thats what i call music volume iv", "now thats what i call music 4"},
+		{"now thats what i call music xii", "now thats what i call music 12"},
+		{"greatest hits vol 05", "greatest hits 5"},
+
+		// A lone "i" isn't a numeral, and neither is a word that only looks
+		// like one somewhere other than at the end.
+		{"i am", "i am"},
+		{"mix live", "mix live"},
+		{"songs vol", "songs vol"},
+	}
+
+	for _, c := range cases {
+		folded := foldVolumeNumbers(c.normalized)
+		if folded != c.folded {
+			t.Fatalf("[%s] not folded correctly: [%s] != [%s]", c.normalized, folded, c.folded)
+		}
+	}
+}
+
+func TestFoldDiacritics(t *testing.T) {
+	cases := []struct {
+		arg    string
+		folded string
+	}{
+		{"Motörhead", "Motorhead"},
+		{"Beyoncé", "Beyonce"},
+		{"Sigur Rós", "Sigur Ros"},
+		{"Mötley Crüe", "Motley Crue"},
+		{"The Band", "The Band"},
+	}
+
+	for _, c := range cases {
+		folded := foldDiacritics(c.arg)
+		if folded != c.folded {
+			t.Fatalf("[%s] not folded correctly: [%s] != [%s]", c.arg, folded, c.folded)
+		}
+	}
+}
+
+func TestRemoveFeaturedArtists(t *testing.T) {
+	cases := []struct {
+		arg       string
+		distilled string
+	}{
+		{"Song (feat. Drake)", "Song"},
+		{"Song [ft. Drake]", "Song"},
+		{"Song (Featuring Drake & Rihanna)", "Song"},
+		{"Song (with Drake)", "Song"},
+		{"Song (feat. Drake) (Remastered)", "Song (Remastered)"},
+		{"Song feat. Drake", "Song"},
+		{"Song ft Drake", "Song"},
+		{"Drake ft. Rihanna", "Drake"},
+
+		// "with" only counts at the start of a clause.
+		{"Dance With Me", "Dance With Me"},
+		{"Song (Live with Orchestra)", "Song (Live with Orchestra)"},
+
+		// The marker has to be a whole word, and the first word is kept.
+		{"Song (Featurette)", "Song (Featurette)"},
+		{"Feat Song", "Feat Song"},
+		{"Song (feat. Drake", "Song (feat. Drake"},
+	}
+
+	for _, c := range cases {
+		distilled := removeFeaturedArtists(c.arg)
+		if distilled != c.distilled {
+			t.Fatalf("Featured artists not removed from [%s] correctly: [%s] != [%s]", c.arg, distilled, c.distilled)
+		}
+	}
+}
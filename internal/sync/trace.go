@@ -0,0 +1,168 @@
+package gnsssync
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/dsoprea/go-logging"
+)
+
+// Config
+const (
+	// traceBodyLimit is how much of each response body we'll log.
+	traceBodyLimit = 1024
+)
+
+// Misc
+var (
+	tLog = log.NewLogger("gnss.http")
+
+	// redactedQueryParameters are the query parameters whose values will not
+	// be logged.
+	redactedQueryParameters = []string{
+		"apikey",
+		"api_key",
+		"access_token",
+		"refresh_token",
+		"client_secret",
+		"code",
+		"password",
+		"token",
+	}
+
+	// redactedHeaders are the headers whose values will not be logged.
+	redactedHeaders = []string{
+		"Authorization",
+		"Apikey",
+		"Cookie",
+		"Set-Cookie",
+	}
+
+	redactedBodyRx *regexp.Regexp
+)
+
+const (
+	redactedValue = "REDACTED"
+)
+
+// tracingTransport is an `http.RoundTripper` that logs each request and
+// response, with credentials redacted.
+type tracingTransport struct {
+	name string
+	base http.RoundTripper
+}
+
+// NewTracingTransport returns an `http.RoundTripper` that logs all traffic
+// passing through it before handing it to `base`.
+func NewTracingTransport(name string, base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &tracingTransport{
+		name: name,
+		base: base,
+	}
+}
+
+// RoundTrip logs at the info level. This transport is only installed when
+// tracing was asked for, so the traffic should be shown without also having
+// to turn up the logging.
+func (tt *tracingTransport) RoundTrip(r *http.Request) (response *http.Response, err error) {
+	tLog.Infof(nil, "%s: REQUEST: %s %s %s", tt.name, r.Method, redactUrl(r.URL), redactHeaders(r.Header))
+
+	response, err = tt.base.RoundTrip(r)
+	if err != nil {
+		tLog.Infof(nil, "%s: FAILED: %s %s: %s", tt.name, r.Method, redactUrl(r.URL), err)
+		return nil, err
+	}
+
+	// Read the start of the body and then put it back in front of the rest.
+
+	original := response.Body
+	head, _ := ioutil.ReadAll(io.LimitReader(original, traceBodyLimit+1))
+
+	response.Body = struct {
+		io.Reader
+		io.Closer
+	}{
+		Reader: io.MultiReader(bytes.NewReader(head), original),
+		Closer: original,
+	}
+
+	truncated := ""
+	if len(head) > traceBodyLimit {
+		head = head[:traceBodyLimit]
+		truncated = " (TRUNCATED)"
+	}
+
+	tLog.Infof(nil, "%s: RESPONSE: %s %s => (%d) %s BODY=[%s]%s", tt.name, r.Method, redactUrl(r.URL), response.StatusCode, redactHeaders(response.Header), redactBody(string(head)), truncated)
+
+	return response, nil
+}
+
+// redactUrl returns the URL as a string with any credentials removed.
+func redactUrl(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+
+	q := redacted.Query()
+	for key, _ := range q {
+		for _, sensitive := range redactedQueryParameters {
+			if strings.ToLower(key) == sensitive {
+				q.Set(key, redactedValue)
+				break
+			}
+		}
+	}
+
+	redacted.RawQuery = q.Encode()
+
+	return redacted.String()
+}
+
+// redactHeaders returns the headers as a string with any credentials
+// removed.
+func redactHeaders(h http.Header) string {
+	names := make([]string, 0, len(h))
+	for name, _ := range h {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	parts := make([]string, len(names))
+	for j, name := range names {
+		value := strings.Join(h[name], ",")
+
+		for _, sensitive := range redactedHeaders {
+			if http.CanonicalHeaderKey(name) == sensitive {
+				value = redactedValue
+				break
+			}
+		}
+
+		parts[j] = name + "=[" + value + "]"
+	}
+
+	return "HEADERS<" + strings.Join(parts, " ") + ">"
+}
+
+// redactBody removes tokens from a (JSON) body.
+func redactBody(body string) string {
+	return redactedBodyRx.ReplaceAllString(body, `"$1":"`+redactedValue+`"`)
+}
+
+func init() {
+	var err error
+
+	redactedBodyRx, err = regexp.Compile(`"(access_token|refresh_token|client_secret|password)"\s*:\s*"[^"]*"`)
+	log.PanicIf(err)
+}
@@ -0,0 +1,78 @@
+package gnsssync
+
+import (
+	"bufio"
+	"os"
+	"sort"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// Config
+const (
+	// spotifyTrackUriPrefix is what a track ID is prefixed with to make the
+	// URI that the Spotify apps understand.
+	spotifyTrackUriPrefix = "spotify:track:"
+)
+
+// TrackUri returns the Spotify URI for the given track.
+func TrackUri(id spotify.ID) string {
+	return spotifyTrackUriPrefix + string(id)
+}
+
+// sortedTrackIds returns the IDs of the given tracks ordered by artist, album,
+// and title.
+func sortedTrackIds(tracks map[spotify.ID]TrackInfo) []spotify.ID {
+	ids := make([]spotify.ID, 0, len(tracks))
+	for id, _ := range tracks {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(j, k int) bool {
+		a := tracks[ids[j]]
+		b := tracks[ids[k]]
+
+		if a.ArtistName != b.ArtistName {
+			return a.ArtistName < b.ArtistName
+		} else if a.AlbumName != b.AlbumName {
+			return a.AlbumName < b.AlbumName
+		} else if a.TitleName != b.TitleName {
+			return a.TitleName < b.TitleName
+		}
+
+		return ids[j] < ids[k]
+	})
+
+	return ids
+}
+
+// WriteTrackUris writes the URIs of the given tracks to a file, one per line
+// and ordered by artist, album, and title. This is the form that the Spotify
+// desktop app accepts when pasting into a playlist.
+func WriteTrackUris(filepath string, tracks map[spotify.ID]TrackInfo) (err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	ids := sortedTrackIds(tracks)
+
+	f, err := os.Create(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+
+	for _, id := range ids {
+		_, err := w.WriteString(TrackUri(id) + "\n")
+		log.PanicIf(err)
+	}
+
+	err = w.Flush()
+	log.PanicIf(err)
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package gnsssync
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"io/ioutil"
+	"path"
+
+	"github.com/zmb3/spotify"
+)
+
+func TestWriteTrackUris(t *testing.T) {
+	tracks := map[spotify.ID]TrackInfo{
+		"4uLU6hMCjMI75M1A2tKUQC": {ArtistName: "The Band", AlbumName: "Second Album", TitleName: "Deep Cut"},
+		"0eGsygTp906u18L0Oimnem": {ArtistName: "The Band", AlbumName: "First Album", TitleName: "Opener"},
+		"7GhIk7Il098yCjg4BQjzvb": {ArtistName: "Another Band", AlbumName: "Debut", TitleName: "Single"},
+	}
+
+	urisFilepath := path.Join(t.TempDir(), "tracks.txt")
+
+	err := WriteTrackUris(urisFilepath, tracks)
+	if err != nil {
+		t.Fatalf("Could not write URIs: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(urisFilepath)
+	if err != nil {
+		t.Fatalf("Could not read URIs: %s", err)
+	}
+
+	expected := `spotify:track:7GhIk7Il098yCjg4BQjzvb
+spotify:track:0eGsygTp906u18L0Oimnem
+spotify:track:4uLU6hMCjMI75M1A2tKUQC
+`
+
+	if string(data) != expected {
+		t.Fatalf("URIs not correct:\n%s", string(data))
+	}
+
+	// Every line is something that the desktop app will accept.
+
+	uriRx := regexp.MustCompile(`^spotify:track:[0-9A-Za-z]{22}$`)
+
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if uriRx.MatchString(line) != true {
+			t.Fatalf("Not a track URI: [%s]", line)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package gnsssync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"io/ioutil"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/zmb3/spotify"
+)
+
+// File kinds
+const (
+	FileKindFavorites     = "favorites"
+	FileKindMissingReport = "missing-report"
+	FileKindLedger        = "ledger"
+)
+
+// Config
+const (
+	// spotifyIdLength is how long every Spotify ID is.
+	spotifyIdLength = 22
+)
+
+// Errors
+var (
+	ErrFileKindUnknown = fmt.Errorf("file is not one that we write")
+)
+
+// Misc
+var (
+	missingReasons = map[string]bool{
+		MissingReasonArtistNotFound:  true,
+		MissingReasonAlbumNotFound:   true,
+		MissingReasonTrackNotFound:   true,
+		MissingReasonAlbumIncomplete: true,
+		MissingReasonUnplayable:      true,
+		MissingReasonDuration:        true,
+		MissingReasonLookupFailed:    true,
+	}
+)
+
+// isValidSpotifyId returns whether the given ID looks like a Spotify ID.
+func isValidSpotifyId(id spotify.ID) bool {
+	if len(id) != spotifyIdLength {
+		return false
+	}
+
+	for _, r := range id {
+		if (r < '0' || r > '9') && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ValidateFile checks a favorites snapshot, missing report, or ledger before
+// it's fed back in. The kind of file is determined from its contents. Any
+// problems are returned rather than failing; `err` is only set if the file
+// couldn't be read.
+func ValidateFile(filepath string) (kind string, problems []string, err error) {
+	defer func() {
+		if state := recover(); state != nil {
+			err = log.Wrap(state.(error))
+		}
+	}()
+
+	raw, err := ioutil.ReadFile(filepath)
+	log.PanicIf(err)
+
+	fields := make(map[string]json.RawMessage)
+
+	err = json.Unmarshal(raw, &fields)
+	if err != nil {
+		return "", []string{fmt.Sprintf("not a JSON object: %s", err)}, nil
+	}
+
+	if _, found := fields["playlists"]; found == true {
+		kind = FileKindLedger
+	} else if tracksRaw, found := fields["tracks"]; found == true {
+		// The missing report is the one whose tracks have reasons.
+
+		tracks := make([]map[string]json.RawMessage, 0)
+		if err := json.Unmarshal(tracksRaw, &tracks); err == nil && len(tracks) > 0 {
+			if _, found := tracks[0]["reason"]; found == true {
+				kind = FileKindMissingReport
+			}
+		}
+
+		if kind == "" {
+			kind = FileKindFavorites
+		}
+	} else {
+		log.Panic(ErrFileKindUnknown)
+	}
+
+	// Decode strictly so that misspelled or unknown fields are reported.
+
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.DisallowUnknownFields()
+
+	problems = make([]string, 0)
+
+	switch kind {
+	case FileKindFavorites:
+		fs := favoritesSnapshot{}
+		if err := d.Decode(&fs); err != nil {
+			return kind, append(problems, err.Error()), nil
+		}
+
+		for j, nt := range fs.Tracks {
+			problems = append(problems, validateNormalizedTrack(j, nt)...)
+		}
+	case FileKindMissingReport:
+		mr := missingReport{}
+		if err := d.Decode(&mr); err != nil {
+			return kind, append(problems, err.Error()), nil
+		}
+
+		for j, mt := range mr.Tracks {
+			if mt == nil {
+				problems = append(problems, fmt.Sprintf("track (%d) is null", j))
+				continue
+			}
+
+			problems = append(problems, validateNormalizedTrack(j, &mt.NormalizedTrack)...)
+
+			if missingReasons[mt.Reason] == false {
+				problems = append(problems, fmt.Sprintf("track (%d) has an unknown reason: [%s]", j, mt.Reason))
+			}
+		}
+	case FileKindLedger:
+		l := Ledger{}
+		if err := d.Decode(&l); err != nil {
+			return kind, append(problems, err.Error()), nil
+		}
+
+		playlistIds := make([]string, 0, len(l.Playlists))
+		for playlistId, _ := range l.Playlists {
+			playlistIds = append(playlistIds, string(playlistId))
+		}
+
+		sort.Strings(playlistIds)
+
+		for _, playlistIdRaw := range playlistIds {
+			playlistId := spotify.ID(playlistIdRaw)
+			entries := l.Playlists[playlistId]
+
+			if isValidSpotifyId(playlistId) == false {
+				problems = append(problems, fmt.Sprintf("playlist ID is not valid: [%s]", playlistId))
+			}
+
+			for j, le := range entries {
+				if isValidSpotifyId(le.TrackId) == false {
+					problems = append(problems, fmt.Sprintf("playlist [%s] entry (%d) has an invalid track ID: [%s]", playlistId, j, le.TrackId))
+				}
+
+				if le.AddedAt.IsZero() == true {
+					problems = append(problems, fmt.Sprintf("playlist [%s] entry (%d) has no added-at time", playlistId, j))
+				} else if le.RemovedAt != nil && le.RemovedAt.Before(le.AddedAt) == true {
+					problems = append(problems, fmt.Sprintf("playlist [%s] entry (%d) was removed before it was added", playlistId, j))
+				}
+			}
+		}
+	}
+
+	return kind, problems, nil
+}
+
+// validateNormalizedTrack returns the problems with the given track from a
+// favorites snapshot or missing report.
+func validateNormalizedTrack(j int, nt *NormalizedTrack) (problems []string) {
+	problems = make([]string, 0)
+
+	if nt == nil {
+		return append(problems, fmt.Sprintf("track (%d) is null", j))
+	}
+
+	if nt.ArtistName == "" {
+		problems = append(problems, fmt.Sprintf("track (%d) has no artist name", j))
+	}
+
+	if nt.TrackName == "" {
+		problems = append(problems, fmt.Sprintf("track (%d) has no track name", j))
+	}
+
+	return problems
+}
@@ -0,0 +1,110 @@
+package gnsssync
+
+import (
+	"reflect"
+	"testing"
+
+	"io/ioutil"
+	"path"
+
+	"github.com/dsoprea/go-logging"
+)
+
+func TestValidateFile(t *testing.T) {
+	cases := []struct {
+		description string
+		data        string
+		kind        string
+		problems    []string
+	}{
+		{
+			description: "valid favorites",
+			data:        `{"tracks":[{"artist_name":"The Band","album_name":"First Album","track_name":"Opener"}]}`,
+			kind:        FileKindFavorites,
+			problems:    []string{},
+		},
+		{
+			description: "favorites missing names",
+			data:        `{"tracks":[{"artist_name":"","album_name":"First Album","track_name":""},null]}`,
+			kind:        FileKindFavorites,
+			problems: []string{
+				"track (0) has no artist name",
+				"track (0) has no track name",
+				"track (1) is null",
+			},
+		},
+		{
+			description: "favorites with an unknown field",
+			data:        `{"tracks":[{"artist_name":"The Band","album":"First Album","track_name":"Opener"}]}`,
+			kind:        FileKindFavorites,
+			problems:    []string{`json: unknown field "album"`},
+		},
+		{
+			description: "valid missing report",
+			data:        `{"tracks":[{"artist_name":"The Band","album_name":"First Album","track_name":"Ghost","reason":"track-not-found"}]}`,
+			kind:        FileKindMissingReport,
+			problems:    []string{},
+		},
+		{
+			description: "missing report with a bad reason",
+			data:        `{"tracks":[{"artist_name":"The Band","album_name":"First Album","track_name":"Ghost","reason":"lost"}]}`,
+			kind:        FileKindMissingReport,
+			problems:    []string{"track (0) has an unknown reason: [lost]"},
+		},
+		{
+			description: "valid ledger",
+			data:        `{"playlists":{"37i9dQZF1DXcBWIGoYBM5M":[{"track_id":"4uLU6hMCjMI75M1A2tKUQC","added_at":"2020-01-02T03:04:05Z"}]}}`,
+			kind:        FileKindLedger,
+			problems:    []string{},
+		},
+		{
+			description: "ledger with bad IDs and times",
+			data:        `{"playlists":{"short":[{"track_id":"bad-id","added_at":"2020-01-02T03:04:05Z","removed_at":"2020-01-01T00:00:00Z"},{"track_id":"4uLU6hMCjMI75M1A2tKUQC"}]}}`,
+			kind:        FileKindLedger,
+			problems: []string{
+				"playlist ID is not valid: [short]",
+				"playlist [short] entry (0) has an invalid track ID: [bad-id]",
+				"playlist [short] entry (0) was removed before it was added",
+				"playlist [short] entry (1) has no added-at time",
+			},
+		},
+		{
+			description: "not JSON",
+			data:        `tracks:`,
+			kind:        "",
+			problems:    []string{"not a JSON object: invalid character 'a' in literal true (expecting 'u')"},
+		},
+	}
+
+	for _, c := range cases {
+		filepath := path.Join(t.TempDir(), "file.json")
+
+		err := ioutil.WriteFile(filepath, []byte(c.data), 0644)
+		if err != nil {
+			t.Fatalf("Could not write file: %s", err)
+		}
+
+		kind, problems, err := ValidateFile(filepath)
+		if err != nil {
+			t.Fatalf("[%s] Could not validate: %s", c.description, err)
+		} else if kind != c.kind {
+			t.Fatalf("[%s] Kind not correct: [%s] != [%s]", c.description, kind, c.kind)
+		} else if reflect.DeepEqual(problems, c.problems) != true {
+			t.Fatalf("[%s] Problems not correct: %q", c.description, problems)
+		}
+	}
+}
+
+func TestValidateFile_UnknownKind(t *testing.T) {
+	filepath := path.Join(t.TempDir(), "file.json")
+
+	err := ioutil.WriteFile(filepath, []byte(`{"other":[]}`), 0644)
+	if err != nil {
+		t.Fatalf("Could not write file: %s", err)
+	}
+
+	_, _, err = ValidateFile(filepath)
+	if log.Is(err, ErrFileKindUnknown) != true {
+		t.Fatalf("Expected the file to not be recognized: [%v]", err)
+	}
+}
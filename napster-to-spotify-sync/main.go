@@ -1,7 +1,9 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/dsoprea/go-logging"
 	"github.com/jessevdk/go-flags"
@@ -28,33 +30,540 @@ var (
 	spotifyBatchSize = 50
 )
 
+// Exit codes
+const (
+	ExitSuccess         = 0
+	ExitFailure         = 1
+	ExitAuthFailure     = 2
+	ExitRateLimited     = 3
+	ExitNothingToImport = 4
+	ExitPartialFailure  = 5
+)
+
+// Errors
+var (
+	ErrNothingToImport = fmt.Errorf("no tracks found to import")
+	ErrBatchesFailed   = fmt.Errorf("some tracks could not be added to the playlist")
+	ErrFileNotValid    = fmt.Errorf("file is not valid")
+	ErrGoldenDrift     = fmt.Errorf("favorites were not matched as in the golden file")
+)
+
 // Misc
 var (
 	mLog = log.NewLogger("main")
 )
 
 type options struct {
-	SpotifyApiClientId  string `long:"spotify-api-client-id" required:"true" description:"Spotify API client-ID"`
-	SpotifyApiSecretKey string `long:"spotify-api-secret-key" required:"true" description:"Spotify API secret key"`
+	SpotifyApiClientId  string `long:"spotify-api-client-id" description:"Spotify API client-ID (required unless only checking a file)"`
+	SpotifyApiSecretKey string `long:"spotify-api-secret-key" description:"Spotify API secret key (required unless only checking a file)"`
 
-	NapsterApiKey    string `long:"napster-api-key" required:"true" description:"Napster API key"`
-	NapsterSecretKey string `long:"napster-secret-key" required:"true" description:"Napster secret key"`
+	NapsterApiKey    string `long:"napster-api-key" description:"Napster API key"`
+	NapsterSecretKey string `long:"napster-secret-key" description:"Napster secret key"`
 
-	NapsterUsername string `long:"napster-username" required:"true" description:"Napster username"`
-	NapsterPassword string `long:"napster-password" required:"true" description:"Napster password"`
+	NapsterUsername string `long:"napster-username" description:"Napster username"`
+	NapsterPassword string `long:"napster-password" description:"Napster password"`
 
-	SpotifyPlaylistName string   `short:"p" long:"playlist-name" required:"true" description:"Spotify playlist name"`
-	OnlyArtists         []string `short:"a" long:"only-artists" required:"true" description:"One artist to import"`
+	SpotifyPlaylistName string   `short:"p" long:"playlist-name" description:"Spotify playlist name (this, --playlist-name-contains, or --playlist-id is required)"`
+	SpotifyPlaylistId   string   `long:"playlist-id" description:"Spotify playlist ID, to use rather than finding the playlist by name (e.g. if more than one has the same name)"`
+	OnlyArtists         []string `short:"a" long:"only-artists" description:"One artist to import (if none are given, every artist is imported)"`
+	OnlyArtistsFilepath string   `long:"only-artists-file" description:"File with more artists to import, one per line (blank lines and lines starting with '#' are ignored)"`
+	ArtistsFilepath     string   `long:"artists-file" description:"Same as --only-artists-file"`
+	AllArtists          bool     `long:"all-artists" description:"Import the favorites by every artist (other than any --exclude-artists). This is the default if no --only-artists are given"`
+	ExcludeArtists      []string `long:"exclude-artists" description:"One artist to not import, even if it's one of the --only-artists or is featured on their tracks"`
 
 	NoChanges bool `short:"n" long:"no-changes" description:"Do not make changes to Spotify"`
 
 	SpotifyAlbumMarket string `short:"m" long:"spotify-album-market" description:"Name of music market (two-letter country code) to filter Spotify albums by"`
+
+	SkipIfInAnyPlaylist bool `long:"skip-if-in-any-playlist" description:"Skip tracks that are already in any of the user's playlists (reads every playlist)"`
+
+	LedgerFilepath string `long:"ledger" description:"File to record the tracks that we add to each playlist in"`
+	RemoveLedgered bool   `long:"remove-ledgered" description:"Remove all of the tracks recorded in the ledger from the playlist rather than importing"`
+
+	DumpFavoritesFilepath string `long:"dump-favorites" description:"Write the favorites read from Napster to a JSON file"`
+	FavoritesInFilepath   string `long:"favorites-in" description:"Read the favorites from a file written by --dump-favorites rather than from Napster"`
+
+	ArtistConcurrency int `long:"artist-concurrency" default:"1" description:"Number of artists to match against Spotify at the same time"`
+
+	AdaptiveConcurrency bool `long:"adaptive-concurrency" description:"Halve the artist concurrency while Spotify is rate-limiting us and slowly raise it back up once it stops"`
+
+	AlbumSearchOnArtistMiss bool `long:"album-search-on-artist-miss" description:"If an artist can't be found in Spotify, search for their albums directly and loosely match the artist"`
+
+	TraceHttp bool `long:"trace-http" description:"Log all Spotify and Napster requests and responses (credentials are redacted)"`
+
+	NapsterFavoritesLimit            int  `long:"napster-favorites-limit" description:"Stop reading Napster favorites after this many (zero for no limit)"`
+	NapsterFavoritesLimitAfterFilter bool `long:"napster-favorites-limit-after-filter" description:"Only count favorites that pass the artist filter toward --napster-favorites-limit"`
+
+	SpotifyFallbackMarkets []string `long:"spotify-fallback-market" description:"Market to try if an album can't be matched in the primary market (may be given more than once; tried in order)"`
+	UnionMarkets           bool     `long:"union-markets" description:"Match every album in every market and combine the results rather than stopping at the first market that matches"`
+
+	ValidateFilepath string `long:"validate-file" description:"Only check a file written by --dump-favorites, --missing-report, or --ledger for problems and then exit"`
+
+	DumpCacheFilepath string `long:"dump-cache" description:"Only print the artists, albums, and album tracks in a file written by --search-cache and then exit"`
+
+	CheckCredentials bool `long:"check-credentials" description:"Only verify the Spotify client credentials and the Napster API key and then exit"`
+
+	EditionStopwords []string `long:"edition-stopword" description:"Word identifying a trailing parenthetical as an edition to ignore when loosely matching titles (may be given more than once; replaces the defaults)"`
+
+	AlbumCompleteOnly bool `long:"album-complete-only" description:"Skip an album entirely if any of its favorited tracks can't be found in Spotify"`
+
+	PreferEarliestAlbum bool `long:"prefer-earliest-album" description:"When more than one of an artist's albums match (e.g. reissues), use the one released first"`
+
+	CsvOutFilepath string `long:"csv-out" description:"Write the tracks to add (Spotify ID, artist, album, and title) to this CSV file, even with --no-changes"`
+
+	RunReportFilepath string `long:"report-file" description:"Write the missing artists, albums, and tracks and the tracks to add (with their Spotify IDs) to this JSON file"`
+
+	UrisOutFilepath string `long:"uris-out" description:"Write the Spotify URIs of the tracks to add to this file, one per line (to paste into the Spotify desktop app)"`
+
+	MissingReportFilepath string `long:"missing-report" description:"Write the favorited tracks that couldn't be added to a JSON file"`
+	RetryMissingFilepath  string `long:"retry-missing" description:"Only retry the tracks in a file written by --missing-report rather than reading the favorites"`
+
+	Scopes []string `long:"scope" description:"Spotify scope to request (may be given more than once; defaults to the read scopes with --no-changes and to the read and playlist-modify scopes otherwise)"`
+
+	AuthTimeout time.Duration `long:"auth-timeout" default:"5m" description:"How long to wait for Spotify to be authorized before giving up (0 to wait forever)"`
+
+	NoBrowser bool `long:"no-browser" description:"Print the Spotify authorization URL rather than opening a browser and accept the URL that it redirects to (or its code) on stdin (e.g. when running over SSH)"`
+
+	ShowPlan     bool   `long:"show-plan" description:"Print the tracks to add, already present, and missing (by artist and album) before adding them"`
+	OutputFormat string `long:"output-format" choice:"text" choice:"json" default:"text" description:"Format of the plan printed by --show-plan and of the --verify report"`
+
+	PlaylistNameContains string `long:"playlist-name-contains" description:"Use the one playlist whose name contains this (rather than giving the whole name with --playlist-name)"`
+
+	ExactPlaylistName bool `long:"exact-playlist-name" description:"Match the playlist name exactly rather than ignoring case"`
+
+	SpotifyUserId string `long:"spotify-user-id" description:"Operate on this Spotify user's playlists rather than the authenticated user's (their playlist must be collaborative)"`
+
+	MinDuration time.Duration `long:"min-duration" description:"Skip (and report) matched tracks that are shorter than this (e.g. 1m30s)"`
+	MaxDuration time.Duration `long:"max-duration" description:"Skip (and report) matched tracks that are longer than this (e.g. 15m)"`
+
+	SkipUnplayable bool `long:"skip-unplayable" description:"Skip (and report) matched tracks that aren't available in the --spotify-album-market market"`
+
+	ArtistTriage bool `long:"artist-triage" description:"Report whether each --only-artists artist had Napster favorites and was found in Spotify"`
+
+	NapsterRestartOnShift bool `long:"napster-restart-on-shift" description:"If the Napster favorites change while they're being read (so that some might be missed), start reading them over"`
+
+	AnnotateNearest bool `long:"annotate-nearest" description:"Report (in the log and the --missing-report) the closest album or track that was seen for each one that couldn't be found"`
+
+	FoldDiacritics bool `long:"fold-diacritics" description:"Ignore accents when comparing artist, album, and track names (e.g. 'Motörhead' and 'Motorhead')"`
+
+	StripTrackNumbers bool `long:"strip-track-numbers" description:"When matching track names, ignore a leading track number followed by a separator (e.g. '01 - Intro' or '1. Intro')"`
+
+	FoldVolumes bool `long:"fold-volumes" description:"When matching album names liberally, treat 'Vol. 5', 'Volume V', and a bare '5' as the same"`
+
+	TrackMatchDistance int `long:"track-match-distance" description:"If a track name isn't found on the album, accept the album track whose name is within this many single-character edits of it (the substitution is logged; zero to only match exactly)"`
+
+	StrictArtist bool `long:"strict-artist" description:"Require artist names to match exactly (other than case) rather than loosely; anything else is reported as not found"`
+
+	Interactive bool `long:"interactive" description:"If the playlist can't be found, ask which of your playlists to use (or whether to create it) rather than failing"`
+
+	LogFilepath  string `long:"log-file" description:"Also write the log to this file"`
+	LogFileMaxMb int    `long:"log-file-max-mb" description:"Rotate the log file (keeping one previous file) once it reaches this many megabytes (zero to never rotate)"`
+	LogFileOnly  bool   `long:"log-file-only" description:"Only write the log to the --log-file file rather than also to the console"`
+
+	LogSessionId bool `long:"log-session-id" description:"Prefix every log message with a short ID that's generated for each run (to pick one run out of a shared log)"`
+
+	StateDirPath string `long:"state-dir" description:"Directory to keep the ledger, the missing report, and the search cache in (unless they're given explicitly)"`
+
+	Sample int   `long:"sample" description:"Only add this many of the matched tracks, chosen at random (to try things out)"`
+	Seed   int64 `long:"seed" description:"Seed for choosing the --sample tracks so that the same ones are chosen again (random if not given)"`
+
+	GoldenFilepath string `long:"golden-file" description:"Only compare how the favorites were matched against a file written by --update-golden and report the differences; make no changes"`
+	UpdateGolden   bool   `long:"update-golden" description:"Write how the favorites were matched to the --golden-file file rather than comparing against it"`
+
+	Mirror bool `long:"mirror" description:"Also remove the playlist tracks (by the given artists) that are no longer favorited so that the playlist mirrors the favorites (previewed with --no-changes)"`
+
+	Verify bool `long:"verify" description:"Only report the matched favorites that are missing from the playlist and the playlist tracks that are no longer favorited (per --output-format); make no changes"`
+
+	AddPosition string `long:"add-position" choice:"start" choice:"end" default:"end" description:"Where in the playlist to add the tracks"`
+
+	MaxRuntime time.Duration `long:"max-runtime" description:"Stop matching artists after this long (e.g. 30m) and add what was already matched"`
+
+	NoFail bool `long:"no-fail" description:"Skip (and report as missing) any artist or album whose lookup fails unexpectedly rather than stopping"`
+
+	SearchCacheFilepath      string        `long:"search-cache" description:"Keep the Spotify artist, album, and track lookups in this file so that later runs don't repeat them"`
+	SearchCacheNegativeTtl   time.Duration `long:"search-cache-negative-ttl" default:"24h" description:"How long the --search-cache remembers lookups that found nothing before trying them again"`
+	SearchCacheFlushEvery    int           `long:"search-cache-flush-every" default:"100" description:"Also write the --search-cache during the run after this many new lookups (0 to not)"`
+	SearchCacheFlushInterval time.Duration `long:"search-cache-flush-interval" default:"1m" description:"Also write the --search-cache during the run once this long has passed since it was last written (0 to not)"`
+
+	DedupeSource bool `long:"dedupe-source" description:"Report (in the log and the --show-plan plan) the favorites that matched the same Spotify track as another favorite"`
+
+	IgnorePreloadErrors bool `long:"ignore-preload-errors" description:"If the tracks already in the playlist can't be read, carry on as if it were empty (tracks may be added twice) rather than stopping"`
+
+	ArtistBatch int `long:"artist-batch" description:"Match the artists in groups of this many and add each group's tracks before moving on (so that a failure part-way through keeps the earlier groups)"`
+
+	AlbumTypes string `long:"album-types" description:"Comma-separated kinds of album to look for an album's name under, in order of preference if the name exists as more than one (album, single, compilation; defaults to album)"`
+
+	MatchStrategy string `long:"match-strategy" description:"Comma-separated match strategies to try, in order, until each track is found (strict-album, liberal-album, single, track-search, album-search; defaults to strict-album,liberal-album,single,track-search)"`
+}
+
+// checkCredentials verifies the API credentials before we start the
+// interactive authorization, so that typos are caught immediately.
+func checkCredentials(ctx context.Context, o *options) {
+	err := gnsssync.CheckSpotifyCredentials(ctx, nil, o.SpotifyApiClientId, o.SpotifyApiSecretKey)
+	if log.Is(err, gnsssync.ErrSpotifyCredentialsInvalid) == true {
+		mLog.Warningf(ctx, "The Spotify client-ID or secret key was rejected; please check them.")
+	}
+
+	log.PanicIf(err)
+
+	if o.NapsterApiKey != "" {
+		err := gnsssync.CheckNapsterApiKey(ctx, nil, o.NapsterApiKey)
+		if log.Is(err, gnsssync.ErrNapsterApiKeyInvalid) == true {
+			mLog.Warningf(ctx, "The Napster API key was rejected; please check it.")
+		}
+
+		log.PanicIf(err)
+	}
+}
+
+// removeLedgered removes all of the tracks that the ledger says that we added
+// to the playlist.
+func removeLedgered(spotifyAuth *gnsssync.SpotifyContext, sc *gnsssync.SpotifyCache, ledger *gnsssync.Ledger, playlistName string, noChanges bool) {
+	spotifyUserId, err := sc.GetSpotifyUserId()
+	log.PanicIf(err)
+
+	spotifyPlaylistId, err := sc.GetSpotifyPlaylistId(spotifyUserId, playlistName)
+	log.PanicIf(err)
+
+	ids := ledger.Active(spotifyPlaylistId)
+
+	len_ := len(ids)
+	if len_ == 0 {
+		mLog.Warningf(nil, "No ledgered tracks found to remove.")
+		return
+	} else if noChanges == true {
+		mLog.Warningf(nil, "There were (%d) ledgered tracks to remove but we were told to not make changes.", len_)
+		return
+	}
+
+	err = sc.CheckSpotifyPlaylistWritable(spotifyUserId, spotifyPlaylistId)
+	log.PanicIf(err)
+
+	sa := gnsssync.NewSpotifyAdapter(nil, spotifyAuth)
+
+	beforeIds, err := sa.ReadSpotifyPlaylist(spotifyPlaylistId, spotifyUserId, "")
+	log.PanicIf(err)
+
+	mLog.Infof(nil, "Removing (%d) ledgered tracks from the playlist.", len_)
+
+	removeTrackBatches(spotifyAuth, ledger, spotifyUserId, spotifyPlaylistId, ids)
+
+	// Only the tracks that were still in the playlist were actually removed.
+
+	beforeIndex := make(map[spotify.ID]bool, len(beforeIds))
+	for _, id := range beforeIds {
+		beforeIndex[id] = true
+	}
+
+	removedCount := 0
+	for _, id := range ids {
+		if _, found := beforeIndex[id]; found == true {
+			removedCount++
+		}
+	}
+
+	logPlaylistChange(nil, playlistName, len(beforeIds), 0, removedCount)
+}
+
+// removeTrackBatches removes the given tracks from the playlist in batches and
+// marks them as removed in the ledger (if there is one).
+func removeTrackBatches(spotifyAuth *gnsssync.SpotifyContext, ledger *gnsssync.Ledger, spotifyUserId string, spotifyPlaylistId spotify.ID, ids []spotify.ID) {
+	len_ := len(ids)
+	for j := 0; j < len_; j += spotifyBatchSize {
+		k := j + spotifyBatchSize
+		if k > len_ {
+			k = len_
+		}
+
+		batchIdList := ids[j:k]
+
+		_, err := spotifyAuth.InstrumentedClient().RemoveTracksFromPlaylist(spotifyUserId, spotifyPlaylistId, batchIdList...)
+		log.PanicIf(err)
+
+		if ledger != nil {
+			err = ledger.MarkRemoved(spotifyPlaylistId, batchIdList)
+			log.PanicIf(err)
+		}
+	}
+}
+
+// removeTracks removes the given tracks (which are all in the playlist) from
+// the playlist.
+func removeTracks(ctx context.Context, spotifyAuth *gnsssync.SpotifyContext, sc *gnsssync.SpotifyCache, ledger *gnsssync.Ledger, playlistName string, tracks map[spotify.ID]gnsssync.TrackInfo) {
+	mLog.Infof(ctx, "Removing (%d) tracks from the playlist.", len(tracks))
+
+	spotifyUserId, err := sc.GetSpotifyUserId()
+	log.PanicIf(err)
+
+	spotifyPlaylistId, err := sc.GetSpotifyPlaylistId(spotifyUserId, playlistName)
+	log.PanicIf(err)
+
+	err = sc.CheckSpotifyPlaylistWritable(spotifyUserId, spotifyPlaylistId)
+	log.PanicIf(err)
+
+	ids := make([]spotify.ID, 0, len(tracks))
+	for id, trackInfo := range tracks {
+		mLog.Debugf(ctx, "REMOVING: [%s] %s", id, trackInfo)
+
+		ids = append(ids, id)
+	}
+
+	removeTrackBatches(spotifyAuth, ledger, spotifyUserId, spotifyPlaylistId, ids)
+}
+
+// addTracks adds the given tracks to the playlist in batches and returns how
+// many of them couldn't be added. If `position` isn't negative, the tracks are
+// inserted starting there rather than added to the end.
+func addTracks(ctx context.Context, spotifyAuth *gnsssync.SpotifyContext, sc *gnsssync.SpotifyCache, ledger *gnsssync.Ledger, playlistName string, ids map[spotify.ID]gnsssync.TrackInfo, position int) (failedCount int) {
+	mLog.Infof(ctx, "Adding (%d) tracks to the playlist.", len(ids))
+
+	spotifyUserId, err := sc.GetSpotifyUserId()
+	log.PanicIf(err)
+
+	spotifyPlaylistId, err := sc.GetSpotifyPlaylistId(spotifyUserId, playlistName)
+	log.PanicIf(err)
+
+	err = sc.CheckSpotifyPlaylistWritable(spotifyUserId, spotifyPlaylistId)
+	log.PanicIf(err)
+
+	sa := gnsssync.NewSpotifyAdapter(ctx, spotifyAuth)
+
+	// A track that Spotify rejects (e.g. one that was delisted) is dropped
+	// from its batch so that the rest of the batch is still added.
+	flushCb := func(idList []spotify.ID) (addedCount int, dropped []spotify.ID, err error) {
+		defer func() {
+			if state := recover(); state != nil {
+				err = log.Wrap(state.(error))
+			}
+		}()
+
+		added, dropped, addErr := sa.AddTracksIsolatingBadIds(spotifyUserId, spotifyPlaylistId, idList, position)
+		addedCount = len(added)
+
+		if position >= 0 {
+			// The next batch goes after this one.
+			position += len(added)
+		}
+
+		// Record whatever was added even if the rest of the batch failed.
+		if ledger != nil && len(added) > 0 {
+			err := ledger.Append(spotifyPlaylistId, added)
+			log.PanicIf(err)
+		}
+
+		log.PanicIf(addErr)
+
+		return addedCount, dropped, nil
+	}
+
+	// A failed batch doesn't stop the others from being added, but we'll
+	// report it in the exit-code.
+	flush := func(idList []spotify.ID) {
+		addedCount, dropped, err := flushCb(idList)
+		if err != nil {
+			mLog.Errorf(ctx, err, "Could not add batch of (%d) tracks.", len(idList))
+			failedCount += len(idList) - addedCount
+
+			return
+		}
+
+		for _, id := range dropped {
+			mLog.Warningf(ctx, "DROPPED (REJECTED BY SPOTIFY): [%s] %s", id, ids[id])
+		}
+
+		failedCount += len(dropped)
+	}
+
+	batchIdList := make([]spotify.ID, spotifyBatchSize)
+	j := 0
+	for id, trackInfo := range ids {
+		batchIdList[j] = id
+		j++
+
+		mLog.Debugf(ctx, "ADDING: [%s] %s", id, trackInfo)
+
+		if j >= spotifyBatchSize {
+			flush(batchIdList)
+			j = 0
+		}
+	}
+
+	if j > 0 {
+		flush(batchIdList[:j])
+	}
+
+	return failedCount
+}
+
+// mergeArtistsFiles reads the artists from the artists files (either flag)
+// into the artists to import.
+func mergeArtistsFiles(o *options) error {
+	for _, filepath := range []string{o.OnlyArtistsFilepath, o.ArtistsFilepath} {
+		if filepath == "" {
+			continue
+		}
+
+		artistNames, err := gnsssync.ReadArtistsFile(filepath)
+		if err != nil {
+			return err
+		}
+
+		o.OnlyArtists = gnsssync.MergeArtistNames(o.OnlyArtists, artistNames)
+	}
+
+	return nil
+}
+
+// checkSpotifyOptions makes sure that we were given the Spotify credentials.
+// These are only required once we know that we'll be talking to Spotify so
+// that the modes that only read a local file can be run without them.
+func checkSpotifyOptions(o *options) error {
+	if o.SpotifyApiClientId == "" || o.SpotifyApiSecretKey == "" {
+		return fmt.Errorf("--spotify-api-client-id and --spotify-api-secret-key are required")
+	}
+
+	return nil
+}
+
+// resolveArtistOptions defaults to importing every artist if none were given
+// and makes sure that the artist options agree. Any artists file must already
+// have been merged into the artists.
+func resolveArtistOptions(o *options) error {
+	// Without any artists, import them all (unless they come from the report
+	// that's being retried or the artists file was just empty).
+	if len(o.OnlyArtists) == 0 && o.OnlyArtistsFilepath == "" && o.ArtistsFilepath == "" && o.RetryMissingFilepath == "" {
+		o.AllArtists = true
+	}
+
+	if len(o.OnlyArtists) > 0 && o.AllArtists == true {
+		return fmt.Errorf("--only-artists and --all-artists can not be used together")
+	}
+
+	return nil
+}
+
+// playlistChangeSummary describes the net change to the playlist.
+func playlistChangeSummary(playlistName string, beforeCount, addedCount, removedCount int) string {
+	afterCount := beforeCount + addedCount - removedCount
+
+	return fmt.Sprintf("Playlist [%s]: (%d) tracks before, +(%d) added, -(%d) removed, (%d) after.", playlistName, beforeCount, addedCount, removedCount, afterCount)
+}
+
+// logPlaylistChange prints the net change to the playlist.
+func logPlaylistChange(ctx context.Context, playlistName string, beforeCount, addedCount, removedCount int) {
+	mLog.Infof(ctx, "%s", playlistChangeSummary(playlistName, beforeCount, addedCount, removedCount))
+}
+
+// nothingToImportReason explains why there was nothing to import.
+func nothingToImportReason(stats gnsssync.ImportStats) string {
+	if stats.FavoritesCount == 0 {
+		return "there are no favorites in Napster"
+	} else if stats.FilteredCount == stats.FavoritesCount {
+		return fmt.Sprintf("none of the (%d) favorites are by the given artists", stats.FavoritesCount)
+	} else if stats.MissingCount == 0 {
+		return fmt.Sprintf("all (%d) matched tracks are already in the playlist", stats.AlreadyPresentCount)
+	}
+
+	return fmt.Sprintf("(%d) tracks couldn't be found in Spotify and (%d) are already in the playlist", stats.MissingCount, stats.AlreadyPresentCount)
+}
+
+// logNothingToImport explains why there was nothing to import.
+func logNothingToImport(ctx context.Context, stats gnsssync.ImportStats) {
+	mLog.Warningf(ctx, "No tracks found to import: %s.", nothingToImportReason(stats))
+}
+
+// validateFile prints the problems with the given file. It's an error if there
+// are any.
+func validateFile(filepath string) {
+	kind, problems, err := gnsssync.ValidateFile(filepath)
+	log.PanicIf(err)
+
+	if len(problems) == 0 {
+		fmt.Printf("[%s] is a valid %s file.\n", filepath, kind)
+		return
+	}
+
+	fmt.Printf("[%s] (%s) has (%d) problems:\n", filepath, kind, len(problems))
+
+	for _, problem := range problems {
+		fmt.Printf("- %s\n", problem)
+	}
+
+	log.Panic(ErrFileNotValid)
+}
+
+// writeCsv writes the tracks to add to the given CSV file.
+func writeCsv(filepath string, ids map[spotify.ID]gnsssync.TrackInfo) {
+	f, err := os.Create(filepath)
+	log.PanicIf(err)
+
+	defer f.Close()
+
+	err = gnsssync.WriteTrackInfoCSV(f, ids)
+	log.PanicIf(err)
+}
+
+// checkGolden compares how the favorites were matched against the golden file
+// (or, if `update` is set, rewrites it) and fails if there were differences.
+func checkGolden(ctx context.Context, i *gnsssync.Importer, filepath string, update bool) {
+	resolutions := i.Resolutions()
+
+	if update == true {
+		err := gnsssync.WriteGoldenFile(filepath, resolutions)
+		log.PanicIf(err)
+
+		mLog.Infof(ctx, "Wrote (%d) matched favorites to golden file [%s].", len(resolutions), filepath)
+
+		return
+	}
+
+	drift, err := gnsssync.CompareGoldenFile(filepath, resolutions)
+	log.PanicIf(err)
+
+	if len(drift) == 0 {
+		fmt.Printf("All (%d) matched favorites are as in [%s].\n", len(resolutions), filepath)
+		return
+	}
+
+	fmt.Printf("(%d) favorites were not matched as in [%s]:\n", len(drift), filepath)
+
+	for _, line := range drift {
+		fmt.Printf("- %s\n", line)
+	}
+
+	log.Panic(ErrGoldenDrift)
+}
+
+// exitCode returns the exit-code that corresponds to the given error so that
+// scripts can tell failures apart.
+func exitCode(err error) int {
+	if log.Is(err, gnsssync.ErrSpotifyCredentialsInvalid) == true || log.Is(err, gnsssync.ErrNapsterApiKeyInvalid) == true {
+		return ExitAuthFailure
+	} else if log.Is(err, gnsssync.ErrAuthTimeout) == true {
+		return ExitAuthFailure
+	} else if log.Is(err, gnsssync.ErrNapsterRateLimited) == true || log.Is(err, gnsssync.ErrSpotifyRateLimited) == true {
+		return ExitRateLimited
+	} else if log.Is(err, ErrNothingToImport) == true {
+		return ExitNothingToImport
+	} else if log.Is(err, ErrBatchesFailed) == true {
+		return ExitPartialFailure
+	}
+
+	return ExitFailure
 }
 
 func main() {
 	defer func() {
 		if state := recover(); state != nil {
-			mLog.Errorf(nil, state.(error), "There was an error.")
+			err := state.(error)
+
+			// Having nothing to import isn't really an error, and we've
+			// already said so.
+			if log.Is(err, ErrNothingToImport) == false {
+				mLog.Errorf(nil, err, "There was an error.")
+			}
+
+			os.Exit(exitCode(err))
 		}
 	}()
 
@@ -69,83 +578,452 @@ func main() {
 
 	o := new(options)
 	if _, err := flags.Parse(o); err != nil {
-		os.Exit(1)
+		os.Exit(ExitFailure)
+	}
+
+	var la log.LogAdapter = cla
+	adapterName := ""
+
+	if o.LogFilepath != "" {
+		fla, err := gnsssync.NewFileLogAdapter(o.LogFilepath, int64(o.LogFileMaxMb)*1024*1024)
+		log.PanicIf(err)
+
+		defer fla.Close()
+
+		if o.LogFileOnly == true {
+			la = fla
+			adapterName = "file"
+		} else {
+			la = gnsssync.NewMultiLogAdapter(cla, fla)
+			adapterName = "console_and_file"
+		}
+	} else if o.LogFileOnly == true {
+		log.Panic(fmt.Errorf("--log-file-only requires --log-file"))
+	}
+
+	sessionId := ""
+	if o.LogSessionId == true {
+		var err error
+
+		sessionId, err = gnsssync.NewSessionId()
+		log.PanicIf(err)
+
+		la = gnsssync.NewSessionLogAdapter(sessionId, la)
+		adapterName = "session"
+	}
+
+	if adapterName != "" {
+		log.AddAdapter(adapterName, la)
+		log.SetDefaultAdapterName(adapterName)
+	}
+
+	if o.ValidateFilepath != "" {
+		validateFile(o.ValidateFilepath)
+		return
+	}
+
+	if o.DumpCacheFilepath != "" {
+		err := gnsssync.DumpSearchCache(os.Stdout, o.DumpCacheFilepath)
+		log.PanicIf(err)
+
+		return
+	}
+
+	err := checkSpotifyOptions(o)
+	log.PanicIf(err)
+
+	if o.FavoritesInFilepath == "" && o.RetryMissingFilepath == "" && o.CheckCredentials == false {
+		if o.NapsterApiKey == "" || o.NapsterSecretKey == "" || o.NapsterUsername == "" || o.NapsterPassword == "" {
+			log.Panic(fmt.Errorf("the Napster API key, secret key, username, and password are required unless --favorites-in or --retry-missing is given"))
+		}
+	}
+
+	playlistOptionCount := 0
+	for _, value := range []string{o.SpotifyPlaylistName, o.PlaylistNameContains, o.SpotifyPlaylistId} {
+		if value != "" {
+			playlistOptionCount++
+		}
+	}
+
+	if playlistOptionCount == 0 && o.CheckCredentials == false {
+		log.Panic(fmt.Errorf("one of --playlist-name, --playlist-name-contains, or --playlist-id is required"))
+	} else if playlistOptionCount > 1 {
+		log.Panic(fmt.Errorf("only one of --playlist-name, --playlist-name-contains, and --playlist-id can be given"))
+	}
+
+	err = mergeArtistsFiles(o)
+	log.PanicIf(err)
+
+	err = resolveArtistOptions(o)
+	log.PanicIf(err)
+
+	if o.FavoritesInFilepath != "" && o.RetryMissingFilepath != "" {
+		log.Panic(fmt.Errorf("--favorites-in and --retry-missing can not be used together"))
+	}
+
+	if o.SpotifyAlbumMarket != "" {
+		marketName, err := gnsssync.NormalizeMarketName(o.SpotifyAlbumMarket)
+		if err != nil {
+			log.Panic(fmt.Errorf("market [%s] is not a valid two-letter country code (e.g. US, GB)", o.SpotifyAlbumMarket))
+		}
+
+		o.SpotifyAlbumMarket = marketName
+	}
+
+	for j, fallbackMarketName := range o.SpotifyFallbackMarkets {
+		marketName, err := gnsssync.NormalizeMarketName(fallbackMarketName)
+		if err != nil {
+			log.Panic(fmt.Errorf("fallback market [%s] is not a valid two-letter country code (e.g. US, GB)", fallbackMarketName))
+		}
+
+		o.SpotifyFallbackMarkets[j] = marketName
+	}
+
+	var matchStrategies []string
+	if o.MatchStrategy != "" {
+		var err error
+
+		matchStrategies, err = gnsssync.ParseMatchStrategies(o.MatchStrategy)
+		if err != nil {
+			log.Panic(fmt.Errorf("match strategy [%s] is not valid", o.MatchStrategy))
+		}
+	}
+
+	var albumTypes []spotify.AlbumType
+	if o.AlbumTypes != "" {
+		var err error
+
+		albumTypes, err = gnsssync.ParseAlbumTypes(o.AlbumTypes)
+		if err != nil {
+			log.Panic(fmt.Errorf("album types [%s] are not valid", o.AlbumTypes))
+		}
+	}
+
+	if o.UpdateGolden == true && o.GoldenFilepath == "" {
+		log.Panic(fmt.Errorf("--update-golden requires --golden-file"))
+	}
+
+	if o.GoldenFilepath != "" && (o.Verify == true || o.ArtistBatch > 0) {
+		log.Panic(fmt.Errorf("--golden-file can not be used with --verify or --artist-batch"))
+	}
+
+	if o.Mirror == true && (o.Verify == true || o.RetryMissingFilepath != "" || o.NapsterFavoritesLimit > 0 || o.NoFail == true) {
+		log.Panic(fmt.Errorf("--mirror can not be used with --verify, --retry-missing, --napster-favorites-limit, or --no-fail since not every favorite would be matched"))
+	}
+
+	if o.Verify == true && (o.ArtistBatch > 0 || o.SkipIfInAnyPlaylist == true) {
+		log.Panic(fmt.Errorf("--verify can not be used with --artist-batch or --skip-if-in-any-playlist"))
+	}
+
+	if o.Sample > 0 && o.ArtistBatch > 0 {
+		log.Panic(fmt.Errorf("--sample can not be used with --artist-batch"))
+	}
+
+	if o.MinDuration > 0 && o.MaxDuration > 0 && o.MinDuration > o.MaxDuration {
+		log.Panic(fmt.Errorf("--min-duration can not be more than --max-duration"))
+	}
+
+	if o.SkipUnplayable == true && o.SpotifyAlbumMarket == "" {
+		log.Panic(fmt.Errorf("--skip-unplayable requires --spotify-album-market"))
+	}
+
+	if o.StateDirPath != "" {
+		sd, err := gnsssync.OpenStateDir(o.StateDirPath)
+		log.PanicIf(err)
+
+		if o.LedgerFilepath == "" {
+			o.LedgerFilepath = sd.LedgerFilepath()
+		}
+
+		if o.MissingReportFilepath == "" {
+			o.MissingReportFilepath = sd.MissingReportFilepath()
+		}
+
+		if o.SearchCacheFilepath == "" {
+			o.SearchCacheFilepath = sd.SearchCacheFilepath()
+		}
+	}
+
+	if o.RemoveLedgered == true && o.LedgerFilepath == "" {
+		log.Panic(fmt.Errorf("--remove-ledgered requires --ledger or --state-dir"))
 	}
 
 	ctx := context.Background()
-	authC := make(chan *gnsssync.SpotifyContext)
+
+	if sessionId != "" {
+		ctx = gnsssync.WithSessionId(ctx, sessionId)
+		mLog.Infof(ctx, "Session ID: [%s]", sessionId)
+	}
+
+	checkCredentials(ctx, o)
+
+	if o.CheckCredentials == true {
+		mLog.Infof(ctx, "Credentials are valid.")
+		return
+	}
+
+	// Buffered so that a late authorization doesn't block once we've given
+	// up.
+	authC := make(chan *gnsssync.SpotifyContext, 1)
+	authErrC := make(chan error, 1)
 
 	go func() {
 		sa := gnsssync.NewSpotifyAuthorizer(ctx, o.SpotifyApiClientId, o.SpotifyApiSecretKey, SpotifyRedirectUrl, SpotifyAuthorizeLocalBindUrl, authC)
-		if err := sa.Authorize(); err != nil {
-			log.Panic(err)
+
+		if o.TraceHttp == true {
+			sa.SetHttpTransport(gnsssync.NewTracingTransport("spotify", nil))
+		}
+
+		sa.SetNoBrowser(o.NoBrowser)
+		sa.SetAuthTimeout(o.AuthTimeout)
+
+		// Only ask for what we'll actually use so that the consent screen
+		// is accurate.
+		if len(o.Scopes) > 0 {
+			sa.SetScopes(o.Scopes)
+		} else if o.NoChanges == true {
+			sa.SetScopes(gnsssync.ReadOnlySpotifyScopes)
 		}
 
-		// Somehow the HTTP handler doesn't hold the application open and we'll
-		// terminate at the end as would be desired.
+		if err := sa.Authorize(); err != nil {
+			authErrC <- err
+		}
 	}()
 
-	spotifyAuth := <-authC
+	var spotifyAuth *gnsssync.SpotifyContext
+
+	select {
+	case spotifyAuth = <-authC:
+	case err := <-authErrC:
+		log.Panic(err)
+	}
 
 	spotifyAuth.Client.AutoRetry = true
 
 	mLog.Debugf(nil, "Received auth-code. Proceeding with import.")
 
+	// Once the time is up, we stop matching artists and add whatever was
+	// already matched.
+	if o.MaxRuntime > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, o.MaxRuntime)
+		defer cancel()
+	}
+
 	sc := gnsssync.NewSpotifyCache(ctx, spotifyAuth)
+	sc.SetUserIdOverride(o.SpotifyUserId)
+	sc.SetExactPlaylistName(o.ExactPlaylistName)
+
+	if o.SpotifyPlaylistId != "" {
+		sc.SetPlaylistIdOverride(spotify.ID(o.SpotifyPlaylistId))
+
+		// The name is then only used to describe the playlist.
+		o.SpotifyPlaylistName = o.SpotifyPlaylistId
+	}
+
+	if o.Interactive == true {
+		sc.SetPlaylistPrompt(os.Stdin, os.Stdout)
+	}
+
+	if o.PlaylistNameContains != "" {
+		spotifyUserId, err := sc.GetSpotifyUserId()
+		log.PanicIf(err)
+
+		p, err := sc.FindSpotifyPlaylistByNameContains(spotifyUserId, o.PlaylistNameContains)
+		log.PanicIf(err)
+
+		mLog.Infof(ctx, "Using playlist [%s] ([%s]).", p.Name, p.ID)
+
+		o.SpotifyPlaylistName = p.Name
+	}
+
+	var ledger *gnsssync.Ledger
+	if o.LedgerFilepath != "" {
+		var err error
+
+		ledger, err = gnsssync.LoadLedger(o.LedgerFilepath)
+		log.PanicIf(err)
+	}
+
+	if o.RemoveLedgered == true {
+		removeLedgered(spotifyAuth, sc, ledger, o.SpotifyPlaylistName, o.NoChanges)
+		return
+	}
+
 	i := gnsssync.NewImporter(ctx, o.NapsterApiKey, o.NapsterSecretKey, o.NapsterUsername, o.NapsterPassword, spotifyAuth, sc, napsterBatchSize, o.SpotifyAlbumMarket)
+	i.SetSkipIfInAnyPlaylist(o.SkipIfInAnyPlaylist)
+	i.SetFavoritesInFilepath(o.FavoritesInFilepath)
+	i.SetDumpFavoritesFilepath(o.DumpFavoritesFilepath)
+	i.SetArtistConcurrency(o.ArtistConcurrency)
+	i.SetAdaptiveConcurrency(o.AdaptiveConcurrency)
+	i.SetAlbumSearchOnArtistMiss(o.AlbumSearchOnArtistMiss)
+	i.SetTraceHttp(o.TraceHttp)
+	i.SetNapsterFavoritesLimit(o.NapsterFavoritesLimit, o.NapsterFavoritesLimitAfterFilter)
+	i.SetFallbackMarketNames(o.SpotifyFallbackMarkets)
+	i.SetUnionMarkets(o.UnionMarkets)
+	i.SetAlbumCompleteOnly(o.AlbumCompleteOnly)
+	i.SetPreferEarliestAlbum(o.PreferEarliestAlbum)
+	i.SetMissingReportFilepath(o.MissingReportFilepath)
+	i.SetRetryMissingFilepath(o.RetryMissingFilepath)
+	i.SetSkipUnplayable(o.SkipUnplayable)
+	i.SetDurationRange(o.MinDuration, o.MaxDuration)
+	i.SetAllArtists(o.AllArtists)
+	i.SetExcludeArtists(o.ExcludeArtists)
+	i.SetStrictArtist(o.StrictArtist)
+	i.SetTrackMatchDistance(o.TrackMatchDistance)
+	i.SetFoldVolumes(o.FoldVolumes)
+	i.SetStripTrackNumbers(o.StripTrackNumbers)
+	i.SetFoldDiacritics(o.FoldDiacritics)
+	i.SetAnnotateNearest(o.AnnotateNearest)
+	i.SetNapsterRestartOnShift(o.NapsterRestartOnShift)
+	i.SetNoFail(o.NoFail)
+	i.SetIgnorePreloadErrors(o.IgnorePreloadErrors)
+	i.SetDedupeSource(o.DedupeSource)
 
-	ids, err := i.GetTracksToAdd(o.SpotifyPlaylistName, o.OnlyArtists, o.SpotifyAlbumMarket)
-	log.PanicIf(err)
+	if o.SearchCacheFilepath != "" {
+		i.SetSearchCache(o.SearchCacheFilepath, o.SearchCacheNegativeTtl)
+		i.SetSearchCacheFlush(o.SearchCacheFlushEvery, o.SearchCacheFlushInterval)
+	}
+	i.SetArtistTriage(o.ArtistTriage)
 
-	len_ := len(ids)
-	if len_ == 0 {
-		mLog.Warningf(ctx, "No tracks found to import.")
-	} else if o.NoChanges == true {
-		mLog.Warningf(ctx, "There were changes to make but we were told to not make them.")
-	} else {
-		mLog.Infof(ctx, "Adding tracks to the playlist.")
+	if matchStrategies != nil {
+		i.SetMatchStrategies(matchStrategies)
+	}
 
-		spotifyUserId, err := sc.GetSpotifyCurrentUserId()
+	if albumTypes != nil {
+		i.SetAlbumTypes(albumTypes)
+	}
+
+	if len(o.EditionStopwords) > 0 {
+		i.SetEditionStopwords(o.EditionStopwords)
+	}
+
+	if o.Verify == true {
+		dr, err := i.Verify(o.SpotifyPlaylistName, o.OnlyArtists, o.SpotifyAlbumMarket)
 		log.PanicIf(err)
 
-		spotifyPlaylistId, err := sc.GetSpotifyPlaylistId(spotifyUserId, o.SpotifyPlaylistName)
+		err = dr.Write(os.Stdout, o.OutputFormat)
 		log.PanicIf(err)
 
-		flushCb := func(idList []spotify.ID) (err error) {
-			defer func() {
-				if state := recover(); state != nil {
-					err = log.Wrap(state.(error))
-				}
-			}()
+		return
+	}
+
+	// When the artists are matched in groups, each group is added as soon as
+	// it's matched rather than all at the end.
+	position := -1
+	if o.AddPosition == gnsssync.AddPositionStart {
+		position = 0
+	}
+
+	failedCount := 0
+	if o.ArtistBatch > 0 {
+		i.SetArtistBatch(o.ArtistBatch, func(groupIds map[spotify.ID]gnsssync.TrackInfo) error {
+			if len(groupIds) == 0 || o.NoChanges == true {
+				return nil
+			}
+
+			groupFailedCount := addTracks(ctx, spotifyAuth, sc, ledger, o.SpotifyPlaylistName, groupIds, position)
+			failedCount += groupFailedCount
 
-			if _, err := spotifyAuth.Client.AddTracksToPlaylist(spotifyUserId, spotifyPlaylistId, idList...); err != nil {
-				log.Panic(err)
+			// Keep the groups in order.
+			if position >= 0 {
+				position += len(groupIds) - groupFailedCount
 			}
 
 			return nil
+		})
+	}
+
+	ids, err := i.GetTracksToAdd(o.SpotifyPlaylistName, o.OnlyArtists, o.SpotifyAlbumMarket)
+	log.PanicIf(err)
+
+	if stats := i.Stats(); stats.FailedArtistCount > 0 {
+		mLog.Warningf(ctx, "(%d) artists were skipped because their lookups failed.", stats.FailedArtistCount)
+	}
+
+	if stats := i.Stats(); stats.RemainingArtistCount > 0 {
+		mLog.Warningf(ctx, "Ran out of time: (%d) artists weren't matched. Run again to add them.", stats.RemainingArtistCount)
+	}
+
+	if o.GoldenFilepath != "" {
+		checkGolden(ctx, i, o.GoldenFilepath, o.UpdateGolden)
+		return
+	}
+
+	if o.Sample > 0 && o.Sample < len(ids) {
+		seed := o.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
 		}
 
-		batchIdList := make([]spotify.ID, spotifyBatchSize)
-		j := 0
-		for id, trackInfo := range ids {
-			batchIdList[j] = id
-			j++
+		mLog.Infof(ctx, "Sampling (%d) of the (%d) tracks with seed (%d).", o.Sample, len(ids), seed)
 
-			mLog.Debugf(ctx, "ADDING: [%s] %s", id, trackInfo)
+		ids = gnsssync.SampleTracks(ids, o.Sample, seed)
+	}
+
+	if o.ShowPlan == true {
+		err := i.MatchReport().WritePlan(os.Stdout, o.OutputFormat)
+		log.PanicIf(err)
+	}
 
-			if j >= spotifyBatchSize {
-				if err := flushCb(batchIdList); err != nil {
-					log.Panic(err)
-				}
+	if o.UrisOutFilepath != "" {
+		err := gnsssync.WriteTrackUris(o.UrisOutFilepath, ids)
+		log.PanicIf(err)
 
-				j = 0
-			}
+		mLog.Infof(ctx, "Wrote (%d) track URIs to [%s].", len(ids), o.UrisOutFilepath)
+	}
+
+	if o.CsvOutFilepath != "" {
+		writeCsv(o.CsvOutFilepath, ids)
+
+		mLog.Infof(ctx, "Wrote (%d) tracks to [%s].", len(ids), o.CsvOutFilepath)
+	}
+
+	if o.RunReportFilepath != "" {
+		err := gnsssync.WriteRunReport(o.RunReportFilepath, i.RunReport(ids))
+		log.PanicIf(err)
+
+		mLog.Infof(ctx, "Wrote report to [%s].", o.RunReportFilepath)
+	}
+
+	var removeIds map[spotify.ID]gnsssync.TrackInfo
+	if o.Mirror == true {
+		removeIds, err = i.GetTracksToRemove(o.OnlyArtists)
+		log.PanicIf(err)
+
+		for id, trackInfo := range removeIds {
+			mLog.Infof(ctx, "NO LONGER FAVORITED: [%s] %s", id, trackInfo)
+		}
+	}
+
+	len_ := len(ids)
+	if len_ == 0 && len(removeIds) == 0 {
+		logNothingToImport(ctx, i.Stats())
+		log.Panic(ErrNothingToImport)
+	} else if o.NoChanges == true {
+		mLog.Warningf(ctx, "There were changes to make but we were told to not make them.")
+	} else {
+		if o.ArtistBatch == 0 && len_ > 0 {
+			failedCount = addTracks(ctx, spotifyAuth, sc, ledger, o.SpotifyPlaylistName, ids, position)
 		}
 
-		if j > 0 {
-			if err := flushCb(batchIdList[:j]); err != nil {
-				log.Panic(err)
-			}
+		if len(removeIds) > 0 {
+			removeTracks(ctx, spotifyAuth, sc, ledger, o.SpotifyPlaylistName, removeIds)
 		}
 	}
+
+	addedCount := 0
+	removedCount := 0
+	if o.NoChanges == false {
+		addedCount = len_ - failedCount
+		removedCount = len(removeIds)
+	}
+
+	logPlaylistChange(ctx, o.SpotifyPlaylistName, i.PlaylistTrackCount(), addedCount, removedCount)
+
+	if failedCount > 0 {
+		mLog.Warningf(ctx, "(%d) of (%d) tracks could not be added.", failedCount, len_)
+		log.Panic(ErrBatchesFailed)
+	}
 }
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"io/ioutil"
+	"path"
+
+	"github.com/dsoprea/go-logging"
+	"github.com/jessevdk/go-flags"
+
+	"github.com/dsoprea/go-napster-to-spotify-sync/internal/sync"
+)
+
+func TestExitCode(t *testing.T) {
+	cases := []struct {
+		err      error
+		exitCode int
+	}{
+		{gnsssync.ErrSpotifyCredentialsInvalid, ExitAuthFailure},
+		{gnsssync.ErrNapsterApiKeyInvalid, ExitAuthFailure},
+		{gnsssync.ErrAuthTimeout, ExitAuthFailure},
+		{gnsssync.ErrNapsterRateLimited, ExitRateLimited},
+		{gnsssync.ErrSpotifyRateLimited, ExitRateLimited},
+		{ErrNothingToImport, ExitNothingToImport},
+		{ErrBatchesFailed, ExitPartialFailure},
+		{ErrFileNotValid, ExitFailure},
+		{ErrGoldenDrift, ExitFailure},
+		{fmt.Errorf("something else"), ExitFailure},
+	}
+
+	for _, c := range cases {
+		if code := exitCode(c.err); code != c.exitCode {
+			t.Fatalf("[%s] exit-code not correct: (%d) != (%d)", c.err, code, c.exitCode)
+		}
+
+		// The errors usually arrive wrapped by the panic/recover in
+		// between.
+		if code := exitCode(log.Wrap(c.err)); code != c.exitCode {
+			t.Fatalf("[%s] exit-code not correct when wrapped: (%d) != (%d)", c.err, code, c.exitCode)
+		}
+	}
+}
+
+func TestNothingToImportReason(t *testing.T) {
+	cases := []struct {
+		stats  gnsssync.ImportStats
+		reason string
+	}{
+		{gnsssync.ImportStats{}, "there are no favorites in Napster"},
+		{gnsssync.ImportStats{FavoritesCount: 3, FilteredCount: 3}, "none of the (3) favorites are by the given artists"},
+		{gnsssync.ImportStats{FavoritesCount: 3, FilteredCount: 1, AlreadyPresentCount: 2}, "all (2) matched tracks are already in the playlist"},
+		{gnsssync.ImportStats{FavoritesCount: 3, AlreadyPresentCount: 1, MissingCount: 2}, "(2) tracks couldn't be found in Spotify and (1) are already in the playlist"},
+	}
+
+	for _, c := range cases {
+		if reason := nothingToImportReason(c.stats); reason != c.reason {
+			t.Fatalf("Reason not correct for %+v: [%s] != [%s]", c.stats, reason, c.reason)
+		}
+	}
+}
+
+func TestPlaylistChangeSummary(t *testing.T) {
+	cases := []struct {
+		beforeCount  int
+		addedCount   int
+		removedCount int
+		summary      string
+	}{
+		{1200, 85, 0, "Playlist [Favorites]: (1200) tracks before, +(85) added, -(0) removed, (1285) after."},
+		{1200, 0, 15, "Playlist [Favorites]: (1200) tracks before, +(0) added, -(15) removed, (1185) after."},
+		{1200, 85, 15, "Playlist [Favorites]: (1200) tracks before, +(85) added, -(15) removed, (1270) after."},
+		{0, 3, 0, "Playlist [Favorites]: (0) tracks before, +(3) added, -(0) removed, (3) after."},
+	}
+
+	for _, c := range cases {
+		summary := playlistChangeSummary("Favorites", c.beforeCount, c.addedCount, c.removedCount)
+		if summary != c.summary {
+			t.Fatalf("Summary not correct: [%s] != [%s]", summary, c.summary)
+		}
+	}
+}
+
+func TestCheckSpotifyOptions(t *testing.T) {
+	cases := []struct {
+		o       options
+		isValid bool
+	}{
+		{options{SpotifyApiClientId: "id", SpotifyApiSecretKey: "secret"}, true},
+		{options{SpotifyApiClientId: "id"}, false},
+		{options{SpotifyApiSecretKey: "secret"}, false},
+		{options{}, false},
+	}
+
+	for _, c := range cases {
+		o := c.o
+
+		err := checkSpotifyOptions(&o)
+		if c.isValid == true && err != nil {
+			t.Fatalf("Options should be valid: %s", err)
+		} else if c.isValid == false && err == nil {
+			t.Fatalf("Expected the options to be rejected: %v", c.o)
+		}
+	}
+}
+
+func TestParseOptions_ValidateFile(t *testing.T) {
+	// Only checking a file doesn't need the Spotify credentials.
+
+	o := new(options)
+
+	_, err := flags.ParseArgs(o, []string{"--validate-file", "favorites.json"})
+	if err != nil {
+		t.Fatalf("Options should have parsed without the Spotify credentials: %s", err)
+	} else if o.ValidateFilepath != "favorites.json" {
+		t.Fatalf("File not correct: [%s]", o.ValidateFilepath)
+	}
+}
+
+func TestParseOptions_DumpCache(t *testing.T) {
+	// Only reading the search-cache doesn't need the Spotify credentials.
+
+	o := new(options)
+
+	_, err := flags.ParseArgs(o, []string{"--dump-cache", "search_cache.json"})
+	if err != nil {
+		t.Fatalf("Options should have parsed without the Spotify credentials: %s", err)
+	} else if o.DumpCacheFilepath != "search_cache.json" {
+		t.Fatalf("File not correct: [%s]", o.DumpCacheFilepath)
+	}
+}
+
+func TestResolveArtistOptions(t *testing.T) {
+	cases := []struct {
+		description string
+		o           options
+		allArtists  bool
+		isValid     bool
+	}{
+		{"nothing", options{}, true, true},
+		{"all", options{AllArtists: true}, true, true},
+		{"all excluding", options{AllArtists: true, ExcludeArtists: []string{"b"}}, true, true},
+		{"excluding only", options{ExcludeArtists: []string{"b"}}, true, true},
+		{"only", options{OnlyArtists: []string{"a"}}, false, true},
+		{"only excluding", options{OnlyArtists: []string{"a"}, ExcludeArtists: []string{"b"}}, false, true},
+		{"only and all", options{OnlyArtists: []string{"a"}, AllArtists: true}, true, false},
+
+		// The artists come from somewhere else.
+		{"empty file", options{OnlyArtistsFilepath: "artists.txt"}, false, true},
+		{"empty alias file", options{ArtistsFilepath: "artists.txt"}, false, true},
+		{"retry", options{RetryMissingFilepath: "missing.json"}, false, true},
+	}
+
+	for _, c := range cases {
+		o := c.o
+
+		err := resolveArtistOptions(&o)
+		if c.isValid == false {
+			if err == nil {
+				t.Fatalf("[%s] Expected the options to be rejected.", c.description)
+			}
+
+			continue
+		} else if err != nil {
+			t.Fatalf("[%s] Options should be valid: %s", c.description, err)
+		}
+
+		if o.AllArtists != c.allArtists {
+			t.Fatalf("[%s] All-artists not correct: (%v)", c.description, o.AllArtists)
+		}
+	}
+}
+
+func TestMergeArtistsFiles(t *testing.T) {
+	tempPath := t.TempDir()
+
+	onlyArtistsFilepath := path.Join(tempPath, "only-artists.txt")
+	artistsFilepath := path.Join(tempPath, "artists.txt")
+
+	err := ioutil.WriteFile(onlyArtistsFilepath, []byte("# Favorites\nThe Band\n\nOther Artist\n"), 0644)
+	if err != nil {
+		t.Fatalf("Could not write artists file: %s", err)
+	}
+
+	err = ioutil.WriteFile(artistsFilepath, []byte("other artist\nThird Artist\n"), 0644)
+	if err != nil {
+		t.Fatalf("Could not write alias artists file: %s", err)
+	}
+
+	// Either flag works on its own, and both can be given.
+
+	cases := []struct {
+		o        options
+		expected []string
+	}{
+		// Without a file, the artists are left alone.
+		{options{OnlyArtists: []string{"Given Artist"}}, []string{"Given Artist"}},
+
+		{options{OnlyArtists: []string{"Given Artist"}, OnlyArtistsFilepath: onlyArtistsFilepath}, []string{"given artist", "the band", "other artist"}},
+		{options{ArtistsFilepath: artistsFilepath}, []string{"other artist", "third artist"}},
+		{options{OnlyArtistsFilepath: onlyArtistsFilepath, ArtistsFilepath: artistsFilepath}, []string{"the band", "other artist", "third artist"}},
+	}
+
+	for _, c := range cases {
+		o := c.o
+
+		err := mergeArtistsFiles(&o)
+		if err != nil {
+			t.Fatalf("Could not merge artists files: %s", err)
+		}
+
+		if reflect.DeepEqual(o.OnlyArtists, c.expected) != true {
+			t.Fatalf("Artists not correct: %v != %v", o.OnlyArtists, c.expected)
+		}
+	}
+
+	o := options{ArtistsFilepath: path.Join(tempPath, "missing.txt")}
+
+	err = mergeArtistsFiles(&o)
+	if err == nil {
+		t.Fatalf("Expected a missing artists file to fail.")
+	}
+}
+
+func TestMergeArtistsFiles_BothFlags(t *testing.T) {
+	tempPath := t.TempDir()
+
+	onlyArtistsFilepath := path.Join(tempPath, "only-artists.txt")
+	artistsFilepath := path.Join(tempPath, "artists.txt")
+
+	err := ioutil.WriteFile(onlyArtistsFilepath, []byte("The Band\nShared Artist\n"), 0644)
+	if err != nil {
+		t.Fatalf("Could not write artists file: %s", err)
+	}
+
+	err = ioutil.WriteFile(artistsFilepath, []byte("SHARED ARTIST\nthe band\nThird Artist\n"), 0644)
+	if err != nil {
+		t.Fatalf("Could not write alias artists file: %s", err)
+	}
+
+	o := new(options)
+
+	_, err = flags.ParseArgs(o, []string{"-a", "Shared Artist", "--only-artists-file", onlyArtistsFilepath, "--artists-file", artistsFilepath})
+	if err != nil {
+		t.Fatalf("Could not parse options: %s", err)
+	}
+
+	err = mergeArtistsFiles(o)
+	if err != nil {
+		t.Fatalf("Could not merge artists files: %s", err)
+	}
+
+	// The artists from both files are merged and each one is only given once
+	// however many times (and however it's capitalized) it's listed.
+
+	counts := make(map[string]int)
+	for _, artistName := range o.OnlyArtists {
+		counts[artistName]++
+	}
+
+	expectedCounts := map[string]int{
+		"shared artist": 1,
+		"the band":      1,
+		"third artist":  1,
+	}
+
+	if reflect.DeepEqual(counts, expectedCounts) != true {
+		t.Fatalf("Artists not merged and deduplicated: %v", o.OnlyArtists)
+	}
+
+	expected := []string{"shared artist", "the band", "third artist"}
+	if reflect.DeepEqual(o.OnlyArtists, expected) != true {
+		t.Fatalf("Artists not correct: %v != %v", o.OnlyArtists, expected)
+	}
+}